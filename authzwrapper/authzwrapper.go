@@ -1,12 +1,15 @@
 package authzwrapper
 
 import (
+	"errors"
 	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/context"
 	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
 	"github.com/xtraclabs/rollsecrets/secrets"
-	"github.com/xtraclabs/rollauthz/rollauthz"
 	"net/http"
+	"strings"
 )
 
 type key int
@@ -16,40 +19,178 @@ const AuthzSubject key = 0
 const AuthzAdminScope key = 1
 
 type authHandler struct {
-	handler     http.Handler
-	rollAuthZ 	*rollauthz.RollAuthZ
-	adminRepo   roll.AdminRepo
-	whiteList   map[string]string
+	handler        http.Handler
+	keyFunc        jwt.Keyfunc
+	adminRepo      roll.AdminRepo
+	revocationRepo roll.RevocationRepo
+	resource       string
+	whiteList      map[string]string
 }
 
-//Wrap takes a handler and decorates it with JWT bearer token validation.
-func Wrap(secretsRepo secrets.SecretsRepo, adminRepo roll.AdminRepo, whitelistedClientIDs []string, h http.Handler) http.Handler {
+//Wrap takes a handler and decorates it with JWT bearer token validation. Tokens recorded as revoked
+//in the revocation repo are rejected, as are tokens whose audience does not include the resource
+//identifier of the wrapped service. An empty resource identifier accepts tokens for any audience. When
+//client IDs are whitelisted, only tokens issued to those clients are accepted.
+func Wrap(secretsRepo secrets.SecretsRepo, adminRepo roll.AdminRepo, revocationRepo roll.RevocationRepo, resource string, whitelistedClientIDs []string, h http.Handler) http.Handler {
+	return WrapWithKeyFunc(clientKeyFunc(secretsRepo), adminRepo, revocationRepo, resource, whitelistedClientIDs, h)
+}
+
+//WrapWithKeyFunc is like Wrap, but bearer token signatures are verified with the key returned by keyFunc,
+//which allows tokens signed with keys other than the application's current key to be accepted.
+func WrapWithKeyFunc(keyFunc jwt.Keyfunc, adminRepo roll.AdminRepo, revocationRepo roll.RevocationRepo, resource string, whitelistedClientIDs []string, h http.Handler) http.Handler {
 	wl := make(map[string]string)
 	for _, cid := range whitelistedClientIDs {
 		wl[cid] = cid
 	}
 
 	return &authHandler{
-		handler:     h,
-		rollAuthZ: &rollauthz.RollAuthZ{secretsRepo},
-		adminRepo:   adminRepo,
-		whiteList:   wl,
+		handler:        h,
+		keyFunc:        keyFunc,
+		adminRepo:      adminRepo,
+		revocationRepo: revocationRepo,
+		resource:       resource,
+		whiteList:      wl,
 	}
 }
 
-//AddWhiteListedClientID adds a client id to the whitelist. When the whitelist contains 1 or more
-//client IDs, the aud claim of the bearer token is checked against the whitelist -- if present
-//in the list access is granted.
-func (ah authHandler) AddWhiteListedClientID(clientId string) {
-	ah.whiteList[clientId] = clientId
+//tokenClientID returns the client the token was issued to. Tokens issued for a resource name the client
+//in the client_id claim, older tokens in the aud claim.
+func tokenClientID(claims map[string]interface{}) (string, bool) {
+	if clientID, ok := claims["client_id"].(string); ok && clientID != "" {
+		return clientID, true
+	}
+
+	clientID, ok := claims["aud"].(string)
+	return clientID, ok && clientID != ""
 }
 
-func (ah authHandler) whiteListOK(clientID string) bool {
+//clientKeyFunc returns a jwt.Keyfunc that verifies tokens with the current key of the application they
+//were issued to. Tokens issued for a resource name the application in the client_id claim, older tokens
+//in the aud claim. The token must be signed with the method that uses the application's key.
+func clientKeyFunc(secretsRepo secrets.SecretsRepo) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		clientID, ok := tokenClientID(token.Claims)
+		if !ok {
+			return nil, errors.New("Token has no client_id or aud claim")
+		}
+
+		publicKey, err := secretsRepo.RetrievePublicKeyForApp(clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		return signing.VerificationKey(token, publicKey)
+	}
+}
+
+//whiteListOK is true if the token was issued to a whitelisted client, or no clients are whitelisted
+func (ah authHandler) whiteListOK(claims map[string]interface{}) bool {
 	if len(ah.whiteList) == 0 {
 		return true
 	}
 
-	return ah.whiteList[clientID] == clientID
+	clientID, ok := tokenClientID(claims)
+	return ok && ah.whiteList[clientID] == clientID
+}
+
+//audienceOK is true if the resource identifier is the token's audience, or one of them. The aud claim
+//may be a single value or an array - see RFC 7519 section 4.1.3.
+func (ah authHandler) audienceOK(aud interface{}) bool {
+	if ah.resource == "" {
+		return true
+	}
+
+	switch aud := aud.(type) {
+	case string:
+		return aud == ah.resource
+	case []interface{}:
+		for _, a := range aud {
+			if a == ah.resource {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+const (
+	//LoginSessionTokenType is the typ header of the login session tokens roll signs with an application's key
+	LoginSessionTokenType = "roll-session+jwt"
+
+	//CSRFTokenType is the typ header of the anti-forgery tokens roll signs with an application's key
+	CSRFTokenType = "roll-csrf+jwt"
+)
+
+//ErrNotAccessToken is returned when a token signed with an application's key is not an access token
+var ErrNotAccessToken = errors.New("not an access token")
+
+//nonAccessTokenTypes are the typ headers of the other tokens roll signs with an application's key
+var nonAccessTokenTypes = []string{LoginSessionTokenType, CSRFTokenType}
+
+//nonAccessTokenClaims mark the other tokens roll signs with an application's key - login sessions,
+//authorize page anti-forgery tokens and id tokens
+var nonAccessTokenClaims = []string{"login_session", "csrf", "at_hash"}
+
+//CheckAccessToken checks a verified token is an access token. Authorization codes, id tokens, login
+//sessions and anti-forgery tokens are all signed with the application's key too, so an access token must
+//be positively identified: it needs an exp and a jti, and must name the application it was issued to in
+//the client_id claim, or in the application claim of tokens issued before client_id was added.
+func CheckAccessToken(token *jwt.Token) error {
+	typ, _ := token.Header["typ"].(string)
+	for _, nonAccessType := range nonAccessTokenTypes {
+		if typ == nonAccessType {
+			return ErrNotAccessToken
+		}
+	}
+
+	for _, claim := range nonAccessTokenClaims {
+		if _, ok := token.Claims[claim]; ok {
+			return ErrNotAccessToken
+		}
+	}
+
+	scope, _ := token.Claims["scope"].(string)
+	for _, s := range strings.Fields(scope) {
+		if s == "xtAuthCode" {
+			return errors.New("authorization code presented as access token")
+		}
+	}
+
+	if _, ok := token.Claims["exp"].(float64); !ok {
+		return ErrNotAccessToken
+	}
+
+	if jti, _ := token.Claims["jti"].(string); jti == "" {
+		return ErrNotAccessToken
+	}
+
+	clientID, _ := token.Claims["client_id"].(string)
+	application, _ := token.Claims["application"].(string)
+	if clientID == "" && application == "" {
+		return ErrNotAccessToken
+	}
+
+	return nil
+}
+
+//validateAccessToken validates the bearer token in the authorization header, returning its claims
+func (ah authHandler) validateAccessToken(authzHeader string) (map[string]interface{}, error) {
+	parts := strings.SplitAfter(authzHeader, "Bearer")
+	if len(parts) != 2 {
+		return nil, errors.New("Unexpected authorization header format - expecting bearer token")
+	}
+
+	token, err := jwt.Parse(strings.TrimSpace(parts[1]), ah.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckAccessToken(token); err != nil {
+		return nil, err
+	}
+
+	return token.Claims, nil
 }
 
 func (ah authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -62,15 +203,40 @@ func (ah authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims, err := ah.rollAuthZ.ValidateAccessToken(authzHeader)
+	claims, err := ah.validateAccessToken(authzHeader)
 	if err != nil {
 		log.Info(err.Error())
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte("Unauthorized\n"))
+		return
 	}
 
-	//Check against the whitelist
-	aud, ok := claims["aud"].(string)
+	//Check the token has not been revoked
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		log.Info("jti claim not present in token")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized\n"))
+		return
+	}
+
+	revoked, err := ah.revocationRepo.IsTokenRevoked(jti)
+	if err != nil {
+		log.Info("error checking token revocation: ", err.Error())
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized\n"))
+		return
+	}
+
+	if revoked {
+		log.Info("revoked token presented: ", jti)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized\n"))
+		return
+	}
+
+	//Check the token was issued for this resource
+	aud, ok := claims["aud"]
 	if !ok {
 		log.Info("aud claim not present in token")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -78,13 +244,20 @@ func (ah authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !ah.whiteListOK(aud) {
-		log.Info("token failed whitelist check: ", aud)
+	if !ah.audienceOK(aud) {
+		log.Info("token not issued for resource ", ah.resource, ": ", aud)
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte("Unauthorized\n"))
 		return
 	}
 
+	//Check against the whitelist
+	if !ah.whiteListOK(claims) {
+		log.Info("token failed whitelist check: ", claims["client_id"], " ", claims["aud"])
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized\n"))
+		return
+	}
 
 	sub, ok := claims["sub"].(string)
 	if !ok {
@@ -96,7 +269,7 @@ func (ah authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	context.Set(r, AuthzAdminScope, false)
 	scope, ok := claims["scope"].(string)
-	if ok && scope == "admin" {
+	if ok && hasAdminScope(scope) {
 		admin, err := ah.adminRepo.IsAdmin(sub)
 		if err != nil {
 			log.Info("error making admin scope determination: ", err.Error())
@@ -112,3 +285,14 @@ func (ah authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ah.handler.ServeHTTP(w, r)
 	context.Clear(r)
 }
+
+//hasAdminScope indicates if admin is one of the whitespace delimited scopes, e.g. "openid admin"
+func hasAdminScope(scope string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == "admin" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,15 +1,19 @@
 package authzwrapper
 
 import (
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/roll/signing"
 	"github.com/xtraclabs/rollsecrets/secrets"
 	rolltoken "github.com/xtraclabs/rollsecrets/token"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func echoHandler() http.HandlerFunc {
@@ -33,7 +37,8 @@ func echoHandler() http.HandlerFunc {
 func TestNoToken(t *testing.T) {
 	secretsRepo := new(mocks.SecretsRepo)
 	adminRepo := new(mocks.AdminRepo)
-	testServer := httptest.NewServer(Wrap(secretsRepo, adminRepo, []string{}, echoHandler()))
+	revocationRepo := new(mocks.RevocationRepo)
+	testServer := httptest.NewServer(Wrap(secretsRepo, adminRepo, revocationRepo, "", nil, echoHandler()))
 	defer testServer.Close()
 
 	resp, err := http.Post(testServer.URL, "text/plain", nil)
@@ -48,7 +53,7 @@ func TestGoodToken(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -63,11 +68,13 @@ func TestGoodToken(t *testing.T) {
 	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
 	adminRepo := new(mocks.AdminRepo)
+	revocationRepo := new(mocks.RevocationRepo)
+	revocationRepo.On("IsTokenRevoked", mock.Anything).Return(false, nil)
 
 	token, err := rolltoken.GenerateToken("a-subject", "", app.ClientID, app.ApplicationName, privateKey)
 	assert.Nil(t, err)
 
-	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, []string{}, echoHandler()))
+	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, revocationRepo, "", nil, echoHandler()))
 	defer testServer.Close()
 
 	client := http.Client{}
@@ -81,6 +88,35 @@ func TestGoodToken(t *testing.T) {
 
 }
 
+func TestRevokedToken(t *testing.T) {
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := new(mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	adminRepo := new(mocks.AdminRepo)
+	revocationRepo := new(mocks.RevocationRepo)
+	revocationRepo.On("IsTokenRevoked", mock.Anything).Return(true, nil)
+
+	token, err := rolltoken.GenerateToken("a-subject", "", "1111-2222-3333333-4444444", "fight club", privateKey)
+	assert.Nil(t, err)
+
+	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, revocationRepo, "", nil, echoHandler()))
+	defer testServer.Close()
+
+	client := http.Client{}
+	req, err := http.NewRequest("POST", testServer.URL, nil)
+	assert.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	revocationRepo.AssertCalled(t, "IsTokenRevoked", mock.Anything)
+}
+
 func TestUnsecureWithSubjectHeader(t *testing.T) {
 	testServer := httptest.NewServer(WrapUnsecure(echoHandler()))
 	defer testServer.Close()
@@ -111,8 +147,9 @@ func TestUnsecureMissingSubjectHeader(t *testing.T) {
 func TestMalformedToken(t *testing.T) {
 	secretsRepo := new(mocks.SecretsRepo)
 	adminRepo := new(mocks.AdminRepo)
+	revocationRepo := new(mocks.RevocationRepo)
 
-	testServer := httptest.NewServer(Wrap(secretsRepo, adminRepo, []string{}, echoHandler()))
+	testServer := httptest.NewServer(Wrap(secretsRepo, adminRepo, revocationRepo, "", nil, echoHandler()))
 	defer testServer.Close()
 
 	client := http.Client{}
@@ -128,7 +165,8 @@ func TestMalformedToken(t *testing.T) {
 func TestNonBearerToken(t *testing.T) {
 	secretsRepo := new(mocks.SecretsRepo)
 	adminRepo := new(mocks.AdminRepo)
-	testServer := httptest.NewServer(Wrap(secretsRepo, adminRepo, []string{}, echoHandler()))
+	revocationRepo := new(mocks.RevocationRepo)
+	testServer := httptest.NewServer(Wrap(secretsRepo, adminRepo, revocationRepo, "", nil, echoHandler()))
 	defer testServer.Close()
 
 	client := http.Client{}
@@ -147,7 +185,7 @@ func TestInvalidSignature(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -165,11 +203,12 @@ func TestInvalidSignature(t *testing.T) {
 	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
 	adminRepo := new(mocks.AdminRepo)
+	revocationRepo := new(mocks.RevocationRepo)
 
 	token, err := rolltoken.GenerateToken("b-subject", "", app.ClientID, app.ApplicationName, private2)
 	assert.Nil(t, err)
 
-	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, []string{}, echoHandler()))
+	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, revocationRepo, "", nil, echoHandler()))
 	defer testServer.Close()
 
 	client := http.Client{}
@@ -188,7 +227,7 @@ func TestAuthCodeUsedForAccess(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -203,11 +242,12 @@ func TestAuthCodeUsedForAccess(t *testing.T) {
 	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
 	adminRepo := new(mocks.AdminRepo)
+	revocationRepo := new(mocks.RevocationRepo)
 
 	token, err := rolltoken.GenerateCode("a-subject", "", app.ClientID, privateKey)
 	assert.Nil(t, err)
 
-	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, []string{}, echoHandler()))
+	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, revocationRepo, "", nil, echoHandler()))
 	defer testServer.Close()
 
 	client := http.Client{}
@@ -219,3 +259,141 @@ func TestAuthCodeUsedForAccess(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
+
+const testResource = "https://roll.example.com/v1"
+
+//accessTokenForAudience signs an access token issued to the fight club app for the given audience
+func accessTokenForAudience(t *testing.T, privateKey string, aud interface{}) string {
+	signingKey, err := signing.ParsePrivateKeyPEM(privateKey)
+	assert.Nil(t, err)
+
+	method, err := signing.MethodForKey(signingKey.Public())
+	assert.Nil(t, err)
+
+	token := jwt.New(method)
+	token.Claims = map[string]interface{}{
+		"sub":       "a-subject",
+		"jti":       "a-token-id",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"client_id": "1111-2222-3333333-4444444",
+		"aud":       aud,
+	}
+
+	tokenString, err := token.SignedString(signingKey)
+	assert.Nil(t, err)
+	return tokenString
+}
+
+func postWithAudience(t *testing.T, aud interface{}) *http.Response {
+	return postSignedWith(t, signing.RS256, aud)
+}
+
+//postSignedWith posts with an access token for the audience signed with a key for the given algorithm
+func postSignedWith(t *testing.T, alg string, aud interface{}) *http.Response {
+	return postSignedWithWhitelist(t, alg, aud, nil)
+}
+
+//postSignedWithWhitelist posts to a service that only accepts tokens issued to the whitelisted clients
+func postSignedWithWhitelist(t *testing.T, alg string, aud interface{}, whitelist []string) *http.Response {
+	privateKey, publicKey, err := signing.GenerateKeyPair(alg)
+	assert.Nil(t, err)
+
+	secretsMock := new(mocks.SecretsRepo)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	adminRepo := new(mocks.AdminRepo)
+	revocationRepo := new(mocks.RevocationRepo)
+	revocationRepo.On("IsTokenRevoked", "a-token-id").Return(false, nil)
+
+	testServer := httptest.NewServer(Wrap(secretsMock, adminRepo, revocationRepo, testResource, whitelist, echoHandler()))
+	defer testServer.Close()
+
+	req, err := http.NewRequest("POST", testServer.URL, nil)
+	assert.Nil(t, err)
+	req.Header.Add("Authorization", "Bearer "+accessTokenForAudience(t, privateKey, aud))
+
+	client := http.Client{}
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestTokenForResource(t *testing.T) {
+	resp := postWithAudience(t, testResource)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTokenForSeveralResources(t *testing.T) {
+	resp := postWithAudience(t, []string{"https://api.example.com/orders", testResource})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTokenForOtherResource(t *testing.T) {
+	resp := postWithAudience(t, "https://api.example.com/orders")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestTokenForClientRejectedByResource(t *testing.T) {
+	resp := postWithAudience(t, "1111-2222-3333333-4444444")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestTokenForResourceWhitelist(t *testing.T) {
+	resp := postSignedWithWhitelist(t, signing.RS256, testResource, []string{"1111-2222-3333333-4444444"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	//Tokens for the resource issued to other clients are rejected
+	resp = postSignedWithWhitelist(t, signing.RS256, testResource, []string{"5555-6666"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestECDSATokenForResource(t *testing.T) {
+	for _, alg := range []string{signing.ES256, signing.ES384} {
+		resp := postSignedWith(t, alg, testResource)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, alg)
+	}
+}
+
+func TestEdDSATokenForResource(t *testing.T) {
+	resp := postSignedWith(t, signing.EdDSA, testResource)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCheckAccessToken(t *testing.T) {
+	accessClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":       "a-subject",
+			"jti":       "a-token-id",
+			"exp":       float64(time.Now().Add(time.Hour).Unix()),
+			"client_id": "1111-2222-3333333-4444444",
+		}
+	}
+
+	assert.Nil(t, CheckAccessToken(&jwt.Token{Claims: accessClaims()}))
+
+	//Tokens issued before client_id was added name the application instead
+	legacy := accessClaims()
+	delete(legacy, "client_id")
+	legacy["application"] = "fight club"
+	assert.Nil(t, CheckAccessToken(&jwt.Token{Claims: legacy}))
+
+	for _, change := range []func(map[string]interface{}){
+		func(claims map[string]interface{}) { delete(claims, "jti") },
+		func(claims map[string]interface{}) { delete(claims, "exp") },
+		func(claims map[string]interface{}) { delete(claims, "client_id") },
+		func(claims map[string]interface{}) { claims["login_session"] = true },
+		func(claims map[string]interface{}) { claims["csrf"] = true },
+		func(claims map[string]interface{}) { claims["at_hash"] = "abc" },
+		func(claims map[string]interface{}) { claims["scope"] = "xtAuthCode read" },
+	} {
+		claims := accessClaims()
+		change(claims)
+		assert.NotNil(t, CheckAccessToken(&jwt.Token{Claims: claims}))
+	}
+
+	session := &jwt.Token{Header: map[string]interface{}{"typ": LoginSessionTokenType}, Claims: accessClaims()}
+	assert.Equal(t, ErrNotAccessToken, CheckAccessToken(session))
+
+	csrf := &jwt.Token{Header: map[string]interface{}{"typ": CSRFTokenType}, Claims: accessClaims()}
+	assert.Equal(t, ErrNotAccessToken, CheckAccessToken(csrf))
+}
@@ -17,6 +17,22 @@ var Authorize = `
 
 <div class="container">
     <h2>{{.AppName}} Would Like Access to Your XTRAC Data</h2>
+    {{if .Scopes}}
+    <p>Requested access:</p>
+    <ul>
+    {{range .Scopes}}
+        <li><strong>{{.Name}}</strong> - {{.Description}}</li>
+    {{end}}
+    </ul>
+    {{end}}
+    {{if .Resources}}
+    <p>For use with:</p>
+    <ul>
+    {{range .Resources}}
+        <li>{{.Description}}</li>
+    {{end}}
+    </ul>
+    {{end}}
 <form method="post" role="form" action="validate">
     <div class="form-group">
         <label for="username">User Name:</label>
@@ -31,8 +47,22 @@ var Authorize = `
     <button type="submit"  class="btn btn-info" name="authorize" value="deny">Deny</button>
 
     <input type="hidden" name="client_id" value="{{.ClientID}}"/>
+    <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}"/>
     <input type="hidden" name="response_type" value="token"/>
     <input type="hidden" name="scope" value="{{.Scope}}"/>
+    {{if .State}}
+    <input type="hidden" name="state" value="{{.State}}"/>
+    {{end}}
+    {{if .ResponseMode}}
+    <input type="hidden" name="response_mode" value="{{.ResponseMode}}"/>
+    {{end}}
+    {{if .Nonce}}
+    <input type="hidden" name="nonce" value="{{.Nonce}}"/>
+    {{end}}
+    {{range .Resources}}
+    <input type="hidden" name="resource" value="{{.Identifier}}"/>
+    {{end}}
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}"/>
 </form>
 </div>
 </body>
@@ -56,6 +86,22 @@ var Authorize3Leg = `
 
 <div class="container">
     <h2>{{.AppName}} Would Like Access to Your XTRAC Data</h2>
+    {{if .Scopes}}
+    <p>Requested access:</p>
+    <ul>
+    {{range .Scopes}}
+        <li><strong>{{.Name}}</strong> - {{.Description}}</li>
+    {{end}}
+    </ul>
+    {{end}}
+    {{if .Resources}}
+    <p>For use with:</p>
+    <ul>
+    {{range .Resources}}
+        <li>{{.Description}}</li>
+    {{end}}
+    </ul>
+    {{end}}
 <form method="post" role="form" action="validate">
     <div class="form-group">
         <label for="username">User Name:</label>
@@ -70,10 +116,132 @@ var Authorize3Leg = `
     <button type="submit"  class="btn btn-info" name="authorize" value="deny">Deny</button>
 
     <input type="hidden" name="client_id" value="{{.ClientID}}"/>
+    <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}"/>
     <input type="hidden" name="response_type" value="code"/>
     <input type="hidden" name="scope" value="{{.Scope}}"/>
+    {{if .State}}
+    <input type="hidden" name="state" value="{{.State}}"/>
+    {{end}}
+    {{if .ResponseMode}}
+    <input type="hidden" name="response_mode" value="{{.ResponseMode}}"/>
+    {{end}}
+    {{if .Nonce}}
+    <input type="hidden" name="nonce" value="{{.Nonce}}"/>
+    {{end}}
+    {{range .Resources}}
+    <input type="hidden" name="resource" value="{{.Identifier}}"/>
+    {{end}}
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}"/>
+    {{if .CodeChallenge}}
+    <input type="hidden" name="code_challenge" value="{{.CodeChallenge}}"/>
+    <input type="hidden" name="code_challenge_method" value="{{.CodeChallengeMethod}}"/>
+    {{end}}
 </form>
 </div>
 </body>
 </html>
 `
+
+var DeviceVerification = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>Authorize a Device</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <link rel="stylesheet" href="http://maxcdn.bootstrapcdn.com/bootstrap/3.3.5/css/bootstrap.min.css">
+    <script src="https://ajax.googleapis.com/ajax/libs/jquery/1.11.3/jquery.min.js"></script>
+    <script src="http://maxcdn.bootstrapcdn.com/bootstrap/3.3.5/js/bootstrap.min.js"></script>
+</head>
+<body>
+
+
+
+<div class="container">
+    {{if .AppName}}
+    <h2>{{.AppName}} Would Like Access to Your XTRAC Data</h2>
+    {{if .Scope}}
+    <p>Requested access: {{.Scope}}</p>
+    {{end}}
+    {{else}}
+    <h2>Enter the Code Shown on Your Device</h2>
+    {{end}}
+    {{if .Message}}
+    <div class="alert alert-danger">{{.Message}}</div>
+    {{end}}
+{{if .CSRFToken}}
+<form method="post" role="form" action="device">
+    <input type="hidden" name="user_code" value="{{.UserCode}}"/>
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}"/>
+    <div class="form-group">
+        <label>Code:</label>
+        <p class="form-control-static">{{.UserCode}}</p>
+    </div>
+    <div class="form-group">
+        <label for="username">User Name:</label>
+        <input type="text" class="form-control" id="username" name="username"/>
+    </div>
+    <div class="form-group">
+        <label for="password">Password:</label>
+        <input type="password" class="form-control" id="password" name="password"/>
+    </div>
+
+    <button type="submit"  class="btn btn-default" name="authorize" value="allow">Allow</button>
+    <button type="submit"  class="btn btn-info" name="authorize" value="deny">Deny</button>
+</form>
+{{else}}
+<form method="get" role="form" action="device">
+    <div class="form-group">
+        <label for="user_code">Code:</label>
+        <input type="text" class="form-control" id="user_code" name="user_code" value="{{.UserCode}}"/>
+    </div>
+
+    <button type="submit"  class="btn btn-default">Continue</button>
+</form>
+{{end}}
+</div>
+</body>
+</html>
+`
+
+var DeviceVerified = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>Authorize a Device</title>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <link rel="stylesheet" href="http://maxcdn.bootstrapcdn.com/bootstrap/3.3.5/css/bootstrap.min.css">
+</head>
+<body>
+
+
+
+<div class="container">
+    <h2>{{.Message}}</h2>
+</div>
+</body>
+</html>
+`
+
+var FormPost = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>Returning to the Application</title>
+</head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.RedirectURI}}">
+    {{range $name, $values := .Params}}
+    {{range $values}}
+    <input type="hidden" name="{{$name}}" value="{{.}}"/>
+    {{end}}
+    {{end}}
+    <noscript>
+    <button type="submit">Continue</button>
+    </noscript>
+</form>
+</body>
+</html>
+`
@@ -1,11 +1,14 @@
 package http
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/xtraclabs/roll/repos"
 	"github.com/xtraclabs/roll/roll"
-	"github.com/xtraclabs/rollsecrets/secrets"
+	"github.com/xtraclabs/roll/signing"
+	"io/ioutil"
 	"net/http"
 	"strings"
 )
@@ -118,6 +121,10 @@ func handleApplicationPost(core *roll.Core, w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if !allowedScopesRegistered(core, w, app.AllowedScopes) {
+		return
+	}
+
 	//Extract the subject from the request header based on security mode
 	subject, _, err := subjectAndAdminScopeFromRequestCtx(r)
 	if err != nil {
@@ -143,9 +150,9 @@ func handleApplicationPost(core *roll.Core, w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	//Generate a private/public key pair
+	//Generate a private/public key pair for the application's token signing algorithm
 	log.Info("Generate key pair")
-	private, public, err := secrets.GenerateKeyPair()
+	private, public, err := signing.GenerateKeyPair(app.SigningAlg())
 	if err != nil {
 		respondError(w, http.StatusBadRequest, err)
 		return
@@ -168,12 +175,18 @@ func handleApplicationPost(core *roll.Core, w http.ResponseWriter, r *http.Reque
 }
 
 func handleApplicationPut(core *roll.Core, w http.ResponseWriter, r *http.Request) {
-	var app roll.Application
-	if err := parseRequest(r, &app); err != nil {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
 		respondError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	var app roll.Application
+	if err := json.Unmarshal(body, &app); err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("Failed to parse JSON input: %s", err))
+		return
+	}
+
 	//Make sure we use the clientID in the resource not any clientID sent in the JSON.
 	clientID := strings.TrimPrefix(r.RequestURI, ApplicationsURI)
 	if clientID == "" {
@@ -189,6 +202,10 @@ func handleApplicationPut(core *roll.Core, w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !allowedScopesRegistered(core, w, app.AllowedScopes) {
+		return
+	}
+
 	//Extract the subject from the request header based on security mode
 	subject, adminScope, err := subjectAndAdminScopeFromRequestCtx(r)
 	if err != nil {
@@ -209,12 +226,15 @@ func handleApplicationPut(core *roll.Core, w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	//Copy over the potential updates
-	storedApp.ApplicationName = app.ApplicationName
-	storedApp.DeveloperEmail = app.DeveloperEmail
-	storedApp.LoginProvider = app.LoginProvider
-	storedApp.RedirectURI = app.RedirectURI
-	storedApp.DeveloperID = app.DeveloperID
+	//Copy over the updates. Settings left out of the request keep their stored values, so clients that
+	//only know some of the application's settings don't reset the others.
+	app = *storedApp
+	if err := json.Unmarshal(body, &app); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	app.ClientID = clientID
 
 	//Store the application definition
 	log.Info("updating app def: ", app)
@@ -230,6 +250,18 @@ func handleApplicationPut(core *roll.Core, w http.ResponseWriter, r *http.Reques
 		default:
 			respondError(w, http.StatusInternalServerError, err)
 		}
+		return
+	}
+
+	//Tokens are signed with a new key when the signing algorithm changes. The old key continues to verify
+	//tokens issued before the change until the grace period has passed.
+	if app.SigningAlg() != storedApp.SigningAlg() {
+		log.Info("Signing algorithm for ", clientID, " changed to ", app.SigningAlg())
+		if _, err := rotateSigningKey(core, &app, core.SigningKeyGracePeriod()); err != nil {
+			log.Info("Error rotating signing key: ", err.Error())
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
 	}
 
 	respondOk(w, nil)
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/roll/signing"
 	"net/http"
 	"testing"
 )
@@ -22,7 +23,7 @@ func TestStoreAppOK(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		ClientID:        "steve",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -62,7 +63,7 @@ func TestStoreAppSecretStoreFault(t *testing.T) {
 		DeveloperEmail:  "doug@dev.com",
 		DeveloperID:     "rolltest",
 		ClientID:        "steve",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -88,7 +89,7 @@ func TestUpdateAppOK(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		ClientID:        "111-222-333",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -97,7 +98,7 @@ func TestUpdateAppOK(t *testing.T) {
 		ApplicationName: "foos",
 		ClientID:        "111-222-333",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -118,6 +119,149 @@ func TestUpdateAppOK(t *testing.T) {
 	checkResponseStatus(t, resp, http.StatusNoContent)
 }
 
+func TestStoreAppWithSigningAlg(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	app := roll.Application{
+		ApplicationName: "ambivilant birds",
+		ClientID:        "steve",
+		DeveloperEmail:  "doug@dev.com",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		DeveloperID:     "rolltest",
+		TokenSigningAlg: "ES256",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("CreateApplication", &app).Return(nil)
+
+	secretsRepoMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsRepoMock.On("StoreKeysForApp", "steve", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil).Once()
+
+	resp := TestHTTPPostWithRollSubject(t, addr+"/v1/applications", app)
+	checkResponseStatus(t, resp, http.StatusOK)
+
+	privateKey, err := signing.ParsePrivateKeyPEM(secretsRepoMock.Calls[0].Arguments.String(1))
+	if assert.Nil(t, err) {
+		method, err := signing.MethodForKey(privateKey.Public())
+		assert.Nil(t, err)
+		assert.Equal(t, "ES256", method.Alg())
+	}
+}
+
+func TestStoreAppUnsupportedSigningAlg(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	app := roll.Application{
+		ApplicationName: "ambivilant birds",
+		DeveloperEmail:  "doug@dev.com",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		TokenSigningAlg: "HS256",
+	}
+
+	resp := TestHTTPPostWithRollSubject(t, addr+"/v1/applications", app)
+	checkResponseStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestUpdateAppSigningAlgRotatesKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	app := roll.Application{
+		ApplicationName: "ambivilant birds",
+		ClientID:        "111-222-333",
+		DeveloperEmail:  "doug@dev.com",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		DeveloperID:     "rolltest",
+	}
+
+	app2 := app
+	app2.TokenSigningAlg = "EdDSA"
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("RetrieveApplication", "111-222-333", "rolltest", false).Return(&app, nil)
+	appRepoMock.On("UpdateApplication", &app2, "rolltest").Return(nil)
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("ListSigningKeys", "111-222-333").Return([]roll.SigningKey{
+		{ClientID: "111-222-333", KeyID: "rsa-key", Version: 1},
+	}, nil)
+	signingKeyRepoMock.On("StoreSigningKey", mock.AnythingOfType("*roll.SigningKey")).Return(nil)
+	signingKeyRepoMock.On("RetireSigningKey", "111-222-333", 1, mock.AnythingOfType("int64")).Return(nil)
+
+	var privateKey string
+	secretsRepoMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsRepoMock.On("StoreKeysForApp", "111-222-333/v2", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+	secretsRepoMock.On("StoreKeysForApp", "111-222-333", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil).Run(func(args mock.Arguments) {
+		privateKey = args.String(1)
+	})
+
+	resp := TestHTTPPutWithRollSubject(t, addr+"/v1/applications/111-222-333", app2)
+	checkResponseStatus(t, resp, http.StatusNoContent)
+	signingKeyRepoMock.AssertExpectations(t)
+
+	signingKey, err := signing.ParsePrivateKeyPEM(privateKey)
+	if assert.Nil(t, err) {
+		method, err := signing.MethodForKey(signingKey.Public())
+		assert.Nil(t, err)
+		assert.Equal(t, "EdDSA", method.Alg())
+	}
+}
+
+func TestUpdateAppKeepsOmittedSettings(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	app := roll.Application{
+		ApplicationName:          "ambivilant birds",
+		ClientID:                 "111-222-333",
+		DeveloperEmail:           "doug@dev.com",
+		RedirectURIs:             "http://localhost:3000/ab",
+		LoginProvider:            "xtrac://localhost:9000",
+		DeveloperID:              "rolltest",
+		AllowedScopes:            "orders.read",
+		TokenSigningAlg:          "ES256",
+		TokenEndpointAuthMethods: roll.PrivateKeyJWT,
+		ClientAssertionPublicKey: "a public key",
+		GrantTypes:               "authorization_code",
+		AccessTokenLifetime:      600,
+
+		RequirePushedAuthorizationRequests: true,
+	}
+
+	//Portals that predate the newer settings only send the original fields
+	update := map[string]interface{}{
+		"applicationName": "foos",
+		"developerEmail":  "doug@dev.com",
+		"redirectURI":     "http://localhost:3000/cd",
+		"loginProvider":   "xtrac://localhost:9000",
+	}
+
+	expected := app
+	expected.ApplicationName = "foos"
+	expected.RedirectURIs = "http://localhost:3000/cd"
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("RetrieveApplication", "111-222-333", "rolltest", false).Return(&app, nil)
+	appRepoMock.On("UpdateApplication", &expected, "rolltest").Return(nil)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+"/v1/applications/111-222-333", update)
+	checkResponseStatus(t, resp, http.StatusNoContent)
+	appRepoMock.AssertCalled(t, "UpdateApplication", &expected, "rolltest")
+
+	//The signing algorithm is unchanged, so the key is not rotated
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.AssertNotCalled(t, "ListSigningKeys", mock.Anything)
+}
+
 func TestUpdateAppStoreFault(t *testing.T) {
 	core, coreConfig := NewTestCore()
 	ln, addr := TestServer(t, core)
@@ -127,7 +271,7 @@ func TestUpdateAppStoreFault(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		ClientID:        "111-222-333",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -136,7 +280,7 @@ func TestUpdateAppStoreFault(t *testing.T) {
 		ApplicationName: "foos",
 		ClientID:        "111-222-333",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -166,7 +310,7 @@ func TestUpdateAppRetrieveFault(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		DeveloperEmail:  "doug@dev.com",
 		ClientID:        "1111-2222-3333333-4444444",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -188,7 +332,7 @@ func TestUpdateAppNotFound(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		DeveloperEmail:  "doug@dev.com",
 		ClientID:        "1111-2222-3333333-4444444",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -210,7 +354,7 @@ func TestUpdateAppNotOwner(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		ClientID:        "111-222-333",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -219,7 +363,7 @@ func TestUpdateAppNotOwner(t *testing.T) {
 		ApplicationName: "foos",
 		ClientID:        "111-222-333",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -257,7 +401,7 @@ func TestStoreAppIDGenFault(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		DeveloperEmail:  "doug@dev.com",
 		ClientID:        "1111-2222-3333333-4444444",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -276,7 +420,7 @@ func TestStoreAppContentValidationFault(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		DeveloperEmail:  "yeah yeah yeah",
 		ClientID:        "1111-2222-3333333-4444444",
-		RedirectURI:     "not a uri",
+		RedirectURIs:    "not a uri",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -294,7 +438,7 @@ func TestStoreAppStoreFault(t *testing.T) {
 	app := roll.Application{
 		ApplicationName: "ambivilant birds",
 		DeveloperEmail:  "doug@dev.com",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -317,7 +461,7 @@ func TestUpdateAppNoResource(t *testing.T) {
 		ApplicationName: "ambivilant birds",
 		DeveloperEmail:  "doug@dev.com",
 		ClientID:        "1111-2222-3333333-4444444",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -385,7 +529,7 @@ func TestStoreAppInvalidContent(t *testing.T) {
 		ApplicationName: "ambivilant birds<script>",
 		DeveloperEmail:  "doug@dev.com",
 		ClientID:        "1111-2222-3333333-4444444",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -405,7 +549,7 @@ func TestGetApplication(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 		DeveloperID:     "rolltest",
 	}
@@ -429,7 +573,7 @@ func TestGetApplication(t *testing.T) {
 	assert.Equal(t, "1111-2222-3333333-4444444", actual.ClientID)
 	assert.Equal(t, "fight club", actual.ApplicationName)
 	assert.Equal(t, "not for browser clients", actual.ClientSecret)
-	assert.Equal(t, "http://localhost:3000/ab", actual.RedirectURI)
+	assert.Equal(t, "http://localhost:3000/ab", actual.RedirectURIs)
 	assert.Equal(t, "xtrac://localhost:9000", actual.LoginProvider)
 	assert.Equal(t, "rolltest", actual.DeveloperID)
 
@@ -446,7 +590,7 @@ func TestGetApplicationsOK(t *testing.T) {
 			ClientID:        "1111-2222-3333333-4444444",
 			ApplicationName: "fight club",
 			ClientSecret:    "not for browser clients",
-			RedirectURI:     "http://localhost:3000/ab",
+			RedirectURIs:    "http://localhost:3000/ab",
 			LoginProvider:   "xtrac://localhost:9000",
 			DeveloperID:     "rolltest",
 		},
@@ -455,7 +599,7 @@ func TestGetApplicationsOK(t *testing.T) {
 			ClientID:        "1111-2222-3333333-4444444",
 			ApplicationName: "fight club",
 			ClientSecret:    "not for browser clients",
-			RedirectURI:     "http://localhost:3000/ab",
+			RedirectURIs:    "http://localhost:3000/ab",
 			LoginProvider:   "xtrac://localhost:9000",
 			DeveloperID:     "rolltest",
 		}}
@@ -479,7 +623,7 @@ func TestGetApplicationsOK(t *testing.T) {
 		assert.Equal(t, "1111-2222-3333333-4444444", app.ClientID)
 		assert.Equal(t, "fight club", app.ApplicationName)
 		assert.Equal(t, "not for browser clients", app.ClientSecret)
-		assert.Equal(t, "http://localhost:3000/ab", app.RedirectURI)
+		assert.Equal(t, "http://localhost:3000/ab", app.RedirectURIs)
 		assert.Equal(t, "xtrac://localhost:9000", app.LoginProvider)
 		assert.Equal(t, "rolltest", app.DeveloperID)
 	}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//Lifetime of an issued authorization code - RFC 6749 section 4.1.2 recommends no more than 10 minutes
+	authCodeLifetime = 10 * time.Minute
+)
+
+var (
+	//ErrInvalidAuthCode is returned when a code has no record, has expired, or was issued to a different
+	//client or redirect uri
+	ErrInvalidAuthCode = errors.New("Invalid authorization code")
+
+	//ErrAuthCodeReuse is returned when an authorization code that has already been exchanged is presented again
+	ErrAuthCodeReuse = errors.New("Authorization code has already been used - tokens issued for the code revoked")
+)
+
+//decodeClaims returns the claims of a token without verifying its signature. It is only for use
+//on tokens roll has just generated.
+func decodeClaims(tokenString string) (map[string]interface{}, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+//addClaimsToToken adds claims to a signed token, re-signing it with the given private key
+func addClaimsToToken(tokenString string, claims map[string]interface{}, privateKey string) (string, error) {
+	tokenClaims, err := decodeClaims(tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	for k, v := range claims {
+		tokenClaims[k] = v
+	}
+
+	return signToken(tokenClaims, privateKey)
+}
+
+//storeAuthCode records an issued code so it can only be exchanged once, by the client it was
+//issued to, using the redirect uri it was issued for
+func storeAuthCode(core *roll.Core, codeID, redirectURI string, expiresAt int64, app *roll.Application) error {
+	return core.StoreAuthCode(&roll.AuthCode{
+		CodeID:      codeID,
+		ClientID:    app.ClientID,
+		RedirectURI: redirectURI,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+//retrieveAuthCodeForExchange looks up the record of the code being exchanged. A nil code with
+//no error is returned if the code may not be exchanged by the client.
+func retrieveAuthCodeForExchange(core *roll.Core, claims map[string]interface{}, codeContext *authCodeContext) (*roll.AuthCode, error) {
+	codeID, ok := claims["jti"].(string)
+	if !ok || codeID == "" {
+		return nil, nil
+	}
+
+	code, err := core.RetrieveAuthCode(codeID)
+	if err != nil || code == nil {
+		return nil, err
+	}
+
+	if code.ClientID != codeContext.clientID || code.RedirectURI != codeContext.redirectURI {
+		log.Info("Authorization code presented by different client or with different redirect uri")
+		return nil, nil
+	}
+
+	return code, nil
+}
+
+//revokeAuthCodeGrant revokes the tokens issued in exchange for an authorization code that has been
+//presented again - see RFC 6749 section 4.1.2
+func revokeAuthCodeGrant(core *roll.Core, codeID string, w http.ResponseWriter) {
+	log.Warn("Authorization code reuse detected for code ", codeID, " - revoking issued tokens")
+
+	//Reread the code to pick up the tokens recorded by the first exchange
+	code, err := core.RetrieveAuthCode(codeID)
+	if err != nil {
+		log.Info("Error retrieving authorization code: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	if code != nil && code.AccessTokenID != "" {
+		if err := core.RevokeToken(code.AccessTokenID, code.AccessTokenExpiresAt); err != nil {
+			log.Info("Error revoking access token: ", err.Error())
+			respondServerError(w, err)
+			return
+		}
+	}
+
+	if code != nil && code.RefreshTokenFamilyID != "" {
+		if err := core.RevokeRefreshTokenFamily(code.RefreshTokenFamilyID); err != nil {
+			log.Info("Error revoking refresh token family: ", err.Error())
+			respondServerError(w, err)
+			return
+		}
+	}
+
+	respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrAuthCodeReuse)
+}
+
+//exchangeAuthCode spends the code and responds with the tokens issued for it. The tokens are recorded
+//against the code so they can be revoked if the code is replayed. An id token is included if the code
+//was issued for an OpenID Connect sign in. The access token is for the given resources, whereas the
+//refresh token keeps all the resources the code was granted for.
+func exchangeAuthCode(core *roll.Core, code *roll.AuthCode, subject, scope string, resources, grantedResources []string, app *roll.Application, si *signIn, w http.ResponseWriter) {
+	//Spend the code. Losing the race to mark it used is treated the same as reuse.
+	err := core.MarkAuthCodeUsed(code.CodeID)
+	if err != nil {
+		switch err.(type) {
+		case roll.AuthCodeReuseError:
+			revokeAuthCodeGrant(core, code.CodeID, w)
+		default:
+			respondServerError(w, err)
+		}
+
+		return
+	}
+
+	var at *accessTokenResponse
+	if si != nil {
+		at, err = generateOpenIDTokenResponse(core, subject, scope, resources, app, si)
+	} else {
+		at, err = generateAccessTokenResponse(core, subject, scope, resources, app)
+	}
+
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	//The first refresh token issued starts a new family, so its id is also the family id
+	at.RefreshToken, err = issueRefreshToken(core, subject, scope, grantedResources, "", app)
+	if err != nil {
+		log.Info("Error issuing refresh token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	claims, err := decodeClaims(at.AccessToken)
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	accessTokenID, _ := claims["jti"].(string)
+	err = core.RecordAuthCodeTokens(code.CodeID, accessTokenID, tokenExpiry(core, claims), at.RefreshToken)
+	if err != nil {
+		log.Info("Error recording tokens issued for authorization code: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	respondWithAccessToken(w, at)
+}
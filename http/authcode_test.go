@@ -0,0 +1,202 @@
+package http
+
+import (
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	rolltoken "github.com/xtraclabs/rollsecrets/token"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testAuthCode(redirectURI string) *roll.AuthCode {
+	return &roll.AuthCode{
+		CodeID:      "code-1",
+		ClientID:    "1111-2222-3333333-4444444",
+		RedirectURI: redirectURI,
+		ExpiresAt:   time.Now().Add(authCodeLifetime).Unix(),
+	}
+}
+
+//expectAuthCodeExchange sets up the code store for the successful exchange of a code issued
+//for the given redirect uri
+func expectAuthCodeExchange(coreConfig *roll.CoreConfig, redirectURI string) {
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("RetrieveAuthCode", mock.Anything).Return(testAuthCode(redirectURI), nil)
+	authCodeRepoMock.On("MarkAuthCodeUsed", "code-1").Return(nil)
+	authCodeRepoMock.On("RecordAuthCodeTokens", "code-1", mock.Anything, mock.Anything, "steve").Return(nil)
+}
+
+func exchangeCode(t *testing.T, addr, code, redirectURI string) *http.Response {
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"redirect_uri":  {redirectURI},
+			"code":          {code}})
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestGenerateSignedCodeStoresCode(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupPKCETestApp(t, coreConfig, false)
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("StoreAuthCode", mock.Anything).Return(nil)
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	code, err := generateSignedCode(core, "a-subject", "", "http://localhost:3000/ab", nil, app, nil, nil)
+	assert.Nil(t, err)
+
+	token, err := jwt.Parse(code, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "steve", token.Claims["jti"])
+		exp, ok := token.Claims["exp"].(float64)
+		assert.True(t, ok)
+		assert.True(t, int64(exp) <= time.Now().Add(authCodeLifetime).Unix())
+	}
+
+	stored := authCodeRepoMock.Calls[0].Arguments.Get(0).(*roll.AuthCode)
+	assert.Equal(t, "steve", stored.CodeID)
+	assert.Equal(t, "1111-2222-3333333-4444444", stored.ClientID)
+	assert.Equal(t, "http://localhost:3000/ab", stored.RedirectURI)
+	assert.False(t, stored.Used)
+}
+
+func TestAuthCodeReplayRevokesTokens(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	usedCode := testAuthCode("http://localhost:3000/ab")
+	usedCode.Used = true
+	usedCode.AccessTokenID = "at-1"
+	usedCode.AccessTokenExpiresAt = 1234
+	usedCode.RefreshTokenFamilyID = "family-1"
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("RetrieveAuthCode", mock.Anything).Return(usedCode, nil)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("RevokeToken", "at-1", int64(1234)).Return(nil)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RevokeRefreshTokenFamily", "family-1").Return(nil)
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	revocationRepoMock.AssertExpectations(t)
+	refreshTokenRepoMock.AssertExpectations(t)
+}
+
+func TestAuthCodeConcurrentExchange(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("RetrieveAuthCode", mock.Anything).Return(testAuthCode("http://localhost:3000/ab"), nil)
+	authCodeRepoMock.On("MarkAuthCodeUsed", "code-1").Return(roll.AuthCodeReuseError{})
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.Contains(t, body, ErrAuthCodeReuse.Error())
+}
+
+func TestAuthCodeUnknown(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("RetrieveAuthCode", mock.Anything).Return(nil, nil)
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.Contains(t, body, ErrInvalidAuthCode.Error())
+}
+
+func TestAuthCodeRedirectURIMismatch(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("RetrieveAuthCode", mock.Anything).Return(testAuthCode("http://localhost:3000/other"), nil)
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	authCodeRepoMock.AssertNotCalled(t, "MarkAuthCodeUsed", mock.Anything)
+}
+
+func TestAuthCodeExpired(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	expiredCode := testAuthCode("http://localhost:3000/ab")
+	expiredCode.ExpiresAt = time.Now().Add(-1 * time.Minute).Unix()
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("RetrieveAuthCode", mock.Anything).Return(expiredCode, nil)
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAuthCodeExpiredClaim(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:     "1111-2222-3333333-4444444",
+		ClientSecret: "not for browser clients",
+		RedirectURIs: "http://localhost:3000/ab",
+	}, nil)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	code, err = addClaimsToToken(code, map[string]interface{}{"exp": time.Now().Add(-1 * time.Minute).Unix()}, privateKey)
+	assert.Nil(t, err)
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_grant", readOAuth2Error(t, resp).Error)
+}
@@ -7,11 +7,13 @@ import (
 	"github.com/xtraclabs/roll/html"
 	"github.com/xtraclabs/roll/login"
 	"github.com/xtraclabs/roll/roll"
-	rolltoken "github.com/xtraclabs/rollsecrets/token"
 	"html/template"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var authTemplate *template.Template
@@ -34,9 +36,22 @@ func init() {
 }
 
 type authPageContext struct {
-	AppName  string
-	ClientID string
-	Scope    string
+	AppName             string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	ResponseMode        string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	CSRFToken           string
+
+	//Scopes describes each of the requested scopes
+	Scopes []roll.Scope
+
+	//Resources describes each of the protected resources the requested access is for
+	Resources []roll.ProtectedResource
 }
 
 const (
@@ -48,13 +63,26 @@ const (
 
 	oauth2Scope = "scope"
 	adminScope  = "admin"
-
-	serverErrorRedirectURLFormat          = "%s?error=server_error&error_description=%s"
-	serverErrorRedirectURLFragmentFormat  = "%s#error=server_error&error_description=%s"
-	invalidScopeRedirectURLFormat         = "%s?error=access_denied&error_description=scope-problem"
-	invalidScopeRedirectURLFragmentFormat = "%s#error=access_denied&error_description=scope-problem"
 )
 
+//supportedResponseTypes are the response types the authorize endpoint supports
+var supportedResponseTypes = []string{"code", "token"}
+
+//responseTypeGrantTypes are the grant types a client uses when authorizing with each response type
+var responseTypeGrantTypes = map[string]string{
+	"code":  "authorization_code",
+	"token": "implicit",
+}
+
+//ErrResponseTypeNotAllowed is returned when a client uses a response type it did not register
+var ErrResponseTypeNotAllowed = errors.New("response_type not allowed for the client")
+
+//responseTypeAllowed is true when the client may authorize using the response type, which requires
+//both the response type and the grant type it implies be allowed for the client
+func responseTypeAllowed(app *roll.Application, responseType string) bool {
+	return app.AllowsResponseType(responseType) && app.AllowsGrantType(responseTypeGrantTypes[responseType])
+}
+
 func handleAuthorize(core *roll.Core) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -79,12 +107,9 @@ func requiredQueryParamsPresent(r *http.Request) bool {
 	return true
 }
 
+//validateInputParams looks up the client and checks the redirect uri. Errors up to this point can't be
+//redirected back to the client as we don't know the redirect uri is safe to use.
 func validateInputParams(core *roll.Core, r *http.Request) (*roll.Application, error) {
-	responseType := r.FormValue("response_type")
-	if responseType != "token" && responseType != "code" {
-		return nil, errors.New("response_type must be code or token")
-	}
-
 	//Client id is application key
 	clientID := r.FormValue("client_id")
 	app, err := core.SystemRetrieveApplication(clientID)
@@ -96,14 +121,28 @@ func validateInputParams(core *roll.Core, r *http.Request) (*roll.Application, e
 		return nil, errors.New("Invalid client id")
 	}
 
-	redirectURI := r.FormValue("redirect_uri")
-	if app.RedirectURI != redirectURI {
-		return nil, errors.New("redirect_uri does not match registered redirect URIs")
+	if !app.AllowsRedirectURI(r.FormValue("redirect_uri")) {
+		return nil, ErrRedirectURIMismatch
 	}
 
 	return app, nil
 }
 
+//redirectURIFromForm returns the redirect uri carried in the authorize page form. The uri may be omitted
+//if the application has only one redirect uri - see RFC 6749 section 3.1.2.3.
+func redirectURIFromForm(r *http.Request, app *roll.Application) (string, error) {
+	redirectURI := r.FormValue("redirect_uri")
+	if redirectURI == "" {
+		redirectURI = app.SingleRedirectURI()
+	}
+
+	if redirectURI == "" || !app.AllowsRedirectURI(redirectURI) {
+		return "", ErrRedirectURIMismatch
+	}
+
+	return redirectURI, nil
+}
+
 func executeAuthTemplate(w http.ResponseWriter, r *http.Request, pageCtx *authPageContext) error {
 	responseType := r.FormValue("response_type")
 	var authPage *template.Template
@@ -125,60 +164,136 @@ func executeAuthTemplate(w http.ResponseWriter, r *http.Request, pageCtx *authPa
 
 }
 
-//validateScopes validates the requested scopes. We will be strict here: anything we don't recognize
-//means validation fails.
-func validateKnownScopes(scope string) error {
-	if scope == "" {
-		log.Info("No scope content to validate")
-		return nil
-	}
-
-	//According to RFC 6749 scopes are whitespace delimited string values.
-	scopeParts := strings.Fields(scope)
-
-	//We only know about one scope, so if there's more than one it's invalid
-	if len(scopeParts) != 1 {
-		return errors.New("scope contains unknown part(s)")
-	}
+func handleAuthZGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
 
-	if scopeParts[0] != adminScope {
-		return errors.New("admin is the only known scope")
+	//Requests made with a pushed request uri or a request object are checked using the params they carry
+	r, pushed := resolveAuthorizeRequest(core, w, r)
+	if r == nil {
+		return
 	}
 
-	log.Info("scope content valid")
-	return nil
-}
-
-func handleAuthZGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
-
 	//Check the query params
 	if !requiredQueryParamsPresent(r) {
-		respondError(w, http.StatusBadRequest, errors.New("Missing required query params or multiple values for single param"))
+		respondInvalidRequest(w, errors.New("Missing required query params or multiple values for single param"))
 		return
 	}
 
 	//Validate client_id and redirect_uri
 	app, err := validateInputParams(core, r)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err)
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	//From here on errors are reported by redirecting back to the client, returning the state given by the client
+	redirectURI := r.FormValue("redirect_uri")
+	state := r.FormValue("state")
+	responseType, err := getResponseType(r)
+	responseMode, modeErr := getResponseMode(r, responseType)
+	if err != nil {
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2UnsupportedResponseType, err.Error())
+		return
+	}
+
+	if modeErr != nil {
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2InvalidRequest, modeErr.Error())
+		return
+	}
+
+	if app.RequirePushedAuthorizationRequests && !pushed {
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2InvalidRequest, ErrPushedAuthorizationRequired.Error())
+		return
+	}
+
+	if !responseTypeAllowed(app, responseType) {
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2UnauthorizedClient, ErrResponseTypeNotAllowed.Error())
 		return
 	}
 
 	//Check scopes, if specified
 	scopes := r.FormValue(oauth2Scope)
-	err = validateKnownScopes(scopes)
+	err = validateRequestedScope(core, app, scopes)
 	if err != nil {
 		log.Info("Error validating scope: ", err.Error())
-		redirectURL := buildScopeErrorRedirectURL(app)
-		http.Redirect(w, r, redirectURL, http.StatusFound)
+		errorCode := oauth2ServerError
+		if invalidScope(err) {
+			errorCode = oauth2InvalidScope
+		}
+
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, errorCode, err.Error())
+		return
+	}
+
+	//The scopes have been validated, so are all in the registry
+	scopeDescriptions, err := describeScopes(core, scopes)
+	if err != nil {
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2ServerError, err.Error())
+		return
+	}
+
+	//Check the resources the access is for, if specified - see RFC 8707 section 2.1
+	resources := r.Form["resource"]
+	resourceDescriptions, err := describeResources(core, resources)
+	if err != nil {
+		log.Info("Error validating resources: ", err.Error())
+		errorCode := oauth2ServerError
+		if invalidTarget(err) {
+			errorCode = oauth2InvalidTarget
+		}
+
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, errorCode, err.Error())
+		return
+	}
+
+	//OpenID Connect requires a nonce for the implicit flow so the client can detect replayed id tokens
+	nonce := r.FormValue("nonce")
+	if responseType == "token" && hasOpenIDScope(scopes) && nonce == "" {
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2InvalidRequest, ErrNonceRequired.Error())
 		return
 	}
 
 	//Build and return the login page
 	pageCtx := &authPageContext{
-		AppName:  app.ApplicationName,
-		ClientID: app.ClientID,
-		Scope:    scopes,
+		AppName:      app.ApplicationName,
+		ClientID:     app.ClientID,
+		RedirectURI:  redirectURI,
+		Scope:        scopes,
+		State:        state,
+		ResponseMode: r.FormValue("response_mode"),
+		Nonce:        nonce,
+		Scopes:       scopeDescriptions,
+		Resources:    resourceDescriptions,
+	}
+
+	//Check the PKCE code challenge for the code flow
+	var cc *codeChallenge
+	if responseType == "code" {
+		cc, err = checkCodeChallenge(r, app)
+		if err != nil {
+			log.Info("Error validating code challenge: ", err.Error())
+			respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2InvalidRequest, err.Error())
+			return
+		}
+
+		if cc != nil {
+			pageCtx.CodeChallenge = cc.Challenge
+			pageCtx.CodeChallengeMethod = cc.Method
+		}
+	}
+
+	//Skip the authorize page if the user is signed in and has already consented to the request
+	if subject, userClaims := loginSessionFromRequest(core, r, app); subject != "" {
+		if authorizeWithConsent(core, w, r, responseType, responseMode, redirectURI, state, subject, scopes, resources, app, cc, userClaims) {
+			return
+		}
+	}
+
+	//Protect the authorize page form from cross site request forgery
+	pageCtx.CSRFToken, err = newCSRFToken(core, w, r, app, pageCtx.authorizeRequestValues(responseType))
+	if err != nil {
+		log.Info("Error generating csrf token: ", err.Error())
+		respondServerError(w, err)
+		return
 	}
 
 	err = executeAuthTemplate(w, r, pageCtx)
@@ -189,6 +304,38 @@ func handleAuthZGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
 
 }
 
+//authorizeWithConsent completes the authorization of a signed in user without showing the authorize page,
+//returning false if the user has not already consented to the request.
+func authorizeWithConsent(core *roll.Core, w http.ResponseWriter, r *http.Request, responseType, responseMode, redirectURI, state, subject, scope string, resources []string, app *roll.Application, cc *codeChallenge, userClaims map[string]interface{}) bool {
+	consented, err := consentCovers(core, subject, app, scope)
+	if err != nil {
+		log.Info("Error checking consent: ", err.Error())
+		return false
+	}
+
+	if !consented {
+		return false
+	}
+
+	//Admin scope depends on the user, which may have changed since consent was given
+	valid, err := validateScopes(core, app, subject, scope)
+	if err != nil || !valid {
+		return false
+	}
+
+	log.Info("Consent given previously by ", subject, " to ", app.ClientID)
+
+	params, err := buildAuthorizationParams(core, responseType, redirectURI, state, subject, scope, resources, app, cc, newSignIn(core, r, scope, userClaims))
+	if err != nil {
+		log.Info("Error generating authorization response: ", err.Error())
+		respondServerError(w, err)
+		return true
+	}
+
+	respondAuthorization(w, r, responseMode, redirectURI, params)
+	return true
+}
+
 func handleValidate(core *roll.Core) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -218,59 +365,149 @@ func lookupApplicationFromFormClientID(core *roll.Core, r *http.Request) (*roll.
 	return app, nil
 }
 
-func buildDeniedRedirectURLFragment(app *roll.Application) string {
-	return fmt.Sprintf("%s#error=access_denied", app.RedirectURI)
-}
+//checkCodeChallenge extracts the code challenge from the request, making sure public clients
+//supply one.
+func checkCodeChallenge(r *http.Request, app *roll.Application) (*codeChallenge, error) {
+	cc, err := codeChallengeFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
 
-func buildScopeErrorRedirectURL(app *roll.Application) string {
-	return fmt.Sprintf("%s?error=access_denied&error_description=scope-problem", app.RedirectURI)
+	if cc == nil && app.PublicClient {
+		return nil, ErrCodeChallengeRequired
+	}
+
+	return cc, nil
 }
 
-func buildRedirectURL(core *roll.Core, w http.ResponseWriter, responseType, subject, scope string, app *roll.Application) (string, error) {
-	log.Info("build redirect, app ctx: ", app.RedirectURI)
+//buildAuthorizationParams builds the parameters of a successful authorization response, returning the state
+//given by the client. The sign in is nil unless the openid scope was requested.
+func buildAuthorizationParams(core *roll.Core, responseType, redirectURI, state, subject, scope string, resources []string, app *roll.Application, cc *codeChallenge, si *signIn) (url.Values, error) {
+	log.Info("build authorization response, redirect uri: ", redirectURI)
 
-	var redirectURL string
+	params := url.Values{}
 	switch responseType {
 	case "token":
 		//Create signed token
-		token, err := generateJWT(subject, scope, core, app)
+		token, err := generateJWT(subject, scope, core, app, withAudience(si.accessTokenClaims(), resources))
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		params.Set("access_token", token)
+		params.Set("token_type", "Bearer")
+		params.Set("expires_in", strconv.FormatInt(expiresIn(core, app), 10))
+		if scope != "" {
+			params.Set("scope", scope)
+		}
+
+		if si != nil {
+			idToken, err := generateIDToken(core, subject, app, si, token)
+			if err != nil {
+				return nil, err
+			}
+			params.Set("id_token", idToken)
 		}
-		redirectURL = fmt.Sprintf("%s#access_token=%s&token_type=Bearer", app.RedirectURI, token)
 	case "code":
-		token, err := generateSignedCode(core, subject, scope, app)
+		token, err := generateSignedCode(core, subject, scope, redirectURI, resources, app, cc, si)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		redirectURL = fmt.Sprintf("%s?code=%s", app.RedirectURI, token)
+		params.Set("code", token)
 	default:
-		panic(errors.New("unexpected response type in buildRedirectURL: " + responseType))
+		panic(errors.New("unexpected response type in buildAuthorizationParams: " + responseType))
 	}
 
-	log.Info("redirect url: ", redirectURL)
+	if state != "" {
+		params.Set("state", state)
+	}
 
-	return redirectURL, nil
+	return params, nil
 }
 
-func generateJWT(subject, scope string, core *roll.Core, app *roll.Application) (string, error) {
+//generateJWT generates an access token, with an expiry based on the access token lifetime for the app.
+//The client_id claim names the app, as the audience may be overridden by the extra claims to restrict the
+//token to the resources it was issued for. Any extra claims given are added to the token. The token is
+//signed with the app's private key, using the signing method for the type of key.
+func generateJWT(subject, scope string, core *roll.Core, app *roll.Application, extraClaims map[string]interface{}) (string, error) {
 	privateKey, err := core.RetrievePrivateKeyForApp(app.ClientID)
 	if err != nil {
 		return "", err
 	}
 
-	token, err := rolltoken.GenerateToken(subject, scope, app.ClientID, app.ApplicationName, privateKey)
-	return token, err
+	tokenID, err := core.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud":         app.ClientID,
+		"sub":         subject,
+		"scope":       grantedScopeFromCode(scope),
+		"application": app.ApplicationName,
+		"jti":         tokenID,
+		"iat":         now.Unix(),
+		"exp":         now.Add(core.AccessTokenLifetime(app)).Unix(),
+		"client_id":   app.ClientID,
+	}
+
+	for k, v := range extraClaims {
+		claims[k] = v
+	}
+
+	return signToken(claims, privateKey)
 }
 
-func generateSignedCode(core *roll.Core, subject, scope string, app *roll.Application) (string, error) {
+//generateSignedCode generates a short lived authorization code, recording it in the code store so it
+//can only be exchanged once. If the code flow was started with a PKCE code challenge, the challenge is
+//carried in the code so it can be checked when the code is exchanged. Likewise the details of an OpenID
+//Connect sign in, and the resources the access is for, are carried so the tokens can be issued.
+func generateSignedCode(core *roll.Core, subject, scope, redirectURI string, resources []string, app *roll.Application, cc *codeChallenge, si *signIn) (string, error) {
 	privateKey, err := core.RetrievePrivateKeyForApp(app.ClientID)
 	if err != nil {
 		return "", err
 	}
 
-	token, err := rolltoken.GenerateCode(subject, scope, app.ClientID, privateKey)
-	return token, err
+	codeID, err := core.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	//The scope marker distinguishes codes from access tokens signed with the same key
+	now := time.Now()
+	expiresAt := now.Add(authCodeLifetime).Unix()
+	claims := map[string]interface{}{
+		"aud":   app.ClientID,
+		"sub":   subject,
+		"scope": strings.TrimSpace(authCodeScopeMarker + " " + scope),
+		"jti":   codeID,
+		"iat":   now.Unix(),
+		"exp":   expiresAt,
+	}
+
+	if cc != nil {
+		claims[codeChallengeClaim] = cc.Challenge
+		claims[codeChallengeMethodClaim] = cc.Method
+	}
+
+	if len(resources) > 0 {
+		claims[resourceClaim] = resources
+	}
+
+	for k, v := range si.codeClaims() {
+		claims[k] = v
+	}
+
+	token, err := signToken(claims, privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	if err := storeAuthCode(core, codeID, redirectURI, expiresAt, app); err != nil {
+		return "", err
+	}
+
+	return token, nil
 }
 
 func getResponseType(r *http.Request) (string, error) {
@@ -279,25 +516,29 @@ func getResponseType(r *http.Request) (string, error) {
 		return "", errors.New("Expected single response_type param as part of query params")
 	}
 
-	if responseType != "token" && responseType != "code" {
-		return "", errors.New("valid values for response_type are token and code")
+	for _, supported := range supportedResponseTypes {
+		if responseType == supported {
+			return responseType, nil
+		}
 	}
 
-	return responseType, nil
+	return "", errors.New("valid values for response_type are token and code")
 
 }
 
-func authenticateUser(username, password string, app *roll.Application) (bool, error) {
+//authenticateUser logs the user in using the login provider for the application. On a successful
+//login the claims describing the user are returned along with the authentication status.
+func authenticateUser(username, password string, app *roll.Application) (bool, map[string]interface{}, error) {
 	//Convert login provider to a URL
 	loginURL, err := url.Parse(app.LoginProvider)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
 
 	//Grab the login kit
 	kit := login.GetLoginKit(loginURL.Scheme)
 	if kit == nil {
-		return false, errors.New("No login kit for login provider " + loginURL.Scheme)
+		return false, nil, errors.New("No login kit for login provider " + loginURL.Scheme)
 	}
 
 	//Form the request and endpoint
@@ -308,7 +549,7 @@ func authenticateUser(username, password string, app *roll.Application) (bool, e
 	client := &http.Client{}
 	req, err := http.NewRequest("POST", endpoint, strings.NewReader(loginRequest))
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
 
 	req.Header.Add("SOAPAction", "\"\"")
@@ -318,59 +559,54 @@ func authenticateUser(username, password string, app *roll.Application) (bool, e
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
 
+	defer resp.Body.Close()
+
 	log.Info(fmt.Sprintf("%v", resp))
 
-	return resp.StatusCode == http.StatusOK, nil
+	if resp.StatusCode != http.StatusOK {
+		return false, nil, nil
+	}
+
+	loginResponse, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return true, kit.UserClaims(username, loginResponse), nil
 
 }
 
-func validateScopes(core *roll.Core, r *http.Request) (bool, error) {
-	scope := r.FormValue(oauth2Scope)
+//validateScopes validates the scope requested on behalf of a user. As well as being a scope the application
+//may request, admin scope may only be granted to admins.
+func validateScopes(core *roll.Core, app *roll.Application, subject, scope string) (bool, error) {
 	log.Info("validating scope", scope)
 	if scope == "" {
 		return true, nil
 	}
 
-	scopeParts := strings.Fields(scope)
-	if len(scopeParts) > 1 || scopeParts[0] != adminScope {
-		log.Info("scope not allowed")
-		return false, nil
-	}
+	if err := validateRequestedScope(core, app, scope); err != nil {
+		if invalidScope(err) {
+			log.Info("scope not allowed")
+			return false, nil
+		}
 
-	subject := r.FormValue("username")
-	validAdmin, err := core.IsAdmin(subject)
-	if err != nil {
 		return false, err
 	}
 
-	return validAdmin, nil
-}
-
-func buildServerErrorRedirectURL(responseType string, app *roll.Application, errorDetail string) string {
-	var urlFormat string
-
-	if responseType == "code" {
-		urlFormat = serverErrorRedirectURLFormat
-	} else {
-		urlFormat = serverErrorRedirectURLFragmentFormat
+	//Only the admin scope needs to be checked against the user
+	if !scopeContains(scope, adminScope) {
+		return true, nil
 	}
 
-	return fmt.Sprintf(urlFormat, app.RedirectURI, errorDetail)
-}
-
-func buildInvalidScopeRedirectURL(responseType string, app *roll.Application) string {
-	var urlFormat string
-
-	if responseType == "code" {
-		urlFormat = invalidScopeRedirectURLFormat
-	} else {
-		urlFormat = invalidScopeRedirectURLFormat
+	validAdmin, err := core.IsAdmin(subject)
+	if err != nil {
+		return false, err
 	}
 
-	return fmt.Sprintf(urlFormat, app.RedirectURI)
+	return validAdmin, nil
 }
 
 func handleAuthZValidate(core *roll.Core, w http.ResponseWriter, r *http.Request) {
@@ -378,65 +614,137 @@ func handleAuthZValidate(core *roll.Core, w http.ResponseWriter, r *http.Request
 	//Get the response type
 	responseType, err := getResponseType(r)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err)
+		respondInvalidRequest(w, err)
 		return
 	}
 
 	//Lookup the client based on the hidden input field
 	app, err := lookupApplicationFromFormClientID(core, r)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err)
+		respondServerError(w, err)
+		return
+	}
+
+	//The redirect uri is also a hidden input field, so check it again before redirecting to it
+	redirectURI, err := redirectURIFromForm(r, app)
+	if err != nil {
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	if !responseTypeAllowed(app, responseType) {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2UnauthorizedClient, ErrResponseTypeNotAllowed)
+		return
+	}
+
+	//Make sure the form was posted from the authorize page we served for this request. Forged requests are
+	//not redirected to the client.
+	if err := checkCSRFToken(core, r, app); err != nil {
+		log.Info("Rejecting authorize page form: ", err.Error())
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	//The response mode is a hidden input field too, so is checked along with the other fields
+	responseMode, err := getResponseMode(r, responseType)
+	if err != nil {
+		respondInvalidRequest(w, err)
 		return
 	}
 
+	state := r.FormValue("state")
+
 	//Check if user denied authorization. Note we assume if the request was not allowed it was denied.
 	if denied(r) {
-		redirectURL := buildDeniedRedirectURLFragment(app)
-		http.Redirect(w, r, redirectURL, http.StatusFound)
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2AccessDenied, "")
 		return
 	}
 
 	//Authenticate the user
-	authenticated, err := authenticateUser(r.FormValue("username"), r.FormValue("password"), app)
+	authenticated, userClaims, err := authenticateUser(r.FormValue("username"), r.FormValue("password"), app)
 	if err != nil {
 		log.Info("Error authenticating user: ", err.Error())
-		respondError(w, http.StatusInternalServerError, err)
+		respondServerError(w, err)
 		return
 	}
 
 	//Was the authentication successful?
 	if !authenticated {
-		redirectURL := buildDeniedRedirectURLFragment(app)
-		http.Redirect(w, r, redirectURL, http.StatusFound)
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2AccessDenied, "")
 		return
 	}
 
 	//If a scope is present, validate it.
 	log.Info("validate scope")
-	valid, err := validateScopes(core, r)
+	valid, err := validateScopes(core, app, r.FormValue("username"), r.FormValue(oauth2Scope))
 	if err != nil {
 		log.Info("error validating scope: ", err.Error())
-		redirectURL := buildServerErrorRedirectURL(responseType, app, err.Error())
-		http.Redirect(w, r, redirectURL, http.StatusFound)
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2ServerError, err.Error())
 		return
 	}
 
 	if !valid {
 		log.Info("scope is invalid")
-		redirectURL := buildInvalidScopeRedirectURL(responseType, app)
-		http.Redirect(w, r, redirectURL, http.StatusFound)
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2InvalidScope, ErrScopeNotAllowed.Error())
+		return
+	}
+
+	//The code challenge is carried as a hidden form field - check it again as we can't
+	//trust what we get back
+	var cc *codeChallenge
+	if responseType == "code" {
+		cc, err = checkCodeChallenge(r, app)
+		if err != nil {
+			log.Info("Error validating code challenge: ", err.Error())
+			respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2InvalidRequest, err.Error())
+			return
+		}
+	}
+
+	//An OpenID Connect sign in also needs the nonce, which is carried as a hidden form field too
+	si := newSignIn(core, r, r.FormValue("scope"), userClaims)
+	if si != nil && responseType == "token" && si.Nonce == "" {
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2InvalidRequest, ErrNonceRequired.Error())
 		return
 	}
 
-	//Build redirect url with embedded token or code
-	redirectURL, err := buildRedirectURL(core, w, responseType, r.FormValue("username"), r.FormValue("scope"), app)
+	//The resources are hidden form fields too, and may have been removed from the registry since the
+	//authorize page was served
+	resources := r.Form["resource"]
+	if _, err := describeResources(core, resources); err != nil {
+		log.Info("Error validating resources: ", err.Error())
+		errorCode := oauth2ServerError
+		if invalidTarget(err) {
+			errorCode = oauth2InvalidTarget
+		}
+
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, errorCode, err.Error())
+		return
+	}
+
+	//Remember what the user allowed so they need not be asked again
+	if err := recordConsent(core, r.FormValue("username"), app, r.FormValue("scope")); err != nil {
+		log.Info("Error recording consent: ", err.Error())
+		respondAuthorizationError(w, r, responseMode, redirectURI, state, oauth2ServerError, err.Error())
+		return
+	}
+
+	//Build the response carrying the token or code
+	params, err := buildAuthorizationParams(core, responseType, redirectURI, state, r.FormValue("username"), r.FormValue("scope"), resources, app, cc, si)
 	if err != nil {
-		log.Info("Error generating redirect url: ", err.Error())
-		respondError(w, http.StatusInternalServerError, err)
+		log.Info("Error generating authorization response: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	//Sign the user in so later requests they have consented to skip the authorize page
+	if err := setLoginSessionCookie(core, w, r, r.FormValue("username"), app, userClaims); err != nil {
+		log.Info("Error creating login session: ", err.Error())
+		respondServerError(w, err)
 		return
 	}
 
-	//Redirect the user to the new URL
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	//Return the user to the client with the response
+	respondAuthorization(w, r, responseMode, redirectURI, params)
 
 }
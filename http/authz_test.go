@@ -4,6 +4,7 @@ import (
 	"errors"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/roll/roll/mocks"
 	"github.com/xtraclabs/rollsecrets/secrets"
@@ -44,7 +45,7 @@ func TestInputParamsValid(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -58,18 +59,19 @@ func TestInputParamsValid(t *testing.T) {
 	assert.NotNil(t, app)
 }
 
-func TestInputParamsInvalidResponseType(t *testing.T) {
-	req, _ := http.NewRequest("POST", "/?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=bad", nil)
-	app, err := validateInputParams(nil, req)
-	assert.Nil(t, app)
+func TestGetResponseType(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/?response_type=bad", nil)
+	_, err := getResponseType(req)
 	assert.NotNil(t, err)
-}
 
-func TestInputParamsMissingResponseType(t *testing.T) {
-	req, _ := http.NewRequest("POST", "/?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab", nil)
-	app, err := validateInputParams(nil, req)
-	assert.Nil(t, app)
+	req, _ = http.NewRequest("POST", "/", nil)
+	_, err = getResponseType(req)
 	assert.NotNil(t, err)
+
+	req, _ = http.NewRequest("POST", "/?response_type=code", nil)
+	responseType, err := getResponseType(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "code", responseType)
 }
 
 func TestInputParamsMissingClientID(t *testing.T) {
@@ -105,7 +107,7 @@ func TestInputParamsInvalidRedirectURI(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -119,6 +121,51 @@ func TestInputParamsInvalidRedirectURI(t *testing.T) {
 
 }
 
+func TestInputParamsSecondRedirectURI(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		ClientSecret:    "not for browser clients",
+		RedirectURIs:    "http://localhost:3000/ab https://test.fightclub.com/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	req, _ := http.NewRequest("POST", "/?client_id=1111-2222-3333333-4444444&redirect_uri=https://test.fightclub.com/ab&response_type=token", nil)
+	app, err := validateInputParams(core, req)
+	assert.Nil(t, err)
+	assert.NotNil(t, app)
+}
+
+func TestRedirectURIFromForm(t *testing.T) {
+	app := &roll.Application{
+		RedirectURIs: "http://localhost:3000/ab",
+	}
+
+	req, _ := http.NewRequest("POST", "/", nil)
+	redirectURI, err := redirectURIFromForm(req, app)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:3000/ab", redirectURI)
+
+	app.RedirectURIs = "http://localhost:3000/ab https://test.fightclub.com/ab"
+	_, err = redirectURIFromForm(req, app)
+	assert.Equal(t, ErrRedirectURIMismatch, err)
+
+	req, _ = http.NewRequest("POST", "/?redirect_uri=https://test.fightclub.com/ab", nil)
+	redirectURI, err = redirectURIFromForm(req, app)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://test.fightclub.com/ab", redirectURI)
+
+	req, _ = http.NewRequest("POST", "/?redirect_uri=https://evil.com/ab", nil)
+	_, err = redirectURIFromForm(req, app)
+	assert.Equal(t, ErrRedirectURIMismatch, err)
+}
+
 func TestExecuteAuthTemplateForCode(t *testing.T) {
 	w := httptest.NewRecorder()
 	pageCtx := &authPageContext{
@@ -194,7 +241,7 @@ func TestAuthValidateMissingParams(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -220,7 +267,7 @@ func TestAuthValidateBadResponseType(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -242,6 +289,7 @@ func TestAuthValidateBadResponseType(t *testing.T) {
 func TestAuthValidateCodeResponseAuthenticateOk(t *testing.T) {
 
 	core, coreConfig := NewTestCore()
+	consentRepoMock := setupConsentRecording(coreConfig)
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -252,6 +300,9 @@ func TestAuthValidateCodeResponseAuthenticateOk(t *testing.T) {
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
 	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("StoreAuthCode", mock.Anything).Return(nil)
+
 	var loginCalled = false
 	ls := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		loginCalled = true
@@ -271,6 +322,7 @@ func TestAuthValidateCodeResponseAuthenticateOk(t *testing.T) {
 		scope, ok := token.Claims["scope"].(string)
 		assert.True(t, ok)
 		assert.Equal(t, "xtAuthCode", scope)
+		assert.Equal(t, "af0ifjsldkj", r.FormValue("state"))
 	}))
 	defer ts.Close()
 
@@ -281,27 +333,33 @@ func TestAuthValidateCodeResponseAuthenticateOk(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL,
+		RedirectURIs:    ts.URL,
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
 	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
 	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
 
-	_, err = http.PostForm(addr+"/oauth2/validate",
+	_, err = postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
 			"response_type": {"code"},
+			"state":         {"af0ifjsldkj"},
 			"client_id":     {"1111-2222-3333333-4444444"}})
 	assert.Nil(t, err)
 	assert.True(t, callbackInvoked)
 	assert.True(t, loginCalled)
+
+	consentRepoMock.AssertCalled(t, "StoreConsent", mock.MatchedBy(func(c *roll.Consent) bool {
+		return c.Subject == "x" && c.ClientID == "1111-2222-3333333-4444444"
+	}))
 }
 
 func TestAuthValidateCodeResponseAuthenticateAdminScopeOk(t *testing.T) {
 
 	core, coreConfig := NewTestCore()
+	setupConsentRecording(coreConfig)
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -312,6 +370,9 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeOk(t *testing.T) {
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
 	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("StoreAuthCode", mock.Anything).Return(nil)
+
 	var loginCalled = false
 	ls := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		loginCalled = true
@@ -339,7 +400,8 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeOk(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL,
+		RedirectURIs:    ts.URL,
+		AllowedScopes:   "admin",
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
@@ -349,7 +411,7 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeOk(t *testing.T) {
 	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
 	adminRepoMock.On("IsAdmin", "x").Return(true, nil)
 
-	_, err = http.PostForm(addr+"/oauth2/validate",
+	_, err = postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
@@ -376,7 +438,8 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeDenied(t *testing.T) {
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		callbackInvoked = true
-		assert.True(t, strings.Contains(r.RequestURI, "error=access_denied&error_description=scope-problem"))
+		assert.Equal(t, "invalid_scope", r.URL.Query().Get("error"))
+		assert.Equal(t, ErrScopeNotAllowed.Error(), r.URL.Query().Get("error_description"))
 	}))
 	defer ts.Close()
 
@@ -391,7 +454,8 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeDenied(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL + "/foo",
+		RedirectURIs:    ts.URL + "/foo",
+		AllowedScopes:   "admin",
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
@@ -401,13 +465,14 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeDenied(t *testing.T) {
 	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
 	adminRepoMock.On("IsAdmin", "x").Return(false, nil)
 
-	privateKey, _, err := secrets.GenerateKeyPair()
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
 	assert.Nil(t, err)
 
 	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
-	_, err = http.PostForm(addr+"/oauth2/validate",
+	_, err = postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
@@ -416,6 +481,7 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeDenied(t *testing.T) {
 			"client_id":     {"1111-2222-3333333-4444444"}})
 	assert.Nil(t, err)
 	assert.True(t, callbackInvoked)
+	assert.True(t, loginCalled)
 }
 
 func TestAuthValidateCodeResponseAuthenticateAdminScopeError(t *testing.T) {
@@ -433,7 +499,7 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeError(t *testing.T) {
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		callbackInvoked = true
-		assert.True(t, strings.Contains(r.RequestURI, "error=server_error&error_description="))
+		assert.Equal(t, "server_error", r.URL.Query().Get("error"))
 	}))
 	defer ts.Close()
 
@@ -448,7 +514,8 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeError(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL + "/foo",
+		RedirectURIs:    ts.URL + "/foo",
+		AllowedScopes:   "admin",
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
@@ -458,13 +525,14 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeError(t *testing.T) {
 	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
 	adminRepoMock.On("IsAdmin", "x").Return(false, errors.New("BOOM!"))
 
-	privateKey, _, err := secrets.GenerateKeyPair()
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
 	assert.Nil(t, err)
 
 	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
-	_, err = http.PostForm(addr+"/oauth2/validate",
+	_, err = postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
@@ -473,4 +541,69 @@ func TestAuthValidateCodeResponseAuthenticateAdminScopeError(t *testing.T) {
 			"client_id":     {"1111-2222-3333333-4444444"}})
 	assert.Nil(t, err)
 	assert.True(t, callbackInvoked)
+	assert.True(t, loginCalled)
+}
+
+func TestAuthValidateUnregisteredRedirectURI(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		ClientSecret:    "not for browser clients",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	resp, err := http.PostForm(addr+"/oauth2/validate",
+		url.Values{"username": {"x"},
+			"password":      {"y"},
+			"authorize":     {"allow"},
+			"response_type": {"code"},
+			"redirect_uri":  {"http://evil.com/ab"},
+			"client_id":     {"1111-2222-3333333-4444444"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAuthorizeResponseTypeNotAllowed(t *testing.T) {
+	var cases = []struct {
+		grantTypes, responseTypes string
+	}{
+		{"", "token"},
+		{"client_credentials", ""},
+	}
+
+	for _, c := range cases {
+		core, coreConfig := NewTestCore()
+
+		appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+		appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+			ClientID:        "1111-2222-3333333-4444444",
+			ApplicationName: "fight club",
+			RedirectURIs:    "http://localhost:3000/ab",
+			LoginProvider:   "xtrac://localhost:9000",
+			GrantTypes:      c.grantTypes,
+			ResponseTypes:   c.responseTypes,
+		}, nil)
+
+		w := authorizeRequest(core, url.Values{
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"response_type": {"code"},
+			"state":         {"xyz"},
+		})
+		assert.Equal(t, http.StatusFound, w.Code)
+		redirect, err := url.Parse(w.Header().Get("Location"))
+		if assert.Nil(t, err) {
+			assert.Equal(t, oauth2UnauthorizedClient, redirect.Query().Get("error"))
+			assert.Equal(t, "xyz", redirect.Query().Get("state"))
+		}
+	}
 }
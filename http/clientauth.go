@@ -0,0 +1,269 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	//clientAuthNone identifies public clients, which present only their client id
+	clientAuthNone = "none"
+
+	clientAssertionTypeJWT = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	//Client assertions are meant to be used once, right after they are created, so long lived assertions
+	//are refused
+	clientAssertionMaxLifetime = 10 * time.Minute
+)
+
+var (
+	//ErrMultipleClientAuthMethods is returned when a request uses more than one client authentication method
+	ErrMultipleClientAuthMethods = errors.New("Request must use only one client authentication method")
+
+	//ErrClientIDMismatch is returned when the client_id param names a different client than the credentials
+	ErrClientIDMismatch = errors.New("client_id does not match the client credentials")
+
+	//ErrUnsupportedClientAssertionType is returned for client assertions other than JWTs
+	ErrUnsupportedClientAssertionType = errors.New("Unsupported client_assertion_type")
+)
+
+//clientCredentials are the credentials a client presented to authenticate itself, using one of
+//client_secret_basic, client_secret_post, private_key_jwt, or none for public clients
+type clientCredentials struct {
+	method       string
+	clientID     string
+	clientSecret string
+	assertion    string
+
+	//endpoint is the URL the request was made to, which a client assertion must name as its audience
+	endpoint string
+}
+
+//clientCredentialsFromRequest extracts the client credentials from the Authorization header or form
+//params of the request
+func clientCredentialsFromRequest(core *roll.Core, r *http.Request) (*clientCredentials, error) {
+	creds := &clientCredentials{
+		method:   clientAuthNone,
+		clientID: r.FormValue("client_id"),
+		endpoint: issuerURL(core) + r.URL.Path,
+	}
+
+	methods := 0
+
+	//The client id and secret are form encoded before being base64 encoded - see RFC 6749 section 2.3.1
+	if basicID, basicSecret, ok := r.BasicAuth(); ok {
+		methods++
+
+		clientID, err := url.QueryUnescape(basicID)
+		if err != nil {
+			return nil, err
+		}
+
+		clientSecret, err := url.QueryUnescape(basicSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		if creds.clientID != "" && creds.clientID != clientID {
+			return nil, ErrClientIDMismatch
+		}
+
+		creds.method = roll.ClientSecretBasic
+		creds.clientID = clientID
+		creds.clientSecret = clientSecret
+	}
+
+	if clientSecret := r.FormValue("client_secret"); clientSecret != "" {
+		methods++
+		creds.method = roll.ClientSecretPost
+		creds.clientSecret = clientSecret
+	}
+
+	if assertion := r.FormValue("client_assertion"); assertion != "" {
+		methods++
+
+		if r.FormValue("client_assertion_type") != clientAssertionTypeJWT {
+			return nil, ErrUnsupportedClientAssertionType
+		}
+
+		//The client id is optional with an assertion, as the assertion subject identifies the client.
+		//The subject is checked against the client id once the assertion is verified.
+		subject := unverifiedAssertionSubject(assertion)
+		if creds.clientID != "" && creds.clientID != subject {
+			return nil, ErrClientIDMismatch
+		}
+
+		creds.method = roll.PrivateKeyJWT
+		creds.clientID = subject
+		creds.assertion = assertion
+	}
+
+	if methods > 1 {
+		return nil, ErrMultipleClientAuthMethods
+	}
+
+	return creds, nil
+}
+
+//unverifiedAssertionSubject returns the sub claim of a JWT without verifying the JWT
+func unverifiedAssertionSubject(assertion string) string {
+	subject, _ := unverifiedClaims(assertion)["sub"].(string)
+	return subject
+}
+
+//unverifiedClaims returns the claims of a JWT without verifying the JWT, or nil if the JWT is malformed
+func unverifiedClaims(assertion string) map[string]interface{} {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	claimBytes, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(claimBytes, &claims); err != nil {
+		return nil
+	}
+
+	return claims
+}
+
+//present is true if the client presented a secret or an assertion
+func (creds *clientCredentials) present() bool {
+	return creds.method != clientAuthNone
+}
+
+//authenticateClient returns the application identified by the client credentials if the credentials
+//are valid, and the application allows the authentication method used. Public clients may present
+//only their client id if allowPublic is true. ErrInvalidClientDetails is returned if the client cannot
+//be authenticated.
+func authenticateClient(core *roll.Core, creds *clientCredentials, allowPublic bool) (*roll.Application, error) {
+	app, err := lookupApplication(core, creds.clientID)
+	if err != nil {
+		log.Info("error looking up application")
+		return nil, err
+	}
+
+	switch creds.method {
+	case clientAuthNone:
+		if !allowPublic || !app.PublicClient {
+			log.Info("client credentials missing for ", app.ClientID)
+			return nil, ErrInvalidClientDetails
+		}
+
+		return app, nil
+	case roll.ClientSecretBasic, roll.ClientSecretPost:
+		if subtle.ConstantTimeCompare([]byte(app.ClientSecret), []byte(creds.clientSecret)) != 1 {
+			log.Info("error validating client secret for ", app.ClientID)
+			return nil, ErrInvalidClientDetails
+		}
+	case roll.PrivateKeyJWT:
+		assertion, err := verifyClientAssertion(app, creds)
+		if err != nil {
+			log.Info("error validating client assertion for ", app.ClientID, ": ", err.Error())
+			return nil, ErrInvalidClientDetails
+		}
+
+		if err := recordClientAssertionUse(core, app, assertion); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidClientDetails
+	}
+
+	if !app.AllowsClientAuthMethod(creds.method) {
+		log.Info("client authentication method ", creds.method, " not allowed for ", app.ClientID)
+		return nil, ErrInvalidClientDetails
+	}
+
+	return app, nil
+}
+
+//verifyClientAssertion checks a private_key_jwt client assertion is signed with the key registered for the
+//application, and that the issuer, subject, audience, expiry and jti are as required by RFC 7523 section 3
+func verifyClientAssertion(app *roll.Application, creds *clientCredentials) (*jwt.Token, error) {
+	if app.ClientAssertionPublicKey == "" {
+		return nil, errors.New("No client assertion key registered")
+	}
+
+	token, err := jwt.Parse(creds.assertion, func(token *jwt.Token) (interface{}, error) {
+		return signing.VerificationKey(token, app.ClientAssertionPublicKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("Invalid client assertion")
+	}
+
+	if token.Claims["iss"] != app.ClientID || token.Claims["sub"] != app.ClientID {
+		return nil, errors.New("Client assertion iss and sub must be the client id")
+	}
+
+	if !audienceIncludes(token.Claims["aud"], creds.endpoint) {
+		return nil, errors.New("Client assertion audience must be " + creds.endpoint)
+	}
+
+	exp, ok := token.Claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("Client assertion has no exp claim")
+	}
+
+	if time.Unix(int64(exp), 0).After(time.Now().Add(clientAssertionMaxLifetime)) {
+		return nil, errors.New("Client assertion expiry too far in the future")
+	}
+
+	if tokenID, _ := token.Claims["jti"].(string); tokenID == "" {
+		return nil, ErrAssertionMissingID
+	}
+
+	return token, nil
+}
+
+//recordClientAssertionUse records the use of a verified client assertion, so it cannot be replayed to
+//authenticate as the client - see RFC 7523 section 3
+func recordClientAssertionUse(core *roll.Core, app *roll.Application, assertion *jwt.Token) error {
+	tokenID, _ := assertion.Claims["jti"].(string)
+
+	//The assertion is accepted until it expires, so its use must be remembered until then
+	err := core.RecordAssertionUse(app.ClientID, tokenID, int64Claim(assertion.Claims, "exp"))
+	switch err.(type) {
+	case nil:
+		return nil
+	case roll.AssertionReplayError:
+		log.Info("client assertion ", tokenID, " for ", app.ClientID, " already used")
+		return ErrInvalidClientDetails
+	default:
+		log.Info("error recording client assertion use: ", err.Error())
+		return ErrRetrievingAppData
+	}
+}
+
+//audienceIncludes is true if the aud claim, which may be a single value or an array, includes the audience
+func audienceIncludes(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,355 @@
+package http
+
+import (
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/roll/signing"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+//setupClientAuthTestApp registers an app allowing the given client authentication methods, returning the
+//private key the app signs its client assertions with
+func setupClientAuthTestApp(t *testing.T, coreConfig *roll.CoreConfig, authMethods string) string {
+	return setupClientAuthTestAppWithAlg(t, coreConfig, authMethods, signing.RS256)
+}
+
+//setupClientAuthTestAppWithAlg is setupClientAuthTestApp with a client assertion key for the given algorithm
+func setupClientAuthTestAppWithAlg(t *testing.T, coreConfig *roll.CoreConfig, authMethods, alg string) string {
+	assertionPrivateKey, assertionPublicKey, err := signing.GenerateKeyPair(alg)
+	assert.Nil(t, err)
+
+	returnVal := roll.Application{
+		DeveloperEmail:           "doug@dev.com",
+		ClientID:                 "1111-2222-3333333-4444444",
+		ApplicationName:          "batch job",
+		ClientSecret:             "not for browser clients",
+		RedirectURIs:             "http://localhost:3000/ab",
+		LoginProvider:            "xtrac://localhost:9000",
+		TokenEndpointAuthMethods: authMethods,
+		ClientAssertionPublicKey: assertionPublicKey,
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	replayRepoMock := coreConfig.AssertionReplayRepo.(*mocks.AssertionReplayRepo)
+	replayRepoMock.On("RecordAssertionUse", "1111-2222-3333333-4444444", mock.Anything, mock.Anything).Return(nil)
+
+	return assertionPrivateKey
+}
+
+//clientAssertion signs the claims with the private key, using the method for the type of key
+func clientAssertion(t *testing.T, privateKeyPEM string, claims map[string]interface{}) string {
+	privateKey, err := signing.ParsePrivateKeyPEM(privateKeyPEM)
+	assert.Nil(t, err)
+
+	method, err := signing.MethodForKey(privateKey.Public())
+	assert.Nil(t, err)
+
+	token := jwt.New(method)
+	for k, v := range claims {
+		token.Claims[k] = v
+	}
+
+	assertion, err := token.SignedString(privateKey)
+	assert.Nil(t, err)
+	return assertion
+}
+
+func assertionClaims(addr string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": "1111-2222-3333333-4444444",
+		"sub": "1111-2222-3333333-4444444",
+		"aud": addr + OAuth2TokenBaseURI,
+		"jti": "assertion-1",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func postTokenRequest(t *testing.T, addr string, form url.Values, clientID, clientSecret string) *http.Response {
+	req, err := http.NewRequest("POST", addr+OAuth2TokenBaseURI, strings.NewReader(form.Encode()))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestClientSecretBasic(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientAuthTestApp(t, coreConfig, "")
+
+	resp := postTokenRequest(t, addr, url.Values{"grant_type": {"client_credentials"}},
+		"1111-2222-3333333-4444444", "not for browser clients")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", jsonResponse.AccessToken)
+}
+
+func TestClientSecretBasicInvalidSecret(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientAuthTestApp(t, coreConfig, "")
+
+	resp := postTokenRequest(t, addr, url.Values{"grant_type": {"client_credentials"}},
+		"1111-2222-3333333-4444444", "guessing")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrInvalidClientDetails.Error()))
+}
+
+func TestClientSecretBasicClientIDMismatch(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientAuthTestApp(t, coreConfig, "")
+
+	resp := postTokenRequest(t, addr, url.Values{"grant_type": {"client_credentials"}, "client_id": {"another-app"}},
+		"1111-2222-3333333-4444444", "not for browser clients")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrClientIDMismatch.Error()))
+}
+
+func TestMultipleClientAuthMethods(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientAuthTestApp(t, coreConfig, "")
+
+	resp := postTokenRequest(t, addr, url.Values{"grant_type": {"client_credentials"},
+		"client_secret": {"not for browser clients"}},
+		"1111-2222-3333333-4444444", "not for browser clients")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrMultipleClientAuthMethods.Error()))
+}
+
+func TestClientAuthMethodNotAllowed(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientAuthTestApp(t, coreConfig, roll.ClientSecretBasic)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrInvalidClientDetails.Error()))
+}
+
+func TestPrivateKeyJWT(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	assertionKey := setupClientAuthTestApp(t, coreConfig, roll.PrivateKeyJWT)
+
+	//The client id is optional as the assertion identifies the client
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_assertion_type": {clientAssertionTypeJWT},
+			"client_assertion":      {clientAssertion(t, assertionKey, assertionClaims(addr))}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPrivateKeyJWTECAndEd25519Keys(t *testing.T) {
+	for _, alg := range []string{signing.ES256, signing.ES384, signing.EdDSA} {
+		core, coreConfig := NewTestCore()
+		ln, addr := TestServer(t, core)
+
+		assertionKey := setupClientAuthTestAppWithAlg(t, coreConfig, roll.PrivateKeyJWT, alg)
+
+		resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+			url.Values{"grant_type": {"client_credentials"},
+				"client_assertion_type": {clientAssertionTypeJWT},
+				"client_assertion":      {clientAssertion(t, assertionKey, assertionClaims(addr))}})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, alg)
+
+		//An assertion signed with a key of another type is rejected
+		otherKey, _, err := signing.GenerateKeyPair(signing.RS256)
+		assert.Nil(t, err)
+
+		resp, err = http.PostForm(addr+OAuth2TokenBaseURI,
+			url.Values{"grant_type": {"client_credentials"},
+				"client_assertion_type": {clientAssertionTypeJWT},
+				"client_assertion":      {clientAssertion(t, otherKey, assertionClaims(addr))}})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, alg)
+
+		ln.Close()
+	}
+}
+
+func TestPrivateKeyJWTNotAllowed(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	assertionKey := setupClientAuthTestApp(t, coreConfig, "")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":             {"1111-2222-3333333-4444444"},
+			"client_assertion_type": {clientAssertionTypeJWT},
+			"client_assertion":      {clientAssertion(t, assertionKey, assertionClaims(addr))}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestPrivateKeyJWTInvalidAssertions(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	assertionKey := setupClientAuthTestApp(t, coreConfig, roll.PrivateKeyJWT)
+	otherKey, _, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	wrongAudience := assertionClaims(addr)
+	wrongAudience["aud"] = "http://elsewhere/oauth2/token"
+
+	wrongIssuer := assertionClaims(addr)
+	wrongIssuer["iss"] = "someone-else"
+
+	noExpiry := assertionClaims(addr)
+	delete(noExpiry, "exp")
+
+	longLived := assertionClaims(addr)
+	longLived["exp"] = time.Now().Add(time.Hour).Unix()
+
+	expired := assertionClaims(addr)
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+
+	noID := assertionClaims(addr)
+	delete(noID, "jti")
+
+	assertions := []string{
+		clientAssertion(t, otherKey, assertionClaims(addr)),
+		clientAssertion(t, assertionKey, wrongAudience),
+		clientAssertion(t, assertionKey, wrongIssuer),
+		clientAssertion(t, assertionKey, noExpiry),
+		clientAssertion(t, assertionKey, longLived),
+		clientAssertion(t, assertionKey, expired),
+		clientAssertion(t, assertionKey, noID),
+	}
+
+	for _, assertion := range assertions {
+		resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+			url.Values{"grant_type": {"client_credentials"},
+				"client_id":             {"1111-2222-3333333-4444444"},
+				"client_assertion_type": {clientAssertionTypeJWT},
+				"client_assertion":      {assertion}})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestPrivateKeyJWTReplayed(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	replayRepoMock := coreConfig.AssertionReplayRepo.(*mocks.AssertionReplayRepo)
+	replayRepoMock.On("RecordAssertionUse", "1111-2222-3333333-4444444", "assertion-1", mock.Anything).Return(nil).Once()
+	replayRepoMock.On("RecordAssertionUse", "1111-2222-3333333-4444444", "assertion-1", mock.Anything).Return(roll.AssertionReplayError{})
+
+	assertionKey := setupClientAuthTestApp(t, coreConfig, roll.PrivateKeyJWT)
+	form := url.Values{"grant_type": {"client_credentials"},
+		"client_assertion_type": {clientAssertionTypeJWT},
+		"client_assertion":      {clientAssertion(t, assertionKey, assertionClaims(addr))}}
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	replayRepoMock.AssertExpectations(t)
+}
+
+func TestPrivateKeyJWTAudienceArray(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	assertionKey := setupClientAuthTestApp(t, coreConfig, roll.PrivateKeyJWT)
+
+	claims := assertionClaims(addr)
+	claims["aud"] = []string{"http://elsewhere", addr + OAuth2TokenBaseURI}
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_assertion_type": {clientAssertionTypeJWT},
+			"client_assertion":      {clientAssertion(t, assertionKey, claims)}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestUnsupportedClientAssertionType(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":             {"1111-2222-3333333-4444444"},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:saml2-bearer"},
+			"client_assertion":      {"x"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrUnsupportedClientAssertionType.Error()))
+}
+
+func TestIntrospectWithClientSecretBasic(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientAuthTestApp(t, coreConfig, "")
+
+	req, err := http.NewRequest("POST", addr+IntrospectURI, strings.NewReader(url.Values{"token": {"not-a-token"}}.Encode()))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("1111-2222-3333333-4444444", url.QueryEscape("not for browser clients"))
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "not-a-token").Return(nil, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
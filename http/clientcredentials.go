@@ -0,0 +1,53 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"strings"
+)
+
+var (
+	//ErrScopeNotAllowed is returned when a client asks for scope the application is not allowed
+	ErrScopeNotAllowed = errors.New("Requested scope not allowed for application")
+)
+
+//handleClientCredentialsGrantType issues tokens to applications acting on their own behalf. There
+//is no end user, so the token subject is the client ID. The scope that may be requested is limited to
+//the allowed scopes in the application definition. No refresh token is issued as the client can
+//simply authenticate again.
+func handleClientCredentialsGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
+	app, err := validateClientDetails(core, codeContext)
+	if err != nil {
+		respondClientAuthError(w, err)
+
+		return
+	}
+
+	if err := validateRequestedScope(core, app, codeContext.scope); err != nil {
+		respondScopeError(w, err)
+		return
+	}
+
+	//Admin scope additionally requires the client itself be registered as an admin
+	for _, s := range strings.Fields(codeContext.scope) {
+		if s != adminScope {
+			continue
+		}
+
+		isAdmin, err := grantAdminScope(core, app.ClientID)
+		if err != nil {
+			log.Info("Error checking admin status of client: ", err.Error())
+			respondServerError(w, err)
+			return
+		}
+
+		if !isAdmin {
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, ErrScopeNotAllowed)
+			return
+		}
+	}
+
+	generateAndRespondWithAccessToken(core, app.ClientID, codeContext.scope, codeContext.resources, app, w)
+}
@@ -0,0 +1,190 @@
+package http
+
+import (
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	rolltoken "github.com/xtraclabs/rollsecrets/token"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func setupClientCredentialsTestApp(t *testing.T, coreConfig *roll.CoreConfig, allowedScopes string) {
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "batch job",
+		ClientSecret:    "not for browser clients",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		AllowedScopes:   allowedScopes,
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+}
+
+func TestClientCredentialsMissingClientSecret(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id": {"1111-2222-3333333-4444444"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Basic realm="roll", error="invalid_client"`, resp.Header.Get("WWW-Authenticate"))
+
+	errResp := readOAuth2Error(t, resp)
+	assert.Equal(t, "invalid_client", errResp.Error)
+	assert.Equal(t, "client_secret missing from request", errResp.ErrorDescription)
+}
+
+func TestClientCredentialsInvalidSecret(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"guessing"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, ErrInvalidClientDetails.Error()))
+}
+
+func TestClientCredentialsOk(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body := responseAsString(t, resp)
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(body), &jsonResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", jsonResponse.TokenType)
+	assert.Equal(t, "", jsonResponse.RefreshToken)
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	assert.Nil(t, err)
+	assert.Equal(t, "1111-2222-3333333-4444444", token.Claims["sub"].(string))
+	assert.Equal(t, "1111-2222-3333333-4444444", token.Claims["aud"].(string))
+}
+
+func TestClientCredentialsScopeNotAllowed(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"scope":         {"admin"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, ErrScopeNotAllowed.Error()))
+}
+
+func TestClientCredentialsGrantTypeNotAllowed(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "batch job",
+		ClientSecret:    "not for browser clients",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		GrantTypes:      "authorization_code refresh_token",
+	}, nil)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, oauth2UnauthorizedClient))
+	assert.True(t, strings.Contains(body, ErrGrantTypeNotAllowed.Error()))
+}
+
+func TestClientCredentialsAdminScopeClientNotAdmin(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "admin")
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "1111-2222-3333333-4444444").Return(false, nil)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"scope":         {"admin"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestClientCredentialsAdminScopeOk(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "admin")
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "1111-2222-3333333-4444444").Return(true, nil)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"scope":         {"admin"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body := responseAsString(t, resp)
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(body), &jsonResponse)
+	assert.Nil(t, err)
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", token.Claims["scope"].(string))
+}
@@ -0,0 +1,205 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/authzwrapper"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//ConsentsURI is the base uri for users to manage the consent they have given applications - the client
+	//id of the application follows the base uri
+	ConsentsURI = "/v1/consents/"
+
+	//loginSessionCookie holds the user's sign in at an application, which allows the authorize page to be
+	//skipped when the user has already consented to a request
+	loginSessionCookie   = "roll_session"
+	loginSessionClaim    = "login_session"
+	loginSessionLifetime = 8 * time.Hour
+)
+
+//newLoginSession returns a login session for the subject, signed with the application's key. The session's
+//typ header marks it as a login session, so it is rejected wherever an access token is expected.
+func newLoginSession(core *roll.Core, subject string, app *roll.Application, userClaims map[string]interface{}) (string, error) {
+	privateKey, err := core.RetrievePrivateKeyForApp(app.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{
+		"sub":             subject,
+		"aud":             app.ClientID,
+		"iat":             time.Now().Unix(),
+		"exp":             time.Now().Add(loginSessionLifetime).Unix(),
+		loginSessionClaim: true,
+	}
+
+	if userClaims != nil {
+		claims[userInfoClaim] = userClaims
+	}
+
+	return signTypedToken(claims, privateKey, authzwrapper.LoginSessionTokenType)
+}
+
+//setLoginSessionCookie signs the user in to the application for the lifetime of a login session
+func setLoginSessionCookie(core *roll.Core, w http.ResponseWriter, r *http.Request, subject string, app *roll.Application, userClaims map[string]interface{}) error {
+	session, err := newLoginSession(core, subject, app, userClaims)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginSessionCookie,
+		Value:    session,
+		Path:     "/oauth2/",
+		Expires:  time.Now().Add(loginSessionLifetime),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+	})
+
+	return nil
+}
+
+//loginSessionFromRequest returns the subject and user claims of the user signed in to the application, or
+//an empty subject if there is no valid login session for the application
+func loginSessionFromRequest(core *roll.Core, r *http.Request, app *roll.Application) (string, map[string]interface{}) {
+	cookie, err := r.Cookie(loginSessionCookie)
+	if err != nil {
+		return "", nil
+	}
+
+	token, err := jwt.Parse(cookie.Value, keyExtractionFunction(core))
+	if err != nil || !token.Valid {
+		log.Info("Ignoring invalid login session")
+		return "", nil
+	}
+
+	if typ, _ := token.Header["typ"].(string); typ != authzwrapper.LoginSessionTokenType {
+		return "", nil
+	}
+
+	if isSession, _ := token.Claims[loginSessionClaim].(bool); !isSession {
+		return "", nil
+	}
+
+	if aud, _ := token.Claims["aud"].(string); aud != app.ClientID {
+		return "", nil
+	}
+
+	subject, _ := token.Claims["sub"].(string)
+	userClaims, _ := token.Claims[userInfoClaim].(map[string]interface{})
+	return subject, userClaims
+}
+
+//consentCovers is true if the subject has already consented to the application requesting the scope
+func consentCovers(core *roll.Core, subject string, app *roll.Application, scope string) (bool, error) {
+	consent, err := core.RetrieveConsent(subject, app.ClientID)
+	if err != nil {
+		return false, err
+	}
+
+	return consent != nil && consent.Covers(scope), nil
+}
+
+//recordConsent adds the scope to the consent the subject has given the application
+func recordConsent(core *roll.Core, subject string, app *roll.Application, scope string) error {
+	consent, err := core.RetrieveConsent(subject, app.ClientID)
+	if err != nil {
+		return err
+	}
+
+	if consent == nil {
+		consent = &roll.Consent{Subject: subject, ClientID: app.ClientID}
+	}
+
+	consent.AddScope(scope)
+	consent.GrantedAt = time.Now().Unix()
+
+	return core.StoreConsent(consent)
+}
+
+func handleConsents(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleConsentsGet(core, w, r)
+		case "DELETE":
+			handleConsentsDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func handleConsentsGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	subject, _, err := subjectAndAdminScopeFromRequestCtx(r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	consents, err := core.ListConsents(subject)
+	if err != nil {
+		log.Info("Error listing consents: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if consents == nil {
+		consents = []roll.Consent{}
+	}
+
+	respondOk(w, consents)
+}
+
+//handleConsentsDelete revokes the consent the user has given an application, along with the refresh tokens
+//issued to the application on the user's behalf
+func handleConsentsDelete(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	subject, _, err := subjectAndAdminScopeFromRequestCtx(r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	clientID := strings.TrimPrefix(r.URL.Path, ConsentsURI)
+	if clientID == "" {
+		respondError(w, http.StatusBadRequest, errors.New("Resource not specified"))
+		return
+	}
+
+	consent, err := core.RetrieveConsent(subject, clientID)
+	if err != nil {
+		log.Info("Error retrieving consent: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if consent == nil {
+		respondNotFound(w)
+		return
+	}
+
+	if err := core.RevokeSubjectRefreshTokens(subject, clientID); err != nil {
+		log.Info("Error revoking refresh tokens: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := core.DeleteConsent(subject, clientID); err != nil {
+		switch err.(type) {
+		case roll.NoSuchConsentError:
+			respondNotFound(w)
+		default:
+			log.Info("Error deleting consent: ", err.Error())
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	respondOk(w, nil)
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+//setupConsentRecording allows tests that complete an authorization to record consent
+func setupConsentRecording(coreConfig *roll.CoreConfig) *mocks.ConsentRepo {
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("RetrieveConsent", mock.Anything, mock.Anything).Return(nil, nil)
+	consentRepoMock.On("StoreConsent", mock.AnythingOfType("*roll.Consent")).Return(nil)
+	return consentRepoMock
+}
+
+func TestRecordConsentAddsScope(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("RetrieveConsent", "a-subject", "1111-2222-3333333-4444444").Return(&roll.Consent{
+		Subject:  "a-subject",
+		ClientID: "1111-2222-3333333-4444444",
+		Scope:    "openid",
+	}, nil)
+	consentRepoMock.On("StoreConsent", mock.AnythingOfType("*roll.Consent")).Return(nil)
+
+	err := recordConsent(core, "a-subject", &roll.Application{ClientID: "1111-2222-3333333-4444444"}, "admin")
+	assert.Nil(t, err)
+
+	stored := consentRepoMock.Calls[1].Arguments.Get(0).(*roll.Consent)
+	assert.Equal(t, "openid admin", stored.Scope)
+	assert.True(t, stored.GrantedAt > 0)
+}
+
+func TestLoginSessionRoundTrip(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupPKCETestApp(t, coreConfig, false)
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	session, err := newLoginSession(core, "a-subject", app, map[string]interface{}{"name": "A Subject"})
+	assert.Nil(t, err)
+
+	r, _ := http.NewRequest("GET", "/oauth2/authorize", nil)
+	r.AddCookie(&http.Cookie{Name: loginSessionCookie, Value: session})
+
+	subject, userClaims := loginSessionFromRequest(core, r, app)
+	assert.Equal(t, "a-subject", subject)
+	assert.Equal(t, "A Subject", userClaims["name"])
+
+	//A session for one application does not sign the user in to another
+	subject, _ = loginSessionFromRequest(core, r, &roll.Application{ClientID: "another-client"})
+	assert.Equal(t, "", subject)
+
+	//Sessions are marked by their typ header as well as their claims
+	privateKey, err := core.RetrievePrivateKeyForApp(app.ClientID)
+	assert.Nil(t, err)
+
+	untyped, err := signToken(map[string]interface{}{
+		"sub":             "a-subject",
+		"aud":             app.ClientID,
+		"exp":             time.Now().Add(time.Minute).Unix(),
+		loginSessionClaim: true,
+	}, privateKey)
+	assert.Nil(t, err)
+
+	r, _ = http.NewRequest("GET", "/oauth2/authorize", nil)
+	r.AddCookie(&http.Cookie{Name: loginSessionCookie, Value: untyped})
+	subject, _ = loginSessionFromRequest(core, r, app)
+	assert.Equal(t, "", subject)
+}
+
+func TestAuthorizeSkipsPageWithConsent(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("RetrieveConsent", "a-subject", "1111-2222-3333333-4444444").Return(&roll.Consent{
+		Subject:  "a-subject",
+		ClientID: "1111-2222-3333333-4444444",
+		Scope:    "openid",
+	}, nil)
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("StoreAuthCode", mock.AnythingOfType("*roll.AuthCode")).Return(nil)
+
+	session, err := newLoginSession(core, "a-subject", &roll.Application{ClientID: "1111-2222-3333333-4444444"}, nil)
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest("GET", addr+"/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=code&scope=openid", nil)
+	assert.Nil(t, err)
+	req.AddCookie(&http.Cookie{Name: loginSessionCookie, Value: session})
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	redirect, err := url.Parse(resp.Header.Get("Location"))
+	if assert.Nil(t, err) {
+		assert.NotEqual(t, "", redirect.Query().Get("code"))
+	}
+}
+
+func TestAuthorizeShowsPageWithoutConsent(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("RetrieveConsent", "a-subject", "1111-2222-3333333-4444444").Return(&roll.Consent{
+		Subject:  "a-subject",
+		ClientID: "1111-2222-3333333-4444444",
+		Scope:    "openid",
+	}, nil)
+
+	session, err := newLoginSession(core, "a-subject", &roll.Application{ClientID: "1111-2222-3333333-4444444"}, nil)
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest("GET", addr+"/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=code&scope=openid+admin", nil)
+	assert.Nil(t, err)
+	req.AddCookie(&http.Cookie{Name: loginSessionCookie, Value: session})
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestConsentsList(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("ListConsents", "rolltest").Return([]roll.Consent{
+		{Subject: "rolltest", ClientID: "1111-2222-3333333-4444444", Scope: "openid"},
+	}, nil)
+
+	resp := TestHTTPGetWithRollSubject(t, addr+ConsentsURI, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var consents []roll.Consent
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &consents)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(consents)) {
+		assert.Equal(t, "1111-2222-3333333-4444444", consents[0].ClientID)
+	}
+}
+
+func TestConsentsDeleteRevokesRefreshTokens(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("RetrieveConsent", "rolltest", "1111-2222-3333333-4444444").Return(&roll.Consent{
+		Subject:  "rolltest",
+		ClientID: "1111-2222-3333333-4444444",
+	}, nil)
+	consentRepoMock.On("DeleteConsent", "rolltest", "1111-2222-3333333-4444444").Return(nil)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RevokeSubjectRefreshTokens", "rolltest", "1111-2222-3333333-4444444").Return(nil)
+
+	resp := TestHTTPDeleteWithRollSubject(t, addr+ConsentsURI+"1111-2222-3333333-4444444", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	refreshTokenRepoMock.AssertExpectations(t)
+	consentRepoMock.AssertExpectations(t)
+}
+
+func TestConsentsDeleteNotFound(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("RetrieveConsent", "rolltest", "1111-2222-3333333-4444444").Return(nil, nil)
+
+	resp := TestHTTPDeleteWithRollSubject(t, addr+ConsentsURI+"1111-2222-3333333-4444444", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestConsentsDeleteRevocationError(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	consentRepoMock := coreConfig.ConsentRepo.(*mocks.ConsentRepo)
+	consentRepoMock.On("RetrieveConsent", "rolltest", "1111-2222-3333333-4444444").Return(&roll.Consent{
+		Subject:  "rolltest",
+		ClientID: "1111-2222-3333333-4444444",
+	}, nil)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RevokeSubjectRefreshTokens", "rolltest", "1111-2222-3333333-4444444").Return(errors.New("boom"))
+
+	resp := TestHTTPDeleteWithRollSubject(t, addr+ConsentsURI+"1111-2222-3333333-4444444", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	consentRepoMock.AssertNotCalled(t, "DeleteConsent", "rolltest", "1111-2222-3333333-4444444")
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/authzwrapper"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	//csrfCookie binds the anti-forgery token on the authorize page to the browser the page was served to
+	csrfCookie = "roll_csrf"
+
+	csrfTokenParam    = "csrf_token"
+	csrfTokenClaim    = "csrf"
+	csrfRequestClaim  = "authz_req"
+	csrfBindingClaim  = "bnd"
+	csrfTokenLifetime = 10 * time.Minute
+)
+
+//ErrInvalidCSRFToken is returned when the authorize or device verification page form is posted without a valid
+//anti-forgery token
+var ErrInvalidCSRFToken = errors.New("Missing, expired or invalid csrf_token")
+
+//authorizeRequestParams are the authorize request parameters carried through the authorize page form
+var authorizeRequestParams = []string{
+	"client_id", "redirect_uri", "response_type", "scope", "state", "nonce", "code_challenge", "code_challenge_method",
+	"resource", "response_mode",
+}
+
+//authorizeRequestHash identifies an authorize request by hashing the parameters carried through the
+//authorize page form. Parameters the form omits hash the same as empty ones, and the resource parameter
+//may be repeated.
+func authorizeRequestHash(params url.Values) string {
+	values := url.Values{}
+	for _, p := range authorizeRequestParams {
+		if len(params[p]) > 0 {
+			values[p] = params[p]
+		} else {
+			values.Set(p, "")
+		}
+	}
+
+	return sha256Encoded(values.Encode())
+}
+
+//deviceRequestHash identifies the device authorization request approved with the device verification page
+//form by hashing its user code
+func deviceRequestHash(userCode string) string {
+	return sha256Encoded(url.Values{"user_code": {normalizeUserCode(userCode)}}.Encode())
+}
+
+func sha256Encoded(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+//authorizeRequestValues returns the authorize request parameters as they will be posted by the authorize page
+func (pageCtx *authPageContext) authorizeRequestValues(responseType string) url.Values {
+	var resources []string
+	for _, resource := range pageCtx.Resources {
+		resources = append(resources, resource.Identifier)
+	}
+
+	return url.Values{
+		"client_id":             {pageCtx.ClientID},
+		"redirect_uri":          {pageCtx.RedirectURI},
+		"response_type":         {responseType},
+		"scope":                 {pageCtx.Scope},
+		"state":                 {pageCtx.State},
+		"nonce":                 {pageCtx.Nonce},
+		"code_challenge":        {pageCtx.CodeChallenge},
+		"code_challenge_method": {pageCtx.CodeChallengeMethod},
+		"resource":              resources,
+		"response_mode":         {pageCtx.ResponseMode},
+	}
+}
+
+//csrfBinding returns the value of the browser's csrf cookie, setting the cookie if the browser does not
+//have one yet
+func csrfBinding(core *roll.Core, w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	binding, err := core.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    binding,
+		Path:     "/oauth2/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+	})
+
+	return binding, nil
+}
+
+//newCSRFToken returns a short lived token for the authorize page form, signed with the application's key.
+//The token is bound to the authorize request and to the browser, so a form posted from another site or
+//with altered hidden fields is rejected. The token's typ header marks it as an anti-forgery token, so it is
+//rejected wherever an access token is expected.
+func newCSRFToken(core *roll.Core, w http.ResponseWriter, r *http.Request, app *roll.Application, params url.Values) (string, error) {
+	return newBoundCSRFToken(core, w, r, app, authorizeRequestHash(params))
+}
+
+//newBoundCSRFToken returns an anti-forgery token bound to the browser and to the request identified by
+//the request hash
+func newBoundCSRFToken(core *roll.Core, w http.ResponseWriter, r *http.Request, app *roll.Application, requestHash string) (string, error) {
+	privateKey, err := core.RetrievePrivateKeyForApp(app.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	binding, err := csrfBinding(core, w, r)
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{
+		"aud":            app.ClientID,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(csrfTokenLifetime).Unix(),
+		csrfTokenClaim:   true,
+		csrfRequestClaim: requestHash,
+		csrfBindingClaim: sha256Encoded(binding),
+	}
+
+	return signTypedToken(claims, privateKey, authzwrapper.CSRFTokenType)
+}
+
+//checkCSRFToken checks the anti-forgery token posted with the authorize page form
+func checkCSRFToken(core *roll.Core, r *http.Request, app *roll.Application) error {
+	return checkBoundCSRFToken(core, r, app, authorizeRequestHash(r.Form))
+}
+
+//checkBoundCSRFToken checks the posted anti-forgery token was issued to the browser for the request
+//identified by the request hash
+func checkBoundCSRFToken(core *roll.Core, r *http.Request, app *roll.Application, requestHash string) error {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return ErrInvalidCSRFToken
+	}
+
+	token, err := jwt.Parse(r.FormValue(csrfTokenParam), keyExtractionFunction(core))
+	if err != nil || !token.Valid {
+		return ErrInvalidCSRFToken
+	}
+
+	if typ, _ := token.Header["typ"].(string); typ != authzwrapper.CSRFTokenType {
+		return ErrInvalidCSRFToken
+	}
+
+	if isCSRF, _ := token.Claims[csrfTokenClaim].(bool); !isCSRF {
+		return ErrInvalidCSRFToken
+	}
+
+	if aud, _ := token.Claims["aud"].(string); aud != app.ClientID {
+		return ErrInvalidCSRFToken
+	}
+
+	if req, _ := token.Claims[csrfRequestClaim].(string); req != requestHash {
+		return ErrInvalidCSRFToken
+	}
+
+	if binding, _ := token.Claims[csrfBindingClaim].(string); binding != sha256Encoded(cookie.Value) {
+		return ErrInvalidCSRFToken
+	}
+
+	return nil
+}
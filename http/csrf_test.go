@@ -0,0 +1,209 @@
+package http
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+//setupCSRFSigning mocks the keys used to sign and check the csrf token on the authorize page
+func setupCSRFSigning(t *testing.T, coreConfig *roll.CoreConfig, clientID string) {
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", clientID).Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", clientID).Return(publicKey, nil)
+}
+
+//newAuthorizePageForm returns the csrf token and cookie the authorize page would have been served with
+//for the form
+func newAuthorizePageForm(t *testing.T, core *roll.Core, form url.Values) (string, *http.Cookie) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	token, err := newCSRFToken(core, w, r, &roll.Application{ClientID: form.Get("client_id")}, form)
+	assert.Nil(t, err)
+
+	cookies := w.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	return token, cookies[0]
+}
+
+//postAuthorizeForm posts the form to the validate endpoint as the authorize page would
+func postAuthorizeForm(t *testing.T, core *roll.Core, client *http.Client, addr string, form url.Values) (*http.Response, error) {
+	token, cookie := newAuthorizePageForm(t, core, form)
+	form.Set(csrfTokenParam, token)
+
+	req, err := http.NewRequest("POST", addr+ValidateBaseURI, strings.NewReader(form.Encode()))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+
+	return client.Do(req)
+}
+
+func postValidateRequest(t *testing.T, form url.Values, cookie *http.Cookie) *http.Request {
+	r, err := http.NewRequest("POST", ValidateBaseURI, strings.NewReader(form.Encode()))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+
+	assert.Nil(t, r.ParseForm())
+	return r
+}
+
+func TestCheckCSRFToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
+	setupCSRFSigning(t, coreConfig, "5555-6666")
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+
+	form := url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"redirect_uri":  {"http://localhost:3000/ab"},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"state":         {"xyz"},
+	}
+
+	token, cookie := newAuthorizePageForm(t, core, form)
+
+	t.Log("the form as served is accepted, along with the username and password filled in by the user")
+	posted := url.Values{"username": {"x"}, "password": {"y"}, "authorize": {"allow"}, csrfTokenParam: {token}}
+	for k, v := range form {
+		posted[k] = v
+	}
+	assert.Nil(t, checkCSRFToken(core, postValidateRequest(t, posted, cookie), app))
+
+	t.Log("the form is rejected without the browser cookie")
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, posted, nil), app))
+
+	t.Log("the form is rejected from another browser")
+	other := &http.Cookie{Name: csrfCookie, Value: "other-browser"}
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, posted, other), app))
+
+	t.Log("the form is rejected if the authorize request was altered")
+	posted.Set("scope", "openid admin")
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, posted, cookie), app))
+	posted.Set("scope", "openid")
+
+	posted.Set("state", "abc")
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, posted, cookie), app))
+	posted.Set("state", "xyz")
+
+	t.Log("the form is rejected for another application")
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, posted, cookie), &roll.Application{ClientID: "5555-6666"}))
+
+	t.Log("the form is rejected with a token that is not typed as an anti-forgery token")
+	privateKey, err := core.RetrievePrivateKeyForApp(app.ClientID)
+	assert.Nil(t, err)
+	untyped, err := signToken(map[string]interface{}{
+		"aud":            app.ClientID,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		csrfTokenClaim:   true,
+		csrfRequestClaim: authorizeRequestHash(form),
+		csrfBindingClaim: sha256Encoded(cookie.Value),
+	}, privateKey)
+	assert.Nil(t, err)
+	posted.Set(csrfTokenParam, untyped)
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, posted, cookie), app))
+
+	t.Log("the form is rejected without a token")
+	posted.Del(csrfTokenParam)
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, posted, cookie), app))
+}
+
+func TestCheckCSRFTokenRejectsLoginSession(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+
+	session, err := newLoginSession(core, "x", app, nil)
+	assert.Nil(t, err)
+
+	form := url.Values{"client_id": {"1111-2222-3333333-4444444"}, csrfTokenParam: {session}}
+	cookie := &http.Cookie{Name: csrfCookie, Value: "steve"}
+	assert.Equal(t, ErrInvalidCSRFToken, checkCSRFToken(core, postValidateRequest(t, form, cookie), app))
+}
+
+func TestAuthorizePageCarriesStateAndCSRFToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		RedirectURIs:    "http://localhost:3000/ab",
+	}, nil)
+
+	r, _ := http.NewRequest("GET", "/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=code&state=xyz", nil)
+	w := httptest.NewRecorder()
+	handleAuthZGet(core, w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, `name="state" value="xyz"`))
+	assert.True(t, strings.Contains(body, `name="csrf_token" value="ey`))
+
+	cookies := w.Result().Cookies()
+	if assert.Equal(t, 1, len(cookies)) {
+		assert.Equal(t, csrfCookie, cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+}
+
+func TestAuthorizeErrorRedirectCarriesState(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:     "1111-2222-3333333-4444444",
+		RedirectURIs: "http://localhost:3000/ab",
+	}, nil)
+
+	r, _ := http.NewRequest("GET", "/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=bogus&state=xyz", nil)
+	w := httptest.NewRecorder()
+	handleAuthZGet(core, w, r)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, oauth2UnsupportedResponseType, redirect.Query().Get("error"))
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	}
+}
+
+func TestAuthValidateRejectsForgedForm(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:      "1111-2222-3333333-4444444",
+		RedirectURIs:  "http://localhost:3000/ab",
+		LoginProvider: "xtrac://localhost:9000",
+	}, nil)
+
+	resp, err := http.PostForm(addr+"/oauth2/validate",
+		url.Values{"username": {"x"},
+			"password":      {"y"},
+			"authorize":     {"allow"},
+			"response_type": {"code"},
+			"client_id":     {"1111-2222-3333333-4444444"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), "csrf_token"))
+}
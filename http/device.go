@@ -0,0 +1,452 @@
+package http
+
+import (
+	"crypto/rand"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/html"
+	"github.com/xtraclabs/roll/roll"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	//DeviceAuthorizationURI is the uri devices use to start the device authorization grant (RFC 8628)
+	DeviceAuthorizationURI = "/oauth2/device_authorization"
+
+	//DeviceVerificationURI is the uri of the page where users enter the code shown on their device
+	DeviceVerificationURI = "/oauth2/device"
+
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	//Lifetime of a device authorization request, and the polling interval devices start with. Devices
+	//that poll too quickly have their interval increased by the slow down increment.
+	deviceCodeLifetime          = 10 * time.Minute
+	devicePollInterval          = 5
+	devicePollSlowDownIncrement = 5
+
+	//User codes are drawn from consonants, avoiding ambiguous characters and making it unlikely a code
+	//spells a word - see RFC 8628 section 6.1
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+)
+
+var (
+	//ErrInvalidUserCode is returned when a user code does not identify a pending device authorization
+	ErrInvalidUserCode = errors.New("The code is invalid or has expired")
+
+	//ErrInvalidDeviceCode is returned when a device code has no record or was issued to a different client
+	ErrInvalidDeviceCode = errors.New("Invalid device code")
+)
+
+var deviceTemplate *template.Template
+var deviceVerifiedTemplate *template.Template
+
+func init() {
+	var err error
+
+	deviceTemplate = template.New("device.html")
+	deviceTemplate, err = deviceTemplate.Parse(html.DeviceVerification)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	deviceVerifiedTemplate = template.New("deviceverified.html")
+	deviceVerifiedTemplate, err = deviceVerifiedTemplate.Parse(html.DeviceVerified)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type devicePageContext struct {
+	UserCode  string
+	AppName   string
+	Scope     string
+	Message   string
+	CSRFToken string
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+//generateUserCode generates a random user code, which is stored without the separator it is shown with
+func generateUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeCharset)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+//formatUserCode formats a user code for display as two groups of characters
+func formatUserCode(userCode string) string {
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+//normalizeUserCode converts a user code as typed by the user to the stored form, ignoring case and any
+//separators or spaces
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(userCodeCharset, r) {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(userCode))
+}
+
+func handleDeviceAuthorization(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			handleDeviceAuthorizationPost(core, w, r)
+		default:
+			respondOAuth2Error(w, http.StatusMethodNotAllowed, oauth2InvalidRequest, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func handleDeviceAuthorizationPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	client, err := clientCredentialsFromRequest(core, r)
+	if err != nil {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, err)
+		return
+	}
+
+	if client.clientID == "" {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, errors.New("client_id missing from request"))
+		return
+	}
+
+	//Public clients have no credentials to present, so are identified by their client id alone
+	app, err := authenticateClient(core, client, true)
+	if err == nil && !app.AllowsGrantType(deviceCodeGrantType) {
+		err = ErrGrantTypeNotAllowed
+	}
+
+	if err != nil {
+		respondClientAuthError(w, err)
+
+		return
+	}
+
+	scope := r.FormValue(oauth2Scope)
+	if err := validateRequestedScope(core, app, scope); err != nil {
+		respondScopeError(w, err)
+		return
+	}
+
+	deviceCode, err := core.GenerateID()
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	err = core.StoreDeviceAuthorization(&roll.DeviceAuthorization{
+		DeviceCode: deviceCode,
+		UserCode:   userCode,
+		ClientID:   app.ClientID,
+		Scope:      scope,
+		Status:     roll.DeviceAuthorizationPending,
+		ExpiresAt:  time.Now().Add(deviceCodeLifetime).Unix(),
+		Interval:   devicePollInterval,
+	})
+	if err != nil {
+		log.Info("Error storing device authorization: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	verificationURI := issuerURL(core) + DeviceVerificationURI
+	w.Header().Add("Cache-Control", "no-store")
+	respondOk(w, &deviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(formatUserCode(userCode)),
+		ExpiresIn:               int64(deviceCodeLifetime / time.Second),
+		Interval:                devicePollInterval,
+	})
+}
+
+//pendingDeviceAuthorization looks up the device authorization for a user code, returning nil if there
+//is no pending, unexpired authorization for the code
+func pendingDeviceAuthorization(core *roll.Core, userCode string) (*roll.DeviceAuthorization, error) {
+	userCode = normalizeUserCode(userCode)
+	if len(userCode) != userCodeLength {
+		return nil, nil
+	}
+
+	da, err := core.RetrieveDeviceAuthorizationByUserCode(userCode)
+	if err != nil || da == nil {
+		return nil, err
+	}
+
+	if da.Status != roll.DeviceAuthorizationPending || da.Expired() {
+		return nil, nil
+	}
+
+	return da, nil
+}
+
+func handleDeviceVerification(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleDeviceVerificationGet(core, w, r)
+		case "POST":
+			handleDeviceVerificationPost(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func executeDeviceTemplate(w http.ResponseWriter, status int, pageCtx *devicePageContext) {
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := deviceTemplate.Execute(w, pageCtx); err != nil {
+		log.Info("Error executing device verification template: ", err.Error())
+	}
+}
+
+func executeDeviceVerifiedTemplate(w http.ResponseWriter, message string) {
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	if err := deviceVerifiedTemplate.Execute(w, &devicePageContext{Message: message}); err != nil {
+		log.Info("Error executing device verified template: ", err.Error())
+	}
+}
+
+func handleDeviceVerificationGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	//The user code is present when the user follows verification_uri_complete, in which case we can
+	//show which application is asking for access
+	userCode := r.FormValue("user_code")
+	pageCtx := &devicePageContext{UserCode: userCode}
+	if userCode == "" {
+		executeDeviceTemplate(w, http.StatusOK, pageCtx)
+		return
+	}
+
+	da, err := pendingDeviceAuthorization(core, userCode)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if da == nil {
+		pageCtx.Message = ErrInvalidUserCode.Error()
+		executeDeviceTemplate(w, http.StatusOK, pageCtx)
+		return
+	}
+
+	app, err := lookupApplication(core, da.ClientID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	pageCtx.AppName = app.ApplicationName
+	pageCtx.Scope = da.Scope
+	executeDeviceApprovalTemplate(core, w, r, http.StatusOK, pageCtx, app)
+}
+
+//executeDeviceApprovalTemplate shows the form for approving the device authorization. The form is protected
+//from cross site request forgery by a token bound to the user code and the browser, so users can only
+//approve or deny a device from the page we served them.
+func executeDeviceApprovalTemplate(core *roll.Core, w http.ResponseWriter, r *http.Request, status int, pageCtx *devicePageContext, app *roll.Application) {
+	var err error
+	pageCtx.CSRFToken, err = newBoundCSRFToken(core, w, r, app, deviceRequestHash(pageCtx.UserCode))
+	if err != nil {
+		log.Info("Error generating csrf token: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	executeDeviceTemplate(w, status, pageCtx)
+}
+
+func handleDeviceVerificationPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	userCode := r.FormValue("user_code")
+	pageCtx := &devicePageContext{UserCode: userCode}
+
+	da, err := pendingDeviceAuthorization(core, userCode)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if da == nil {
+		pageCtx.Message = ErrInvalidUserCode.Error()
+		executeDeviceTemplate(w, http.StatusBadRequest, pageCtx)
+		return
+	}
+
+	app, err := lookupApplication(core, da.ClientID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	pageCtx.AppName = app.ApplicationName
+	pageCtx.Scope = da.Scope
+
+	//Make sure the form was posted from the verification page we served for this user code
+	if err := checkBoundCSRFToken(core, r, app, deviceRequestHash(userCode)); err != nil {
+		log.Info("Rejecting device verification form: ", err.Error())
+		pageCtx.Message = err.Error()
+		executeDeviceApprovalTemplate(core, w, r, http.StatusBadRequest, pageCtx, app)
+		return
+	}
+
+	//Note we assume if the request was not allowed it was denied
+	if r.FormValue("authorize") != "allow" {
+		completeDeviceVerification(core, w, da, roll.DeviceAuthorizationDenied, "")
+		return
+	}
+
+	authenticated, _, err := authenticateUser(r.FormValue("username"), r.FormValue("password"), app)
+	if err != nil {
+		log.Info("Error authenticating user: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !authenticated {
+		pageCtx.Message = "Invalid user name or password"
+		executeDeviceApprovalTemplate(core, w, r, http.StatusUnauthorized, pageCtx, app)
+		return
+	}
+
+	//Only admins may grant the admin scope
+	if scopeContains(da.Scope, adminScope) {
+		isAdmin, err := core.IsAdmin(r.FormValue("username"))
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !isAdmin {
+			completeDeviceVerification(core, w, da, roll.DeviceAuthorizationDenied, "")
+			return
+		}
+	}
+
+	completeDeviceVerification(core, w, da, roll.DeviceAuthorizationApproved, r.FormValue("username"))
+}
+
+//completeDeviceVerification records the user's decision, which the device learns of when it next polls
+//the token endpoint
+func completeDeviceVerification(core *roll.Core, w http.ResponseWriter, da *roll.DeviceAuthorization, status, subject string) {
+	err := core.UpdateDeviceAuthorizationStatus(da.DeviceCode, roll.DeviceAuthorizationPending, status, subject)
+	if err != nil {
+		switch err.(type) {
+		case roll.DeviceAuthorizationStatusError:
+			executeDeviceTemplate(w, http.StatusBadRequest, &devicePageContext{Message: ErrInvalidUserCode.Error()})
+		default:
+			respondError(w, http.StatusInternalServerError, err)
+		}
+
+		return
+	}
+
+	if status == roll.DeviceAuthorizationApproved {
+		executeDeviceVerifiedTemplate(w, "Your device is now authorized - you may return to it")
+	} else {
+		executeDeviceVerifiedTemplate(w, "Access was denied for your device")
+	}
+}
+
+func handleDeviceCodeGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
+	app, err := authenticateClient(core, codeContext.client, true)
+	if err == nil && !app.AllowsGrantType(deviceCodeGrantType) {
+		err = ErrGrantTypeNotAllowed
+	}
+
+	if err != nil {
+		respondClientAuthError(w, err)
+
+		return
+	}
+
+	da, err := core.RetrieveDeviceAuthorization(codeContext.deviceCode)
+	if err != nil {
+		log.Info("Error retrieving device authorization: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	if da == nil || da.ClientID != app.ClientID {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidDeviceCode)
+		return
+	}
+
+	if da.Expired() {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2ExpiredToken, nil)
+		return
+	}
+
+	switch da.Status {
+	case roll.DeviceAuthorizationPending:
+		pollDeviceAuthorization(core, da, w)
+	case roll.DeviceAuthorizationDenied:
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2AccessDenied, nil)
+	case roll.DeviceAuthorizationApproved:
+		//Spend the device code. Losing the race to do so means another request got the tokens.
+		err := core.UpdateDeviceAuthorizationStatus(da.DeviceCode, roll.DeviceAuthorizationApproved, roll.DeviceAuthorizationComplete, "")
+		if err != nil {
+			switch err.(type) {
+			case roll.DeviceAuthorizationStatusError:
+				respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidDeviceCode)
+			default:
+				respondServerError(w, err)
+			}
+
+			return
+		}
+
+		generateAndRespondWithRefreshableAccessToken(core, da.Subject, da.Scope, codeContext.resources, app, w)
+	default:
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidDeviceCode)
+	}
+}
+
+//pollDeviceAuthorization responds to a device polling for a pending authorization. Devices that poll more
+//often than their interval allows are told to slow down, and must add to their interval from then on.
+func pollDeviceAuthorization(core *roll.Core, da *roll.DeviceAuthorization, w http.ResponseWriter) {
+	now := time.Now().Unix()
+	interval := da.Interval
+	errorCode := oauth2AuthorizationPending
+	if da.LastPolledAt != 0 && now-da.LastPolledAt < da.Interval {
+		interval += devicePollSlowDownIncrement
+		errorCode = oauth2SlowDown
+	}
+
+	if err := core.RecordDeviceAuthorizationPoll(da.DeviceCode, now, interval); err != nil {
+		log.Info("Error recording device authorization poll: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	respondOAuth2Error(w, http.StatusBadRequest, errorCode, nil)
+}
@@ -0,0 +1,452 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const deviceTestClientID = "1111-2222-3333333-4444444"
+
+func setupDeviceTestApp(coreConfig *roll.CoreConfig, publicClient bool, loginProvider string) {
+	app := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        deviceTestClientID,
+		ApplicationName: "kiosk",
+		ClientSecret:    "kiosk secret",
+		LoginProvider:   loginProvider,
+		PublicClient:    publicClient,
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", deviceTestClientID).Return(&app, nil)
+}
+
+func pendingTestDeviceAuthorization() *roll.DeviceAuthorization {
+	return &roll.DeviceAuthorization{
+		DeviceCode: "device-code",
+		UserCode:   "BCDFGHJK",
+		ClientID:   deviceTestClientID,
+		Status:     roll.DeviceAuthorizationPending,
+		ExpiresAt:  time.Now().Add(time.Minute).Unix(),
+		Interval:   devicePollInterval,
+	}
+}
+
+//postDeviceVerificationForm posts the form to the verification page as the page served for the user code would
+func postDeviceVerificationForm(t *testing.T, core *roll.Core, addr string, form url.Values) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	token, err := newBoundCSRFToken(core, w, r, &roll.Application{ClientID: deviceTestClientID}, deviceRequestHash(form.Get("user_code")))
+	assert.Nil(t, err)
+	form.Set(csrfTokenParam, token)
+
+	req, err := http.NewRequest("POST", addr+DeviceVerificationURI, strings.NewReader(form.Encode()))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(w.Result().Cookies()[0])
+
+	return http.DefaultClient.Do(req)
+}
+
+func pollForDeviceToken(t *testing.T, addr string) (*http.Response, OAuth2ErrorResponse) {
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {deviceCodeGrantType},
+			"client_id":   {deviceTestClientID},
+			"device_code": {"device-code"}})
+	assert.Nil(t, err)
+
+	var errResp OAuth2ErrorResponse
+	if resp.StatusCode != http.StatusOK {
+		err = json.Unmarshal([]byte(responseAsString(t, resp)), &errResp)
+		assert.Nil(t, err)
+	}
+
+	return resp, errResp
+}
+
+func TestUserCodeFormat(t *testing.T) {
+	userCode, err := generateUserCode()
+	assert.Nil(t, err)
+	assert.Equal(t, userCodeLength, len(userCode))
+	assert.Equal(t, userCode, normalizeUserCode(userCode))
+
+	formatted := formatUserCode(userCode)
+	assert.Equal(t, "-", formatted[4:5])
+	assert.Equal(t, userCode, normalizeUserCode(strings.ToLower(formatted)))
+	assert.Equal(t, "BCDFGHJK", normalizeUserCode(" bcdf ghjk "))
+}
+
+func TestDeviceAuthorization(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+
+	var stored *roll.DeviceAuthorization
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("StoreDeviceAuthorization", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*roll.DeviceAuthorization)
+	})
+
+	resp, err := http.PostForm(addr+DeviceAuthorizationURI,
+		url.Values{"client_id": {deviceTestClientID}, "scope": {"openid"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	var daResp deviceAuthorizationResponse
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &daResp)
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, stored) {
+		assert.Equal(t, stored.DeviceCode, daResp.DeviceCode)
+		assert.Equal(t, formatUserCode(stored.UserCode), daResp.UserCode)
+		assert.Equal(t, "openid", stored.Scope)
+		assert.Equal(t, roll.DeviceAuthorizationPending, stored.Status)
+	}
+
+	assert.Equal(t, addr+DeviceVerificationURI, daResp.VerificationURI)
+	assert.Equal(t, addr+DeviceVerificationURI+"?user_code="+daResp.UserCode, daResp.VerificationURIComplete)
+	assert.Equal(t, int64(600), daResp.ExpiresIn)
+	assert.Equal(t, int64(devicePollInterval), daResp.Interval)
+}
+
+func TestDeviceAuthorizationConfidentialClientNeedsSecret(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, false, "")
+
+	resp, err := http.PostForm(addr+DeviceAuthorizationURI, url.Values{"client_id": {deviceTestClientID}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), "invalid_client"))
+}
+
+func TestDeviceAuthorizationUnknownScope(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, false, "")
+
+	resp, err := http.PostForm(addr+DeviceAuthorizationURI,
+		url.Values{"client_id": {deviceTestClientID}, "client_secret": {"kiosk secret"}, "scope": {"everything"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), "invalid_scope"))
+}
+
+func TestDeviceTokenAuthorizationPending(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorization", "device-code").Return(pendingTestDeviceAuthorization(), nil)
+	daRepoMock.On("RecordDeviceAuthorizationPoll", "device-code", mock.AnythingOfType("int64"), int64(devicePollInterval)).Return(nil)
+
+	resp, errResp := pollForDeviceToken(t, addr)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "authorization_pending", errResp.Error)
+	daRepoMock.AssertExpectations(t)
+}
+
+func TestDeviceTokenSlowDown(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+
+	da := pendingTestDeviceAuthorization()
+	da.LastPolledAt = time.Now().Unix()
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorization", "device-code").Return(da, nil)
+	daRepoMock.On("RecordDeviceAuthorizationPoll", "device-code", mock.AnythingOfType("int64"),
+		int64(devicePollInterval+devicePollSlowDownIncrement)).Return(nil)
+
+	resp, errResp := pollForDeviceToken(t, addr)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "slow_down", errResp.Error)
+	daRepoMock.AssertExpectations(t)
+}
+
+func TestDeviceTokenDenied(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+
+	da := pendingTestDeviceAuthorization()
+	da.Status = roll.DeviceAuthorizationDenied
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorization", "device-code").Return(da, nil)
+
+	_, errResp := pollForDeviceToken(t, addr)
+	assert.Equal(t, "access_denied", errResp.Error)
+}
+
+func TestDeviceTokenExpired(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+
+	da := pendingTestDeviceAuthorization()
+	da.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorization", "device-code").Return(da, nil)
+
+	_, errResp := pollForDeviceToken(t, addr)
+	assert.Equal(t, "expired_token", errResp.Error)
+}
+
+func TestDeviceTokenIssuedOnce(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+	setupPKCETestApp(t, coreConfig, true)
+
+	da := pendingTestDeviceAuthorization()
+	da.Status = roll.DeviceAuthorizationApproved
+	da.Subject = "a-user"
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorization", "device-code").Return(da, nil)
+	daRepoMock.On("UpdateDeviceAuthorizationStatus", "device-code", roll.DeviceAuthorizationApproved,
+		roll.DeviceAuthorizationComplete, "").Return(nil).Once()
+	daRepoMock.On("UpdateDeviceAuthorizationStatus", "device-code", roll.DeviceAuthorizationApproved,
+		roll.DeviceAuthorizationComplete, "").Return(roll.DeviceAuthorizationStatusError{})
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	resp, _ := pollForDeviceToken(t, addr)
+	if assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		var at accessTokenResponse
+		err := json.Unmarshal([]byte(responseAsString(t, resp)), &at)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", at.AccessToken)
+		assert.NotEqual(t, "", at.RefreshToken)
+
+		claims, err := decodeClaims(at.AccessToken)
+		assert.Nil(t, err)
+		assert.Equal(t, "a-user", claims["sub"])
+	}
+
+	resp, errResp := pollForDeviceToken(t, addr)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_grant", errResp.Error)
+}
+
+func TestDeviceTokenWrongClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+
+	da := pendingTestDeviceAuthorization()
+	da.ClientID = "another-client"
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorization", "device-code").Return(da, nil)
+
+	_, errResp := pollForDeviceToken(t, addr)
+	assert.Equal(t, "invalid_grant", errResp.Error)
+}
+
+func TestDeviceVerificationPageShowsApp(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+	setupCSRFSigning(t, coreConfig, deviceTestClientID)
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorizationByUserCode", "BCDFGHJK").Return(pendingTestDeviceAuthorization(), nil)
+
+	resp, err := http.Get(addr + DeviceVerificationURI + "?user_code=bcdf-ghjk")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, "kiosk Would Like Access"))
+	assert.True(t, strings.Contains(body, `value="bcdf-ghjk"`))
+	assert.True(t, strings.Contains(body, `name="csrf_token"`))
+	assert.Equal(t, csrfCookie, resp.Cookies()[0].Name)
+}
+
+func TestDeviceVerificationPageWithoutCode(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.Get(addr + DeviceVerificationURI)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	//Only the code is asked for until the page knows which device authorization is being approved
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, "Enter the Code Shown on Your Device"))
+	assert.False(t, strings.Contains(body, `name="password"`))
+	assert.False(t, strings.Contains(body, `name="csrf_token"`))
+}
+
+func TestDeviceVerificationApprove(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	var loginCalled = false
+	ls := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loginCalled = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ls.Close()
+
+	lsURL, _ := url.Parse(ls.URL)
+	setupDeviceTestApp(coreConfig, true, "xtrac://"+lsURL.Host)
+	setupCSRFSigning(t, coreConfig, deviceTestClientID)
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorizationByUserCode", "BCDFGHJK").Return(pendingTestDeviceAuthorization(), nil)
+	daRepoMock.On("UpdateDeviceAuthorizationStatus", "device-code", roll.DeviceAuthorizationPending,
+		roll.DeviceAuthorizationApproved, "a-user").Return(nil)
+
+	resp, err := postDeviceVerificationForm(t, core, addr,
+		url.Values{"user_code": {"BCDF-GHJK"},
+			"username":  {"a-user"},
+			"password":  {"a-password"},
+			"authorize": {"allow"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), "Your device is now authorized"))
+	assert.True(t, loginCalled)
+	daRepoMock.AssertExpectations(t)
+}
+
+func TestDeviceVerificationDeny(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+	setupCSRFSigning(t, coreConfig, deviceTestClientID)
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorizationByUserCode", "BCDFGHJK").Return(pendingTestDeviceAuthorization(), nil)
+	daRepoMock.On("UpdateDeviceAuthorizationStatus", "device-code", roll.DeviceAuthorizationPending,
+		roll.DeviceAuthorizationDenied, "").Return(nil)
+
+	resp, err := postDeviceVerificationForm(t, core, addr,
+		url.Values{"user_code": {"BCDFGHJK"}, "authorize": {"deny"}})
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(responseAsString(t, resp), "Access was denied"))
+	daRepoMock.AssertExpectations(t)
+}
+
+func TestDeviceVerificationLoginFailure(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	ls := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ls.Close()
+
+	lsURL, _ := url.Parse(ls.URL)
+	setupDeviceTestApp(coreConfig, true, "xtrac://"+lsURL.Host)
+	setupCSRFSigning(t, coreConfig, deviceTestClientID)
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorizationByUserCode", "BCDFGHJK").Return(pendingTestDeviceAuthorization(), nil)
+
+	resp, err := postDeviceVerificationForm(t, core, addr,
+		url.Values{"user_code": {"BCDFGHJK"},
+			"username":  {"a-user"},
+			"password":  {"wrong"},
+			"authorize": {"allow"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, "Invalid user name or password"))
+	assert.True(t, strings.Contains(body, `name="csrf_token"`))
+	daRepoMock.AssertNotCalled(t, "UpdateDeviceAuthorizationStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeviceVerificationUnknownCode(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorizationByUserCode", "BCDFGHJK").Return(nil, nil)
+
+	resp, err := http.PostForm(addr+DeviceVerificationURI,
+		url.Values{"user_code": {"BCDFGHJK"}, "authorize": {"allow"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrInvalidUserCode.Error()))
+}
+
+func TestDeviceVerificationRequiresCSRFToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupDeviceTestApp(coreConfig, true, "")
+	setupCSRFSigning(t, coreConfig, deviceTestClientID)
+
+	daRepoMock := coreConfig.DeviceAuthorizationRepo.(*mocks.DeviceAuthorizationRepo)
+	daRepoMock.On("RetrieveDeviceAuthorizationByUserCode", "BCDFGHJK").Return(pendingTestDeviceAuthorization(), nil)
+
+	//A form posted from another site has no token or cookie
+	resp, err := http.PostForm(addr+DeviceVerificationURI,
+		url.Values{"user_code": {"BCDFGHJK"}, "authorize": {"deny"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrInvalidCSRFToken.Error()))
+
+	//Tokens issued for another user code are rejected too
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	token, err := newBoundCSRFToken(core, w, r, &roll.Application{ClientID: deviceTestClientID}, deviceRequestHash("MNPQRSTV"))
+	assert.Nil(t, err)
+
+	form := url.Values{"user_code": {"BCDFGHJK"}, "authorize": {"deny"}, csrfTokenParam: {token}}
+	req, err := http.NewRequest("POST", addr+DeviceVerificationURI, strings.NewReader(form.Encode()))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(w.Result().Cookies()[0])
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	daRepoMock.AssertNotCalled(t, "UpdateDeviceAuthorizationStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -19,23 +19,72 @@ func Handler(core *roll.Core) http.Handler {
 			panic(errors.New("Cannot run in secure mode without a client ID to white list (from ROLL_CLIENTID env variable)"))
 		}
 
+		//Tokens must be issued to the whitelisted client for the roll API. The API may be registered as a
+		//protected resource, otherwise tokens issued to the client without a resource are for the API.
+		rollResource := os.Getenv("ROLL_RESOURCE")
+		if rollResource == "" {
+			rollResource = rollClientID
+		}
+
 		whitelist := []string{rollClientID}
-		mux.Handle(DevelopersBaseURI, authzwrapper.Wrap(core.SecretsRepo, core.AdminRepo, whitelist, handleDevelopersBase(core)))
-		mux.Handle(DevelopersURI, authzwrapper.Wrap(core.SecretsRepo, core.AdminRepo, whitelist, handleDevelopers(core)))
-		mux.Handle(ApplicationsURI, authzwrapper.Wrap(core.SecretsRepo, core.AdminRepo, whitelist, handleApplications(core)))
-		mux.Handle(ApplicationsBaseURI, authzwrapper.Wrap(core.SecretsRepo, core.AdminRepo, whitelist, handleApplicationsBase(core)))
-		mux.Handle(JWTFlowCertsURI, authzwrapper.Wrap(core.SecretsRepo, core.AdminRepo, whitelist, handleJWTFlowCerts(core)))
+		keyFunc := keyExtractionFunction(core)
+		mux.Handle(DevelopersBaseURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleDevelopersBase(core)))
+		mux.Handle(DevelopersURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleDevelopers(core)))
+		mux.Handle(ApplicationsURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleApplications(core)))
+		mux.Handle(ApplicationsBaseURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleApplicationsBase(core)))
+		mux.Handle(JWTFlowCertsURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleJWTFlowCerts(core)))
+		mux.Handle(SigningKeysURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleSigningKeys(core)))
+		mux.Handle(TrustedIssuersURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleTrustedIssuers(core)))
+		mux.Handle(ScopesURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleScopes(core)))
+		mux.Handle(ConsentsURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleConsents(core)))
+		mux.Handle(InitialAccessTokensURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleInitialAccessTokens(core)))
+		mux.Handle(ProtectedResourcesURI, authzwrapper.WrapWithKeyFunc(keyFunc, core.AdminRepo, core.RevocationRepo, rollResource, whitelist, handleProtectedResources(core)))
 	} else {
 		mux.Handle(DevelopersBaseURI, authzwrapper.WrapUnsecure(handleDevelopersBase(core)))
 		mux.Handle(DevelopersURI, authzwrapper.WrapUnsecure(handleDevelopers(core)))
 		mux.Handle(ApplicationsURI, authzwrapper.WrapUnsecure(handleApplications(core)))
 		mux.Handle(ApplicationsBaseURI, authzwrapper.WrapUnsecure(handleApplicationsBase(core)))
 		mux.Handle(JWTFlowCertsURI, authzwrapper.WrapUnsecure(handleJWTFlowCerts(core)))
+		mux.Handle(SigningKeysURI, authzwrapper.WrapUnsecure(handleSigningKeys(core)))
+		mux.Handle(TrustedIssuersURI, authzwrapper.WrapUnsecure(handleTrustedIssuers(core)))
+		mux.Handle(ScopesURI, authzwrapper.WrapUnsecure(handleScopes(core)))
+		mux.Handle(ConsentsURI, authzwrapper.WrapUnsecure(handleConsents(core)))
+		mux.Handle(InitialAccessTokensURI, authzwrapper.WrapUnsecure(handleInitialAccessTokens(core)))
+		mux.Handle(ProtectedResourcesURI, authzwrapper.WrapUnsecure(handleProtectedResources(core)))
+	}
+
+	for _, endpoint := range oauth2Endpoints {
+		mux.Handle(endpoint.uri, endpoint.handler(core))
 	}
 
-	mux.Handle(AuthorizeBaseURI, handleAuthorize(core))
-	mux.Handle(ValidateBaseURI, handleValidate(core))
-	mux.Handle(OAuth2TokenBaseURI, handleToken(core))
-	mux.Handle(TokenInfoURI, handleTokenInfo(core))
+	mux.Handle(AuthorizationServerMetadataURI, handleAuthorizationServerMetadata(core))
+	mux.Handle(OpenIDConfigurationURI, handleOpenIDConfiguration(core))
 	return mux
 }
+
+//oauth2Endpoint is an endpoint used by OAuth 2.0 clients. Endpoints with a metadata name are advertised
+//under that name in the authorization server metadata.
+type oauth2Endpoint struct {
+	uri      string
+	metadata string
+	handler  func(core *roll.Core) http.Handler
+}
+
+//oauth2Endpoints are the endpoints used by OAuth 2.0 clients, which are served without the roll
+//api authorization checks
+var oauth2Endpoints = []oauth2Endpoint{
+	{AuthorizeBaseURI, "authorization_endpoint", handleAuthorize},
+	{PushedAuthorizationURI, "pushed_authorization_request_endpoint", handlePushedAuthorizationRequest},
+	{ValidateBaseURI, "", handleValidate},
+	{OAuth2TokenBaseURI, "token_endpoint", handleToken},
+	{DeviceAuthorizationURI, "device_authorization_endpoint", handleDeviceAuthorization},
+	{DeviceVerificationURI, "", handleDeviceVerification},
+	{TokenInfoURI, "tokeninfo_endpoint", handleTokenInfo},
+	{RevokeURI, "revocation_endpoint", handleRevoke},
+	{IntrospectURI, "introspection_endpoint", handleIntrospect},
+	{UserInfoURI, "userinfo_endpoint", handleUserInfo},
+	{JWKSURI, "jwks_uri", handleJWKS},
+	{AppJWKSURI, "", handleAppJWKS},
+	{RegisterURI, "registration_endpoint", handleRegister},
+	{RegisterClientURI, "", handleClientConfiguration},
+}
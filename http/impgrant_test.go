@@ -38,6 +38,7 @@ func TestExecuteAuthTemplateForToken(t *testing.T) {
 
 func TestHandleImpGrantAuthorize(t *testing.T) {
 	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -46,7 +47,7 @@ func TestHandleImpGrantAuthorize(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -67,6 +68,7 @@ func TestHandleImpGrantAuthorize(t *testing.T) {
 
 func TestHandleImpGrantAuthorizeAdminScope(t *testing.T) {
 	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -75,7 +77,8 @@ func TestHandleImpGrantAuthorizeAdminScope(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
+		AllowedScopes:   "admin",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -99,30 +102,63 @@ func TestHandleAuthorizeWithInvalidScope(t *testing.T) {
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
-	var redirectCalled = false
-	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		redirectCalled = true
-		assert.True(t, strings.Contains(r.RequestURI, "error=access_denied&error_description=scope-problem"))
-	}))
-	defer rs.Close()
-
 	returnVal := roll.Application{
 		DeveloperEmail:  "doug@dev.com",
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     rs.URL + "/foo",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
 	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
 	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
 
-	TestHTTPGet(t, addr+"/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri="+rs.URL+"/foo&response_type=token&scope=invalid-scope", nil)
-	appRepoMock.AssertCalled(t, "SystemRetrieveApplication", "1111-2222-3333333-4444444")
+	//The implicit flow returns errors in the fragment, which is never sent to the redirect server
+	var fragment url.Values
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			fragment, _ = url.ParseQuery(req.URL.Fragment)
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(addr + "/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=token&scope=invalid-scope")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "invalid_scope", fragment.Get("error"))
+	assert.Equal(t, authorizationErrorsSpec, fragment.Get("error_uri"))
+}
+
+func TestHandleAuthorizeUnsupportedResponseType(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	returnVal := roll.Application{
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
 
-	assert.True(t, redirectCalled)
+	resp, err := client.Get(addr + "/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=bad")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
 
+	location, err := resp.Location()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "unsupported_response_type", location.Query().Get("error"))
+	}
 }
 
 func TestHandleAuthorizeBadRedirectParam(t *testing.T) {
@@ -135,7 +171,7 @@ func TestHandleAuthorizeBadRedirectParam(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -178,6 +214,7 @@ func TestAuthValidateDenied(t *testing.T) {
 	defer ts.Close()
 
 	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -186,14 +223,14 @@ func TestAuthValidateDenied(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL,
+		RedirectURIs:    ts.URL,
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
 	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
 	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
 
-	_, err := http.PostForm(addr+"/oauth2/validate",
+	_, err := postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"deny"},
@@ -222,6 +259,7 @@ func TestAuthValidateAuthenticateFail(t *testing.T) {
 	defer ts.Close()
 
 	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -232,14 +270,14 @@ func TestAuthValidateAuthenticateFail(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL,
+		RedirectURIs:    ts.URL,
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
 	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
 	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
 
-	_, err := http.PostForm(addr+"/oauth2/validate",
+	_, err := postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
@@ -269,6 +307,7 @@ func TestAuthValidateAuthenticateOkSecretsFail(t *testing.T) {
 	defer ts.Close()
 
 	core, coreConfig := NewTestCore()
+	setupConsentRecording(coreConfig)
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -279,17 +318,23 @@ func TestAuthValidateAuthenticateOkSecretsFail(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL,
+		RedirectURIs:    ts.URL,
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
 	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
 	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
 
+	//The key is available when the authorize page is served, but not when the token is generated
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
 	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil).Once()
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return("", errors.New("Drat"))
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
-	_, err := http.PostForm(addr+"/oauth2/validate",
+	_, err = postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
@@ -319,6 +364,7 @@ func TestAuthValidateAuthenticateOk(t *testing.T) {
 	defer ts.Close()
 
 	core, coreConfig := NewTestCore()
+	setupConsentRecording(coreConfig)
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -329,20 +375,21 @@ func TestAuthValidateAuthenticateOk(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL,
+		RedirectURIs:    ts.URL,
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
 	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
 	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
 
-	privateKey, _, err := secrets.GenerateKeyPair()
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
 	assert.Nil(t, err)
 
 	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
-	_, err = http.PostForm(addr+"/oauth2/validate",
+	_, err = postAuthorizeForm(t, core, http.DefaultClient, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
@@ -373,6 +420,7 @@ func TestImplGrantAuthValidateAuthenticateOkAdminScope(t *testing.T) {
 	defer ts.Close()
 
 	core, coreConfig := NewTestCore()
+	setupConsentRecording(coreConfig)
 	ln, addr := TestServer(t, core)
 	defer ln.Close()
 
@@ -383,7 +431,8 @@ func TestImplGrantAuthValidateAuthenticateOkAdminScope(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     ts.URL + "/foo",
+		RedirectURIs:    ts.URL + "/foo",
+		AllowedScopes:   "admin",
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
@@ -416,12 +465,14 @@ func TestImplGrantAuthValidateAuthenticateOkAdminScope(t *testing.T) {
 			assert.Equal(t, "1111-2222-3333333-4444444", token.Claims["aud"].(string))
 
 			assert.Equal(t, "Bearer", m.Get("token_type"))
+			assert.Equal(t, "86400", m.Get("expires_in"))
+			assert.Equal(t, "admin", m.Get("scope"))
 
 			return nil
 		},
 	}
 
-	_, err = client.PostForm(addr+"/oauth2/validate",
+	_, err = postAuthorizeForm(t, core, client, addr,
 		url.Values{"username": {"x"},
 			"password":      {"y"},
 			"authorize":     {"allow"},
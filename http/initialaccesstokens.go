@@ -0,0 +1,165 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//InitialAccessTokensURI is the base uri for the initial access tokens admins issue to allow clients to
+//use the dynamic client registration endpoint - the token id follows the base uri
+const InitialAccessTokensURI = "/v1/initialaccesstokens/"
+
+//initialAccessTokenRequest describes an initial access token to issue. ExpiresIn is the lifetime of the
+//token in seconds - tokens issued without a lifetime do not expire.
+type initialAccessTokenRequest struct {
+	Description string `json:"description"`
+	ExpiresIn   int64  `json:"expiresIn"`
+}
+
+//InitialAccessTokenResponse returns a newly issued initial access token. The token cannot be retrieved
+//again once issued.
+type InitialAccessTokenResponse struct {
+	roll.RegistrationToken
+	InitialAccessToken string `json:"initialAccessToken"`
+}
+
+func handleInitialAccessTokens(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleInitialAccessTokensGet(core, w, r)
+		case "POST":
+			handleInitialAccessTokensPost(core, w, r)
+		case "DELETE":
+			handleInitialAccessTokensDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//initialAccessTokenAdmin returns the subject of the caller, responding with an error if the caller is
+//not an admin
+func initialAccessTokenAdmin(core *roll.Core, w http.ResponseWriter, r *http.Request) string {
+	admin, err := scopeAdmin(core, r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return ""
+	}
+
+	if !admin {
+		respondError(w, http.StatusForbidden, errors.New("Admin scope required to manage initial access tokens"))
+		return ""
+	}
+
+	subject, _, err := subjectAndAdminScopeFromRequestCtx(r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return ""
+	}
+
+	return subject
+}
+
+func handleInitialAccessTokensGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	if initialAccessTokenAdmin(core, w, r) == "" {
+		return
+	}
+
+	tokens, err := core.ListInitialAccessTokens()
+	if err != nil {
+		log.Info("Error listing initial access tokens: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if tokens == nil {
+		tokens = []roll.RegistrationToken{}
+	}
+
+	respondOk(w, tokens)
+}
+
+func handleInitialAccessTokensPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	subject := initialAccessTokenAdmin(core, w, r)
+	if subject == "" {
+		return
+	}
+
+	if r.URL.Path != InitialAccessTokensURI {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+
+	var req initialAccessTokenRequest
+	if err := parseRequest(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if req.ExpiresIn < 0 {
+		respondError(w, http.StatusBadRequest, errors.New("Fields with invalid content: ExpiresIn "))
+		return
+	}
+
+	token := roll.RegistrationToken{
+		TokenType:   roll.InitialAccessTokenType,
+		IssuedBy:    subject,
+		Description: req.Description,
+	}
+
+	if req.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(req.ExpiresIn) * time.Second).Unix()
+	}
+
+	value, err := newRegistrationToken(core, &token)
+	if err != nil {
+		log.Info("Error issuing initial access token: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, InitialAccessTokenResponse{RegistrationToken: token, InitialAccessToken: value})
+}
+
+func handleInitialAccessTokensDelete(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	if initialAccessTokenAdmin(core, w, r) == "" {
+		return
+	}
+
+	tokenID := strings.TrimPrefix(r.URL.Path, InitialAccessTokensURI)
+	if tokenID == "" {
+		respondError(w, http.StatusBadRequest, errors.New("Resource not specified"))
+		return
+	}
+
+	//Registration access tokens belong to the client they were issued to, so are not managed here
+	token, err := core.RetrieveRegistrationToken(tokenID)
+	if err != nil {
+		log.Info("Error retrieving initial access token: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if token == nil || token.TokenType != roll.InitialAccessTokenType {
+		respondNotFound(w)
+		return
+	}
+
+	if err := core.DeleteRegistrationToken(tokenID); err != nil {
+		switch err.(type) {
+		case roll.NoSuchRegistrationTokenError:
+			respondNotFound(w)
+		default:
+			log.Info("Error deleting initial access token: ", err.Error())
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	respondOk(w, nil)
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitialAccessTokensPost(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	rtRepoMock := coreConfig.RegistrationTokenRepo.(*mocks.RegistrationTokenRepo)
+	rtRepoMock.On("StoreRegistrationToken", mock.AnythingOfType("*roll.RegistrationToken")).Return(nil)
+
+	resp := TestHTTPPostWithRollSubject(t, addr+InitialAccessTokensURI, initialAccessTokenRequest{Description: "partner onboarding", ExpiresIn: 3600})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var issued InitialAccessTokenResponse
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &issued)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(issued.InitialAccessToken, "steve."))
+
+	stored := rtRepoMock.Calls[0].Arguments.Get(0).(*roll.RegistrationToken)
+	assert.Equal(t, "steve", stored.TokenID)
+	assert.Equal(t, roll.InitialAccessTokenType, stored.TokenType)
+	assert.Equal(t, "rolltest", stored.IssuedBy)
+	assert.Equal(t, "partner onboarding", stored.Description)
+	assert.Equal(t, sha256Encoded(strings.TrimPrefix(issued.InitialAccessToken, "steve.")), stored.SecretHash)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), stored.ExpiresAt, 5)
+}
+
+func TestInitialAccessTokensPostNotAdmin(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(false, nil)
+
+	resp := TestHTTPPostWithRollSubject(t, addr+InitialAccessTokensURI, initialAccessTokenRequest{})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestInitialAccessTokensPostInvalidLifetime(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	resp := TestHTTPPostWithRollSubject(t, addr+InitialAccessTokensURI, initialAccessTokenRequest{ExpiresIn: -1})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestInitialAccessTokensList(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	rtRepoMock := coreConfig.RegistrationTokenRepo.(*mocks.RegistrationTokenRepo)
+	rtRepoMock.On("ListInitialAccessTokens").Return([]roll.RegistrationToken{
+		{TokenID: "a-token", SecretHash: "hashed", TokenType: roll.InitialAccessTokenType, IssuedBy: "rolltest"},
+	}, nil)
+
+	resp := TestHTTPGetWithRollSubject(t, addr+InitialAccessTokensURI, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body := responseAsString(t, resp)
+	assert.False(t, strings.Contains(body, "hashed"))
+
+	var tokens []roll.RegistrationToken
+	err := json.Unmarshal([]byte(body), &tokens)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(tokens)) {
+		assert.Equal(t, "a-token", tokens[0].TokenID)
+	}
+}
+
+func TestInitialAccessTokensDelete(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	rtRepoMock := coreConfig.RegistrationTokenRepo.(*mocks.RegistrationTokenRepo)
+	rtRepoMock.On("RetrieveRegistrationToken", "initial-token").Return(&roll.RegistrationToken{TokenID: "initial-token", TokenType: roll.InitialAccessTokenType}, nil)
+	rtRepoMock.On("RetrieveRegistrationToken", "client-token").Return(&roll.RegistrationToken{TokenID: "client-token", TokenType: roll.RegistrationAccessTokenType}, nil)
+	rtRepoMock.On("RetrieveRegistrationToken", "no-such-token").Return(nil, nil)
+	rtRepoMock.On("DeleteRegistrationToken", "initial-token").Return(nil)
+
+	resp := TestHTTPDeleteWithRollSubject(t, addr+InitialAccessTokensURI+"initial-token", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	t.Log("registration access tokens are not managed by admins")
+	resp = TestHTTPDeleteWithRollSubject(t, addr+InitialAccessTokensURI+"client-token", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = TestHTTPDeleteWithRollSubject(t, addr+InitialAccessTokensURI+"no-such-token", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	rtRepoMock.AssertNotCalled(t, "DeleteRegistrationToken", "client-token")
+}
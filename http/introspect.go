@@ -0,0 +1,188 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+)
+
+const (
+	//IntrospectURI is the uri for the token introspection endpoint (RFC 7662)
+	IntrospectURI = "/oauth2/introspect"
+)
+
+//introspectionResponse is the RFC 7662 description of a token. Only active is returned for
+//tokens that are not active.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+
+	//Audience is the client id, or the resources the token was issued for
+	Audience interface{} `json:"aud,omitempty"`
+}
+
+var inactiveToken = &introspectionResponse{Active: false}
+
+func handleIntrospect(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			handleIntrospectPost(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func int64Claim(claims map[string]interface{}, name string) int64 {
+	if val, ok := claims[name].(float64); ok {
+		return int64(val)
+	}
+
+	return 0
+}
+
+//introspectAccessToken describes an access token issued by roll. Tokens that fail validation, have
+//been revoked, or are not access tokens are reported as inactive.
+func introspectAccessToken(core *roll.Core, tokenString string) (*introspectionResponse, error) {
+	token, err := verifyAccessToken(core, tokenString)
+	if err != nil {
+		return inactiveToken, nil
+	}
+
+	scope, _ := token.Claims["scope"].(string)
+	clientID, ok := tokenClientID(token.Claims)
+	if !ok {
+		return inactiveToken, nil
+	}
+
+	revoked, err := tokenRevoked(core, token.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return inactiveToken, nil
+	}
+
+	subject, _ := token.Claims["sub"].(string)
+
+	return &introspectionResponse{
+		Active:    true,
+		Subject:   subject,
+		Scope:     scope,
+		ExpiresAt: int64Claim(token.Claims, "exp"),
+		IssuedAt:  int64Claim(token.Claims, "iat"),
+		ClientID:  clientID,
+		TokenType: "Bearer",
+		Audience:  token.Claims["aud"],
+	}, nil
+}
+
+//introspectRefreshToken describes a refresh token. The boolean return is false if the token is
+//not a known refresh token. Refresh tokens are only described to the client they were issued to.
+func introspectRefreshToken(core *roll.Core, tokenString string, callerID string) (*introspectionResponse, bool, error) {
+	rt, err := core.RetrieveRefreshToken(tokenString)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if rt == nil {
+		return nil, false, nil
+	}
+
+	if rt.ClientID != callerID || rt.Used || rt.Revoked || rt.Expired() {
+		return inactiveToken, true, nil
+	}
+
+	return &introspectionResponse{
+		Active:    true,
+		Subject:   rt.Subject,
+		Scope:     rt.Scope,
+		ExpiresAt: rt.ExpiresAt,
+		ClientID:  rt.ClientID,
+		TokenType: "refresh_token",
+	}, true, nil
+}
+
+//introspectToken describes the token, which may be an access token or a refresh token, to the
+//client identified by callerID. Access tokens are only described to the client they were issued
+//to or a client named in their audience.
+func introspectToken(core *roll.Core, tokenString string, callerID string) (*introspectionResponse, error) {
+	ir, err := introspectAccessToken(core, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if ir.Active {
+		if ir.ClientID != callerID && !audienceIncludes(ir.Audience, callerID) {
+			return inactiveToken, nil
+		}
+
+		return ir, nil
+	}
+
+	rtir, found, err := introspectRefreshToken(core, tokenString, callerID)
+	if err != nil || found {
+		return rtir, err
+	}
+
+	return inactiveToken, nil
+}
+
+func handleIntrospectPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	//The caller must authenticate using the client credentials of a registered application, which
+	//keeps the endpoint from being used to probe for valid tokens.
+	client, err := clientCredentialsFromRequest(core, r)
+	if err != nil {
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	if client.clientID == "" || !client.present() {
+		respondOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, ErrInvalidClientDetails)
+		return
+	}
+
+	app, err := authenticateClient(core, client, false)
+	if err != nil {
+		switch err {
+		case ErrRetrievingAppData:
+			respondServerError(w, err)
+		default:
+			respondOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, ErrInvalidClientDetails)
+		}
+
+		return
+	}
+
+	tokenString := r.FormValue("token")
+	if tokenString == "" {
+		respondInvalidRequest(w, errors.New("token missing from request"))
+		return
+	}
+
+	ir, err := introspectToken(core, tokenString, app.ClientID)
+	if err != nil {
+		log.Info("Error introspecting token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	irBytes, err := json.Marshal(ir)
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Write(irBytes)
+}
@@ -0,0 +1,287 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	rolltoken "github.com/xtraclabs/rollsecrets/token"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func introspect(t *testing.T, addr, token string) (int, *introspectionResponse) {
+	resp, err := http.PostForm(addr+IntrospectURI,
+		url.Values{"client_id": {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"token":         {token}})
+	assert.Nil(t, err)
+
+	var ir introspectionResponse
+	if resp.StatusCode == http.StatusOK {
+		body := responseAsString(t, resp)
+		err = json.Unmarshal([]byte(body), &ir)
+		assert.Nil(t, err)
+	}
+
+	return resp.StatusCode, &ir
+}
+
+func TestIntrospectUnsupportedMethod(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.Get(addr + IntrospectURI)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestIntrospectUnauthenticated(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.PostForm(addr+IntrospectURI, url.Values{"token": {"xxx.xxx.xxx"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestIntrospectActiveAccessToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupRevokeTestApp(t, coreConfig)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	token, err := rolltoken.GenerateToken("a-subject", "admin", "1111-2222-3333333-4444444", "fight club", privateKey)
+	assert.Nil(t, err)
+
+	status, ir := introspect(t, addr, token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, ir.Active)
+	assert.Equal(t, "a-subject", ir.Subject)
+	assert.Equal(t, "admin", ir.Scope)
+	assert.Equal(t, "1111-2222-3333333-4444444", ir.ClientID)
+	assert.Equal(t, "Bearer", ir.TokenType)
+	assert.True(t, ir.ExpiresAt > time.Now().Unix())
+	assert.True(t, ir.IssuedAt > 0)
+}
+
+func TestIntrospectRevokedAccessToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupRevokeTestApp(t, coreConfig)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(true, nil)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", mock.Anything).Return(nil, nil)
+
+	token, err := rolltoken.GenerateToken("a-subject", "", "1111-2222-3333333-4444444", "fight club", privateKey)
+	assert.Nil(t, err)
+
+	status, ir := introspect(t, addr, token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, ir.Active)
+	assert.Equal(t, "", ir.Subject)
+}
+
+func TestIntrospectAuthCode(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupRevokeTestApp(t, coreConfig)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", mock.Anything).Return(nil, nil)
+
+	code, err := rolltoken.GenerateCode("a-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	status, ir := introspect(t, addr, code)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, ir.Active)
+}
+
+func TestIntrospectGarbage(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "xxx.xxx.xxx").Return(nil, nil)
+
+	status, ir := introspect(t, addr, "xxx.xxx.xxx")
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, ir.Active)
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+
+	status, ir := introspect(t, addr, "rt1")
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, ir.Active)
+	assert.Equal(t, "refresh_token", ir.TokenType)
+	assert.Equal(t, "a-subject", ir.Subject)
+}
+
+func TestIntrospectOtherTokensSignedWithAppKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupRevokeTestApp(t, coreConfig)
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", mock.Anything).Return(nil, nil)
+
+	session, err := newLoginSession(core, "a-subject", app, nil)
+	assert.Nil(t, err)
+
+	r, _ := http.NewRequest("GET", AuthorizeBaseURI, nil)
+	csrfToken, err := newCSRFToken(core, httptest.NewRecorder(), r, app, url.Values{})
+	assert.Nil(t, err)
+
+	idToken, err := generateIDToken(core, "a-subject", app, &signIn{Issuer: "http://localhost"}, "an-access-token")
+	assert.Nil(t, err)
+
+	noJTI, err := signToken(map[string]interface{}{
+		"sub":       "a-subject",
+		"aud":       app.ClientID,
+		"client_id": app.ClientID,
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}, privateKey)
+	assert.Nil(t, err)
+
+	for _, token := range []string{session, csrfToken, idToken, noJTI} {
+		status, ir := introspect(t, addr, token)
+		assert.Equal(t, http.StatusOK, status)
+		assert.False(t, ir.Active)
+	}
+}
+
+const otherIntrospectClientID = "5555-6666-7777777-8888888"
+
+//setupOtherIntrospectApp registers a second application whose tokens the test app introspects
+func setupOtherIntrospectApp(t *testing.T, coreConfig *roll.CoreConfig) string {
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", otherIntrospectClientID).Return(&roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        otherIntrospectClientID,
+		ApplicationName: "project mayhem",
+		ClientSecret:    "another secret",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+	}, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", otherIntrospectClientID).Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", otherIntrospectClientID).Return(publicKey, nil)
+
+	return privateKey
+}
+
+func TestIntrospectOtherClientsAccessToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+	privateKey := setupOtherIntrospectApp(t, coreConfig)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	token, err := rolltoken.GenerateToken("a-subject", "admin", otherIntrospectClientID, "project mayhem", privateKey)
+	assert.Nil(t, err)
+
+	status, ir := introspect(t, addr, token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, ir.Active)
+	assert.Equal(t, "", ir.Subject)
+}
+
+func TestIntrospectAccessTokenNamingCallerInAudience(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+	privateKey := setupOtherIntrospectApp(t, coreConfig)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	token, err := signToken(map[string]interface{}{
+		"sub":       "a-subject",
+		"aud":       []string{"https://api.example.com", "1111-2222-3333333-4444444"},
+		"client_id": otherIntrospectClientID,
+		"jti":       "at1",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}, privateKey)
+	assert.Nil(t, err)
+
+	status, ir := introspect(t, addr, token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, ir.Active)
+	assert.Equal(t, otherIntrospectClientID, ir.ClientID)
+}
+
+func TestIntrospectOtherClientsRefreshToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  otherIntrospectClientID,
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+
+	status, ir := introspect(t, addr, "rt1")
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, ir.Active)
+	assert.Equal(t, "", ir.Subject)
+}
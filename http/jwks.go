@@ -0,0 +1,378 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+const (
+	//JWKSURI is the uri for the JSON Web Key Set holding the public keys of every application
+	JWKSURI = "/.well-known/jwks.json"
+
+	//AppJWKSURI is the base uri for the JSON Web Key Set of a single application - the client id
+	//of the application follows the base uri
+	AppJWKSURI = "/.well-known/jwks/"
+
+	//Key sets change rarely, so let gateways and resource servers cache them for a while
+	jwksCacheControl = "public, max-age=3600"
+)
+
+//jsonWebKey is a public key in JWK form - RSA keys are described in RFC 7518 section 6.3, EC keys in
+//RFC 7518 section 6.2, and Ed25519 keys in RFC 8037 section 2
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+//base64URLUInt encodes an unsigned integer as described in RFC 7518 section 2
+func base64URLUInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+//base64URLCoordinate encodes an EC point coordinate, which must be the full size of the curve's field
+//elements - see RFC 7518 section 6.2.1.2
+func base64URLCoordinate(i *big.Int, curve elliptic.Curve) string {
+	b := make([]byte, (curve.Params().BitSize+7)/8)
+	return base64.RawURLEncoding.EncodeToString(i.FillBytes(b))
+}
+
+//thumbprint returns the RFC 7638 JWK thumbprint of the key, which is computed over the required members
+//of the key in lexicographic order
+func (jwk *jsonWebKey) thumbprint() string {
+	var thumbprintInput string
+	switch jwk.KeyType {
+	case "EC":
+		thumbprintInput = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Curve, jwk.X, jwk.Y)
+	case "OKP":
+		thumbprintInput = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Curve, jwk.X)
+	default:
+		thumbprintInput = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.Exponent, jwk.Modulus)
+	}
+
+	sum := sha256.Sum256([]byte(thumbprintInput))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+//keyID returns the RFC 7638 JWK thumbprint of the public key, which is used as the kid of the key
+func keyID(publicKey crypto.PublicKey) string {
+	jwk, err := jwkFromPublicKey(publicKey)
+	if err != nil {
+		return ""
+	}
+
+	return jwk.KeyID
+}
+
+//jwkFromPublicKey converts an RSA, EC or Ed25519 public key to a JWK
+func jwkFromPublicKey(publicKey crypto.PublicKey) (*jsonWebKey, error) {
+	method, err := signing.MethodForKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := &jsonWebKey{
+		Use:       "sig",
+		Algorithm: method.Alg(),
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.Modulus = base64URLUInt(key.N)
+		jwk.Exponent = base64URLUInt(big.NewInt(int64(key.E)))
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = key.Curve.Params().Name
+		jwk.X = base64URLCoordinate(key.X, key.Curve)
+		jwk.Y = base64URLCoordinate(key.Y, key.Curve)
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	}
+
+	jwk.KeyID = jwk.thumbprint()
+	return jwk, nil
+}
+
+//jwkFromPEM converts a PEM encoded public key to a JWK
+func jwkFromPEM(publicKeyPEM string) (*jsonWebKey, error) {
+	publicKey, err := signing.ParsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwkFromPublicKey(publicKey)
+}
+
+//jwkCurves are the curves of the EC keys roll accepts in JWK form
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+}
+
+//parseJWK reads the public key described by an RSA, EC or Ed25519 JWK
+func parseJWK(jwk *jsonWebKey) (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+		if err != nil {
+			return nil, err
+		}
+
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.Exponent)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(modulus) == 0 || len(exponent) == 0 || len(exponent) > 4 {
+			return nil, errors.New("Invalid RSA key")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}, nil
+	case "EC":
+		curve, ok := jwkCurves[jwk.Curve]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported curve %s", jwk.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+
+		if !curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, errors.New("Invalid EC key")
+		}
+
+		return publicKey, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("Unsupported curve %s", jwk.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("Unsupported key type %s", jwk.KeyType)
+}
+
+//publicKeyPEMFromJWK converts an RSA, EC or Ed25519 JWK to a PEM encoded public key
+func publicKeyPEMFromJWK(jwk *jsonWebKey) (string, error) {
+	publicKey, err := parseJWK(jwk)
+	if err != nil {
+		return "", err
+	}
+
+	return signing.PublicKeyPEM(publicKey)
+}
+
+//signToken signs the claims with the given private key, using the signing method for the type of key. The
+//kid header identifies the key so verifiers can select it from the key set.
+func signToken(claims map[string]interface{}, privateKey string) (string, error) {
+	return signTypedToken(claims, privateKey, "JWT")
+}
+
+//signTypedToken is signToken with the given typ header, which distinguishes the tokens that are signed with
+//the application's key but are not access tokens
+func signTypedToken(claims map[string]interface{}, privateKey, typ string) (string, error) {
+	signingKey, err := signing.ParsePrivateKeyPEM(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	method, err := signing.MethodForKey(signingKey.Public())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.New(method)
+	token.Header["typ"] = typ
+	token.Header["kid"] = keyID(signingKey.Public())
+	token.Claims = claims
+	return token.SignedString(signingKey)
+}
+
+//appJWK returns the JWK for the application's current token signing key
+func appJWK(core *roll.Core, clientID string) (*jsonWebKey, error) {
+	return secretJWK(core, clientID)
+}
+
+//secretJWK returns the JWK for the public key held under the given name in the secrets repo
+func secretJWK(core *roll.Core, secretName string) (*jsonWebKey, error) {
+	publicKey, err := core.RetrievePublicKeyForApp(secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwkFromPEM(publicKey)
+}
+
+//appJWKs returns the JWKs for the application's signing keys that still verify tokens - the current
+//key, and any replaced keys that have not yet been retired
+func appJWKs(core *roll.Core, clientID string) ([]jsonWebKey, error) {
+	keys, err := core.ListSigningKeys(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	//Applications that have never had their key rotated have just the one key
+	if len(keys) == 0 {
+		key, err := appJWK(core, clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		return []jsonWebKey{*key}, nil
+	}
+
+	var jwks []jsonWebKey
+	for i := range keys {
+		if keys[i].State() == roll.SigningKeyRetired {
+			continue
+		}
+
+		key, err := secretJWK(core, keys[i].SecretName())
+		if err != nil {
+			return nil, err
+		}
+
+		jwks = append(jwks, *key)
+	}
+
+	return jwks, nil
+}
+
+func respondWithKeySet(w http.ResponseWriter, keySet *jsonWebKeySet) {
+	keySetBytes, err := json.Marshal(keySet)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", jwksCacheControl)
+	w.Write(keySetBytes)
+}
+
+func handleJWKS(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleJWKSGet(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func handleJWKSGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	apps, err := core.ListApplications("", true)
+	if err != nil {
+		log.Info("Error listing applications: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	keySet := &jsonWebKeySet{Keys: make([]jsonWebKey, 0, len(apps))}
+	for _, app := range apps {
+		keys, err := appJWKs(core, app.ClientID)
+		if err != nil {
+			//Don't let one application with a missing or unreadable key hide the keys of the others
+			log.Info("Error reading public keys for ", app.ClientID, ": ", err.Error())
+			continue
+		}
+
+		keySet.Keys = append(keySet.Keys, keys...)
+	}
+
+	respondWithKeySet(w, keySet)
+}
+
+func handleAppJWKS(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleAppJWKSGet(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func handleAppJWKSGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	clientID := strings.TrimPrefix(r.URL.Path, AppJWKSURI)
+	if clientID == "" {
+		respondError(w, http.StatusNotFound, errors.New("Resource not specified"))
+		return
+	}
+
+	app, err := core.SystemRetrieveApplication(clientID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if app == nil {
+		respondNotFound(w)
+		return
+	}
+
+	keys, err := appJWKs(core, app.ClientID)
+	if err != nil {
+		log.Info("Error reading public keys for ", app.ClientID, ": ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithKeySet(w, &jsonWebKeySet{Keys: keys})
+}
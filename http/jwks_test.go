@@ -0,0 +1,230 @@
+package http
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/roll/signing"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"math/big"
+	"net/http"
+	"testing"
+)
+
+func publicKeyFromJWK(t *testing.T, key jsonWebKey) *rsa.PublicKey {
+	n, err := base64.RawURLEncoding.DecodeString(key.Modulus)
+	assert.Nil(t, err)
+	e, err := base64.RawURLEncoding.DecodeString(key.Exponent)
+	assert.Nil(t, err)
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+}
+
+func readKeySet(t *testing.T, resp *http.Response) jsonWebKeySet {
+	var keySet jsonWebKeySet
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &keySet)
+	assert.Nil(t, err)
+	return keySet
+}
+
+func TestKeyIDIsThumbprint(t *testing.T) {
+	//Example key from RFC 7638 section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", keyID(publicKey))
+}
+
+func TestIssuedTokensHaveKeyID(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupPKCETestApp(t, coreConfig, false)
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	accessToken, err := generateJWT("x", "", core, app, nil)
+	assert.Nil(t, err)
+
+	key, err := appJWK(core, app.ClientID)
+	assert.Nil(t, err)
+
+	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, key.KeyID, token.Header["kid"])
+		return publicKeyFromJWK(t, *key), nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, token.Valid)
+}
+
+func TestJWKS(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	_, publicKey1, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+	_, publicKey2, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("ListApplications", "", true).Return([]roll.Application{
+		{ClientID: "app-1"}, {ClientID: "app-2"}, {ClientID: "app-without-key"},
+	}, nil)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePublicKeyForApp", "app-1").Return(publicKey1, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "app-2").Return(publicKey2, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "app-without-key").Return("", errors.New("no key"))
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("ListSigningKeys", mock.Anything).Return(nil, nil)
+
+	resp := TestHTTPGet(t, addr+JWKSURI, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, jwksCacheControl, resp.Header.Get("Cache-Control"))
+
+	keySet := readKeySet(t, resp)
+	if assert.Equal(t, 2, len(keySet.Keys)) {
+		key1, _ := jwkFromPEM(publicKey1)
+		key2, _ := jwkFromPEM(publicKey2)
+		assert.Equal(t, *key1, keySet.Keys[0])
+		assert.Equal(t, *key2, keySet.Keys[1])
+		assert.Equal(t, "RSA", keySet.Keys[0].KeyType)
+		assert.Equal(t, "RS256", keySet.Keys[0].Algorithm)
+	}
+}
+
+func TestAppJWKS(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("ListSigningKeys", "1111-2222-3333333-4444444").Return(nil, nil)
+
+	resp := TestHTTPGet(t, addr+AppJWKSURI+"1111-2222-3333333-4444444", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, jwksCacheControl, resp.Header.Get("Cache-Control"))
+
+	keySet := readKeySet(t, resp)
+	if assert.Equal(t, 1, len(keySet.Keys)) {
+		signingKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+		assert.Nil(t, err)
+		assert.Equal(t, keyID(&signingKey.PublicKey), keySet.Keys[0].KeyID)
+		assert.Equal(t, signingKey.PublicKey.N, publicKeyFromJWK(t, keySet.Keys[0]).N)
+	}
+}
+
+func TestAppJWKSUnknownApp(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "no-such-app").Return(nil, nil)
+
+	resp := TestHTTPGet(t, addr+AppJWKSURI+"no-such-app", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestEd25519KeyIDIsThumbprint(t *testing.T) {
+	//Example key from RFC 8037 appendix A.3
+	jwk := jsonWebKey{KeyType: "OKP", Curve: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	publicKey, err := parseJWK(&jwk)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", keyID(publicKey))
+	}
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	for _, alg := range []string{"RS256", "ES256", "ES384", "EdDSA"} {
+		_, publicKey, err := signing.GenerateKeyPair(alg)
+		assert.Nil(t, err)
+
+		jwk, err := jwkFromPEM(publicKey)
+		if !assert.Nil(t, err, alg) {
+			continue
+		}
+
+		assert.Equal(t, alg, jwk.Algorithm)
+
+		publicKeyPEM, err := publicKeyPEMFromJWK(jwk)
+		assert.Nil(t, err, alg)
+
+		roundTripped, err := jwkFromPEM(publicKeyPEM)
+		if assert.Nil(t, err, alg) {
+			assert.Equal(t, *jwk, *roundTripped)
+		}
+	}
+}
+
+func TestECJWKMembers(t *testing.T) {
+	_, publicKey, err := signing.GenerateKeyPair("ES384")
+	assert.Nil(t, err)
+
+	jwk, err := jwkFromPEM(publicKey)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "EC", jwk.KeyType)
+		assert.Equal(t, "P-384", jwk.Curve)
+		assert.Equal(t, 64, len(jwk.X))
+		assert.Equal(t, 64, len(jwk.Y))
+		assert.Equal(t, "", jwk.Modulus)
+	}
+}
+
+func TestInvalidECJWK(t *testing.T) {
+	_, publicKey, err := signing.GenerateKeyPair("ES256")
+	assert.Nil(t, err)
+
+	jwk, err := jwkFromPEM(publicKey)
+	assert.Nil(t, err)
+
+	jwk.Y = jwk.X
+	_, err = publicKeyPEMFromJWK(jwk)
+	assert.NotNil(t, err)
+
+	jwk.Curve = "P-521"
+	_, err = publicKeyPEMFromJWK(jwk)
+	assert.NotNil(t, err)
+}
+
+//setupSigningAlgTestApp gives the test app a signing key for the given algorithm, returning the private key
+func setupSigningAlgTestApp(t *testing.T, coreConfig *roll.CoreConfig, alg string) string {
+	privateKey, publicKey, err := signing.GenerateKeyPair(alg)
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	return privateKey
+}
+
+func TestIssuedTokensSignedWithAppAlg(t *testing.T) {
+	for _, alg := range []string{"ES256", "ES384", "EdDSA"} {
+		core, coreConfig := NewTestCore()
+		setupSigningAlgTestApp(t, coreConfig, alg)
+
+		app := &roll.Application{ClientID: "1111-2222-3333333-4444444", TokenSigningAlg: alg}
+		accessToken, err := generateJWT("x", "", core, app, nil)
+		assert.Nil(t, err)
+
+		key, err := appJWK(core, app.ClientID)
+		assert.Nil(t, err)
+
+		token, err := jwt.Parse(accessToken, keyExtractionFunction(core))
+		if assert.Nil(t, err, alg) {
+			assert.Equal(t, alg, token.Header["alg"])
+			assert.Equal(t, key.KeyID, token.Header["kid"])
+			assert.Equal(t, "x", token.Claims["sub"])
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"net/http"
+	"time"
+)
+
+var (
+	//ErrUnknownAssertionIssuer is returned when no application trusts the assertion issuer for the assertion audience
+	ErrUnknownAssertionIssuer = errors.New("Foreign token issuer not known")
+
+	//ErrInvalidAssertionSignature is returned when the assertion is not signed with a key of the issuer
+	ErrInvalidAssertionSignature = errors.New("Assertion signature not valid")
+
+	//ErrAssertionMissingExpiry is returned for assertions without an exp claim
+	ErrAssertionMissingExpiry = errors.New("Assertion has no exp claim")
+
+	//ErrAssertionMissingID is returned for assertions without a jti claim, which is needed to detect replays
+	ErrAssertionMissingID = errors.New("Assertion has no jti claim")
+
+	//ErrAssertionExpired is returned for assertions that have expired
+	ErrAssertionExpired = errors.New("Assertion has expired")
+
+	//ErrAssertionNotYetValid is returned for assertions used before their nbf time, or issued in the future
+	ErrAssertionNotYetValid = errors.New("Assertion not yet valid")
+
+	//ErrAssertionLifetime is returned for assertions that expire too far in the future
+	ErrAssertionLifetime = errors.New("Assertion expiry too far in the future")
+
+	//ErrAssertionReplayed is returned for assertions that have already been exchanged for a token
+	ErrAssertionReplayed = errors.New("Assertion has already been used")
+
+	//ErrSubjectNotAllowed is returned when the issuer may not make assertions about the subject
+	ErrSubjectNotAllowed = errors.New("Subject not allowed for assertion issuer")
+)
+
+//resolveAssertionIssuer looks up the trusted issuer for the assertion issuer and audience, and the application
+//trusting it. Issuers in the trusted issuer registry are checked first, then the issuer registered in the
+//JWT flow settings of the application. The legacy return value is true for issuers from the JWT flow settings.
+func resolveAssertionIssuer(core *roll.Core, issuer, audience string) (*roll.TrustedIssuer, *roll.Application, bool, error) {
+	ti, err := core.RetrieveTrustedIssuer(issuer, audience)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if ti != nil {
+		app, err := lookupApplication(core, ti.ClientID)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		return ti, app, false, nil
+	}
+
+	app, err := core.SystemRetrieveApplicationByJWTFlowAudience(audience)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if app == nil || app.JWTFlowIssuer == "" || app.JWTFlowIssuer != issuer {
+		return nil, nil, false, ErrUnknownAssertionIssuer
+	}
+
+	return &roll.TrustedIssuer{
+		ClientID:   app.ClientID,
+		Issuer:     app.JWTFlowIssuer,
+		Audience:   audience,
+		PublicKeys: app.JWTFlowPublicKey,
+	}, app, true, nil
+}
+
+//verifyAssertionSignature returns the claims of an assertion signed with one of the issuer's keys. The
+//exp and nbf claims are checked by checkAssertionTimes instead, which allows for clock skew.
+func verifyAssertionSignature(assertion string, ti *roll.TrustedIssuer) (map[string]interface{}, error) {
+	for _, keyPEM := range ti.PublicKeyPEMs() {
+		token, err := jwt.Parse(assertion, func(token *jwt.Token) (interface{}, error) {
+			return signing.VerificationKey(token, keyPEM)
+		})
+
+		if err == nil {
+			return token.Claims, nil
+		}
+
+		if vErr, ok := err.(*jwt.ValidationError); ok &&
+			vErr.Errors&^(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) == 0 {
+			return token.Claims, nil
+		}
+	}
+
+	return nil, ErrInvalidAssertionSignature
+}
+
+//checkAssertionTimes checks the time claims of an assertion, allowing for the configured clock skew. The
+//exp claim is required, and may be no further in the future than the configured maximum lifetime.
+func checkAssertionTimes(core *roll.Core, claims map[string]interface{}) error {
+	now := time.Now()
+	skew := core.JWTAssertionClockSkew()
+
+	if _, ok := claims["exp"].(float64); !ok {
+		return ErrAssertionMissingExpiry
+	}
+
+	expiresAt := time.Unix(int64Claim(claims, "exp"), 0)
+	if now.After(expiresAt.Add(skew)) {
+		return ErrAssertionExpired
+	}
+
+	if expiresAt.After(now.Add(core.JWTAssertionMaxLifetime() + skew)) {
+		return ErrAssertionLifetime
+	}
+
+	if _, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64Claim(claims, "nbf"), 0).Add(-skew)) {
+		return ErrAssertionNotYetValid
+	}
+
+	if _, ok := claims["iat"].(float64); ok && time.Unix(int64Claim(claims, "iat"), 0).After(now.Add(skew)) {
+		return ErrAssertionNotYetValid
+	}
+
+	return nil
+}
+
+//handleJWTGrantType issues an access token in exchange for a JWT bearer assertion - see RFC 7523. The
+//assertion must be signed by an issuer the application named in its aud claim trusts, be current and
+//unused, and name a subject and scope the issuer is allowed to assert.
+func handleJWTGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
+	unverified := unverifiedClaims(codeContext.assertion)
+	if unverified == nil {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, errors.New("Malformed assertion"))
+		return
+	}
+
+	issuer, _ := unverified["iss"].(string)
+	audience, _ := unverified["aud"].(string)
+	if issuer == "" || audience == "" {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, errors.New("Assertion must include iss and aud claims"))
+		return
+	}
+
+	ti, app, legacy, err := resolveAssertionIssuer(core, issuer, audience)
+	if err != nil {
+		log.Info("Unable to resolve issuer ", issuer, " for audience ", audience, ": ", err.Error())
+		if err == ErrUnknownAssertionIssuer {
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, err)
+			return
+		}
+
+		respondServerError(w, err)
+		return
+	}
+
+	claims, err := verifyAssertionSignature(codeContext.assertion, ti)
+	if err != nil {
+		log.Info("Assertion from ", issuer, " not signed with a registered key")
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, err)
+		return
+	}
+
+	if !app.AllowsGrantType(codeContext.grantType) {
+		log.Info("Grant type ", codeContext.grantType, " not allowed for ", app.ClientID)
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2UnauthorizedClient, ErrGrantTypeNotAllowed)
+		return
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, errors.New("JWT missing sub claim"))
+		return
+	}
+
+	if !ti.SubjectAllowed(subject) {
+		log.Info("Issuer ", issuer, " may not assert subject ", subject)
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrSubjectNotAllowed)
+		return
+	}
+
+	if err := checkAssertionTimes(core, claims); err != nil {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, err)
+		return
+	}
+
+	tokenID, _ := claims["jti"].(string)
+	if tokenID == "" {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrAssertionMissingID)
+		return
+	}
+
+	//Issuers in the registry must list the scopes they may assert, and like any other grant the
+	//scope must be one the application may request
+	scope, _ := claims["scope"].(string)
+	if !legacy && !scopeWithinGrant(scope, ti.AllowedScopes) {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, ErrScopeNotAllowed)
+		return
+	}
+
+	if err := validateRequestedScope(core, app, scope); err != nil {
+		respondScopeError(w, err)
+		return
+	}
+
+	//The assertion is accepted until its expiry plus the clock skew, so its use must be remembered until then
+	expiresAt := int64Claim(claims, "exp") + int64(core.JWTAssertionClockSkew()/time.Second)
+	if err := core.RecordAssertionUse(issuer, tokenID, expiresAt); err != nil {
+		switch err.(type) {
+		case roll.AssertionReplayError:
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrAssertionReplayed)
+		default:
+			respondServerError(w, err)
+		}
+
+		return
+	}
+
+	generateAndRespondWithAccessToken(core, subject, scope, codeContext.resources, app, w)
+}
@@ -0,0 +1,263 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/roll/signing"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	trustedIssuer   = "https://idp.example.com"
+	trustedAudience = "https://roll.example.com"
+)
+
+//setupTrustedIssuer registers an issuer with two signing keys, trusted by the test app. The private keys
+//are returned, along with the replay repo mock.
+func setupTrustedIssuer(t *testing.T, coreConfig *roll.CoreConfig) (string, string, *mocks.AssertionReplayRepo) {
+	return setupTrustedIssuerWithAlgs(t, coreConfig, signing.RS256, signing.RS256)
+}
+
+//setupTrustedIssuerWithAlgs is setupTrustedIssuer with issuer keys for the given algorithms
+func setupTrustedIssuerWithAlgs(t *testing.T, coreConfig *roll.CoreConfig, alg1, alg2 string) (string, string, *mocks.AssertionReplayRepo) {
+	privateKey1, publicKey1, err := signing.GenerateKeyPair(alg1)
+	assert.Nil(t, err)
+	privateKey2, publicKey2, err := signing.GenerateKeyPair(alg2)
+	assert.Nil(t, err)
+
+	ti := &roll.TrustedIssuer{
+		ClientID:        "1111-2222-3333333-4444444",
+		Issuer:          trustedIssuer,
+		Audience:        trustedAudience,
+		PublicKeys:      publicKey1 + publicKey2,
+		AllowedSubjects: "svc-a svc-b",
+		AllowedScopes:   "read write",
+	}
+
+	trustedIssuerRepoMock := coreConfig.TrustedIssuerRepo.(*mocks.TrustedIssuerRepo)
+	trustedIssuerRepoMock.On("RetrieveTrustedIssuer", trustedIssuer, trustedAudience).Return(ti, nil)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "batch job",
+		AllowedScopes:   "read write",
+	}, nil)
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("RetrieveScope", "read").Return(&roll.Scope{Name: "read", Description: "Read your data"}, nil)
+	scopeRepoMock.On("RetrieveScope", "write").Return(&roll.Scope{Name: "write", Description: "Change your data"}, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	return privateKey1, privateKey2, coreConfig.AssertionReplayRepo.(*mocks.AssertionReplayRepo)
+}
+
+func bearerAssertionClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   trustedIssuer,
+		"aud":   trustedAudience,
+		"sub":   "svc-a",
+		"scope": "read",
+		"jti":   "assertion-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+	}
+}
+
+func postAssertion(t *testing.T, addr, assertion string) *http.Response {
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion": {assertion}})
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestJWTBearerTrustedIssuerOk(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	_, issuerKey2, replayRepoMock := setupTrustedIssuer(t, coreConfig)
+	replayRepoMock.On("RecordAssertionUse", trustedIssuer, "assertion-1", mock.Anything).Return(nil)
+
+	//Assertions signed with any of the issuer's keys are accepted
+	resp := postAssertion(t, addr, clientAssertion(t, issuerKey2, bearerAssertionClaims()))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, keyExtractionFunction(core))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "1111-2222-3333333-4444444", token.Claims["aud"])
+		assert.Equal(t, "svc-a", token.Claims["sub"])
+		assert.Equal(t, "read", token.Claims["scope"])
+	}
+}
+
+func TestJWTBearerECAndEd25519IssuerKeys(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	issuerKey1, issuerKey2, replayRepoMock := setupTrustedIssuerWithAlgs(t, coreConfig, signing.ES256, signing.EdDSA)
+	replayRepoMock.On("RecordAssertionUse", trustedIssuer, mock.Anything, mock.Anything).Return(nil)
+
+	resp := postAssertion(t, addr, clientAssertion(t, issuerKey1, bearerAssertionClaims()))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	claims := bearerAssertionClaims()
+	claims["jti"] = "assertion-2"
+	resp = postAssertion(t, addr, clientAssertion(t, issuerKey2, claims))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	otherKey, _, err := signing.GenerateKeyPair(signing.ES256)
+	assert.Nil(t, err)
+
+	claims["jti"] = "assertion-3"
+	resp = postAssertion(t, addr, clientAssertion(t, otherKey, claims))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestJWTBearerUnknownKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupTrustedIssuer(t, coreConfig)
+	otherKey, _, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	resp := postAssertion(t, addr, clientAssertion(t, otherKey, bearerAssertionClaims()))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestJWTBearerRegistryLookupError(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	issuerKey, _, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	trustedIssuerRepoMock := coreConfig.TrustedIssuerRepo.(*mocks.TrustedIssuerRepo)
+	trustedIssuerRepoMock.On("RetrieveTrustedIssuer", trustedIssuer, trustedAudience).Return(nil, errors.New("Drat"))
+
+	resp := postAssertion(t, addr, clientAssertion(t, issuerKey, bearerAssertionClaims()))
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestJWTBearerPolicyViolations(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	issuerKey, _, _ := setupTrustedIssuer(t, coreConfig)
+
+	subjectNotAllowed := bearerAssertionClaims()
+	subjectNotAllowed["sub"] = "svc-c"
+
+	noExpiry := bearerAssertionClaims()
+	delete(noExpiry, "exp")
+
+	expired := bearerAssertionClaims()
+	expired["exp"] = time.Now().Add(-roll.DefaultJWTAssertionClockSkew - time.Minute).Unix()
+
+	tooLong := bearerAssertionClaims()
+	tooLong["exp"] = time.Now().Add(roll.DefaultJWTAssertionMaxLifetime + 2*roll.DefaultJWTAssertionClockSkew).Unix()
+
+	notYetValid := bearerAssertionClaims()
+	notYetValid["nbf"] = time.Now().Add(2 * roll.DefaultJWTAssertionClockSkew).Unix()
+
+	issuedInFuture := bearerAssertionClaims()
+	issuedInFuture["iat"] = time.Now().Add(2 * roll.DefaultJWTAssertionClockSkew).Unix()
+
+	noID := bearerAssertionClaims()
+	delete(noID, "jti")
+
+	for _, claims := range []map[string]interface{}{subjectNotAllowed, noExpiry, expired, tooLong, notYetValid, issuedInFuture, noID} {
+		resp := postAssertion(t, addr, clientAssertion(t, issuerKey, claims))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, "invalid_grant", readOAuth2Error(t, resp).Error)
+	}
+}
+
+func TestJWTBearerScopeNotAllowed(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	issuerKey, _, _ := setupTrustedIssuer(t, coreConfig)
+
+	claims := bearerAssertionClaims()
+	claims["scope"] = "read admin"
+
+	resp := postAssertion(t, addr, clientAssertion(t, issuerKey, claims))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_scope", readOAuth2Error(t, resp).Error)
+}
+
+func TestJWTBearerWithinClockSkew(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	issuerKey, _, replayRepoMock := setupTrustedIssuer(t, coreConfig)
+	replayRepoMock.On("RecordAssertionUse", trustedIssuer, "assertion-1", mock.Anything).Return(nil)
+
+	claims := bearerAssertionClaims()
+	claims["exp"] = time.Now().Add(-roll.DefaultJWTAssertionClockSkew / 2).Unix()
+	claims["nbf"] = time.Now().Add(roll.DefaultJWTAssertionClockSkew / 2).Unix()
+
+	resp := postAssertion(t, addr, clientAssertion(t, issuerKey, claims))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestJWTBearerReplay(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	issuerKey, _, replayRepoMock := setupTrustedIssuer(t, coreConfig)
+	replayRepoMock.On("RecordAssertionUse", trustedIssuer, "assertion-1", mock.Anything).Return(roll.AssertionReplayError{})
+
+	resp := postAssertion(t, addr, clientAssertion(t, issuerKey, bearerAssertionClaims()))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	errResp := readOAuth2Error(t, resp)
+	assert.Equal(t, "invalid_grant", errResp.Error)
+	assert.Equal(t, ErrAssertionReplayed.Error(), errResp.ErrorDescription)
+}
+
+func TestJWTBearerConfiguredClockSkew(t *testing.T) {
+	_, coreConfig := NewTestCore()
+	coreConfig.JWTAssertionClockSkew = 10 * time.Minute
+	core := roll.NewCore(coreConfig)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	issuerKey, _, replayRepoMock := setupTrustedIssuer(t, coreConfig)
+	replayRepoMock.On("RecordAssertionUse", trustedIssuer, "assertion-1", mock.Anything).Return(nil)
+
+	claims := bearerAssertionClaims()
+	claims["exp"] = time.Now().Add(-5 * time.Minute).Unix()
+
+	resp := postAssertion(t, addr, clientAssertion(t, issuerKey, claims))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	log "github.com/Sirupsen/logrus"
 	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
 	"net/http"
 	"strings"
 )
@@ -83,21 +84,13 @@ func extractPublicKeyFromCert(certPEM string) (string, error) {
 		return "", errors.New("failed to parse certificate: " + err.Error())
 	}
 
-	pk := cert.PublicKey
-
-	pkbytes, err := x509.MarshalPKIXPublicKey(pk)
+	//RSA, EC and Ed25519 keys are supported, and are stored in PKIX form
+	pemdata, err := signing.PublicKeyPEM(cert.PublicKey)
 	if err != nil {
-		return "", errors.New("unable to marshal public key")
+		return "", errors.New("unable to use certificate public key: " + err.Error())
 	}
 
-	pemdata := pem.EncodeToMemory(
-		&pem.Block{
-			Type:  "RSA PUBLIC KEY",
-			Bytes: pkbytes,
-		},
-	)
-
-	return string(pemdata), nil
+	return pemdata, nil
 }
 
 func checkBodyContent(certCtx CertPutCtx) error {
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"net/http"
+	"sort"
+)
+
+//AuthorizationServerMetadataURI is the uri for the OAuth 2.0 authorization server metadata - see RFC 8414
+const AuthorizationServerMetadataURI = "/.well-known/oauth-authorization-server"
+
+var (
+	//tokenSigningAlgs are the algorithms roll signs tokens with - each application's tokens are signed
+	//with the algorithm chosen for the application
+	tokenSigningAlgs = signing.Algs
+
+	//clientAssertionSigningAlgs are the algorithms clients may sign private_key_jwt assertions with
+	clientAssertionSigningAlgs = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}
+
+	//supportedResponseModes are the ways the authorize endpoint returns its response to the client
+	supportedResponseModes = []string{responseModeQuery, responseModeFragment, responseModeFormPost}
+)
+
+//authorizationServerMetadata describes roll as an OAuth 2.0 authorization server. The endpoint URLs are
+//those of the endpoints registered by Handler.
+func authorizationServerMetadata(core *roll.Core, r *http.Request) (map[string]interface{}, error) {
+	issuer := issuerURL(core)
+
+	metadata := map[string]interface{}{
+		"issuer": issuer,
+	}
+
+	for _, endpoint := range oauth2Endpoints {
+		if endpoint.metadata != "" {
+			metadata[endpoint.metadata] = issuer + endpoint.uri
+		}
+	}
+
+	scopes, err := listScopes(core)
+	if err != nil {
+		return nil, err
+	}
+
+	var scopeNames []string
+	for _, scope := range scopes {
+		scopeNames = append(scopeNames, scope.Name)
+	}
+
+	metadata["scopes_supported"] = scopeNames
+	metadata["response_types_supported"] = supportedResponseTypes
+	metadata["response_modes_supported"] = supportedResponseModes
+	metadata["grant_types_supported"] = supportedGrantTypes()
+	metadata["code_challenge_methods_supported"] = []string{codeChallengeMethodS256, codeChallengeMethodPlain}
+
+	//Request objects are verified with the client assertion key, and may be passed by value or pushed.
+	//Pushing is required only for applications that ask for it.
+	metadata["request_parameter_supported"] = true
+	metadata["request_uri_parameter_supported"] = false
+	metadata["request_object_signing_alg_values_supported"] = clientAssertionSigningAlgs
+	metadata["require_pushed_authorization_requests"] = false
+
+	//Public clients identify themselves at the token endpoint without authenticating, but revocation and
+	//introspection are only available to confidential clients
+	clientAuthMethods := []string{roll.ClientSecretBasic, roll.ClientSecretPost, roll.PrivateKeyJWT}
+	metadata["token_endpoint_auth_methods_supported"] = []string{roll.ClientSecretBasic, roll.ClientSecretPost,
+		roll.PrivateKeyJWT, clientAuthNone}
+	metadata["token_endpoint_auth_signing_alg_values_supported"] = clientAssertionSigningAlgs
+	metadata["revocation_endpoint_auth_methods_supported"] = clientAuthMethods
+	metadata["revocation_endpoint_auth_signing_alg_values_supported"] = clientAssertionSigningAlgs
+	metadata["introspection_endpoint_auth_methods_supported"] = clientAuthMethods
+	metadata["introspection_endpoint_auth_signing_alg_values_supported"] = clientAssertionSigningAlgs
+
+	return metadata, nil
+}
+
+//supportedGrantTypes returns the grant types handled by the token endpoint, along with the implicit grant
+//handled by the authorize endpoint
+func supportedGrantTypes() []string {
+	grantTypes := []string{"implicit"}
+	for grantType := range grantTypeHandlers {
+		grantTypes = append(grantTypes, grantType)
+	}
+
+	sort.Strings(grantTypes)
+	return grantTypes
+}
+
+func handleAuthorizationServerMetadata(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleAuthorizationServerMetadataGet(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func handleAuthorizationServerMetadataGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	metadata, err := authorizationServerMetadata(core, r)
+	if err != nil {
+		log.Info("Error building authorization server metadata: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, metadata)
+}
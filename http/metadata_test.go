@@ -0,0 +1,111 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func metadataFromResponse(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	var metadata map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &metadata)
+	assert.Nil(t, err)
+	return metadata
+}
+
+func TestAuthorizationServerMetadata(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("ListScopes").Return([]roll.Scope{{Name: "read", Description: "Read your data"}}, nil)
+
+	r, _ := http.NewRequest("GET", AuthorizationServerMetadataURI, nil)
+	w := httptest.NewRecorder()
+	handleAuthorizationServerMetadata(core).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	metadata := metadataFromResponse(t, w)
+
+	issuer := core.IssuerBaseURL()
+
+	assert.Equal(t, issuer, metadata["issuer"])
+	assert.Equal(t, issuer+"/oauth2/authorize", metadata["authorization_endpoint"])
+	assert.Equal(t, issuer+"/oauth2/token", metadata["token_endpoint"])
+	assert.Equal(t, issuer+"/oauth2/tokeninfo", metadata["tokeninfo_endpoint"])
+	assert.Equal(t, issuer+"/oauth2/revoke", metadata["revocation_endpoint"])
+	assert.Equal(t, issuer+"/oauth2/introspect", metadata["introspection_endpoint"])
+	assert.Equal(t, issuer+"/oauth2/device_authorization", metadata["device_authorization_endpoint"])
+	assert.Equal(t, issuer+"/.well-known/jwks.json", metadata["jwks_uri"])
+	_, present := metadata["validate_endpoint"]
+	assert.False(t, present)
+
+	assert.Equal(t, []interface{}{"admin", "openid", "read"}, metadata["scopes_supported"])
+	assert.Equal(t, []interface{}{"code", "token"}, metadata["response_types_supported"])
+	assert.Contains(t, metadata["token_endpoint_auth_methods_supported"], "private_key_jwt")
+	assert.Contains(t, metadata["token_endpoint_auth_methods_supported"], "none")
+	assert.NotContains(t, metadata["revocation_endpoint_auth_methods_supported"], "none")
+	assert.Contains(t, metadata["code_challenge_methods_supported"], "S256")
+
+	grantTypes := metadata["grant_types_supported"]
+	assert.Contains(t, grantTypes, "implicit")
+	for grantType := range grantTypeHandlers {
+		assert.Contains(t, grantTypes, grantType)
+	}
+}
+
+func TestAuthorizationServerMetadataConfiguredIssuer(t *testing.T) {
+	_, coreConfig := NewTestCore()
+	coreConfig.IssuerBaseURL = "https://auth.example.com/roll/"
+	core := roll.NewCore(coreConfig)
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("ListScopes").Return([]roll.Scope{}, nil)
+
+	r, _ := http.NewRequest("GET", AuthorizationServerMetadataURI, nil)
+	r.Host = "10.0.0.12:3000"
+	w := httptest.NewRecorder()
+	handleAuthorizationServerMetadata(core).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	metadata := metadataFromResponse(t, w)
+	assert.Equal(t, "https://auth.example.com/roll", metadata["issuer"])
+	assert.Equal(t, "https://auth.example.com/roll/oauth2/token", metadata["token_endpoint"])
+
+	assert.Equal(t, "https://auth.example.com/roll", issuerURL(core))
+}
+
+func TestAuthorizationServerMetadataScopeError(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("ListScopes").Return(nil, errors.New("boom"))
+
+	r, _ := http.NewRequest("GET", AuthorizationServerMetadataURI, nil)
+	w := httptest.NewRecorder()
+	handleAuthorizationServerMetadata(core).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestAuthorizationServerMetadataMethodNotAllowed(t *testing.T) {
+	core, _ := NewTestCore()
+
+	r, _ := http.NewRequest("POST", AuthorizationServerMetadataURI, nil)
+	w := httptest.NewRecorder()
+	handleAuthorizationServerMetadata(core).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestInvalidIssuerBaseURL(t *testing.T) {
+	for _, issuer := range []string{"", "/", "auth.example.com", "ftp://auth.example.com", "https://auth.example.com?x=1", "https://auth.example.com#x"} {
+		_, coreConfig := NewTestCore()
+		coreConfig.IssuerBaseURL = issuer
+		assert.Panics(t, func() { roll.NewCore(coreConfig) }, issuer)
+	}
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//OAuth 2.0 error codes - see RFC 6749 sections 4.1.2.1, 4.2.2.1 and 5.2, RFC 8628 section 3.5,
+//RFC 8693 section 2.2.2, RFC 8707 section 2, RFC 7591 section 3.2.2 and RFC 9101 section 7
+const (
+	oauth2InvalidRequest          = "invalid_request"
+	oauth2InvalidClient           = "invalid_client"
+	oauth2InvalidGrant            = "invalid_grant"
+	oauth2UnauthorizedClient      = "unauthorized_client"
+	oauth2UnsupportedGrantType    = "unsupported_grant_type"
+	oauth2UnsupportedResponseType = "unsupported_response_type"
+	oauth2InvalidScope            = "invalid_scope"
+	oauth2InvalidTarget           = "invalid_target"
+	oauth2AccessDenied            = "access_denied"
+	oauth2ServerError             = "server_error"
+	oauth2AuthorizationPending    = "authorization_pending"
+	oauth2SlowDown                = "slow_down"
+	oauth2ExpiredToken            = "expired_token"
+	oauth2InvalidRedirectURI      = "invalid_redirect_uri"
+	oauth2InvalidClientMetadata   = "invalid_client_metadata"
+	oauth2InvalidRequestURI       = "invalid_request_uri"
+	oauth2InvalidRequestObject    = "invalid_request_object"
+)
+
+const (
+	tokenErrorsSpec         = "https://tools.ietf.org/html/rfc6749#section-5.2"
+	authorizationErrorsSpec = "https://tools.ietf.org/html/rfc6749#section-4.1.2.1"
+	deviceErrorsSpec        = "https://tools.ietf.org/html/rfc8628#section-3.5"
+	tokenExchangeErrorsSpec = "https://tools.ietf.org/html/rfc8693#section-2.2.2"
+	resourceErrorsSpec      = "https://tools.ietf.org/html/rfc8707#section-2"
+	registrationErrorsSpec  = "https://tools.ietf.org/html/rfc7591#section-3.2.2"
+	requestObjectErrorsSpec = "https://tools.ietf.org/html/rfc9101#section-7"
+)
+
+//tokenErrorURIs are the error_uri values returned with token endpoint errors, which link to the
+//definition of the error code
+var tokenErrorURIs = map[string]string{
+	oauth2InvalidRequest:        tokenErrorsSpec,
+	oauth2InvalidClient:         tokenErrorsSpec,
+	oauth2InvalidGrant:          tokenErrorsSpec,
+	oauth2UnauthorizedClient:    tokenErrorsSpec,
+	oauth2UnsupportedGrantType:  tokenErrorsSpec,
+	oauth2InvalidScope:          tokenErrorsSpec,
+	oauth2InvalidTarget:         tokenExchangeErrorsSpec,
+	oauth2AccessDenied:          deviceErrorsSpec,
+	oauth2AuthorizationPending:  deviceErrorsSpec,
+	oauth2SlowDown:              deviceErrorsSpec,
+	oauth2ExpiredToken:          deviceErrorsSpec,
+	oauth2InvalidRedirectURI:    registrationErrorsSpec,
+	oauth2InvalidClientMetadata: registrationErrorsSpec,
+	oauth2InvalidRequestURI:     requestObjectErrorsSpec,
+	oauth2InvalidRequestObject:  requestObjectErrorsSpec,
+}
+
+//authorizationErrorURIs are the error_uri values returned with errors redirected from the authorization
+//endpoint
+var authorizationErrorURIs = map[string]string{
+	oauth2InvalidRequest:          authorizationErrorsSpec,
+	oauth2UnauthorizedClient:      authorizationErrorsSpec,
+	oauth2AccessDenied:            authorizationErrorsSpec,
+	oauth2UnsupportedResponseType: authorizationErrorsSpec,
+	oauth2InvalidScope:            authorizationErrorsSpec,
+	oauth2InvalidTarget:           resourceErrorsSpec,
+	oauth2ServerError:             authorizationErrorsSpec,
+}
+
+//OAuth2ErrorResponse conveys an error from an OAuth 2.0 endpoint in the format described in RFC 6749
+//section 5.2
+type OAuth2ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	ErrorURI         string `json:"error_uri,omitempty"`
+}
+
+//respondOAuth2Error responds with an OAuth 2.0 error. Clients that fail to authenticate are told the
+//authentication scheme to use in the WWW-Authenticate header, as required by RFC 6749 section 5.2.
+func respondOAuth2Error(w http.ResponseWriter, status int, errorCode string, err error) {
+	if status == http.StatusUnauthorized {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="roll", error="%s"`, errorCode))
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	resp := &OAuth2ErrorResponse{Error: errorCode, ErrorURI: tokenErrorURIs[errorCode]}
+	if err != nil {
+		resp.ErrorDescription = err.Error()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.Encode(resp)
+}
+
+//respondInvalidRequest responds to a request with missing, invalid or repeated parameters
+func respondInvalidRequest(w http.ResponseWriter, err error) {
+	respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, err)
+}
+
+//respondServerError responds to a request that could not be processed due to an internal error
+func respondServerError(w http.ResponseWriter, err error) {
+	respondOAuth2Error(w, http.StatusInternalServerError, oauth2ServerError, err)
+}
+
+//respondClientAuthError responds to a client that could not be authenticated. Failing to look up the
+//client is a server error, a client using a grant type it did not register is an unauthorized client, and
+//anything else means the client credentials are not valid.
+func respondClientAuthError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrRetrievingAppData:
+		respondServerError(w, err)
+		return
+	case ErrGrantTypeNotAllowed:
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2UnauthorizedClient, err)
+		return
+	}
+
+	respondOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, err)
+}
+
+//redirectWithParams adds response parameters to a redirect uri. The fragment response mode puts the
+//parameters in the fragment so they are not sent to the client's server, the query mode keeps any query
+//the redirect uri already has - see RFC 6749 sections 4.1.2 and 4.2.2.
+func redirectWithParams(responseMode, redirectURI string, params url.Values) string {
+	if responseMode == responseModeFragment {
+		return redirectURI + "#" + params.Encode()
+	}
+
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+
+	return redirectURI + separator + params.Encode()
+}
+
+//authorizationErrorParams are the parameters reporting an authorization error to the client. The state
+//from the authorize request is returned as is.
+func authorizationErrorParams(state, errorCode, description string) url.Values {
+	params := url.Values{"error": {errorCode}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+
+	if uri := authorizationErrorURIs[errorCode]; uri != "" {
+		params.Set("error_uri", uri)
+	}
+
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	return params
+}
+
+//respondAuthorizationError reports an authorization error to the client using the same response mode as
+//a successful response
+func respondAuthorizationError(w http.ResponseWriter, r *http.Request, responseMode, redirectURI, state, errorCode, description string) {
+	respondAuthorization(w, r, responseMode, redirectURI, authorizationErrorParams(state, errorCode, description))
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRedirectWithParams(t *testing.T) {
+	params := url.Values{"code": {"abc"}}
+
+	assert.Equal(t, "http://localhost:3000/ab?code=abc", redirectWithParams(responseModeQuery, "http://localhost:3000/ab", params))
+	assert.Equal(t, "http://localhost:3000/ab?app=1&code=abc", redirectWithParams(responseModeQuery, "http://localhost:3000/ab?app=1", params))
+	assert.Equal(t, "http://localhost:3000/ab#code=abc", redirectWithParams(responseModeFragment, "http://localhost:3000/ab", params))
+}
+
+//authorizationErrorRedirect reports an authorization error, returning the redirect
+func authorizationErrorRedirect(t *testing.T, responseMode, state, errorCode, description string) *url.URL {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", AuthorizeBaseURI, nil)
+	respondAuthorizationError(w, req, responseMode, "http://localhost:3000/ab", state, errorCode, description)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	assert.Nil(t, err)
+	return redirect
+}
+
+func TestRespondAuthorizationError(t *testing.T) {
+	redirect := authorizationErrorRedirect(t, responseModeQuery, "xyz", oauth2InvalidScope, "no & good")
+	if assert.NotNil(t, redirect) {
+		assert.Equal(t, "invalid_scope", redirect.Query().Get("error"))
+		assert.Equal(t, "no & good", redirect.Query().Get("error_description"))
+		assert.Equal(t, authorizationErrorsSpec, redirect.Query().Get("error_uri"))
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	}
+
+	redirect = authorizationErrorRedirect(t, responseModeFragment, "", oauth2AccessDenied, "")
+	if assert.NotNil(t, redirect) {
+		assert.Equal(t, "", redirect.RawQuery)
+
+		fragment, err := url.ParseQuery(redirect.Fragment)
+		assert.Nil(t, err)
+		assert.Equal(t, "access_denied", fragment.Get("error"))
+		_, present := fragment["error_description"]
+		assert.False(t, present)
+		_, present = fragment["state"]
+		assert.False(t, present)
+	}
+}
+
+func TestRespondOAuth2Error(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, errors.New("bad code"))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "", w.Header().Get("WWW-Authenticate"))
+	assert.JSONEq(t, `{"error":"invalid_grant","error_description":"bad code","error_uri":"`+tokenErrorsSpec+`"}`, w.Body.String())
+}
+
+func TestRespondClientAuthError(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondClientAuthError(w, ErrInvalidClientDetails)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="roll", error="invalid_client"`, w.Header().Get("WWW-Authenticate"))
+
+	w = httptest.NewRecorder()
+	respondClientAuthError(w, ErrRetrievingAppData)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "", w.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,302 @@
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"net/http"
+	"time"
+)
+
+const (
+	//UserInfoURI is the uri for the OpenID Connect userinfo endpoint
+	UserInfoURI = "/userinfo"
+
+	//OpenIDConfigurationURI is the uri for the OpenID Connect discovery document
+	OpenIDConfigurationURI = "/.well-known/openid-configuration"
+
+	openIDScope = "openid"
+
+	nonceClaim    = "nonce"
+	authTimeClaim = "auth_time"
+	userInfoClaim = "userinfo"
+)
+
+//ErrNonceRequired is returned when an implicit flow OpenID Connect request does not include a nonce
+var ErrNonceRequired = errors.New("nonce is required for the implicit flow when requesting the openid scope")
+
+//signIn holds the details of an OpenID Connect authentication needed to issue an id token
+type signIn struct {
+	Issuer     string
+	Nonce      string
+	AuthTime   int64
+	UserClaims map[string]interface{}
+}
+
+//hasOpenIDScope indicates if the openid scope is present in the given scope
+func hasOpenIDScope(scope string) bool {
+	return scopeContains(scope, openIDScope)
+}
+
+//issuerURL returns the issuer identifier for the tokens roll issues, which is the configured issuer base
+//URL. It is never derived from the request, as the Host header is chosen by the caller.
+func issuerURL(core *roll.Core) string {
+	return core.IssuerBaseURL()
+}
+
+//newSignIn returns the details of an OpenID Connect sign in, or nil if the openid scope was not requested
+func newSignIn(core *roll.Core, r *http.Request, scope string, userClaims map[string]interface{}) *signIn {
+	if !hasOpenIDScope(scope) {
+		return nil
+	}
+
+	return &signIn{
+		Issuer:     issuerURL(core),
+		Nonce:      r.FormValue(nonceClaim),
+		AuthTime:   time.Now().Unix(),
+		UserClaims: userClaims,
+	}
+}
+
+//codeClaims returns the claims carried in an authorization code so the sign in can be recovered
+//when the code is exchanged
+func (si *signIn) codeClaims() map[string]interface{} {
+	if si == nil {
+		return nil
+	}
+
+	claims := map[string]interface{}{
+		authTimeClaim: si.AuthTime,
+		userInfoClaim: si.UserClaims,
+	}
+
+	if si.Nonce != "" {
+		claims[nonceClaim] = si.Nonce
+	}
+
+	return claims
+}
+
+//accessTokenClaims returns the claims added to an access token so the userinfo endpoint can
+//describe the user
+func (si *signIn) accessTokenClaims() map[string]interface{} {
+	if si == nil {
+		return nil
+	}
+
+	return map[string]interface{}{
+		userInfoClaim: si.UserClaims,
+	}
+}
+
+//signInFromCodeClaims recovers the sign in from the claims of an authorization code, returning nil
+//if the openid scope was not granted
+func signInFromCodeClaims(core *roll.Core, r *http.Request, scope string, claims map[string]interface{}) *signIn {
+	if !hasOpenIDScope(scope) {
+		return nil
+	}
+
+	nonce, _ := claims[nonceClaim].(string)
+	userClaims, _ := claims[userInfoClaim].(map[string]interface{})
+
+	return &signIn{
+		Issuer:     issuerURL(core),
+		Nonce:      nonce,
+		AuthTime:   int64Claim(claims, authTimeClaim),
+		UserClaims: userClaims,
+	}
+}
+
+//accessTokenHash is the at_hash claim value for an id token signed with the given algorithm: the base64url
+//encoding of the left half of the hash of the access token. The hash is the one used by the algorithm - SHA-384
+//for ES384, SHA-512 for EdDSA with Ed25519 keys, and SHA-256 otherwise.
+func accessTokenHash(alg, accessToken string) string {
+	var sum []byte
+	switch alg {
+	case signing.ES384:
+		s := sha512.Sum384([]byte(accessToken))
+		sum = s[:]
+	case signing.EdDSA:
+		s := sha512.Sum512([]byte(accessToken))
+		sum = s[:]
+	default:
+		s := sha256.Sum256([]byte(accessToken))
+		sum = s[:]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+//privateKeyAlg returns the algorithm tokens are signed with using the PEM encoded private key
+func privateKeyAlg(privateKey string) (string, error) {
+	signingKey, err := signing.ParsePrivateKeyPEM(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	method, err := signing.MethodForKey(signingKey.Public())
+	if err != nil {
+		return "", err
+	}
+
+	return method.Alg(), nil
+}
+
+//generateIDToken generates an id token for the app, signed with the app's private key
+func generateIDToken(core *roll.Core, subject string, app *roll.Application, si *signIn, accessToken string) (string, error) {
+	privateKey, err := core.RetrievePrivateKeyForApp(app.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	alg, err := privateKeyAlg(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	claims := make(map[string]interface{})
+	for k, v := range si.UserClaims {
+		claims[k] = v
+	}
+
+	now := time.Now()
+	claims["iss"] = si.Issuer
+	claims["sub"] = subject
+	claims["aud"] = app.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(core.AccessTokenLifetime(app)).Unix()
+	claims[authTimeClaim] = si.AuthTime
+	claims["at_hash"] = accessTokenHash(alg, accessToken)
+
+	if si.Nonce != "" {
+		claims[nonceClaim] = si.Nonce
+	}
+
+	return signToken(claims, privateKey)
+}
+
+//generateOpenIDTokenResponse generates an access token response that includes an id token
+func generateOpenIDTokenResponse(core *roll.Core, subject, scope string, resources []string, app *roll.Application, si *signIn) (*accessTokenResponse, error) {
+	token, err := generateJWT(subject, scope, core, app, withAudience(si.accessTokenClaims(), resources))
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := generateIDToken(core, subject, app, si, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accessTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn(core, app),
+		Scope:       scope,
+		IDToken:     idToken,
+	}, nil
+}
+
+func handleUserInfo(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "POST":
+			handleUserInfoRequest(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//respondBearerError responds with a bearer token error as described in RFC 6750 section 3
+func respondBearerError(w http.ResponseWriter, status int, errorCode string, err error) {
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s"`, errorCode))
+	respondError(w, status, err)
+}
+
+func handleUserInfoRequest(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	bearerToken, err := bearerTokenFromRequest(r)
+	if err != nil {
+		respondBearerError(w, http.StatusUnauthorized, "invalid_token", err)
+		return
+	}
+
+	//Authorization codes, id tokens and login sessions are signed like access tokens but cannot be used as one
+	token, err := verifyAccessToken(core, bearerToken)
+	if err != nil {
+		respondBearerError(w, http.StatusUnauthorized, "invalid_token", errors.New("Invalid access token"))
+		return
+	}
+
+	scope, _ := token.Claims["scope"].(string)
+
+	revoked, err := tokenRevoked(core, token.Claims)
+	if err != nil {
+		log.Info("Error checking token revocation: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if revoked {
+		respondBearerError(w, http.StatusUnauthorized, "invalid_token", errors.New("Access token has been revoked"))
+		return
+	}
+
+	if !hasOpenIDScope(scope) {
+		respondBearerError(w, http.StatusForbidden, "insufficient_scope", errors.New("openid scope required"))
+		return
+	}
+
+	userInfo := make(map[string]interface{})
+	if userClaims, ok := token.Claims[userInfoClaim].(map[string]interface{}); ok {
+		for k, v := range userClaims {
+			userInfo[k] = v
+		}
+	}
+
+	userInfo["sub"] = token.Claims["sub"]
+
+	userInfoBytes, err := json.Marshal(userInfo)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Write(userInfoBytes)
+}
+
+func handleOpenIDConfiguration(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleOpenIDConfigurationGet(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//handleOpenIDConfigurationGet returns the OpenID Connect discovery document, which is the authorization
+//server metadata plus the OpenID Connect provider metadata
+func handleOpenIDConfigurationGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	config, err := authorizationServerMetadata(core, r)
+	if err != nil {
+		log.Info("Error building openid configuration: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	config["subject_types_supported"] = []string{"public"}
+	config["id_token_signing_alg_values_supported"] = tokenSigningAlgs
+	config["claims_supported"] = []string{"iss", "sub", "aud", "exp", "iat", authTimeClaim, nonceClaim, "at_hash",
+		"preferred_username"}
+
+	respondOk(w, config)
+}
@@ -0,0 +1,369 @@
+package http
+
+import (
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/roll/signing"
+	rolltoken "github.com/xtraclabs/rollsecrets/token"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignInOnlyForOpenIDScope(t *testing.T) {
+	core, _ := NewTestCore()
+	req, _ := http.NewRequest("GET", "/?nonce=n-0S6_WzA2Mj", nil)
+	req.Host = "attacker.example.com"
+
+	assert.Nil(t, newSignIn(core, req, "admin", nil))
+
+	//The issuer is the configured issuer, whatever host the request was sent to
+	si := newSignIn(core, req, "admin openid", map[string]interface{}{"preferred_username": "x"})
+	if assert.NotNil(t, si) {
+		assert.Equal(t, core.IssuerBaseURL(), si.Issuer)
+		assert.Equal(t, "n-0S6_WzA2Mj", si.Nonce)
+	}
+
+	var noSignIn *signIn
+	assert.Nil(t, noSignIn.codeClaims())
+	assert.Nil(t, noSignIn.accessTokenClaims())
+}
+
+func TestOpenIDCodeExchangeIDToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+
+	si := &signIn{
+		Nonce:      "n-0S6_WzA2Mj",
+		AuthTime:   time.Now().Unix(),
+		UserClaims: map[string]interface{}{"preferred_username": "b-subject"},
+	}
+
+	code, err := rolltoken.GenerateCode("b-subject", "openid", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+	code, err = addClaimsToToken(code, si.codeClaims(), privateKey)
+	assert.Nil(t, err)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, "openid", jsonResponse.Scope)
+
+	idToken, err := jwt.Parse(jsonResponse.IDToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	if assert.Nil(t, err) {
+		assert.Equal(t, addr, idToken.Claims["iss"])
+		assert.Equal(t, "b-subject", idToken.Claims["sub"])
+		assert.Equal(t, "1111-2222-3333333-4444444", idToken.Claims["aud"])
+		assert.Equal(t, "n-0S6_WzA2Mj", idToken.Claims["nonce"])
+		assert.Equal(t, "b-subject", idToken.Claims["preferred_username"])
+		assert.Equal(t, float64(si.AuthTime), idToken.Claims["auth_time"])
+		assert.Equal(t, accessTokenHash("RS256", jsonResponse.AccessToken), idToken.Claims["at_hash"])
+	}
+}
+
+func TestOpenIDCodeExchangeWithoutOpenIDScope(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, "", jsonResponse.IDToken)
+}
+
+func TestOpenIDImplicitGrantIDToken(t *testing.T) {
+	ls := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ls.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	core, coreConfig := NewTestCore()
+	setupConsentRecording(coreConfig)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	lsURL, _ := url.Parse(ls.URL)
+
+	setupPKCETestApp(t, coreConfig, false)
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	app, _ := appRepoMock.SystemRetrieveApplication("1111-2222-3333333-4444444")
+	app.RedirectURIs = ts.URL
+	app.LoginProvider = "xtrac://" + lsURL.Host
+
+	var fragment url.Values
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			fragment, _ = url.ParseQuery(req.URL.Fragment)
+			return nil
+		},
+	}
+
+	_, err := postAuthorizeForm(t, core, client, addr,
+		url.Values{"username": {"x"},
+			"password":      {"y"},
+			"authorize":     {"allow"},
+			"response_type": {"token"},
+			"scope":         {"openid"},
+			"nonce":         {"n-0S6_WzA2Mj"},
+			"client_id":     {"1111-2222-3333333-4444444"}})
+	assert.Nil(t, err)
+
+	accessToken := fragment.Get("access_token")
+	idToken, err := jwt.Parse(fragment.Get("id_token"), rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "x", idToken.Claims["sub"])
+		assert.Equal(t, "x", idToken.Claims["preferred_username"])
+		assert.Equal(t, "n-0S6_WzA2Mj", idToken.Claims["nonce"])
+		assert.Equal(t, accessTokenHash("RS256", accessToken), idToken.Claims["at_hash"])
+	}
+
+	token, err := jwt.Parse(accessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	if assert.Nil(t, err) {
+		userInfo, ok := token.Claims[userInfoClaim].(map[string]interface{})
+		assert.True(t, ok)
+		assert.Equal(t, "x", userInfo["preferred_username"])
+	}
+}
+
+func TestOpenIDImplicitGrantNonceRequired(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	var fragment url.Values
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			fragment, _ = url.ParseQuery(req.URL.Fragment)
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(addr + "/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=token&scope=openid")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "invalid_request", fragment.Get("error"))
+	assert.Equal(t, ErrNonceRequired.Error(), fragment.Get("error_description"))
+}
+
+func TestHandleAuthorizeNonceInPage(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	resp := TestHTTPGet(t, addr+"/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=token&scope=openid+admin&nonce=n-0S6_WzA2Mj", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	bodyStr := responseAsString(t, resp)
+	assert.True(t, strings.Contains(bodyStr, `<input type="hidden" name="scope" value="openid admin"`))
+	assert.True(t, strings.Contains(bodyStr, `<input type="hidden" name="nonce" value="n-0S6_WzA2Mj"`))
+}
+
+func userInfoRequest(t *testing.T, addr, accessToken string) *http.Response {
+	req, err := http.NewRequest("GET", addr+UserInfoURI, nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestUserInfo(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	si := &signIn{UserClaims: map[string]interface{}{"preferred_username": "x"}}
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	accessToken, err := generateJWT("x", "openid", core, app, si.accessTokenClaims())
+	assert.Nil(t, err)
+
+	resp := userInfoRequest(t, addr, accessToken)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	var userInfo map[string]interface{}
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &userInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, "x", userInfo["sub"])
+	assert.Equal(t, "x", userInfo["preferred_username"])
+}
+
+func TestUserInfoRequiresOpenIDScope(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	accessToken, err := generateJWT("x", "admin", core, app, nil)
+	assert.Nil(t, err)
+
+	resp := userInfoRequest(t, addr, accessToken)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, `Bearer error="insufficient_scope"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestUserInfoRevokedToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(true, nil)
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	accessToken, err := generateJWT("x", "openid", core, app, nil)
+	assert.Nil(t, err)
+
+	resp := userInfoRequest(t, addr, accessToken)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Bearer error="invalid_token"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestUserInfoRejectsCode(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code, err := rolltoken.GenerateCode("x", "openid", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	resp := userInfoRequest(t, addr, code)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestUserInfoRejectsLoginSession(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	session, err := newLoginSession(core, "x", app, map[string]interface{}{"preferred_username": "x"})
+	assert.Nil(t, err)
+
+	resp := userInfoRequest(t, addr, session)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Bearer error="invalid_token"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestUserInfoNoToken(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.Get(addr + UserInfoURI)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Bearer error="invalid_token"`, resp.Header.Get("WWW-Authenticate"))
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("ListScopes").Return([]roll.Scope{}, nil)
+
+	resp := TestHTTPGet(t, addr+OpenIDConfigurationURI, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &config)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, config["issuer"])
+	assert.Equal(t, addr+AuthorizeBaseURI, config["authorization_endpoint"])
+	assert.Equal(t, addr+OAuth2TokenBaseURI, config["token_endpoint"])
+	assert.Equal(t, addr+UserInfoURI, config["userinfo_endpoint"])
+	assert.Contains(t, config["scopes_supported"], "openid")
+	assert.Contains(t, config["id_token_signing_alg_values_supported"], "RS256")
+}
+
+func TestAccessTokenHashPerAlg(t *testing.T) {
+	//From the ID token example in OpenID Connect Core 1.0 appendix A.3
+	assert.Equal(t, "77QmUPtjPfzWtF2AnpK9RQ", accessTokenHash("RS256", "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"))
+
+	//The hash is as long as the left half of the algorithm's hash
+	assert.Equal(t, 32, len(accessTokenHash("ES384", "an access token")))
+	assert.Equal(t, 43, len(accessTokenHash("EdDSA", "an access token")))
+	assert.NotEqual(t, accessTokenHash("ES256", "an access token"), accessTokenHash("ES384", "an access token"))
+}
+
+func TestPrivateKeyAlg(t *testing.T) {
+	for _, alg := range signing.Algs {
+		privateKey, _, err := signing.GenerateKeyPair(alg)
+		assert.Nil(t, err)
+
+		keyAlg, err := privateKeyAlg(privateKey)
+		if assert.Nil(t, err) {
+			assert.Equal(t, alg, keyAlg)
+		}
+	}
+
+	_, err := privateKeyAlg("not a key")
+	assert.NotNil(t, err)
+}
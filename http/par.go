@@ -0,0 +1,399 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	//PushedAuthorizationURI is the uri clients push authorization requests to (RFC 9126)
+	PushedAuthorizationURI = "/oauth2/par"
+
+	//Request uris handed out for pushed requests are URNs, so they can't be mistaken for a uri to fetch
+	//the request from - see RFC 9126 section 2.2
+	requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+	//Pushed requests are meant to be used right away, so have a short lifetime
+	pushedAuthorizationLifetime = 60 * time.Second
+
+	//Request objects are signed for a single authorization request, so long lived request objects are refused
+	requestObjectMaxLifetime = 10 * time.Minute
+
+	//Request objects are signed with the same key as client assertions, so the jtis of request objects are
+	//recorded with a prefix to keep them from colliding with the jtis of the client's assertions
+	requestObjectReplayPrefix = "request_object:"
+)
+
+var (
+	//ErrInvalidRequestURI is returned when a request uri is unknown, expired, already used, or was pushed
+	//by a different client
+	ErrInvalidRequestURI = errors.New("Invalid request_uri")
+
+	//ErrInvalidRequestObject is returned when a request object cannot be verified
+	ErrInvalidRequestObject = errors.New("Invalid request object")
+
+	//ErrRequestAndRequestURI is returned when an authorize request passes a request object both by value
+	//and by reference
+	ErrRequestAndRequestURI = errors.New("Only one of request and request_uri may be given")
+
+	//ErrRequestURINotAllowed is returned when a request uri is pushed to the pushed authorization
+	//request endpoint
+	ErrRequestURINotAllowed = errors.New("request_uri may not be used with a pushed authorization request")
+
+	//ErrPushedAuthorizationRequired is returned when an application requires its authorization requests
+	//to be pushed, but an authorize request was made without a request uri
+	ErrPushedAuthorizationRequired = errors.New("Authorization requests for the application must be pushed")
+)
+
+//clientCredentialParams are the form params a client authenticates with, which are not part of the
+//authorization request pushed by the client
+var clientCredentialParams = map[string]bool{
+	"client_secret":         true,
+	"client_assertion":      true,
+	"client_assertion_type": true,
+}
+
+//requestObjectClaims are the JWT claims of a request object that are not authorization request params
+var requestObjectClaims = map[string]bool{
+	"iss": true,
+	"aud": true,
+	"exp": true,
+	"iat": true,
+	"nbf": true,
+	"jti": true,
+}
+
+type pushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+func handlePushedAuthorizationRequest(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			handlePushedAuthorizationRequestPost(core, w, r)
+		default:
+			respondOAuth2Error(w, http.StatusMethodNotAllowed, oauth2InvalidRequest, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//withAuthorizeParams returns a copy of the request carrying the given authorization request params in
+//place of its own, so the pushed or request object params are checked like those of any other request
+func withAuthorizeParams(r *http.Request, params url.Values) *http.Request {
+	u := *r.URL
+	u.RawQuery = params.Encode()
+
+	ar := *r
+	ar.URL = &u
+	ar.Form = params
+	ar.PostForm = url.Values{}
+	return &ar
+}
+
+//requestObjectParams verifies a request object (RFC 9101) is signed with the client assertion key
+//registered for the application, returning the authorization request params it carries. Params given
+//outside the request object are ignored, as required by RFC 9101 section 6.3. Request objects must carry
+//a jti, and each may be used only once.
+func requestObjectParams(core *roll.Core, app *roll.Application, requestObject string) (url.Values, error) {
+	if app.ClientAssertionPublicKey == "" {
+		log.Info("No key registered to verify request objects from ", app.ClientID)
+		return nil, ErrInvalidRequestObject
+	}
+
+	token, err := jwt.Parse(requestObject, func(token *jwt.Token) (interface{}, error) {
+		return signing.VerificationKey(token, app.ClientAssertionPublicKey)
+	})
+	if err != nil || !token.Valid {
+		log.Info("Unable to verify request object from ", app.ClientID)
+		return nil, ErrInvalidRequestObject
+	}
+
+	if token.Claims["iss"] != app.ClientID {
+		log.Info("Request object iss is not the client id ", app.ClientID)
+		return nil, ErrInvalidRequestObject
+	}
+
+	if clientID, ok := token.Claims["client_id"]; ok && clientID != app.ClientID {
+		log.Info("Request object client_id does not match ", app.ClientID)
+		return nil, ErrInvalidRequestObject
+	}
+
+	if !audienceIncludes(token.Claims["aud"], issuerURL(core)) {
+		log.Info("Request object audience does not include ", issuerURL(core))
+		return nil, ErrInvalidRequestObject
+	}
+
+	exp, ok := token.Claims["exp"].(float64)
+	if !ok {
+		log.Info("Request object from ", app.ClientID, " has no exp claim")
+		return nil, ErrInvalidRequestObject
+	}
+
+	if time.Unix(int64(exp), 0).After(time.Now().Add(requestObjectMaxLifetime)) {
+		log.Info("Request object from ", app.ClientID, " expiry too far in the future")
+		return nil, ErrInvalidRequestObject
+	}
+
+	tokenID, _ := token.Claims["jti"].(string)
+	if tokenID == "" {
+		log.Info("Request object from ", app.ClientID, " has no jti claim")
+		return nil, ErrInvalidRequestObject
+	}
+
+	params := url.Values{}
+	for name, value := range token.Claims {
+		if requestObjectClaims[name] {
+			continue
+		}
+
+		//Request objects may not nest other request objects
+		if name == "request" || name == "request_uri" {
+			log.Info("Request object from ", app.ClientID, " contains ", name)
+			return nil, ErrInvalidRequestObject
+		}
+
+		switch value := value.(type) {
+		case string:
+			params.Set(name, value)
+		case float64:
+			params.Set(name, strconv.FormatFloat(value, 'f', -1, 64))
+		case []interface{}:
+			for _, v := range value {
+				if s, ok := v.(string); ok {
+					params.Add(name, s)
+				}
+			}
+		}
+	}
+
+	//The request object is accepted until it expires, so its use must be remembered until then
+	err = core.RecordAssertionUse(app.ClientID, requestObjectReplayPrefix+tokenID, int64(exp))
+	switch err.(type) {
+	case nil:
+	case roll.AssertionReplayError:
+		log.Info("Request object ", tokenID, " from ", app.ClientID, " already used")
+		return nil, ErrInvalidRequestObject
+	default:
+		return nil, err
+	}
+
+	params.Set("client_id", app.ClientID)
+	return params, nil
+}
+
+func handlePushedAuthorizationRequestPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	client, err := clientCredentialsFromRequest(core, r)
+	if err != nil {
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	if client.clientID == "" {
+		respondInvalidRequest(w, errors.New("client_id missing from request"))
+		return
+	}
+
+	//Only confidential clients may push requests - the authorize endpoint trusts pushed params because
+	//the client authenticated when pushing them
+	app, err := authenticateClient(core, client, false)
+	if err != nil {
+		respondClientAuthError(w, err)
+		return
+	}
+
+	if r.PostFormValue("request_uri") != "" {
+		respondInvalidRequest(w, ErrRequestURINotAllowed)
+		return
+	}
+
+	params := url.Values{}
+	if requestObject := r.PostFormValue("request"); requestObject != "" {
+		params, err = requestObjectParams(core, app, requestObject)
+		switch err {
+		case nil:
+		case ErrInvalidRequestObject:
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequestObject, err)
+			return
+		default:
+			log.Info("Error recording request object use: ", err.Error())
+			respondServerError(w, err)
+			return
+		}
+	} else {
+		for name, values := range r.PostForm {
+			if !clientCredentialParams[name] {
+				params[name] = values
+			}
+		}
+	}
+
+	params.Set("client_id", app.ClientID)
+
+	//The request is checked now so the client learns of problems right away - see RFC 9126 section 2.1.
+	//The redirect uri may be omitted if the application has only one, but is recorded with the request
+	//as the authorize endpoint requires it.
+	ar := withAuthorizeParams(r, params)
+	redirectURI, err := redirectURIFromForm(ar, app)
+	if err != nil {
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	params.Set("redirect_uri", redirectURI)
+
+	responseType, err := getResponseType(ar)
+	if err != nil {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2UnsupportedResponseType, err)
+		return
+	}
+
+	if !responseTypeAllowed(app, responseType) {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2UnauthorizedClient, ErrResponseTypeNotAllowed)
+		return
+	}
+
+	if _, err := getResponseMode(ar, responseType); err != nil {
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	if err := validateRequestedScope(core, app, ar.FormValue(oauth2Scope)); err != nil {
+		respondScopeError(w, err)
+		return
+	}
+
+	if _, err := describeResources(core, ar.Form["resource"]); err != nil {
+		respondTargetError(w, err)
+		return
+	}
+
+	if responseType == "code" {
+		if _, err := checkCodeChallenge(ar, app); err != nil {
+			respondInvalidRequest(w, err)
+			return
+		}
+	}
+
+	requestID, err := core.GenerateID()
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	pa := &roll.PushedAuthorization{
+		RequestURI: requestURIPrefix + requestID,
+		ClientID:   app.ClientID,
+		Params:     params.Encode(),
+		ExpiresAt:  time.Now().Add(pushedAuthorizationLifetime).Unix(),
+	}
+
+	if err := core.StorePushedAuthorization(pa); err != nil {
+		log.Info("Error storing pushed authorization: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+
+	enc := json.NewEncoder(w)
+	enc.Encode(&pushedAuthorizationResponse{
+		RequestURI: pa.RequestURI,
+		ExpiresIn:  int64(pushedAuthorizationLifetime / time.Second),
+	})
+}
+
+//pushedAuthorizationParams redeems a request uri for the params of the pushed request. The pushed
+//request is removed so the request uri can be used only once.
+func pushedAuthorizationParams(core *roll.Core, app *roll.Application, requestURI string) (url.Values, error) {
+	pa, err := core.RetrievePushedAuthorization(requestURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if pa == nil || pa.ClientID != app.ClientID || pa.Expired() {
+		return nil, ErrInvalidRequestURI
+	}
+
+	err = core.DeletePushedAuthorization(requestURI)
+	switch err.(type) {
+	case nil:
+	case roll.NoSuchPushedAuthorizationError:
+		log.Info("Request uri ", requestURI, " already used")
+		return nil, ErrInvalidRequestURI
+	default:
+		return nil, err
+	}
+
+	return url.ParseQuery(pa.Params)
+}
+
+//resolveAuthorizeRequest resolves an authorize request made with a request uri from the pushed
+//authorization request endpoint, or with a request object, to the params of the request. The boolean
+//return is true if the request was pushed. A nil request is returned if the request could not be
+//resolved, in which case an error response has been sent. Errors are not redirected to the client as
+//the redirect uri is not known until the request is resolved.
+func resolveAuthorizeRequest(core *roll.Core, w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	query := r.URL.Query()
+	requestURI := query.Get("request_uri")
+	requestObject := query.Get("request")
+	if requestURI == "" && requestObject == "" {
+		return r, false
+	}
+
+	if requestURI != "" && requestObject != "" {
+		respondInvalidRequest(w, ErrRequestAndRequestURI)
+		return nil, false
+	}
+
+	app, err := core.SystemRetrieveApplication(query.Get("client_id"))
+	if err != nil {
+		respondServerError(w, err)
+		return nil, false
+	}
+
+	if app == nil {
+		respondInvalidRequest(w, errors.New("Invalid client id"))
+		return nil, false
+	}
+
+	if requestObject != "" {
+		params, err := requestObjectParams(core, app, requestObject)
+		switch err {
+		case nil:
+		case ErrInvalidRequestObject:
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequestObject, err)
+			return nil, false
+		default:
+			log.Info("Error recording request object use: ", err.Error())
+			respondServerError(w, err)
+			return nil, false
+		}
+
+		return withAuthorizeParams(r, params), false
+	}
+
+	params, err := pushedAuthorizationParams(core, app, requestURI)
+	switch err {
+	case nil:
+		return withAuthorizeParams(r, params), true
+	case ErrInvalidRequestURI:
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequestURI, err)
+	default:
+		log.Info("Error redeeming request uri: ", err.Error())
+		respondServerError(w, err)
+	}
+
+	return nil, false
+}
@@ -0,0 +1,406 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/roll/signing"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+//setupPARTestApp registers an app with the redirect uri http://localhost:3000/ab, returning the private key
+//the app signs its request objects with
+func setupPARTestApp(t *testing.T, coreConfig *roll.CoreConfig, requirePAR bool) string {
+	requestObjectPrivateKey, requestObjectPublicKey, err := signing.GenerateKeyPair(signing.ES256)
+	assert.Nil(t, err)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:                           "1111-2222-3333333-4444444",
+		ApplicationName:                    "fight club",
+		ClientSecret:                       "not for browser clients",
+		RedirectURIs:                       "http://localhost:3000/ab",
+		LoginProvider:                      "xtrac://localhost:9000",
+		ClientAssertionPublicKey:           requestObjectPublicKey,
+		RequirePushedAuthorizationRequests: requirePAR,
+	}, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	replayRepoMock := coreConfig.AssertionReplayRepo.(*mocks.AssertionReplayRepo)
+	replayRepoMock.On("RecordAssertionUse", "1111-2222-3333333-4444444", mock.Anything, mock.Anything).Return(nil)
+
+	return requestObjectPrivateKey
+}
+
+func requestObjectClaimsForTest(audience string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":           "1111-2222-3333333-4444444",
+		"aud":           audience,
+		"exp":           time.Now().Add(time.Minute).Unix(),
+		"jti":           "request-object-1",
+		"client_id":     "1111-2222-3333333-4444444",
+		"response_type": "code",
+		"redirect_uri":  "http://localhost:3000/ab",
+		"state":         "from-the-request-object",
+	}
+}
+
+func postPushedAuthorizationRequest(t *testing.T, addr string, form url.Values) (*http.Response, map[string]interface{}) {
+	resp, err := http.PostForm(addr+PushedAuthorizationURI, form)
+	assert.Nil(t, err)
+
+	var body map[string]interface{}
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &body)
+	assert.Nil(t, err)
+	return resp, body
+}
+
+//authorizeRequest makes an authorize request with the given query params
+func authorizeRequest(core *roll.Core, query url.Values) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("GET", "http://localhost:3000"+AuthorizeBaseURI+"?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	handleAuthZGet(core, w, r)
+	return w
+}
+
+func oauth2ErrorFromRecorder(t *testing.T, w *httptest.ResponseRecorder) OAuth2ErrorResponse {
+	var errResponse OAuth2ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &errResponse)
+	assert.Nil(t, err)
+	return errResponse
+}
+
+func TestPushedAuthorizationRequest(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPARTestApp(t, coreConfig, false)
+
+	var stored *roll.PushedAuthorization
+	parRepoMock := coreConfig.PushedAuthorizationRepo.(*mocks.PushedAuthorizationRepo)
+	parRepoMock.On("StorePushedAuthorization", mock.AnythingOfType("*roll.PushedAuthorization")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*roll.PushedAuthorization)
+	}).Return(nil)
+
+	resp, body := postPushedAuthorizationRequest(t, addr, url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"client_secret": {"not for browser clients"},
+		"response_type": {"code"},
+		"state":         {"xyz"},
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "urn:ietf:params:oauth:request_uri:steve", body["request_uri"])
+	assert.Equal(t, float64(60), body["expires_in"])
+
+	if assert.NotNil(t, stored) {
+		assert.Equal(t, "1111-2222-3333333-4444444", stored.ClientID)
+		assert.False(t, stored.Expired())
+
+		params, err := url.ParseQuery(stored.Params)
+		assert.Nil(t, err)
+		assert.Equal(t, "http://localhost:3000/ab", params.Get("redirect_uri"))
+		assert.Equal(t, "xyz", params.Get("state"))
+		assert.Equal(t, "", params.Get("client_secret"))
+	}
+}
+
+func TestPushedAuthorizationRequestErrors(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPARTestApp(t, coreConfig, false)
+
+	form := url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"client_secret": {"guessing"},
+		"response_type": {"code"},
+	}
+	resp, body := postPushedAuthorizationRequest(t, addr, form)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, oauth2InvalidClient, body["error"])
+
+	form.Set("client_secret", "not for browser clients")
+	form.Set("request_uri", "urn:ietf:params:oauth:request_uri:steve")
+	resp, body = postPushedAuthorizationRequest(t, addr, form)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, ErrRequestURINotAllowed.Error(), body["error_description"])
+
+	form.Del("request_uri")
+	form.Set("response_type", "bogus")
+	resp, body = postPushedAuthorizationRequest(t, addr, form)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, oauth2UnsupportedResponseType, body["error"])
+
+	form.Set("response_type", "code")
+	form.Set("redirect_uri", "http://evil.com/ab")
+	resp, body = postPushedAuthorizationRequest(t, addr, form)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, oauth2InvalidRequest, body["error"])
+
+	parRepoMock := coreConfig.PushedAuthorizationRepo.(*mocks.PushedAuthorizationRepo)
+	parRepoMock.AssertNotCalled(t, "StorePushedAuthorization", mock.Anything)
+}
+
+func TestPushedAuthorizationRequestObject(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	requestObjectKey := setupPARTestApp(t, coreConfig, false)
+
+	var stored *roll.PushedAuthorization
+	parRepoMock := coreConfig.PushedAuthorizationRepo.(*mocks.PushedAuthorizationRepo)
+	parRepoMock.On("StorePushedAuthorization", mock.AnythingOfType("*roll.PushedAuthorization")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*roll.PushedAuthorization)
+	}).Return(nil)
+
+	//Params outside the request object are ignored
+	resp, _ := postPushedAuthorizationRequest(t, addr, url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"client_secret": {"not for browser clients"},
+		"state":         {"ignored"},
+		"request":       {clientAssertion(t, requestObjectKey, requestObjectClaimsForTest(addr))},
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	if assert.NotNil(t, stored) {
+		params, err := url.ParseQuery(stored.Params)
+		assert.Nil(t, err)
+		assert.Equal(t, "from-the-request-object", params.Get("state"))
+		assert.Equal(t, "code", params.Get("response_type"))
+		assert.Equal(t, "", params.Get("iss"))
+	}
+
+	//The request object must be addressed to roll
+	resp, body := postPushedAuthorizationRequest(t, addr, url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"client_secret": {"not for browser clients"},
+		"request":       {clientAssertion(t, requestObjectKey, requestObjectClaimsForTest("http://somewhere.else"))},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, oauth2InvalidRequestObject, body["error"])
+}
+
+func TestAuthorizeWithPushedRequestURI(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupPARTestApp(t, coreConfig, true)
+
+	params := url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"redirect_uri":  {"http://localhost:3000/ab"},
+		"response_type": {"code"},
+		"state":         {"pushed-state"},
+	}
+
+	parRepoMock := coreConfig.PushedAuthorizationRepo.(*mocks.PushedAuthorizationRepo)
+	parRepoMock.On("RetrievePushedAuthorization", "urn:ietf:params:oauth:request_uri:steve").Return(&roll.PushedAuthorization{
+		RequestURI: "urn:ietf:params:oauth:request_uri:steve",
+		ClientID:   "1111-2222-3333333-4444444",
+		Params:     params.Encode(),
+		ExpiresAt:  time.Now().Add(time.Minute).Unix(),
+	}, nil)
+	parRepoMock.On("DeletePushedAuthorization", "urn:ietf:params:oauth:request_uri:steve").Return(nil).Once()
+	parRepoMock.On("DeletePushedAuthorization", "urn:ietf:params:oauth:request_uri:steve").Return(roll.NoSuchPushedAuthorizationError{})
+
+	query := url.Values{
+		"client_id":   {"1111-2222-3333333-4444444"},
+		"request_uri": {"urn:ietf:params:oauth:request_uri:steve"},
+	}
+	w := authorizeRequest(core, query)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `value="pushed-state"`))
+
+	//The request uri may be used only once
+	w = authorizeRequest(core, query)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, oauth2InvalidRequestURI, oauth2ErrorFromRecorder(t, w).Error)
+}
+
+func TestAuthorizeWithInvalidRequestURI(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupPARTestApp(t, coreConfig, false)
+
+	otherAppRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	otherAppRepoMock.On("SystemRetrieveApplication", "other-client").Return(&roll.Application{
+		ClientID:     "other-client",
+		RedirectURIs: "http://localhost:3000/ab",
+	}, nil)
+
+	parRepoMock := coreConfig.PushedAuthorizationRepo.(*mocks.PushedAuthorizationRepo)
+	parRepoMock.On("RetrievePushedAuthorization", "urn:ietf:params:oauth:request_uri:expired").Return(&roll.PushedAuthorization{
+		RequestURI: "urn:ietf:params:oauth:request_uri:expired",
+		ClientID:   "1111-2222-3333333-4444444",
+		ExpiresAt:  time.Now().Add(-time.Minute).Unix(),
+	}, nil)
+	parRepoMock.On("RetrievePushedAuthorization", "urn:ietf:params:oauth:request_uri:steve").Return(&roll.PushedAuthorization{
+		RequestURI: "urn:ietf:params:oauth:request_uri:steve",
+		ClientID:   "1111-2222-3333333-4444444",
+		ExpiresAt:  time.Now().Add(time.Minute).Unix(),
+	}, nil)
+	parRepoMock.On("RetrievePushedAuthorization", "https://client.example.com/request").Return(nil, nil)
+
+	for _, tc := range []struct{ clientID, requestURI string }{
+		{"1111-2222-3333333-4444444", "urn:ietf:params:oauth:request_uri:expired"},
+		{"other-client", "urn:ietf:params:oauth:request_uri:steve"},
+		{"1111-2222-3333333-4444444", "https://client.example.com/request"},
+	} {
+		w := authorizeRequest(core, url.Values{"client_id": {tc.clientID}, "request_uri": {tc.requestURI}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, oauth2InvalidRequestURI, oauth2ErrorFromRecorder(t, w).Error)
+	}
+
+	//Requests belonging to other clients are left for their owner
+	parRepoMock.AssertNotCalled(t, "DeletePushedAuthorization", mock.Anything)
+
+	w := authorizeRequest(core, url.Values{
+		"client_id":   {"1111-2222-3333333-4444444"},
+		"request_uri": {"urn:ietf:params:oauth:request_uri:steve"},
+		"request":     {"a.b.c"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrRequestAndRequestURI.Error(), oauth2ErrorFromRecorder(t, w).ErrorDescription)
+}
+
+func TestAuthorizeWithRequestObject(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	requestObjectKey := setupPARTestApp(t, coreConfig, false)
+
+	w := authorizeRequest(core, url.Values{
+		"client_id": {"1111-2222-3333333-4444444"},
+		"request":   {clientAssertion(t, requestObjectKey, requestObjectClaimsForTest(core.IssuerBaseURL()))},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `value="from-the-request-object"`))
+
+	//Signed with someone else's key
+	otherKey, _, err := signing.GenerateKeyPair(signing.ES256)
+	assert.Nil(t, err)
+
+	noExpiry := requestObjectClaimsForTest(core.IssuerBaseURL())
+	delete(noExpiry, "exp")
+
+	nested := requestObjectClaimsForTest(core.IssuerBaseURL())
+	nested["request_uri"] = "urn:ietf:params:oauth:request_uri:steve"
+
+	longLived := requestObjectClaimsForTest(core.IssuerBaseURL())
+	longLived["exp"] = time.Now().Add(time.Hour).Unix()
+
+	noID := requestObjectClaimsForTest(core.IssuerBaseURL())
+	delete(noID, "jti")
+
+	for _, requestObject := range []string{
+		clientAssertion(t, otherKey, requestObjectClaimsForTest(core.IssuerBaseURL())),
+		clientAssertion(t, requestObjectKey, requestObjectClaimsForTest("http://somewhere.else")),
+		clientAssertion(t, requestObjectKey, noExpiry),
+		clientAssertion(t, requestObjectKey, nested),
+		clientAssertion(t, requestObjectKey, longLived),
+		clientAssertion(t, requestObjectKey, noID),
+		"not-a-jwt",
+	} {
+		w = authorizeRequest(core, url.Values{
+			"client_id": {"1111-2222-3333333-4444444"},
+			"request":   {requestObject},
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, oauth2InvalidRequestObject, oauth2ErrorFromRecorder(t, w).Error)
+	}
+}
+
+func TestAuthorizeWithReplayedRequestObject(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	replayRepoMock := coreConfig.AssertionReplayRepo.(*mocks.AssertionReplayRepo)
+	replayRepoMock.On("RecordAssertionUse", "1111-2222-3333333-4444444", requestObjectReplayPrefix+"request-object-1", mock.Anything).Return(nil).Once()
+	replayRepoMock.On("RecordAssertionUse", "1111-2222-3333333-4444444", requestObjectReplayPrefix+"request-object-1", mock.Anything).Return(roll.AssertionReplayError{})
+
+	requestObjectKey := setupPARTestApp(t, coreConfig, false)
+	query := url.Values{
+		"client_id": {"1111-2222-3333333-4444444"},
+		"request":   {clientAssertion(t, requestObjectKey, requestObjectClaimsForTest(core.IssuerBaseURL()))},
+	}
+
+	w := authorizeRequest(core, query)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = authorizeRequest(core, query)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, oauth2InvalidRequestObject, oauth2ErrorFromRecorder(t, w).Error)
+	replayRepoMock.AssertExpectations(t)
+}
+
+func TestRequestObjectJTIDoesNotCollideWithClientAssertion(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	//The jti has already been used by a client assertion
+	replayRepoMock := coreConfig.AssertionReplayRepo.(*mocks.AssertionReplayRepo)
+	replayRepoMock.On("RecordAssertionUse", "1111-2222-3333333-4444444", "request-object-1", mock.Anything).Return(roll.AssertionReplayError{})
+
+	requestObjectKey := setupPARTestApp(t, coreConfig, false)
+	w := authorizeRequest(core, url.Values{
+		"client_id": {"1111-2222-3333333-4444444"},
+		"request":   {clientAssertion(t, requestObjectKey, requestObjectClaimsForTest(core.IssuerBaseURL()))},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	replayRepoMock.AssertCalled(t, "RecordAssertionUse", "1111-2222-3333333-4444444", requestObjectReplayPrefix+"request-object-1", mock.Anything)
+	replayRepoMock.AssertNotCalled(t, "RecordAssertionUse", "1111-2222-3333333-4444444", "request-object-1", mock.Anything)
+}
+
+func TestAuthorizeRequiresPushedAuthorization(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	requestObjectKey := setupPARTestApp(t, coreConfig, true)
+
+	w := authorizeRequest(core, url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"redirect_uri":  {"http://localhost:3000/ab"},
+		"response_type": {"code"},
+		"state":         {"xyz"},
+	})
+	assert.Equal(t, http.StatusFound, w.Code)
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, oauth2InvalidRequest, redirect.Query().Get("error"))
+		assert.Equal(t, ErrPushedAuthorizationRequired.Error(), redirect.Query().Get("error_description"))
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	}
+
+	//Request objects passed by value are not pushed either
+	w = authorizeRequest(core, url.Values{
+		"client_id": {"1111-2222-3333333-4444444"},
+		"request":   {clientAssertion(t, requestObjectKey, requestObjectClaimsForTest(core.IssuerBaseURL()))},
+	})
+	assert.Equal(t, http.StatusFound, w.Code)
+}
+
+func TestPushedAuthorizationMetadata(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("ListScopes").Return([]roll.Scope{}, nil)
+
+	r, _ := http.NewRequest("GET", AuthorizationServerMetadataURI, nil)
+	w := httptest.NewRecorder()
+	handleAuthorizationServerMetadata(core).ServeHTTP(w, r)
+
+	metadata := metadataFromResponse(t, w)
+	assert.Equal(t, core.IssuerBaseURL()+"/oauth2/par", metadata["pushed_authorization_request_endpoint"])
+	assert.Equal(t, false, metadata["require_pushed_authorization_requests"])
+	assert.Equal(t, true, metadata["request_parameter_supported"])
+	assert.Equal(t, false, metadata["request_uri_parameter_supported"])
+	assert.Contains(t, metadata["request_object_signing_alg_values_supported"], "ES256")
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"regexp"
+)
+
+//PKCE support - see RFC 7636
+
+const (
+	codeChallengeMethodS256  = "S256"
+	codeChallengeMethodPlain = "plain"
+
+	codeChallengeClaim       = "code_challenge"
+	codeChallengeMethodClaim = "code_challenge_method"
+)
+
+var (
+	//ErrInvalidCodeChallenge is returned when the code challenge or its method is malformed
+	ErrInvalidCodeChallenge = errors.New("code_challenge must be 43 to 128 characters and code_challenge_method S256 or plain")
+
+	//ErrCodeChallengeRequired is returned when a public client starts the code flow without a code challenge
+	ErrCodeChallengeRequired = errors.New("code_challenge is required for public clients")
+
+	//ErrInvalidCodeVerifier is returned when the code verifier does not match the code challenge
+	ErrInvalidCodeVerifier = errors.New("code_verifier does not match code_challenge")
+)
+
+//Code verifiers and S256 challenges share the same character set and length limits
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+type codeChallenge struct {
+	Challenge string
+	Method    string
+}
+
+//codeChallengeFromRequest extracts and validates the code challenge parameters of an authorization
+//request. A nil challenge is returned if the request does not use PKCE.
+func codeChallengeFromRequest(r *http.Request) (*codeChallenge, error) {
+	challenge := r.FormValue("code_challenge")
+	method := r.FormValue("code_challenge_method")
+
+	if challenge == "" {
+		if method != "" {
+			return nil, ErrInvalidCodeChallenge
+		}
+		return nil, nil
+	}
+
+	//The method defaults to plain if not specified
+	if method == "" {
+		method = codeChallengeMethodPlain
+	}
+
+	if method != codeChallengeMethodS256 && method != codeChallengeMethodPlain {
+		return nil, ErrInvalidCodeChallenge
+	}
+
+	if !codeVerifierPattern.MatchString(challenge) {
+		return nil, ErrInvalidCodeChallenge
+	}
+
+	return &codeChallenge{
+		Challenge: challenge,
+		Method:    method,
+	}, nil
+}
+
+//verify checks the code verifier presented at the token endpoint against the challenge
+func (cc *codeChallenge) verify(verifier string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	var computed string
+	switch cc.Method {
+	case codeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case codeChallengeMethodPlain:
+		computed = verifier
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(cc.Challenge)) == 1
+}
+
+//codeChallengeFromClaims extracts the code challenge from the claims of an authorization code. A nil
+//challenge is returned if the code was not issued using PKCE.
+func codeChallengeFromClaims(claims map[string]interface{}) *codeChallenge {
+	challenge, ok := claims[codeChallengeClaim].(string)
+	if !ok || challenge == "" {
+		return nil
+	}
+
+	method, _ := claims[codeChallengeMethodClaim].(string)
+	return &codeChallenge{
+		Challenge: challenge,
+		Method:    method,
+	}
+}
@@ -0,0 +1,250 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	rolltoken "github.com/xtraclabs/rollsecrets/token"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testCodeVerifier = "dBjftJeZ4CVP-mJ0kZbfxAdiDnfRQhAefpZ3pOUYHWdcM2xs6A0tcOHUQFOc"
+
+func s256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestCodeChallengeFromRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/?client_id=123", nil)
+	cc, err := codeChallengeFromRequest(req)
+	assert.Nil(t, err)
+	assert.Nil(t, cc)
+
+	req, _ = http.NewRequest("GET", "/?code_challenge="+testCodeVerifier, nil)
+	cc, err = codeChallengeFromRequest(req)
+	assert.Nil(t, err)
+	if assert.NotNil(t, cc) {
+		assert.Equal(t, codeChallengeMethodPlain, cc.Method)
+	}
+
+	req, _ = http.NewRequest("GET", "/?code_challenge="+s256Challenge(testCodeVerifier)+"&code_challenge_method=S256", nil)
+	cc, err = codeChallengeFromRequest(req)
+	assert.Nil(t, err)
+	if assert.NotNil(t, cc) {
+		assert.Equal(t, codeChallengeMethodS256, cc.Method)
+	}
+
+	req, _ = http.NewRequest("GET", "/?code_challenge="+testCodeVerifier+"&code_challenge_method=S512", nil)
+	_, err = codeChallengeFromRequest(req)
+	assert.Equal(t, ErrInvalidCodeChallenge, err)
+
+	req, _ = http.NewRequest("GET", "/?code_challenge=tooshort", nil)
+	_, err = codeChallengeFromRequest(req)
+	assert.Equal(t, ErrInvalidCodeChallenge, err)
+
+	req, _ = http.NewRequest("GET", "/?code_challenge_method=S256", nil)
+	_, err = codeChallengeFromRequest(req)
+	assert.Equal(t, ErrInvalidCodeChallenge, err)
+}
+
+func TestCodeChallengeVerify(t *testing.T) {
+	cc := &codeChallenge{Challenge: s256Challenge(testCodeVerifier), Method: codeChallengeMethodS256}
+	assert.True(t, cc.verify(testCodeVerifier))
+	assert.False(t, cc.verify(testCodeVerifier+"x"))
+	assert.False(t, cc.verify(""))
+
+	cc = &codeChallenge{Challenge: testCodeVerifier, Method: codeChallengeMethodPlain}
+	assert.True(t, cc.verify(testCodeVerifier))
+	assert.False(t, cc.verify(s256Challenge(testCodeVerifier)))
+}
+
+func setupPKCETestApp(t *testing.T, coreConfig *roll.CoreConfig, publicClient bool) string {
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		ClientSecret:    "not for browser clients",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		PublicClient:    publicClient,
+		AllowedScopes:   "admin",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	return privateKey
+}
+
+func generatePKCECode(t *testing.T, privateKey string, cc *codeChallenge) string {
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	code, err = addClaimsToToken(code, map[string]interface{}{
+		codeChallengeClaim:       cc.Challenge,
+		codeChallengeMethodClaim: cc.Method,
+	}, privateKey)
+	assert.Nil(t, err)
+
+	return code
+}
+
+func TestPKCECodeExchange(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code := generatePKCECode(t, privateKey, &codeChallenge{s256Challenge(testCodeVerifier), codeChallengeMethodS256})
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"code":          {code},
+			"code_verifier": {testCodeVerifier}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body := responseAsString(t, resp)
+
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(body), &jsonResponse)
+	assert.Nil(t, err)
+	assert.True(t, jsonResponse.AccessToken != "")
+}
+
+func TestPKCECodeExchangeWrongVerifier(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code := generatePKCECode(t, privateKey, &codeChallenge{s256Challenge(testCodeVerifier), codeChallengeMethodS256})
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"code":          {code},
+			"code_verifier": {testCodeVerifier + "-wrong"}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPKCEPublicClientWithoutSecret(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, true)
+	code := generatePKCECode(t, privateKey, &codeChallenge{s256Challenge(testCodeVerifier), codeChallengeMethodS256})
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"code":          {code},
+			"code_verifier": {testCodeVerifier}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPKCEPublicClientCodeWithoutChallenge(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, true)
+	code, err := rolltoken.GenerateCode("b-subject", "", "1111-2222-3333333-4444444", privateKey)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"code":          {code}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPKCEVerifierWithoutSecretForConfidentialClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+	code := generatePKCECode(t, privateKey, &codeChallenge{s256Challenge(testCodeVerifier), codeChallengeMethodS256})
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"code":          {code},
+			"code_verifier": {testCodeVerifier}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestPKCEAuthorizePublicClientRequiresChallenge(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	var callbackError, callbackDescription string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbackError = r.FormValue("error")
+		callbackDescription = r.FormValue("error_description")
+	}))
+	defer ts.Close()
+
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		RedirectURIs:    ts.URL,
+		LoginProvider:   "xtrac://localhost:9000",
+		PublicClient:    true,
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	resp := TestHTTPGet(t, addr+"/oauth2/authorize?client_id=1111-2222-3333333-4444444&response_type=code&redirect_uri="+url.QueryEscape(ts.URL), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "invalid_request", callbackError)
+	assert.Equal(t, ErrCodeChallengeRequired.Error(), callbackDescription)
+}
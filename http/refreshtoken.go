@@ -0,0 +1,188 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//Lifetime of an issued refresh token
+	refreshTokenLifetime = 30 * 24 * time.Hour
+
+	//Scope marker rolltoken.GenerateCode adds to the scope of authorization codes
+	authCodeScopeMarker = "xtAuthCode"
+)
+
+var (
+	//ErrInvalidRefreshToken is returned when a refresh token is unknown, expired, revoked, or issued
+	//to a different client
+	ErrInvalidRefreshToken = errors.New("Invalid refresh token")
+
+	//ErrRefreshTokenReuse is returned when a refresh token that has already been exchanged is presented again
+	ErrRefreshTokenReuse = errors.New("Refresh token has already been used - grant revoked")
+
+	//ErrScopeExceedsGrant is returned when a refresh request asks for scope beyond the original grant
+	ErrScopeExceedsGrant = errors.New("Requested scope exceeds the scope originally granted")
+)
+
+//grantedScopeFromCode strips the authorization code marker from the scope carried in a code
+func grantedScopeFromCode(codeScope string) string {
+	var granted []string
+	for _, s := range strings.Fields(codeScope) {
+		if s != authCodeScopeMarker {
+			granted = append(granted, s)
+		}
+	}
+
+	return strings.Join(granted, " ")
+}
+
+//scopeWithinGrant returns true if every part of the requested scope is present in the granted scope
+func scopeWithinGrant(requested, granted string) bool {
+	grantedParts := make(map[string]bool)
+	for _, g := range strings.Fields(granted) {
+		grantedParts[g] = true
+	}
+
+	for _, r := range strings.Fields(requested) {
+		if !grantedParts[r] {
+			return false
+		}
+	}
+
+	return true
+}
+
+//issueRefreshToken creates and stores a refresh token. An empty family ID starts a new token family.
+func issueRefreshToken(core *roll.Core, subject, scope string, resources []string, familyID string, app *roll.Application) (string, error) {
+	tokenID, err := core.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	if familyID == "" {
+		familyID = tokenID
+	}
+
+	rt := &roll.RefreshToken{
+		TokenID:   tokenID,
+		FamilyID:  familyID,
+		ClientID:  app.ClientID,
+		Subject:   subject,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(refreshTokenLifetime).Unix(),
+		Resources: strings.Join(resources, " "),
+	}
+
+	if err := core.StoreRefreshToken(rt); err != nil {
+		return "", err
+	}
+
+	return tokenID, nil
+}
+
+func revokeFamilyOnReuse(core *roll.Core, rt *roll.RefreshToken, w http.ResponseWriter) {
+	log.Warn("Refresh token reuse detected for family ", rt.FamilyID, " - revoking the family")
+	if err := core.RevokeRefreshTokenFamily(rt.FamilyID); err != nil {
+		log.Info("Error revoking refresh token family: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrRefreshTokenReuse)
+}
+
+func handleRefreshTokenGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
+	//Validate client details
+	app, err := validateClientDetails(core, codeContext)
+	if err != nil {
+		respondClientAuthError(w, err)
+
+		return
+	}
+
+	//Look up the refresh token
+	rt, err := core.RetrieveRefreshToken(codeContext.refreshToken)
+	if err != nil {
+		log.Info("Error retrieving refresh token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	if rt == nil || rt.ClientID != app.ClientID {
+		log.Info("Refresh token not found for client ", app.ClientID)
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidRefreshToken)
+		return
+	}
+
+	//A previously used token means the token has leaked or the client is replaying it. Either
+	//way the safe thing to do is revoke everything issued from the grant.
+	if rt.Used {
+		revokeFamilyOnReuse(core, rt, w)
+		return
+	}
+
+	if rt.Revoked || rt.Expired() {
+		log.Info("Refresh token revoked or expired")
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidRefreshToken)
+		return
+	}
+
+	//The requested scope may narrow, but not widen, the original grant
+	scope := rt.Scope
+	if codeContext.scope != "" {
+		if !scopeWithinGrant(codeContext.scope, rt.Scope) {
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, ErrScopeExceedsGrant)
+			return
+		}
+		scope = codeContext.scope
+	}
+
+	//The application may no longer be allowed all of the scope it was granted
+	if err := validateRequestedScope(core, app, scope); err != nil {
+		respondScopeError(w, err)
+		return
+	}
+
+	//Likewise the requested resources may narrow the resources of the original grant
+	grantedResources := strings.Fields(rt.Resources)
+	resources, err := targetResources(codeContext.resources, grantedResources)
+	if err != nil {
+		respondTargetError(w, err)
+		return
+	}
+
+	//Spend the token. Losing the race to mark it used is treated the same as reuse.
+	err = core.MarkRefreshTokenUsed(rt.TokenID)
+	if err != nil {
+		switch err.(type) {
+		case roll.RefreshTokenReuseError:
+			revokeFamilyOnReuse(core, rt, w)
+		default:
+			respondServerError(w, err)
+		}
+
+		return
+	}
+
+	//Rotate - issue a new access token and a new refresh token in the same family. The
+	//replacement refresh token keeps the scope and resources of the original grant.
+	at, err := generateAccessTokenResponse(core, rt.Subject, scope, resources, app)
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	at.RefreshToken, err = issueRefreshToken(core, rt.Subject, rt.Scope, grantedResources, rt.FamilyID, app)
+	if err != nil {
+		log.Info("Error issuing refresh token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	respondWithAccessToken(w, at)
+}
@@ -0,0 +1,306 @@
+package http
+
+import (
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	rolltoken "github.com/xtraclabs/rollsecrets/token"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupRefreshTokenTestApp(t *testing.T, coreConfig *roll.CoreConfig) {
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		ClientSecret:    "not for browser clients",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		AllowedScopes:   "admin",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+}
+
+func postRefreshTokenGrant(t *testing.T, addr, refreshToken, scope string) *http.Response {
+	values := url.Values{"grant_type": {"refresh_token"},
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"client_secret": {"not for browser clients"},
+		"refresh_token": {refreshToken}}
+	if scope != "" {
+		values.Set("scope", scope)
+	}
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, values)
+	assert.Nil(t, err)
+	return resp
+}
+
+func TestRefreshGrantMissingRefreshToken(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"refresh_token"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, "refresh_token missing from request"))
+}
+
+func TestRefreshGrantUnknownToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "no-such-token").Return(nil, nil)
+
+	resp := postRefreshTokenGrant(t, addr, "no-such-token", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, ErrInvalidRefreshToken.Error()))
+}
+
+func TestRefreshGrantOtherClientsToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "some-other-client",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+
+	resp := postRefreshTokenGrant(t, addr, "rt1", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, ErrInvalidRefreshToken.Error()))
+}
+
+func TestRefreshGrantExpiredToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(-1 * time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+
+	resp := postRefreshTokenGrant(t, addr, "rt1", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, ErrInvalidRefreshToken.Error()))
+}
+
+func TestRefreshGrantReuseRevokesFamily(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt2",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Used:      true,
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt2").Return(rt, nil)
+	refreshTokenRepoMock.On("RevokeRefreshTokenFamily", "rt1").Return(nil)
+
+	resp := postRefreshTokenGrant(t, addr, "rt2", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, ErrRefreshTokenReuse.Error()))
+	refreshTokenRepoMock.AssertCalled(t, "RevokeRefreshTokenFamily", "rt1")
+}
+
+func TestRefreshGrantConcurrentUseRevokesFamily(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt2",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt2").Return(rt, nil)
+	refreshTokenRepoMock.On("MarkRefreshTokenUsed", "rt2").Return(roll.RefreshTokenReuseError{})
+	refreshTokenRepoMock.On("RevokeRefreshTokenFamily", "rt1").Return(nil)
+
+	resp := postRefreshTokenGrant(t, addr, "rt2", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	refreshTokenRepoMock.AssertCalled(t, "RevokeRefreshTokenFamily", "rt1")
+}
+
+func TestRefreshGrantScopeExceedsGrant(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+
+	resp := postRefreshTokenGrant(t, addr, "rt1", "admin")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, ErrScopeExceedsGrant.Error()))
+}
+
+func TestRefreshGrantRotatesToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		Scope:     "admin",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+	refreshTokenRepoMock.On("MarkRefreshTokenUsed", "rt1").Return(nil)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.MatchedBy(func(stored *roll.RefreshToken) bool {
+		return stored.FamilyID == "rt1" && stored.Scope == "admin" && stored.Subject == "a-subject"
+	})).Return(nil)
+
+	resp := postRefreshTokenGrant(t, addr, "rt1", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	body := responseAsString(t, resp)
+	var jsonResponse accessTokenResponse
+	err := json.Unmarshal([]byte(body), &jsonResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, "steve", jsonResponse.RefreshToken)
+	assert.True(t, jsonResponse.TokenType == "Bearer")
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	assert.Nil(t, err)
+	assert.Equal(t, "a-subject", token.Claims["sub"].(string))
+	assert.Equal(t, "admin", token.Claims["scope"].(string))
+	refreshTokenRepoMock.AssertExpectations(t)
+}
+
+func TestRefreshGrantPublicClientWithoutSecret(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+	app, _ := core.SystemRetrieveApplication("1111-2222-3333333-4444444")
+	app.PublicClient = true
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		Scope:     "admin",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+	refreshTokenRepoMock.On("MarkRefreshTokenUsed", "rt1").Return(nil)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.MatchedBy(func(stored *roll.RefreshToken) bool {
+		return stored.FamilyID == "rt1" && stored.ClientID == "1111-2222-3333333-4444444"
+	})).Return(nil)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"refresh_token"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"refresh_token": {"rt1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, "steve", jsonResponse.RefreshToken)
+	refreshTokenRepoMock.AssertExpectations(t)
+}
+
+func TestRefreshGrantConfidentialClientWithoutSecret(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"refresh_token"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"refresh_token": {"rt1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.AssertNotCalled(t, "RetrieveRefreshToken", mock.Anything)
+}
@@ -0,0 +1,514 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/repos"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//RegisterURI is the dynamic client registration endpoint - see RFC 7591
+	RegisterURI = "/oauth2/register"
+
+	//RegisterClientURI is the base uri of the client configuration endpoint used to read, update and
+	//delete a registration - the client id follows the base uri. See RFC 7592.
+	RegisterClientURI = RegisterURI + "/"
+)
+
+var (
+	//ErrInvalidRegistrationToken is returned when a registration endpoint is called without a valid
+	//initial access token or registration access token
+	ErrInvalidRegistrationToken = errors.New("Missing, expired or invalid registration token")
+
+	//ErrInvalidRedirectURIs is returned when client metadata does not list valid redirect URIs
+	ErrInvalidRedirectURIs = errors.New("redirect_uris must list one or more valid redirect URIs")
+)
+
+//clientMetadata is the client metadata of RFC 7591 section 2, along with the client information returned
+//by the registration endpoints. login_provider is a roll extension naming the login provider that
+//authenticates the application's users.
+type clientMetadata struct {
+	ClientID                string `json:"client_id,omitempty"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+
+	RedirectURIs            []string       `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string         `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string       `json:"grant_types,omitempty"`
+	ResponseTypes           []string       `json:"response_types,omitempty"`
+	ClientName              string         `json:"client_name,omitempty"`
+	Scope                   string         `json:"scope,omitempty"`
+	Contacts                []string       `json:"contacts,omitempty"`
+	JWKS                    *jsonWebKeySet `json:"jwks,omitempty"`
+	JWKSURI                 string         `json:"jwks_uri,omitempty"`
+	LoginProvider           string         `json:"login_provider,omitempty"`
+
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+}
+
+func stringIn(s string, values []string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+//applicationFromMetadata maps client metadata onto an application definition. Clients that do not name
+//themselves are named by their client id, and the first contact is taken to be the developer's email.
+func applicationFromMetadata(md *clientMetadata, clientID string) (*roll.Application, error) {
+	if len(md.RedirectURIs) == 0 {
+		return nil, ErrInvalidRedirectURIs
+	}
+
+	for _, uri := range md.RedirectURIs {
+		if len(strings.Fields(uri)) != 1 || !roll.ValidRedirectURI(uri) {
+			return nil, ErrInvalidRedirectURIs
+		}
+	}
+
+	if len(md.Contacts) == 0 {
+		return nil, errors.New("contacts must include the email address of the application's developer")
+	}
+
+	//Registered grant and response types restrict the flows the client may use - see Application.AllowsGrantType
+	supported := supportedGrantTypes()
+	for _, grantType := range md.GrantTypes {
+		if !stringIn(grantType, supported) {
+			return nil, fmt.Errorf("Unsupported grant type %s", grantType)
+		}
+	}
+
+	for _, responseType := range md.ResponseTypes {
+		if !stringIn(responseType, supportedResponseTypes) {
+			return nil, fmt.Errorf("Unsupported response type %s", responseType)
+		}
+	}
+
+	if md.JWKSURI != "" {
+		return nil, errors.New("jwks_uri is not supported - register the client's key using jwks")
+	}
+
+	app := &roll.Application{
+		ClientID:        clientID,
+		ApplicationName: md.ClientName,
+		DeveloperEmail:  md.Contacts[0],
+		RedirectURIs:    strings.Join(md.RedirectURIs, " "),
+		LoginProvider:   md.LoginProvider,
+		AllowedScopes:   md.Scope,
+		GrantTypes:      strings.Join(md.GrantTypes, " "),
+		ResponseTypes:   strings.Join(md.ResponseTypes, " "),
+
+		RequirePushedAuthorizationRequests: md.RequirePushedAuthorizationRequests,
+	}
+
+	if app.ApplicationName == "" {
+		app.ApplicationName = clientID
+	}
+
+	switch md.TokenEndpointAuthMethod {
+	case "":
+		app.TokenEndpointAuthMethods = roll.ClientSecretBasic
+	case roll.ClientSecretBasic, roll.ClientSecretPost:
+		app.TokenEndpointAuthMethods = md.TokenEndpointAuthMethod
+	case clientAuthNone:
+		app.PublicClient = true
+	case roll.PrivateKeyJWT:
+		if md.JWKS == nil || len(md.JWKS.Keys) != 1 {
+			return nil, errors.New("private_key_jwt clients must register a single key using jwks")
+		}
+
+		publicKey, err := publicKeyPEMFromJWK(&md.JWKS.Keys[0])
+		if err != nil {
+			return nil, err
+		}
+
+		app.TokenEndpointAuthMethods = roll.PrivateKeyJWT
+		app.ClientAssertionPublicKey = publicKey
+	default:
+		return nil, fmt.Errorf("Unsupported token_endpoint_auth_method %s", md.TokenEndpointAuthMethod)
+	}
+
+	if err := app.Validate(); err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+//metadataFromApplication returns the client information for an application
+func metadataFromApplication(core *roll.Core, r *http.Request, app *roll.Application) *clientMetadata {
+	md := &clientMetadata{
+		ClientID:              app.ClientID,
+		RegistrationClientURI: issuerURL(core) + RegisterClientURI + app.ClientID,
+		RedirectURIs:          strings.Fields(app.RedirectURIs),
+		ClientName:            app.ApplicationName,
+		Scope:                 app.AllowedScopes,
+		Contacts:              []string{app.DeveloperEmail},
+		LoginProvider:         app.LoginProvider,
+		GrantTypes:            strings.Fields(app.GrantTypes),
+		ResponseTypes:         strings.Fields(app.ResponseTypes),
+
+		RequirePushedAuthorizationRequests: app.RequirePushedAuthorizationRequests,
+	}
+
+	if app.PublicClient {
+		md.TokenEndpointAuthMethod = clientAuthNone
+		return md
+	}
+
+	//Client secrets do not expire
+	var secretExpiresAt int64
+	md.ClientSecret = app.ClientSecret
+	md.ClientSecretExpiresAt = &secretExpiresAt
+
+	md.TokenEndpointAuthMethod = roll.ClientSecretBasic
+	if methods := strings.Fields(app.TokenEndpointAuthMethods); len(methods) > 0 {
+		md.TokenEndpointAuthMethod = methods[0]
+	}
+
+	if app.ClientAssertionPublicKey != "" {
+		jwk, err := jwkFromPEM(app.ClientAssertionPublicKey)
+		if err == nil {
+			md.JWKS = &jsonWebKeySet{Keys: []jsonWebKey{*jwk}}
+		}
+	}
+
+	return md
+}
+
+//newRegistrationToken completes and stores a registration token, returning the token value presented by
+//the client. Only a hash of the token secret is stored.
+func newRegistrationToken(core *roll.Core, token *roll.RegistrationToken) (string, error) {
+	tokenID, err := core.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	token.TokenID = tokenID
+	token.SecretHash = sha256Encoded(secret)
+	token.IssuedAt = time.Now().Unix()
+
+	if err := core.StoreRegistrationToken(token); err != nil {
+		return "", err
+	}
+
+	return tokenID + "." + secret, nil
+}
+
+//registrationTokenFromRequest returns the registration token of the given type presented as the bearer token
+//of the request. A nil token is returned if the token is missing, unknown, expired or of another type.
+func registrationTokenFromRequest(core *roll.Core, r *http.Request, tokenType string) (*roll.RegistrationToken, error) {
+	bearerToken, err := bearerTokenFromRequest(r)
+	if err != nil {
+		return nil, nil
+	}
+
+	sep := strings.LastIndex(bearerToken, ".")
+	if sep <= 0 {
+		return nil, nil
+	}
+
+	token, err := core.RetrieveRegistrationToken(bearerToken[:sep])
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	secretHash := sha256Encoded(bearerToken[sep+1:])
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(token.SecretHash)) != 1 {
+		return nil, nil
+	}
+
+	if token.TokenType != tokenType || token.Expired(time.Now().Unix()) {
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+//respondClientInformation responds with client information, which must not be cached as it includes the
+//client's credentials
+func respondClientInformation(w http.ResponseWriter, status int, md *clientMetadata) {
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.Encode(md)
+}
+
+//respondRegistrationError responds to a registration with client metadata that cannot be registered
+func respondRegistrationError(w http.ResponseWriter, err error) {
+	if err == ErrInvalidRedirectURIs {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRedirectURI, err)
+		return
+	}
+
+	respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidClientMetadata, err)
+}
+
+//registrationScopesRegistered checks the scope in client metadata is made up of registered scopes,
+//responding with an error if it is not
+func registrationScopesRegistered(core *roll.Core, w http.ResponseWriter, scope string) bool {
+	err := validateAllowedScopes(core, scope)
+	switch err {
+	case nil:
+		return true
+	case ErrUnknownScope:
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidClientMetadata, err)
+	default:
+		log.Info("Error validating registration scope: ", err.Error())
+		respondServerError(w, err)
+	}
+
+	return false
+}
+
+func handleRegister(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			handleRegisterPost(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//handleRegisterPost registers a client described by RFC 7591 client metadata. The request must carry an
+//initial access token, and the admin who issued the token owns the registered application.
+func handleRegisterPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	initialToken, err := registrationTokenFromRequest(core, r, roll.InitialAccessTokenType)
+	if err != nil {
+		log.Info("Error retrieving initial access token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	if initialToken == nil {
+		respondBearerError(w, http.StatusUnauthorized, "invalid_token", ErrInvalidRegistrationToken)
+		return
+	}
+
+	var md clientMetadata
+	if err := parseRequest(r, &md); err != nil {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidClientMetadata, err)
+		return
+	}
+
+	clientID, err := core.GenerateID()
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	app, err := applicationFromMetadata(&md, clientID)
+	if err != nil {
+		respondRegistrationError(w, err)
+		return
+	}
+
+	if !registrationScopesRegistered(core, w, app.AllowedScopes) {
+		return
+	}
+
+	app.DeveloperID = initialToken.IssuedBy
+
+	if err := core.CreateApplication(app); err != nil {
+		log.Info("Error storing registered app def: ", err.Error())
+		switch err.(type) {
+		case *repos.DuplicateAppdefError:
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidClientMetadata, err)
+		default:
+			respondServerError(w, err)
+		}
+		return
+	}
+
+	private, public, err := signing.GenerateKeyPair(app.SigningAlg())
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	if err := core.StoreKeysForApp(clientID, private, public); err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	registrationToken, err := newRegistrationToken(core, &roll.RegistrationToken{
+		TokenType: roll.RegistrationAccessTokenType,
+		ClientID:  clientID,
+		IssuedBy:  initialToken.IssuedBy,
+	})
+	if err != nil {
+		log.Info("Error issuing registration access token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	info := metadataFromApplication(core, r, app)
+	info.ClientIDIssuedAt = time.Now().Unix()
+	info.RegistrationAccessToken = registrationToken
+
+	respondClientInformation(w, http.StatusCreated, info)
+}
+
+func handleClientConfiguration(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleClientConfigurationGet(core, w, r)
+		case "PUT":
+			handleClientConfigurationPut(core, w, r)
+		case "DELETE":
+			handleClientConfigurationDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//registeredClient returns the application identified by the request uri, responding with an error if the
+//request does not carry the application's registration access token
+func registeredClient(core *roll.Core, w http.ResponseWriter, r *http.Request) (*roll.Application, *roll.RegistrationToken) {
+	clientID := strings.TrimPrefix(r.URL.Path, RegisterClientURI)
+
+	token, err := registrationTokenFromRequest(core, r, roll.RegistrationAccessTokenType)
+	if err != nil {
+		log.Info("Error retrieving registration access token: ", err.Error())
+		respondServerError(w, err)
+		return nil, nil
+	}
+
+	if token == nil || token.ClientID != clientID {
+		respondBearerError(w, http.StatusUnauthorized, "invalid_token", ErrInvalidRegistrationToken)
+		return nil, nil
+	}
+
+	app, err := core.SystemRetrieveApplication(clientID)
+	if err != nil {
+		log.Info("Error retrieving registered app def: ", err.Error())
+		respondServerError(w, err)
+		return nil, nil
+	}
+
+	//The token of a client that no longer exists is revoked - see RFC 7592 section 2.1
+	if app == nil {
+		if err := core.DeleteRegistrationToken(token.TokenID); err != nil {
+			log.Info("Error deleting registration access token: ", err.Error())
+		}
+
+		respondBearerError(w, http.StatusUnauthorized, "invalid_token", ErrInvalidRegistrationToken)
+		return nil, nil
+	}
+
+	return app, token
+}
+
+func handleClientConfigurationGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app, _ := registeredClient(core, w, r)
+	if app == nil {
+		return
+	}
+
+	respondClientInformation(w, http.StatusOK, metadataFromApplication(core, r, app))
+}
+
+//handleClientConfigurationPut replaces the client's metadata - see RFC 7592 section 2.2
+func handleClientConfigurationPut(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app, _ := registeredClient(core, w, r)
+	if app == nil {
+		return
+	}
+
+	var md clientMetadata
+	if err := parseRequest(r, &md); err != nil {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidClientMetadata, err)
+		return
+	}
+
+	if md.ClientID != app.ClientID {
+		respondInvalidRequest(w, errors.New("client_id must match the client being updated"))
+		return
+	}
+
+	if md.ClientSecret != "" && md.ClientSecret != app.ClientSecret {
+		respondInvalidRequest(w, errors.New("client_secret does not match the client's secret"))
+		return
+	}
+
+	updated, err := applicationFromMetadata(&md, app.ClientID)
+	if err != nil {
+		respondRegistrationError(w, err)
+		return
+	}
+
+	if !registrationScopesRegistered(core, w, updated.AllowedScopes) {
+		return
+	}
+
+	updated.ClientSecret = app.ClientSecret
+	updated.DeveloperID = app.DeveloperID
+
+	//Settings that are not part of the client metadata are kept as set through the applications API
+	updated.TokenSigningAlg = app.TokenSigningAlg
+	updated.AccessTokenLifetime = app.AccessTokenLifetime
+	updated.TokenExchangeClients = app.TokenExchangeClients
+	updated.JWTFlowPublicKey = app.JWTFlowPublicKey
+	updated.JWTFlowIssuer = app.JWTFlowIssuer
+	updated.JWTFlowAudience = app.JWTFlowAudience
+
+	if err := core.UpdateApplication(updated, app.DeveloperID); err != nil {
+		log.Info("Error updating registered app def: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	respondClientInformation(w, http.StatusOK, metadataFromApplication(core, r, updated))
+}
+
+//handleClientConfigurationDelete deregisters the client, revoking its registration access token
+func handleClientConfigurationDelete(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app, token := registeredClient(core, w, r)
+	if app == nil {
+		return
+	}
+
+	if err := core.DeleteApplication(app.ClientID); err != nil {
+		log.Info("Error deleting registered app def: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	if err := core.DeleteRegistrationToken(token.TokenID); err != nil {
+		log.Info("Error deleting registration access token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	respondOk(w, nil)
+}
@@ -0,0 +1,436 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const registeredClientID = "1111-2222-3333333-4444444"
+
+//setupRegistrationToken mocks the lookup of a registration token, returning the bearer token value that
+//matches it
+func setupRegistrationToken(coreConfig *roll.CoreConfig, token roll.RegistrationToken) string {
+	token.SecretHash = sha256Encoded("shh")
+
+	rtRepoMock := coreConfig.RegistrationTokenRepo.(*mocks.RegistrationTokenRepo)
+	rtRepoMock.On("RetrieveRegistrationToken", token.TokenID).Return(&token, nil)
+
+	return token.TokenID + ".shh"
+}
+
+func setupInitialAccessToken(coreConfig *roll.CoreConfig) string {
+	return setupRegistrationToken(coreConfig, roll.RegistrationToken{
+		TokenID:   "initial-token",
+		TokenType: roll.InitialAccessTokenType,
+		IssuedBy:  "an-admin",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+}
+
+func setupRegistrationAccessToken(coreConfig *roll.CoreConfig) string {
+	return setupRegistrationToken(coreConfig, roll.RegistrationToken{
+		TokenID:   "client-token",
+		TokenType: roll.RegistrationAccessTokenType,
+		ClientID:  registeredClientID,
+		IssuedBy:  "an-admin",
+	})
+}
+
+func registrationRequest(t *testing.T, method, uri, bearerToken string, body interface{}) *http.Response {
+	bodyBytes, err := json.Marshal(body)
+	assert.Nil(t, err)
+
+	req, err := http.NewRequest(method, uri, bytes.NewReader(bodyBytes))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	return resp
+}
+
+func registrationMetadata() map[string]interface{} {
+	return map[string]interface{}{
+		"client_name":    "fight-club",
+		"redirect_uris":  []string{"https://fightclub.example.com/cb", "http://127.0.0.1/cb"},
+		"contacts":       []string{"tyler@example.com"},
+		"scope":          "orders.read",
+		"grant_types":    []string{"authorization_code", "refresh_token"},
+		"response_types": []string{"code"},
+		"login_provider": "xtrac://localhost:9000",
+	}
+}
+
+func registrationResponse(t *testing.T, resp *http.Response) map[string]interface{} {
+	var body map[string]interface{}
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &body)
+	assert.Nil(t, err)
+	return body
+}
+
+func TestRegisterClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	initialToken := setupInitialAccessToken(coreConfig)
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("RetrieveScope", "orders.read").Return(&roll.Scope{Name: "orders.read", Description: "Read your orders"}, nil)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("CreateApplication", mock.AnythingOfType("*roll.Application")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*roll.Application).ClientSecret = "hush"
+	})
+
+	secretsRepoMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsRepoMock.On("StoreKeysForApp", "steve", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+
+	rtRepoMock := coreConfig.RegistrationTokenRepo.(*mocks.RegistrationTokenRepo)
+	rtRepoMock.On("StoreRegistrationToken", mock.AnythingOfType("*roll.RegistrationToken")).Return(nil)
+
+	resp := registrationRequest(t, "POST", addr+RegisterURI, initialToken, registrationMetadata())
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	info := registrationResponse(t, resp)
+	assert.Equal(t, "steve", info["client_id"])
+	assert.Equal(t, "hush", info["client_secret"])
+	assert.Equal(t, float64(0), info["client_secret_expires_at"])
+	assert.NotNil(t, info["client_id_issued_at"])
+	assert.Equal(t, addr+RegisterClientURI+"steve", info["registration_client_uri"])
+	assert.Equal(t, roll.ClientSecretBasic, info["token_endpoint_auth_method"])
+	assert.Equal(t, []interface{}{"https://fightclub.example.com/cb", "http://127.0.0.1/cb"}, info["redirect_uris"])
+	assert.Equal(t, []interface{}{"authorization_code", "refresh_token"}, info["grant_types"])
+	assert.Equal(t, []interface{}{"code"}, info["response_types"])
+
+	registrationToken, _ := info["registration_access_token"].(string)
+	assert.True(t, strings.HasPrefix(registrationToken, "steve."))
+
+	app := appRepoMock.Calls[0].Arguments.Get(0).(*roll.Application)
+	assert.Equal(t, "steve", app.ClientID)
+	assert.Equal(t, "fight-club", app.ApplicationName)
+	assert.Equal(t, "tyler@example.com", app.DeveloperEmail)
+	assert.Equal(t, "an-admin", app.DeveloperID)
+	assert.Equal(t, "https://fightclub.example.com/cb http://127.0.0.1/cb", app.RedirectURIs)
+	assert.Equal(t, "orders.read", app.AllowedScopes)
+	assert.Equal(t, "xtrac://localhost:9000", app.LoginProvider)
+	assert.Equal(t, "authorization_code refresh_token", app.GrantTypes)
+	assert.Equal(t, "code", app.ResponseTypes)
+
+	stored := rtRepoMock.Calls[1].Arguments.Get(0).(*roll.RegistrationToken)
+	assert.Equal(t, roll.RegistrationAccessTokenType, stored.TokenType)
+	assert.Equal(t, "steve", stored.ClientID)
+	assert.Equal(t, "an-admin", stored.IssuedBy)
+	assert.Equal(t, sha256Encoded(strings.TrimPrefix(registrationToken, "steve.")), stored.SecretHash)
+}
+
+func TestRegisterPublicClient(t *testing.T) {
+	md := &clientMetadata{
+		RedirectURIs:            []string{"http://127.0.0.1/cb"},
+		Contacts:                []string{"tyler@example.com"},
+		TokenEndpointAuthMethod: clientAuthNone,
+		LoginProvider:           "xtrac://localhost:9000",
+	}
+
+	app, err := applicationFromMetadata(md, registeredClientID)
+	if assert.Nil(t, err) {
+		assert.True(t, app.PublicClient)
+		assert.Equal(t, registeredClientID, app.ApplicationName)
+	}
+}
+
+func TestRegisterPrivateKeyJWTClient(t *testing.T) {
+	_, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	jwk, err := jwkFromPEM(publicKey)
+	assert.Nil(t, err)
+
+	md := &clientMetadata{
+		RedirectURIs:            []string{"https://fightclub.example.com/cb"},
+		Contacts:                []string{"tyler@example.com"},
+		TokenEndpointAuthMethod: roll.PrivateKeyJWT,
+		LoginProvider:           "xtrac://localhost:9000",
+	}
+
+	_, err = applicationFromMetadata(md, registeredClientID)
+	assert.NotNil(t, err)
+
+	md.JWKS = &jsonWebKeySet{Keys: []jsonWebKey{*jwk}}
+	app, err := applicationFromMetadata(md, registeredClientID)
+	if assert.Nil(t, err) {
+		assert.Equal(t, roll.PrivateKeyJWT, app.TokenEndpointAuthMethods)
+
+		registered, err := jwkFromPEM(app.ClientAssertionPublicKey)
+		if assert.Nil(t, err) {
+			assert.Equal(t, jwk.KeyID, registered.KeyID)
+		}
+	}
+}
+
+func TestRegisterClientInvalidToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+	expiredToken := setupRegistrationToken(coreConfig, roll.RegistrationToken{
+		TokenID:   "expired-token",
+		TokenType: roll.InitialAccessTokenType,
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	})
+
+	setupInitialAccessToken(coreConfig)
+
+	for _, token := range []string{"", "initial-token", "initial-token.nope", expiredToken, registrationToken} {
+		resp := registrationRequest(t, "POST", addr+RegisterURI, token, registrationMetadata())
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, token)
+		assert.True(t, strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Bearer"))
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.AssertNotCalled(t, "CreateApplication", mock.Anything)
+}
+
+func TestRegisterClientInvalidMetadata(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	initialToken := setupInitialAccessToken(coreConfig)
+
+	md := registrationMetadata()
+	md["redirect_uris"] = []string{"https://fightclub.example.com/cb#fragment"}
+	resp := registrationRequest(t, "POST", addr+RegisterURI, initialToken, md)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, oauth2InvalidRedirectURI, registrationResponse(t, resp)["error"])
+
+	for _, change := range []map[string]interface{}{
+		{"contacts": []string{}},
+		{"login_provider": ""},
+		{"grant_types": []string{"urn:example:unsupported"}},
+		{"response_types": []string{"code id_token"}},
+		{"token_endpoint_auth_method": "client_secret_jwt"},
+		{"jwks_uri": "https://fightclub.example.com/jwks"},
+	} {
+		md := registrationMetadata()
+		for k, v := range change {
+			md[k] = v
+		}
+
+		resp := registrationRequest(t, "POST", addr+RegisterURI, initialToken, md)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, oauth2InvalidClientMetadata, registrationResponse(t, resp)["error"], change)
+	}
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("RetrieveScope", "orders.read").Return(nil, nil)
+
+	resp = registrationRequest(t, "POST", addr+RegisterURI, initialToken, registrationMetadata())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, oauth2InvalidClientMetadata, registrationResponse(t, resp)["error"])
+}
+
+func setupRegisteredClient(coreConfig *roll.CoreConfig) *mocks.ApplicationRepo {
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", registeredClientID).Return(&roll.Application{
+		ClientID:                 registeredClientID,
+		ApplicationName:          "fight-club",
+		ClientSecret:             "hush",
+		DeveloperEmail:           "tyler@example.com",
+		DeveloperID:              "an-admin",
+		RedirectURIs:             "https://fightclub.example.com/cb",
+		LoginProvider:            "xtrac://localhost:9000",
+		TokenEndpointAuthMethods: roll.ClientSecretPost,
+	}, nil)
+
+	return appRepoMock
+}
+
+func TestClientConfigurationGet(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+	setupRegisteredClient(coreConfig)
+
+	resp := registrationRequest(t, "GET", addr+RegisterClientURI+registeredClientID, registrationToken, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	info := registrationResponse(t, resp)
+	assert.Equal(t, registeredClientID, info["client_id"])
+	assert.Equal(t, "hush", info["client_secret"])
+	assert.Equal(t, "fight-club", info["client_name"])
+	assert.Equal(t, roll.ClientSecretPost, info["token_endpoint_auth_method"])
+	assert.Equal(t, []interface{}{"tyler@example.com"}, info["contacts"])
+	_, present := info["registration_access_token"]
+	assert.False(t, present)
+}
+
+func TestClientConfigurationWrongClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+	initialToken := setupInitialAccessToken(coreConfig)
+
+	resp := registrationRequest(t, "GET", addr+RegisterClientURI+"5555-6666", registrationToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = registrationRequest(t, "GET", addr+RegisterClientURI+registeredClientID, initialToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestClientConfigurationDeletedClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", registeredClientID).Return(nil, nil)
+
+	rtRepoMock := coreConfig.RegistrationTokenRepo.(*mocks.RegistrationTokenRepo)
+	rtRepoMock.On("DeleteRegistrationToken", "client-token").Return(nil)
+
+	resp := registrationRequest(t, "GET", addr+RegisterClientURI+registeredClientID, registrationToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	rtRepoMock.AssertCalled(t, "DeleteRegistrationToken", "client-token")
+}
+
+func TestClientConfigurationPut(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+	appRepoMock := setupRegisteredClient(coreConfig)
+	appRepoMock.On("UpdateApplication", mock.AnythingOfType("*roll.Application"), "an-admin").Return(nil)
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("RetrieveScope", "orders.read").Return(&roll.Scope{Name: "orders.read", Description: "Read your orders"}, nil)
+
+	md := registrationMetadata()
+	md["client_id"] = registeredClientID
+	md["client_name"] = "project-mayhem"
+	md["token_endpoint_auth_method"] = clientAuthNone
+
+	resp := registrationRequest(t, "PUT", addr+RegisterClientURI+registeredClientID, registrationToken, md)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	info := registrationResponse(t, resp)
+	assert.Equal(t, "project-mayhem", info["client_name"])
+	assert.Equal(t, clientAuthNone, info["token_endpoint_auth_method"])
+	_, present := info["client_secret"]
+	assert.False(t, present)
+
+	updated := appRepoMock.Calls[1].Arguments.Get(0).(*roll.Application)
+	assert.Equal(t, registeredClientID, updated.ClientID)
+	assert.Equal(t, "project-mayhem", updated.ApplicationName)
+	assert.Equal(t, "hush", updated.ClientSecret)
+	assert.Equal(t, "an-admin", updated.DeveloperID)
+	assert.True(t, updated.PublicClient)
+}
+
+func TestClientConfigurationPutReplacesMetadata(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", registeredClientID).Return(&roll.Application{
+		ClientID:            registeredClientID,
+		ApplicationName:     "fight-club",
+		ClientSecret:        "hush",
+		DeveloperEmail:      "tyler@example.com",
+		DeveloperID:         "an-admin",
+		RedirectURIs:        "https://fightclub.example.com/cb",
+		LoginProvider:       "xtrac://localhost:9000",
+		AllowedScopes:       "orders.read",
+		GrantTypes:          "authorization_code refresh_token",
+		ResponseTypes:       "code",
+		AccessTokenLifetime: 600,
+	}, nil)
+	appRepoMock.On("UpdateApplication", mock.AnythingOfType("*roll.Application"), "an-admin").Return(nil)
+
+	md := registrationMetadata()
+	md["client_id"] = registeredClientID
+	md["contacts"] = []string{"marla@example.com"}
+	delete(md, "scope")
+	delete(md, "grant_types")
+	delete(md, "response_types")
+
+	resp := registrationRequest(t, "PUT", addr+RegisterClientURI+registeredClientID, registrationToken, md)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	info := registrationResponse(t, resp)
+	assert.Equal(t, []interface{}{"marla@example.com"}, info["contacts"])
+	_, present := info["grant_types"]
+	assert.False(t, present)
+
+	//Omitted metadata is cleared, settings made through the applications API are kept
+	updated := appRepoMock.Calls[1].Arguments.Get(0).(*roll.Application)
+	assert.Equal(t, "marla@example.com", updated.DeveloperEmail)
+	assert.Equal(t, "", updated.AllowedScopes)
+	assert.Equal(t, "", updated.GrantTypes)
+	assert.Equal(t, "", updated.ResponseTypes)
+	assert.Equal(t, int64(600), updated.AccessTokenLifetime)
+}
+
+func TestClientConfigurationPutMismatchedCredentials(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+	appRepoMock := setupRegisteredClient(coreConfig)
+
+	md := registrationMetadata()
+	resp := registrationRequest(t, "PUT", addr+RegisterClientURI+registeredClientID, registrationToken, md)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, oauth2InvalidRequest, registrationResponse(t, resp)["error"])
+
+	md["client_id"] = registeredClientID
+	md["client_secret"] = "guess"
+	resp = registrationRequest(t, "PUT", addr+RegisterClientURI+registeredClientID, registrationToken, md)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	appRepoMock.AssertNotCalled(t, "UpdateApplication", mock.Anything, mock.Anything)
+}
+
+func TestClientConfigurationDelete(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	registrationToken := setupRegistrationAccessToken(coreConfig)
+	appRepoMock := setupRegisteredClient(coreConfig)
+	appRepoMock.On("DeleteApplication", registeredClientID).Return(nil)
+
+	rtRepoMock := coreConfig.RegistrationTokenRepo.(*mocks.RegistrationTokenRepo)
+	rtRepoMock.On("DeleteRegistrationToken", "client-token").Return(nil)
+
+	resp := registrationRequest(t, "DELETE", addr+RegisterClientURI+registeredClientID, registrationToken, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	appRepoMock.AssertCalled(t, "DeleteApplication", registeredClientID)
+	rtRepoMock.AssertCalled(t, "DeleteRegistrationToken", "client-token")
+}
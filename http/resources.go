@@ -0,0 +1,224 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"sort"
+)
+
+//ProtectedResourcesURI is the uri for the protected resource registry. Resource identifiers are URIs, so
+//the resource to delete is given in the resource query parameter rather than the path.
+const ProtectedResourcesURI = "/v1/protectedresources/"
+
+//resourceClaim carries the resources requested in an authorize request in the authorization code
+const resourceClaim = "resource"
+
+var (
+	//ErrInvalidResource is returned when a resource indicator is not an absolute URI without a fragment
+	ErrInvalidResource = errors.New("resource must be an absolute URI without a fragment")
+
+	//ErrUnknownResource is returned when a resource indicator is not in the protected resource registry
+	ErrUnknownResource = errors.New("Requested resource is not registered")
+
+	//ErrResourceExceedsGrant is returned when a token request names a resource that was not part of
+	//the original grant
+	ErrResourceExceedsGrant = errors.New("Requested resource exceeds the resources originally granted")
+)
+
+//describeResources returns the registry entries for each of the resource indicators in a request.
+//ErrInvalidResource or ErrUnknownResource are returned for invalid resources, other errors mean the
+//resources could not be checked.
+func describeResources(core *roll.Core, identifiers []string) ([]roll.ProtectedResource, error) {
+	var resources []roll.ProtectedResource
+	for _, identifier := range identifiers {
+		if !roll.ValidResourceIdentifier(identifier) {
+			return nil, ErrInvalidResource
+		}
+
+		resource, err := core.RetrieveProtectedResource(identifier)
+		if err != nil {
+			return nil, err
+		}
+
+		if resource == nil {
+			log.Info("Resource ", identifier, " is not registered")
+			return nil, ErrUnknownResource
+		}
+
+		resources = append(resources, *resource)
+	}
+
+	return resources, nil
+}
+
+//invalidTarget is true for resource validation errors that mean a requested resource is invalid, or
+//was not part of the grant
+func invalidTarget(err error) bool {
+	return err == ErrInvalidResource || err == ErrUnknownResource || err == ErrResourceExceedsGrant
+}
+
+//respondTargetError responds to a token request with a resource that failed validation
+func respondTargetError(w http.ResponseWriter, err error) {
+	if invalidTarget(err) {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidTarget, err)
+		return
+	}
+
+	log.Info("Error validating resource: ", err.Error())
+	respondServerError(w, err)
+}
+
+//targetResources returns the resources a token issued from an earlier grant is for. The token request
+//may narrow, but not widen, the resources of the grant - see RFC 8707 section 2.2.
+func targetResources(requested, granted []string) ([]string, error) {
+	if len(requested) == 0 {
+		return granted, nil
+	}
+
+	for _, r := range requested {
+		if !stringIn(r, granted) {
+			return nil, ErrResourceExceedsGrant
+		}
+	}
+
+	return requested, nil
+}
+
+//resourcesFromClaims returns the resources carried in a claim as a list of strings
+func resourcesFromClaims(claims map[string]interface{}, name string) []string {
+	var resources []string
+	values, _ := claims[name].([]interface{})
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			resources = append(resources, s)
+		}
+	}
+
+	return resources
+}
+
+//withAudience adds an aud claim restricting an access token to the resources it was issued for. Tokens
+//issued without resources keep the client id as their audience.
+func withAudience(claims map[string]interface{}, resources []string) map[string]interface{} {
+	if len(resources) == 0 {
+		return claims
+	}
+
+	if claims == nil {
+		claims = make(map[string]interface{})
+	}
+
+	if len(resources) == 1 {
+		claims["aud"] = resources[0]
+	} else {
+		claims["aud"] = resources
+	}
+
+	return claims
+}
+
+func handleProtectedResources(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleProtectedResourcesGet(core, w, r)
+		case "PUT":
+			handleProtectedResourcesPut(core, w, r)
+		case "DELETE":
+			handleProtectedResourcesDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//protectedResourcesAdmin checks the caller may maintain the protected resource registry, responding with
+//an error if not
+func protectedResourcesAdmin(core *roll.Core, w http.ResponseWriter, r *http.Request) bool {
+	admin, err := scopeAdmin(core, r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if !admin {
+		respondError(w, http.StatusForbidden, errors.New("Admin scope required to maintain the protected resource registry"))
+		return false
+	}
+
+	return true
+}
+
+func handleProtectedResourcesGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	resources, err := core.ListProtectedResources()
+	if err != nil {
+		log.Info("Error listing protected resources: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if resources == nil {
+		resources = []roll.ProtectedResource{}
+	}
+
+	sort.Sort(resourcesByIdentifier(resources))
+	respondOk(w, resources)
+}
+
+func handleProtectedResourcesPut(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	if !protectedResourcesAdmin(core, w, r) {
+		return
+	}
+
+	var resource roll.ProtectedResource
+	if err := parseRequest(r, &resource); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := resource.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := core.StoreProtectedResource(&resource); err != nil {
+		log.Info("Error storing protected resource: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, nil)
+}
+
+func handleProtectedResourcesDelete(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	if !protectedResourcesAdmin(core, w, r) {
+		return
+	}
+
+	identifier := r.URL.Query().Get("resource")
+	if identifier == "" {
+		respondError(w, http.StatusBadRequest, errors.New("resource query parameter must be specified"))
+		return
+	}
+
+	if err := core.DeleteProtectedResource(identifier); err != nil {
+		switch err.(type) {
+		case roll.NoSuchProtectedResourceError:
+			respondNotFound(w)
+		default:
+			log.Info("Error deleting protected resource: ", err.Error())
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	respondOk(w, nil)
+}
+
+type resourcesByIdentifier []roll.ProtectedResource
+
+func (r resourcesByIdentifier) Len() int           { return len(r) }
+func (r resourcesByIdentifier) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r resourcesByIdentifier) Less(i, j int) bool { return r[i].Identifier < r[j].Identifier }
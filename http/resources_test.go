@@ -0,0 +1,443 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	ordersResource   = "https://api.example.com/orders"
+	invoicesResource = "https://api.example.com/invoices"
+)
+
+//setupProtectedResources registers the orders and invoices resources
+func setupProtectedResources(coreConfig *roll.CoreConfig) *mocks.ProtectedResourceRepo {
+	resourceRepoMock := coreConfig.ProtectedResourceRepo.(*mocks.ProtectedResourceRepo)
+	resourceRepoMock.On("RetrieveProtectedResource", ordersResource).Return(&roll.ProtectedResource{Identifier: ordersResource, Description: "Orders API"}, nil)
+	resourceRepoMock.On("RetrieveProtectedResource", invoicesResource).Return(&roll.ProtectedResource{Identifier: invoicesResource, Description: "Invoices API"}, nil)
+	resourceRepoMock.On("RetrieveProtectedResource", mock.AnythingOfType("string")).Return(nil, nil)
+	return resourceRepoMock
+}
+
+func parseAccessToken(t *testing.T, core *roll.Core, body string) *jwt.Token {
+	var jsonResponse accessTokenResponse
+	err := json.Unmarshal([]byte(body), &jsonResponse)
+	assert.Nil(t, err)
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, keyExtractionFunction(core))
+	assert.Nil(t, err)
+	return token
+}
+
+func TestDescribeResources(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	resourceRepoMock := coreConfig.ProtectedResourceRepo.(*mocks.ProtectedResourceRepo)
+	resourceRepoMock.On("RetrieveProtectedResource", ordersResource).Return(&roll.ProtectedResource{Identifier: ordersResource, Description: "Orders API"}, nil)
+	resourceRepoMock.On("RetrieveProtectedResource", invoicesResource).Return(nil, nil)
+	resourceRepoMock.On("RetrieveProtectedResource", "https://api.example.com/broken").Return(nil, errors.New("boom"))
+
+	resources, err := describeResources(core, []string{ordersResource})
+	if assert.Nil(t, err) && assert.Equal(t, 1, len(resources)) {
+		assert.Equal(t, "Orders API", resources[0].Description)
+	}
+
+	_, err = describeResources(core, []string{ordersResource, invoicesResource})
+	assert.Equal(t, ErrUnknownResource, err)
+
+	_, err = describeResources(core, []string{"orders"})
+	assert.Equal(t, ErrInvalidResource, err)
+
+	_, err = describeResources(core, []string{"https://api.example.com/broken"})
+	if assert.NotNil(t, err) {
+		assert.False(t, invalidTarget(err))
+	}
+}
+
+func TestTargetResources(t *testing.T) {
+	granted := []string{ordersResource, invoicesResource}
+
+	resources, err := targetResources(nil, granted)
+	assert.Nil(t, err)
+	assert.Equal(t, granted, resources)
+
+	resources, err = targetResources([]string{invoicesResource}, granted)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{invoicesResource}, resources)
+
+	_, err = targetResources([]string{"https://api.example.com/other"}, granted)
+	assert.Equal(t, ErrResourceExceedsGrant, err)
+
+	_, err = targetResources([]string{ordersResource}, nil)
+	assert.Equal(t, ErrResourceExceedsGrant, err)
+}
+
+func TestProtectedResourcesList(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resourceRepoMock := coreConfig.ProtectedResourceRepo.(*mocks.ProtectedResourceRepo)
+	resourceRepoMock.On("ListProtectedResources").Return([]roll.ProtectedResource{
+		{Identifier: ordersResource, Description: "Orders API"},
+		{Identifier: invoicesResource, Description: "Invoices API"},
+	}, nil)
+
+	resp := TestHTTPGetWithRollSubject(t, addr+ProtectedResourcesURI, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var resources []roll.ProtectedResource
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &resources)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(resources)) {
+		assert.Equal(t, invoicesResource, resources[0].Identifier)
+		assert.Equal(t, ordersResource, resources[1].Identifier)
+	}
+}
+
+func TestProtectedResourcesPut(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	resourceRepoMock := coreConfig.ProtectedResourceRepo.(*mocks.ProtectedResourceRepo)
+	resourceRepoMock.On("StoreProtectedResource", mock.AnythingOfType("*roll.ProtectedResource")).Return(nil)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+ProtectedResourcesURI, roll.ProtectedResource{Identifier: ordersResource, Description: "Orders API"})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	stored := resourceRepoMock.Calls[0].Arguments.Get(0).(*roll.ProtectedResource)
+	assert.Equal(t, ordersResource, stored.Identifier)
+	assert.Equal(t, "Orders API", stored.Description)
+}
+
+func TestProtectedResourcesPutNotAdmin(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(false, nil)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+ProtectedResourcesURI, roll.ProtectedResource{Identifier: ordersResource, Description: "Orders API"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestProtectedResourcesPutInvalid(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+ProtectedResourcesURI, roll.ProtectedResource{Identifier: ordersResource + "#v1", Description: "Orders API"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), "Identifier"))
+}
+
+func TestProtectedResourcesDelete(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	resourceRepoMock := coreConfig.ProtectedResourceRepo.(*mocks.ProtectedResourceRepo)
+	resourceRepoMock.On("DeleteProtectedResource", ordersResource).Return(nil)
+	resourceRepoMock.On("DeleteProtectedResource", invoicesResource).Return(roll.NoSuchProtectedResourceError{})
+
+	resp := TestHTTPDeleteWithRollSubject(t, addr+ProtectedResourcesURI+"?resource="+url.QueryEscape(ordersResource), nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = TestHTTPDeleteWithRollSubject(t, addr+ProtectedResourcesURI+"?resource="+url.QueryEscape(invoicesResource), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = TestHTTPDeleteWithRollSubject(t, addr+ProtectedResourcesURI, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestClientCredentialsForResource(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "")
+	setupProtectedResources(coreConfig)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"resource":      {ordersResource}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	token := parseAccessToken(t, core, responseAsString(t, resp))
+	assert.Equal(t, ordersResource, token.Claims["aud"])
+	assert.Equal(t, "1111-2222-3333333-4444444", token.Claims["client_id"])
+}
+
+func TestClientCredentialsForSeveralResources(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "")
+	setupProtectedResources(coreConfig)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"resource":      {ordersResource, invoicesResource}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	token := parseAccessToken(t, core, responseAsString(t, resp))
+	assert.Equal(t, []interface{}{ordersResource, invoicesResource}, token.Claims["aud"])
+}
+
+func TestClientCredentialsUnknownResource(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupClientCredentialsTestApp(t, coreConfig, "")
+	setupProtectedResources(coreConfig)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"client_credentials"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"resource":      {"https://api.example.com/unregistered"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	errResp := readOAuth2Error(t, resp)
+	assert.Equal(t, "invalid_target", errResp.Error)
+	assert.Equal(t, ErrUnknownResource.Error(), errResp.ErrorDescription)
+}
+
+func TestAuthCodeExchangeForResource(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+	setupProtectedResources(coreConfig)
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("StoreAuthCode", mock.Anything).Return(nil)
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	code, err := generateSignedCode(core, "a-subject", "", "http://localhost:3000/ab", []string{ordersResource, invoicesResource}, app, nil, nil)
+	assert.Nil(t, err)
+
+	//The refresh token keeps all the resources the code was issued for
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.MatchedBy(func(stored *roll.RefreshToken) bool {
+		return stored.Resources == ordersResource+" "+invoicesResource
+	})).Return(nil)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"code":          {code},
+			"resource":      {invoicesResource}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	token := parseAccessToken(t, core, responseAsString(t, resp))
+	assert.Equal(t, invoicesResource, token.Claims["aud"])
+	refreshTokenRepoMock.AssertExpectations(t)
+}
+
+func TestAuthCodeExchangeResourceExceedsGrant(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+	setupProtectedResources(coreConfig)
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("StoreAuthCode", mock.Anything).Return(nil)
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444"}
+	code, err := generateSignedCode(core, "a-subject", "", "http://localhost:3000/ab", []string{ordersResource}, app, nil, nil)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"authorization_code"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"redirect_uri":  {"http://localhost:3000/ab"},
+			"code":          {code},
+			"resource":      {invoicesResource}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	errResp := readOAuth2Error(t, resp)
+	assert.Equal(t, "invalid_target", errResp.Error)
+	assert.Equal(t, ErrResourceExceedsGrant.Error(), errResp.ErrorDescription)
+	authCodeRepoMock.AssertNotCalled(t, "MarkAuthCodeUsed", "code-1")
+}
+
+func TestRefreshGrantForResource(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+	setupProtectedResources(coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Resources: ordersResource + " " + invoicesResource,
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+	refreshTokenRepoMock.On("MarkRefreshTokenUsed", "rt1").Return(nil)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.MatchedBy(func(stored *roll.RefreshToken) bool {
+		return stored.Resources == rt.Resources
+	})).Return(nil)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"refresh_token"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"refresh_token": {"rt1"},
+			"resource":      {ordersResource}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	token := parseAccessToken(t, core, responseAsString(t, resp))
+	assert.Equal(t, ordersResource, token.Claims["aud"])
+	refreshTokenRepoMock.AssertExpectations(t)
+}
+
+func TestRefreshGrantResourceExceedsGrant(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRefreshTokenTestApp(t, coreConfig)
+	setupProtectedResources(coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt1",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt1").Return(rt, nil)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
+		url.Values{"grant_type": {"refresh_token"},
+			"client_id":     {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"refresh_token": {"rt1"},
+			"resource":      {ordersResource}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_target", readOAuth2Error(t, resp).Error)
+	refreshTokenRepoMock.AssertNotCalled(t, "MarkRefreshTokenUsed", "rt1")
+}
+
+func TestAuthorizeUnknownResource(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+	setupProtectedResources(coreConfig)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(addr + AuthorizeBaseURI + "?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=code&state=xyz&resource=" +
+		url.QueryEscape("https://api.example.com/unregistered"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := resp.Location()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "invalid_target", location.Query().Get("error"))
+		assert.Equal(t, resourceErrorsSpec, location.Query().Get("error_uri"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+	}
+}
+
+func TestAuthorizePageCarriesResources(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+	setupProtectedResources(coreConfig)
+
+	resp, err := http.Get(addr + AuthorizeBaseURI + "?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=code" +
+		"&resource=" + url.QueryEscape(ordersResource) + "&resource=" + url.QueryEscape(invoicesResource))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body := responseAsString(t, resp)
+	assert.True(t, strings.Contains(body, "Orders API"))
+	assert.True(t, strings.Contains(body, `<input type="hidden" name="resource" value="`+ordersResource+`"/>`))
+	assert.True(t, strings.Contains(body, `<input type="hidden" name="resource" value="`+invoicesResource+`"/>`))
+}
+
+func TestAuthorizeRequestHashIncludesResources(t *testing.T) {
+	pageCtx := &authPageContext{
+		ClientID:    "1111-2222-3333333-4444444",
+		RedirectURI: "http://localhost:3000/ab",
+		Resources: []roll.ProtectedResource{
+			{Identifier: ordersResource},
+			{Identifier: invoicesResource},
+		},
+	}
+
+	posted := url.Values{
+		"client_id":     {"1111-2222-3333333-4444444"},
+		"redirect_uri":  {"http://localhost:3000/ab"},
+		"response_type": {"code"},
+		"scope":         {""},
+		"resource":      {ordersResource, invoicesResource},
+	}
+
+	hash := authorizeRequestHash(pageCtx.authorizeRequestValues("code"))
+	assert.Equal(t, hash, authorizeRequestHash(posted))
+
+	posted["resource"] = []string{ordersResource}
+	assert.NotEqual(t, hash, authorizeRequestHash(posted))
+}
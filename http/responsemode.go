@@ -0,0 +1,92 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/html"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+//Response modes - see OAuth 2.0 Multiple Response Type Encoding Practices section 2.1 and OAuth 2.0 Form
+//Post Response Mode
+const (
+	responseModeQuery    = "query"
+	responseModeFragment = "fragment"
+	responseModeFormPost = "form_post"
+)
+
+var (
+	//ErrInvalidResponseMode is returned when an authorize request names a response mode roll does not support
+	ErrInvalidResponseMode = errors.New("valid values for response_mode are query, fragment and form_post")
+
+	//ErrQueryResponseModeForToken is returned when an implicit grant asks for the token in the query, where
+	//it would be logged by servers and proxies
+	ErrQueryResponseModeForToken = errors.New("response_mode query may not be used with response_type token")
+)
+
+var formPostTemplate *template.Template
+
+func init() {
+	var err error
+
+	formPostTemplate = template.New("formpost.html")
+	formPostTemplate, err = formPostTemplate.Parse(html.FormPost)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type formPostContext struct {
+	RedirectURI string
+	Params      url.Values
+}
+
+//defaultResponseMode is the response mode used when the client does not ask for one: the implicit flow
+//returns the token in the fragment, the code flow returns the code in the query
+func defaultResponseMode(responseType string) string {
+	if responseType == "token" {
+		return responseModeFragment
+	}
+
+	return responseModeQuery
+}
+
+//getResponseMode returns the response mode requested by the client, or the default for the response type.
+//If the requested mode is not allowed the default is returned with the error, so the error can be reported
+//to the client.
+func getResponseMode(r *http.Request, responseType string) (string, error) {
+	responseMode := r.FormValue("response_mode")
+	if responseMode == "" {
+		return defaultResponseMode(responseType), nil
+	}
+
+	if !stringIn(responseMode, supportedResponseModes) {
+		return defaultResponseMode(responseType), ErrInvalidResponseMode
+	}
+
+	if responseMode == responseModeQuery && responseType == "token" {
+		return defaultResponseMode(responseType), ErrQueryResponseModeForToken
+	}
+
+	return responseMode, nil
+}
+
+//respondAuthorization returns the parameters of an authorization response to the client. The query and
+//fragment modes redirect to the redirect uri, form_post serves a page that posts the parameters to it so
+//they do not appear in the url.
+func respondAuthorization(w http.ResponseWriter, r *http.Request, responseMode, redirectURI string, params url.Values) {
+	if responseMode != responseModeFormPost {
+		http.Redirect(w, r, redirectWithParams(responseMode, redirectURI, params), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := formPostTemplate.Execute(w, &formPostContext{RedirectURI: redirectURI, Params: params}); err != nil {
+		log.Info("Error writing form post response: ", err.Error())
+	}
+}
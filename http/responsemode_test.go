@@ -0,0 +1,207 @@
+package http
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetResponseMode(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	responseMode, err := getResponseMode(req, "code")
+	assert.Nil(t, err)
+	assert.Equal(t, responseModeQuery, responseMode)
+
+	responseMode, err = getResponseMode(req, "token")
+	assert.Nil(t, err)
+	assert.Equal(t, responseModeFragment, responseMode)
+
+	req, _ = http.NewRequest("GET", "/?response_mode=form_post", nil)
+	responseMode, err = getResponseMode(req, "token")
+	assert.Nil(t, err)
+	assert.Equal(t, responseModeFormPost, responseMode)
+
+	req, _ = http.NewRequest("GET", "/?response_mode=fragment", nil)
+	responseMode, err = getResponseMode(req, "code")
+	assert.Nil(t, err)
+	assert.Equal(t, responseModeFragment, responseMode)
+
+	//Errors are reported using the default mode
+	req, _ = http.NewRequest("GET", "/?response_mode=bogus", nil)
+	responseMode, err = getResponseMode(req, "code")
+	assert.Equal(t, ErrInvalidResponseMode, err)
+	assert.Equal(t, responseModeQuery, responseMode)
+
+	req, _ = http.NewRequest("GET", "/?response_mode=query", nil)
+	responseMode, err = getResponseMode(req, "token")
+	assert.Equal(t, ErrQueryResponseModeForToken, err)
+	assert.Equal(t, responseModeFragment, responseMode)
+}
+
+func TestRespondAuthorizationFormPost(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", AuthorizeBaseURI, nil)
+	respondAuthorization(w, req, responseModeFormPost, "http://localhost:3000/ab?app=1",
+		url.Values{"code": {"abc"}, "state": {`x"><script>`}})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, `action="http://localhost:3000/ab?app=1"`))
+	assert.True(t, strings.Contains(body, `name="code" value="abc"`))
+	assert.True(t, strings.Contains(body, `name="state" value="x&#34;&gt;&lt;script&gt;"`))
+	assert.True(t, strings.Contains(body, "document.forms[0].submit()"))
+}
+
+//authorizeWithResponseMode makes an authorize request for an app with the redirect uri
+//http://localhost:3000/ab
+func authorizeWithResponseMode(t *testing.T, query string) *httptest.ResponseRecorder {
+	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		RedirectURIs:    "http://localhost:3000/ab",
+	}, nil)
+
+	r, _ := http.NewRequest("GET", "/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&"+query, nil)
+	w := httptest.NewRecorder()
+	handleAuthZGet(core, w, r)
+	return w
+}
+
+func TestAuthorizeErrorUsesResponseMode(t *testing.T) {
+	w := authorizeWithResponseMode(t, "response_type=bogus&response_mode=form_post&state=xyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, `action="http://localhost:3000/ab"`))
+	assert.True(t, strings.Contains(body, `name="error" value="unsupported_response_type"`))
+	assert.True(t, strings.Contains(body, `name="state" value="xyz"`))
+
+	w = authorizeWithResponseMode(t, "response_type=code&response_mode=fragment&code_challenge=short")
+	assert.Equal(t, http.StatusFound, w.Code)
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "", redirect.RawQuery)
+		fragment, err := url.ParseQuery(redirect.Fragment)
+		assert.Nil(t, err)
+		assert.Equal(t, oauth2InvalidRequest, fragment.Get("error"))
+	}
+}
+
+func TestAuthorizeInvalidResponseMode(t *testing.T) {
+	w := authorizeWithResponseMode(t, "response_type=code&response_mode=bogus&state=xyz")
+	assert.Equal(t, http.StatusFound, w.Code)
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, oauth2InvalidRequest, redirect.Query().Get("error"))
+		assert.Equal(t, ErrInvalidResponseMode.Error(), redirect.Query().Get("error_description"))
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	}
+
+	//Tokens are never returned in the query
+	w = authorizeWithResponseMode(t, "response_type=token&response_mode=query")
+	assert.Equal(t, http.StatusFound, w.Code)
+	redirect, err = url.Parse(w.Header().Get("Location"))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "", redirect.RawQuery)
+		fragment, err := url.ParseQuery(redirect.Fragment)
+		assert.Nil(t, err)
+		assert.Equal(t, oauth2InvalidRequest, fragment.Get("error"))
+	}
+}
+
+func TestAuthorizePageCarriesResponseMode(t *testing.T) {
+	w := authorizeWithResponseMode(t, "response_type=code&response_mode=form_post")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `name="response_mode" value="form_post"`))
+
+	w = authorizeWithResponseMode(t, "response_type=token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, strings.Contains(w.Body.String(), `name="response_mode"`))
+}
+
+func TestAuthValidateFormPostResponse(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
+	setupConsentRecording(coreConfig)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	authCodeRepoMock := coreConfig.AuthCodeRepo.(*mocks.AuthCodeRepo)
+	authCodeRepoMock.On("StoreAuthCode", mock.Anything).Return(nil)
+
+	ls := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ls.Close()
+
+	lsURL, _ := url.Parse(ls.URL)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://" + lsURL.Host,
+	}, nil)
+
+	resp, err := postAuthorizeForm(t, core, http.DefaultClient, addr,
+		url.Values{"username": {"x"},
+			"password":      {"y"},
+			"authorize":     {"allow"},
+			"response_type": {"code"},
+			"response_mode": {"form_post"},
+			"state":         {"af0ifjsldkj"},
+			"client_id":     {"1111-2222-3333333-4444444"}})
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body := responseAsString(t, resp)
+		assert.True(t, strings.Contains(body, `action="http://localhost:3000/ab"`))
+		assert.True(t, strings.Contains(body, `name="code" value="ey`))
+		assert.True(t, strings.Contains(body, `name="state" value="af0ifjsldkj"`))
+	}
+
+	//Denials are posted back too
+	resp, err = postAuthorizeForm(t, core, http.DefaultClient, addr,
+		url.Values{"authorize": {"deny"},
+			"response_type": {"code"},
+			"response_mode": {"form_post"},
+			"client_id":     {"1111-2222-3333333-4444444"}})
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, strings.Contains(responseAsString(t, resp), `name="error" value="access_denied"`))
+	}
+}
+
+func TestAuthValidateInvalidResponseMode(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupCSRFSigning(t, coreConfig, "1111-2222-3333333-4444444")
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&roll.Application{
+		ClientID:     "1111-2222-3333333-4444444",
+		RedirectURIs: "http://localhost:3000/ab",
+	}, nil)
+
+	resp, err := postAuthorizeForm(t, core, http.DefaultClient, addr,
+		url.Values{"authorize": {"deny"},
+			"response_type": {"token"},
+			"response_mode": {"query"},
+			"client_id":     {"1111-2222-3333333-4444444"}})
+	if assert.Nil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,152 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"time"
+)
+
+const (
+	//RevokeURI is the uri for the token revocation endpoint (RFC 7009)
+	RevokeURI = "/oauth2/revoke"
+)
+
+var (
+	//ErrTokenNotIssuedToClient is returned when a client attempts to revoke a token issued to another client
+	ErrTokenNotIssuedToClient = errors.New("Token was not issued to the client")
+)
+
+func handleRevoke(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			handleRevokePost(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//tokenRevoked returns true if the token the claims were extracted from has been revoked
+func tokenRevoked(core *roll.Core, claims map[string]interface{}) (bool, error) {
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return false, nil
+	}
+
+	return core.IsTokenRevoked(jti)
+}
+
+//tokenExpiry returns the exp claim of the token, or the latest time an access token issued now
+//could expire under the core's maximum lifetime if the claim is not present
+func tokenExpiry(core *roll.Core, claims map[string]interface{}) int64 {
+	if exp, ok := claims["exp"].(float64); ok {
+		return int64(exp)
+	}
+
+	return time.Now().Add(core.MaxAccessTokenLifetime()).Unix()
+}
+
+//revokeAccessToken records the jti of an access token as revoked. The boolean return is false if
+//the token is not an access token roll can validate.
+func revokeAccessToken(core *roll.Core, tokenString string, app *roll.Application) (bool, error) {
+	token, err := jwt.Parse(tokenString, keyExtractionFunction(core))
+	if err != nil || !token.Valid {
+		return false, nil
+	}
+
+	if clientID, _ := tokenClientID(token.Claims); clientID != app.ClientID {
+		return true, ErrTokenNotIssuedToClient
+	}
+
+	jti, ok := token.Claims["jti"].(string)
+	if !ok || jti == "" {
+		return true, nil
+	}
+
+	log.Info("Revoking access token ", jti)
+	return true, core.RevokeToken(jti, tokenExpiry(core, token.Claims))
+}
+
+//revokeRefreshToken revokes the refresh token along with the rest of its family. The boolean return
+//is false if the token is not a known refresh token.
+func revokeRefreshToken(core *roll.Core, tokenString string, app *roll.Application) (bool, error) {
+	rt, err := core.RetrieveRefreshToken(tokenString)
+	if err != nil {
+		return false, err
+	}
+
+	if rt == nil {
+		return false, nil
+	}
+
+	if rt.ClientID != app.ClientID {
+		return true, ErrTokenNotIssuedToClient
+	}
+
+	log.Info("Revoking refresh token family ", rt.FamilyID)
+	return true, core.RevokeRefreshTokenFamily(rt.FamilyID)
+}
+
+func handleRevokePost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	tokenString := r.FormValue("token")
+	if tokenString == "" {
+		respondInvalidRequest(w, errors.New("token missing from request"))
+		return
+	}
+
+	//Revocation requests must be authenticated with the client credentials
+	client, err := clientCredentialsFromRequest(core, r)
+	if err != nil {
+		respondInvalidRequest(w, err)
+		return
+	}
+
+	if client.clientID == "" || !client.present() {
+		respondOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, ErrInvalidClientDetails)
+		return
+	}
+
+	app, err := authenticateClient(core, client, false)
+	if err != nil {
+		switch err {
+		case ErrRetrievingAppData:
+			respondServerError(w, err)
+		default:
+			respondOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, ErrInvalidClientDetails)
+		}
+
+		return
+	}
+
+	//The token type hint determines which kind of token we look for first. Per RFC 7009 an
+	//unknown or invalid token is not an error - there is nothing to revoke.
+	revokers := []func(*roll.Core, string, *roll.Application) (bool, error){revokeAccessToken, revokeRefreshToken}
+	if r.FormValue("token_type_hint") == "refresh_token" {
+		revokers = []func(*roll.Core, string, *roll.Application) (bool, error){revokeRefreshToken, revokeAccessToken}
+	}
+
+	for _, revoke := range revokers {
+		found, err := revoke(core, tokenString, app)
+		if err != nil {
+			log.Info("Error revoking token: ", err.Error())
+			switch err {
+			case ErrTokenNotIssuedToClient:
+				respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, err)
+			default:
+				respondServerError(w, err)
+			}
+
+			return
+		}
+
+		if found {
+			break
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	rolltoken "github.com/xtraclabs/rollsecrets/token"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func setupRevokeTestApp(t *testing.T, coreConfig *roll.CoreConfig) string {
+	returnVal := roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        "1111-2222-3333333-4444444",
+		ApplicationName: "fight club",
+		ClientSecret:    "not for browser clients",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	return privateKey
+}
+
+func TestRevokeUnsupportedMethod(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.Get(addr + RevokeURI)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestRevokeMissingToken(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp, err := http.PostForm(addr+RevokeURI,
+		url.Values{"client_id": {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRevokeInvalidClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+
+	resp, err := http.PostForm(addr+RevokeURI,
+		url.Values{"client_id": {"1111-2222-3333333-4444444"},
+			"client_secret": {"wrong"},
+			"token":         {"xxx"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey := setupRevokeTestApp(t, coreConfig)
+
+	token, err := rolltoken.GenerateToken("a-subject", "", "1111-2222-3333333-4444444", "fight club", privateKey)
+	assert.Nil(t, err)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("RevokeToken", mock.Anything, mock.MatchedBy(func(expiresAt int64) bool {
+		return expiresAt > time.Now().Unix()
+	})).Return(nil)
+
+	resp, err := http.PostForm(addr+RevokeURI,
+		url.Values{"client_id": {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"token":         {token}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	revocationRepoMock.AssertExpectations(t)
+}
+
+func TestRevokeOtherClientsAccessToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+
+	otherPrivate, otherPublic, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePublicKeyForApp", "other-client").Return(otherPublic, nil)
+
+	token, err := rolltoken.GenerateToken("a-subject", "", "other-client", "other app", otherPrivate)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+RevokeURI,
+		url.Values{"client_id": {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"token":         {token}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+
+	rt := &roll.RefreshToken{
+		TokenID:   "rt2",
+		FamilyID:  "rt1",
+		ClientID:  "1111-2222-3333333-4444444",
+		Subject:   "a-subject",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "rt2").Return(rt, nil)
+	refreshTokenRepoMock.On("RevokeRefreshTokenFamily", "rt1").Return(nil)
+
+	resp, err := http.PostForm(addr+RevokeURI,
+		url.Values{"client_id": {"1111-2222-3333333-4444444"},
+			"client_secret":   {"not for browser clients"},
+			"token":           {"rt2"},
+			"token_type_hint": {"refresh_token"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	refreshTokenRepoMock.AssertCalled(t, "RevokeRefreshTokenFamily", "rt1")
+}
+
+func TestRevokeUnknownToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupRevokeTestApp(t, coreConfig)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("RetrieveRefreshToken", "no-such-token").Return(nil, nil)
+
+	resp, err := http.PostForm(addr+RevokeURI,
+		url.Values{"client_id": {"1111-2222-3333333-4444444"},
+			"client_secret": {"not for browser clients"},
+			"token":         {"no-such-token"}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTokenExpiryWithoutExpUsesMaxLifetime(t *testing.T) {
+	_, coreConfig := NewTestCore()
+	coreConfig.DefaultAccessTokenLifetime = time.Hour
+	coreConfig.MaxAccessTokenLifetime = 2 * time.Hour
+	core := roll.NewCore(coreConfig)
+
+	exp := time.Now().Add(time.Minute).Unix()
+	assert.Equal(t, exp, tokenExpiry(core, map[string]interface{}{"exp": float64(exp)}))
+	assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), tokenExpiry(core, map[string]interface{}{}), 5)
+}
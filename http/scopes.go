@@ -1,9 +1,266 @@
 package http
 
 import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
 	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"sort"
+	"strings"
 )
 
+//ScopesURI is the base uri for the scope registry - the scope name follows the base uri
+const ScopesURI = "/v1/scopes/"
+
+var (
+	//ErrUnknownScope is returned when a scope is not in the scope registry
+	ErrUnknownScope = errors.New("Requested scope is not registered")
+
+	//ErrReservedScope is returned when attempting to change a built in scope
+	ErrReservedScope = errors.New("Built in scopes cannot be changed")
+)
+
+//builtInScopes are always registered. Applications must list admin in their allowed scopes to request
+//it, but any application may request openid to sign users in.
+var builtInScopes = map[string]string{
+	adminScope:  "Administer roll on your behalf",
+	openIDScope: "Sign you in with your account",
+}
+
 func grantAdminScope(core *roll.Core, subject string) (bool, error) {
 	return core.IsAdmin(subject)
 }
+
+//scopeContains indicates if the given scope is one of the whitespace delimited parts of scope
+func scopeContains(scope, s string) bool {
+	for _, part := range strings.Fields(scope) {
+		if part == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+//lookupScope returns the registered scope with the given name, or nil if there is no such scope
+func lookupScope(core *roll.Core, name string) (*roll.Scope, error) {
+	if description, ok := builtInScopes[name]; ok {
+		return &roll.Scope{Name: name, Description: description}, nil
+	}
+
+	return core.RetrieveScope(name)
+}
+
+//describeScopes returns the registry entries for each part of a scope
+func describeScopes(core *roll.Core, scope string) ([]roll.Scope, error) {
+	var scopes []roll.Scope
+	for _, name := range strings.Fields(scope) {
+		s, err := lookupScope(core, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if s == nil {
+			return nil, ErrUnknownScope
+		}
+
+		scopes = append(scopes, *s)
+	}
+
+	return scopes, nil
+}
+
+//validateAllowedScopes checks the scopes an application declares it may request are registered
+func validateAllowedScopes(core *roll.Core, allowedScopes string) error {
+	_, err := describeScopes(core, allowedScopes)
+	return err
+}
+
+//allowedScopesRegistered checks the allowed scopes in an application definition, responding with an
+//error if any are not in the scope registry
+func allowedScopesRegistered(core *roll.Core, w http.ResponseWriter, allowedScopes string) bool {
+	err := validateAllowedScopes(core, allowedScopes)
+	switch err {
+	case nil:
+		return true
+	case ErrUnknownScope:
+		respondError(w, http.StatusBadRequest, err)
+	default:
+		log.Info("Error validating allowed scopes: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+	}
+
+	return false
+}
+
+//validateRequestedScope checks a scope requested in any grant is made up of registered scopes the
+//application may request. ErrScopeNotAllowed or ErrUnknownScope are returned for invalid scopes, other
+//errors mean the scope could not be checked.
+func validateRequestedScope(core *roll.Core, app *roll.Application, scope string) error {
+	for _, name := range strings.Fields(scope) {
+		if name != openIDScope && !scopeContains(app.AllowedScopes, name) {
+			log.Info("Scope ", name, " not allowed for ", app.ClientID)
+			return ErrScopeNotAllowed
+		}
+	}
+
+	//The registry is checked as well, as scopes may be removed after applications declare them
+	_, err := describeScopes(core, scope)
+	return err
+}
+
+//invalidScope is true for errors returned by validateRequestedScope that mean the scope is invalid
+func invalidScope(err error) bool {
+	return err == ErrScopeNotAllowed || err == ErrUnknownScope
+}
+
+//respondScopeError responds to a token request with a scope that failed validation
+func respondScopeError(w http.ResponseWriter, err error) {
+	if invalidScope(err) {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, err)
+		return
+	}
+
+	log.Info("Error validating scope: ", err.Error())
+	respondServerError(w, err)
+}
+
+func handleScopes(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleScopesGet(core, w, r)
+		case "PUT":
+			handleScopesPut(core, w, r)
+		case "DELETE":
+			handleScopesDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//scopeAdmin is true if the caller may maintain the scope registry and other server wide settings. In secure
+//mode this requires a token with admin scope. In unsecure mode the subject is taken on trust, so must itself
+//be an admin.
+func scopeAdmin(core *roll.Core, r *http.Request) (bool, error) {
+	subject, adminScope, err := subjectAndAdminScopeFromRequestCtx(r)
+	if err != nil {
+		return false, err
+	}
+
+	if adminScope || core.Secure() {
+		return adminScope, nil
+	}
+
+	return core.IsAdmin(subject)
+}
+
+//scopeNameFromRequest extracts the scope name from the request uri, responding with an error if the
+//caller is not an admin or the name is not a scope that can be changed
+func scopeNameFromRequest(core *roll.Core, w http.ResponseWriter, r *http.Request) string {
+	admin, err := scopeAdmin(core, r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return ""
+	}
+
+	if !admin {
+		respondError(w, http.StatusForbidden, errors.New("Admin scope required to maintain the scope registry"))
+		return ""
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, ScopesURI)
+	if !roll.ValidScopeName(name) {
+		respondError(w, http.StatusBadRequest, errors.New("Invalid scope name"))
+		return ""
+	}
+
+	if _, ok := builtInScopes[name]; ok {
+		respondError(w, http.StatusBadRequest, ErrReservedScope)
+		return ""
+	}
+
+	return name
+}
+
+//listScopes returns the built in scopes along with the scopes in the registry, sorted by name
+func listScopes(core *roll.Core) ([]roll.Scope, error) {
+	scopes, err := core.ListScopes()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, description := range builtInScopes {
+		scopes = append(scopes, roll.Scope{Name: name, Description: description})
+	}
+
+	sort.Sort(scopesByName(scopes))
+	return scopes, nil
+}
+
+func handleScopesGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	scopes, err := listScopes(core)
+	if err != nil {
+		log.Info("Error listing scopes: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, scopes)
+}
+
+func handleScopesPut(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	name := scopeNameFromRequest(core, w, r)
+	if name == "" {
+		return
+	}
+
+	var scope roll.Scope
+	if err := parseRequest(r, &scope); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	//The scope is identified by the uri, not the request body
+	scope.Name = name
+
+	if err := scope.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := core.StoreScope(&scope); err != nil {
+		log.Info("Error storing scope: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, nil)
+}
+
+func handleScopesDelete(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	name := scopeNameFromRequest(core, w, r)
+	if name == "" {
+		return
+	}
+
+	if err := core.DeleteScope(name); err != nil {
+		switch err.(type) {
+		case roll.NoSuchScopeError:
+			respondNotFound(w)
+		default:
+			log.Info("Error deleting scope: ", err.Error())
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	respondOk(w, nil)
+}
+
+type scopesByName []roll.Scope
+
+func (s scopesByName) Len() int           { return len(s) }
+func (s scopesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s scopesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
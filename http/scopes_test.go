@@ -1,9 +1,14 @@
 package http
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/roll/roll/mocks"
+	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -40,3 +45,125 @@ func TestAdminScopeWithRepoError(t *testing.T) {
 	_, err := grantAdminScope(core, "foobar")
 	assert.NotNil(t, err)
 }
+
+func TestValidateRequestedScope(t *testing.T) {
+	core, coreConfig := NewTestCore()
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("RetrieveScope", "orders.read").Return(&roll.Scope{Name: "orders.read", Description: "Read your orders"}, nil)
+	scopeRepoMock.On("RetrieveScope", "orders.write").Return(nil, nil)
+	scopeRepoMock.On("RetrieveScope", "orders.cancel").Return(nil, errors.New("boom"))
+
+	app := &roll.Application{ClientID: "1111-2222-3333333-4444444", AllowedScopes: "orders.read orders.write orders.cancel"}
+
+	assert.Nil(t, validateRequestedScope(core, app, ""))
+	assert.Nil(t, validateRequestedScope(core, app, "openid orders.read"))
+	assert.Equal(t, ErrScopeNotAllowed, validateRequestedScope(core, app, "orders.read admin"))
+	assert.Equal(t, ErrUnknownScope, validateRequestedScope(core, app, "orders.write"))
+
+	err := validateRequestedScope(core, app, "orders.cancel")
+	if assert.NotNil(t, err) {
+		assert.False(t, invalidScope(err))
+	}
+}
+
+func TestScopesList(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("ListScopes").Return([]roll.Scope{{Name: "orders.read", Description: "Read your orders"}}, nil)
+
+	resp := TestHTTPGetWithRollSubject(t, addr+ScopesURI, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var scopes []roll.Scope
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &scopes)
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(scopes)) {
+		assert.Equal(t, "admin", scopes[0].Name)
+		assert.Equal(t, "openid", scopes[1].Name)
+		assert.Equal(t, "orders.read", scopes[2].Name)
+	}
+}
+
+func TestScopesPut(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("StoreScope", mock.AnythingOfType("*roll.Scope")).Return(nil)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+ScopesURI+"orders.read", roll.Scope{Description: "Read your orders"})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	stored := scopeRepoMock.Calls[0].Arguments.Get(0).(*roll.Scope)
+	assert.Equal(t, "orders.read", stored.Name)
+	assert.Equal(t, "Read your orders", stored.Description)
+}
+
+func TestScopesPutNotAdmin(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(false, nil)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+ScopesURI+"orders.read", roll.Scope{Description: "Read your orders"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestScopesPutInvalid(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+ScopesURI+"orders.read", roll.Scope{})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = TestHTTPPutWithRollSubject(t, addr+ScopesURI+"admin", roll.Scope{Description: "Mine now"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(responseAsString(t, resp), ErrReservedScope.Error()))
+}
+
+func TestScopesDelete(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
+	adminRepoMock.On("IsAdmin", "rolltest").Return(true, nil)
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("DeleteScope", "orders.read").Return(nil)
+	scopeRepoMock.On("DeleteScope", "orders.write").Return(roll.NoSuchScopeError{})
+
+	resp := TestHTTPDeleteWithRollSubject(t, addr+ScopesURI+"orders.read", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = TestHTTPDeleteWithRollSubject(t, addr+ScopesURI+"orders.write", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAuthorizePageDescribesScopes(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupPKCETestApp(t, coreConfig, false)
+
+	resp := TestHTTPGet(t, addr+"/oauth2/authorize?client_id=1111-2222-3333333-4444444&redirect_uri=http://localhost:3000/ab&response_type=code&scope=openid+admin", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	bodyStr := responseAsString(t, resp)
+	assert.True(t, strings.Contains(bodyStr, "<strong>admin</strong> - "+builtInScopes[adminScope]))
+	assert.True(t, strings.Contains(bodyStr, "<strong>openid</strong> - "+builtInScopes[openIDScope]))
+}
@@ -0,0 +1,419 @@
+package http
+
+import (
+	"crypto"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/signing"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//SigningKeysURI is the base uri for listing and rotating the signing keys of an application - the
+	//client id of the application follows the base uri
+	SigningKeysURI = "/v1/signingkeys/"
+
+	//How often scheduled rotation checks for keys due to be replaced
+	keyRotationCheckInterval = time.Hour
+)
+
+var (
+	//ErrUnknownSigningKey is returned when a token's kid header does not identify a key of the application
+	ErrUnknownSigningKey = errors.New("Token signed with an unknown key")
+
+	//ErrSigningKeyRetired is returned when a token is signed with a key that has been retired
+	ErrSigningKeyRetired = errors.New("Token signed with a retired key")
+)
+
+//signingKeyDescription describes a version of an application's signing key to its owner or an admin
+type signingKeyDescription struct {
+	KeyID     string `json:"kid"`
+	Version   int    `json:"version"`
+	State     string `json:"state"`
+	CreatedAt int64  `json:"createdAt,omitempty"`
+	RetiresAt int64  `json:"retiresAt,omitempty"`
+}
+
+//rotationRequest holds the optional grace period, in seconds, for the key being replaced
+type rotationRequest struct {
+	GracePeriod *int64 `json:"gracePeriod"`
+}
+
+func describeSigningKey(key *roll.SigningKey) signingKeyDescription {
+	return signingKeyDescription{
+		KeyID:     key.KeyID,
+		Version:   key.Version,
+		State:     key.State(),
+		CreatedAt: key.CreatedAt,
+		RetiresAt: key.RetiresAt,
+	}
+}
+
+//parsePublicKey reads a PEM encoded public key from the secrets repo
+func parsePublicKey(core *roll.Core, secretName string) (crypto.PublicKey, error) {
+	publicKey, err := core.RetrievePublicKeyForApp(secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	return signing.ParsePublicKeyPEM(publicKey)
+}
+
+//tokenClientID returns the client id of the application a token was issued to. Access tokens name the
+//client in the client_id claim, as their audience may be the resources they were issued for. Tokens
+//without a client_id claim were issued to the application named in the aud claim.
+func tokenClientID(claims map[string]interface{}) (string, bool) {
+	if clientID, ok := claims["client_id"].(string); ok {
+		return clientID, true
+	}
+
+	clientID, ok := claims["aud"].(string)
+	return clientID, ok
+}
+
+//verificationKey returns the public key if the token is signed with the method that uses it
+func verificationKey(token *jwt.Token, publicKey crypto.PublicKey) (interface{}, error) {
+	if err := signing.CheckMethod(token.Method, publicKey); err != nil {
+		return nil, err
+	}
+
+	return publicKey, nil
+}
+
+//keyExtractionFunction returns a jwt.Keyfunc that verifies tokens with the application's current key,
+//or with a replaced key named by the token's kid header that has not yet been retired. The token must
+//be signed with the method that uses the key, as a replaced key may be for a different algorithm.
+func keyExtractionFunction(core *roll.Core) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		clientID, ok := tokenClientID(token.Claims)
+		if !ok {
+			return nil, errors.New("Token has no client_id or aud claim")
+		}
+
+		publicKey, err := parsePublicKey(core, clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		//Tokens issued before key ids were added have no kid, and were signed with the original key
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" || kid == keyID(publicKey) {
+			return verificationKey(token, publicKey)
+		}
+
+		key, err := core.RetrieveSigningKey(clientID, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key == nil {
+			return nil, ErrUnknownSigningKey
+		}
+
+		if key.State() == roll.SigningKeyRetired {
+			return nil, ErrSigningKeyRetired
+		}
+
+		publicKey, err = parsePublicKey(core, key.SecretName())
+		if err != nil {
+			return nil, err
+		}
+
+		return verificationKey(token, publicKey)
+	}
+}
+
+//legacySigningKey describes the key of an application that has never had its key rotated. Such keys
+//are held only under the client id of the application.
+func legacySigningKey(core *roll.Core, clientID string) (*roll.SigningKey, error) {
+	key, err := appJWK(core, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &roll.SigningKey{
+		ClientID: clientID,
+		KeyID:    key.KeyID,
+		Version:  1,
+	}, nil
+}
+
+//signingKeys returns the versions of the application's signing key, oldest first
+func signingKeys(core *roll.Core, clientID string) ([]roll.SigningKey, error) {
+	keys, err := core.ListSigningKeys(clientID)
+	if err != nil || len(keys) > 0 {
+		return keys, err
+	}
+
+	legacyKey, err := legacySigningKey(core, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []roll.SigningKey{*legacyKey}, nil
+}
+
+//adoptLegacySigningKey records the key of an application that has never had its key rotated as the
+//first version of its signing key, so it can continue to verify tokens once replaced.
+func adoptLegacySigningKey(core *roll.Core, clientID string, now time.Time) (*roll.SigningKey, error) {
+	key, err := legacySigningKey(core, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := core.RetrievePrivateKeyForApp(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := core.RetrievePublicKeyForApp(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := core.StoreKeysForApp(key.SecretName(), privateKey, publicKey); err != nil {
+		return nil, err
+	}
+
+	key.CreatedAt = now.Unix()
+	if err := core.StoreSigningKey(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+//activeSigningKey returns the most recent active key version, or nil if there is none
+func activeSigningKey(keys []roll.SigningKey) *roll.SigningKey {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i].State() == roll.SigningKeyActive {
+			return &keys[i]
+		}
+	}
+
+	return nil
+}
+
+//rotateSigningKey creates a new signing key for the application's signing algorithm and makes it the key
+//new tokens are signed with. The key it replaces continues to verify tokens until the grace period has passed.
+func rotateSigningKey(core *roll.Core, app *roll.Application, gracePeriod time.Duration) (*roll.SigningKey, error) {
+	now := time.Now()
+	clientID := app.ClientID
+
+	keys, err := core.ListSigningKeys(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		legacyKey, err := adoptLegacySigningKey(core, clientID, now)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, *legacyKey)
+	}
+
+	privateKey, publicKey, err := signing.GenerateKeyPair(app.SigningAlg())
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := jwkFromPEM(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	newKey := &roll.SigningKey{
+		ClientID:  clientID,
+		KeyID:     jwk.KeyID,
+		Version:   keys[len(keys)-1].Version + 1,
+		CreatedAt: now.Unix(),
+	}
+
+	if err := core.StoreKeysForApp(newKey.SecretName(), privateKey, publicKey); err != nil {
+		return nil, err
+	}
+
+	if err := core.StoreSigningKey(newKey); err != nil {
+		return nil, err
+	}
+
+	//The current key is held under the client id - replacing it there switches token signing to the new key
+	if err := core.StoreKeysForApp(clientID, privateKey, publicKey); err != nil {
+		return nil, err
+	}
+
+	for _, replaced := range keys {
+		if replaced.State() != roll.SigningKeyActive {
+			continue
+		}
+
+		if err := core.RetireSigningKey(clientID, replaced.Version, now.Add(gracePeriod).Unix()); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("Rotated signing key for ", clientID, " to version ", newKey.Version)
+	return newKey, nil
+}
+
+//rotateDueSigningKeys rotates the signing keys of applications whose active key is older than the
+//rotation interval. Keys that predate key rotation are adopted, which starts their rotation interval.
+func rotateDueSigningKeys(core *roll.Core) {
+	apps, err := core.ListApplications("", true)
+	if err != nil {
+		log.Warn("Error listing applications for key rotation: ", err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, app := range apps {
+		keys, err := core.ListSigningKeys(app.ClientID)
+		if err != nil {
+			log.Warn("Error listing signing keys for ", app.ClientID, ": ", err.Error())
+			continue
+		}
+
+		if len(keys) == 0 {
+			if _, err := adoptLegacySigningKey(core, app.ClientID, now); err != nil {
+				log.Warn("Error recording signing key for ", app.ClientID, ": ", err.Error())
+			}
+			continue
+		}
+
+		active := activeSigningKey(keys)
+		if active != nil && now.Sub(time.Unix(active.CreatedAt, 0)) < core.SigningKeyRotationInterval() {
+			continue
+		}
+
+		if _, err := rotateSigningKey(core, &app, core.SigningKeyGracePeriod()); err != nil {
+			log.Warn("Error rotating signing key for ", app.ClientID, ": ", err.Error())
+		}
+	}
+}
+
+//RotateSigningKeysOnSchedule rotates application signing keys once they reach the rotation interval
+//configured for the core. It does not return, so run it in its own goroutine.
+func RotateSigningKeysOnSchedule(core *roll.Core) {
+	if core.SigningKeyRotationInterval() == 0 {
+		log.Info("Scheduled signing key rotation is disabled")
+		return
+	}
+
+	checkInterval := keyRotationCheckInterval
+	if core.SigningKeyRotationInterval() < checkInterval {
+		checkInterval = core.SigningKeyRotationInterval()
+	}
+
+	for range time.Tick(checkInterval) {
+		rotateDueSigningKeys(core)
+	}
+}
+
+func handleSigningKeys(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleSigningKeysGet(core, w, r)
+		case "POST":
+			handleSigningKeysPost(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+//ownedApplication retrieves the application whose client id follows the base uri in the request uri,
+//applying the application security model: only the owner of the application or an admin may manage
+//its keys and settings. A nil application is returned if a response has been written.
+func ownedApplication(core *roll.Core, w http.ResponseWriter, r *http.Request, baseURI string) *roll.Application {
+	clientID := strings.TrimPrefix(r.URL.Path, baseURI)
+	if clientID == "" {
+		respondError(w, http.StatusNotFound, errors.New("Resource not specified"))
+		return nil
+	}
+
+	subject, adminScope, err := subjectAndAdminScopeFromRequestCtx(r)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, nil)
+		return nil
+	}
+
+	app, err := core.RetrieveApplication(clientID, subject, adminScope)
+	if err != nil {
+		switch err.(type) {
+		case roll.NotAuthorizedToReadApp:
+			respondError(w, http.StatusUnauthorized, err)
+		default:
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return nil
+	}
+
+	if app == nil {
+		respondNotFound(w)
+		return nil
+	}
+
+	return app
+}
+
+func handleSigningKeysGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app := ownedApplication(core, w, r, SigningKeysURI)
+	if app == nil {
+		return
+	}
+
+	keys, err := signingKeys(core, app.ClientID)
+	if err != nil {
+		log.Info("Error listing signing keys: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	descriptions := make([]signingKeyDescription, 0, len(keys))
+	for i := range keys {
+		descriptions = append(descriptions, describeSigningKey(&keys[i]))
+	}
+
+	respondOk(w, descriptions)
+}
+
+func handleSigningKeysPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app := ownedApplication(core, w, r, SigningKeysURI)
+	if app == nil {
+		return
+	}
+
+	//The body is optional - without it the replaced key gets the default grace period
+	var rotation rotationRequest
+	if err := parseRequest(r, &rotation); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	gracePeriod := core.SigningKeyGracePeriod()
+	if rotation.GracePeriod != nil {
+		if *rotation.GracePeriod < 0 {
+			respondError(w, http.StatusBadRequest, errors.New("gracePeriod cannot be negative"))
+			return
+		}
+
+		gracePeriod = time.Duration(*rotation.GracePeriod) * time.Second
+	}
+
+	key, err := rotateSigningKey(core, app, gracePeriod)
+	if err != nil {
+		log.Info("Error rotating signing key: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, describeSigningKey(key))
+}
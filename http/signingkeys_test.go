@@ -0,0 +1,238 @@
+package http
+
+import (
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const signingKeyTestClientID = "1111-2222-3333333-4444444"
+
+//setupReplacedSigningKey sets up the test app with a current key, and records a replaced key that
+//retires at retiresAt. The private key of the replaced key is returned.
+func setupReplacedSigningKey(t *testing.T, coreConfig *roll.CoreConfig, retiresAt int64) (string, string) {
+	setupPKCETestApp(t, coreConfig, false)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	jwk, err := jwkFromPEM(publicKey)
+	assert.Nil(t, err)
+
+	replaced := &roll.SigningKey{
+		ClientID:  signingKeyTestClientID,
+		KeyID:     jwk.KeyID,
+		Version:   1,
+		RetiresAt: retiresAt,
+	}
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePublicKeyForApp", replaced.SecretName()).Return(publicKey, nil)
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("RetrieveSigningKey", signingKeyTestClientID, jwk.KeyID).Return(replaced, nil)
+
+	return privateKey, jwk.KeyID
+}
+
+func signedTestToken(t *testing.T, privateKey string) string {
+	token, err := signToken(map[string]interface{}{
+		"sub": "a-subject",
+		"aud": signingKeyTestClientID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}, privateKey)
+	assert.Nil(t, err)
+	return token
+}
+
+func TestKeyExtractionCurrentKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+
+	token, err := jwt.Parse(signedTestToken(t, privateKey), keyExtractionFunction(core))
+	assert.Nil(t, err)
+	assert.True(t, token.Valid)
+}
+
+func TestKeyExtractionRetiringKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	privateKey, _ := setupReplacedSigningKey(t, coreConfig, time.Now().Add(time.Hour).Unix())
+
+	token, err := jwt.Parse(signedTestToken(t, privateKey), keyExtractionFunction(core))
+	assert.Nil(t, err)
+	assert.True(t, token.Valid)
+}
+
+func TestKeyExtractionRetiredKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	privateKey, _ := setupReplacedSigningKey(t, coreConfig, time.Now().Add(-time.Hour).Unix())
+
+	_, err := jwt.Parse(signedTestToken(t, privateKey), keyExtractionFunction(core))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ErrSigningKeyRetired, err.(*jwt.ValidationError).Inner)
+	}
+}
+
+func TestKeyExtractionUnknownKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	setupPKCETestApp(t, coreConfig, false)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+	jwk, err := jwkFromPEM(publicKey)
+	assert.Nil(t, err)
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("RetrieveSigningKey", signingKeyTestClientID, jwk.KeyID).Return(nil, nil)
+
+	_, err = jwt.Parse(signedTestToken(t, privateKey), keyExtractionFunction(core))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ErrUnknownSigningKey, err.(*jwt.ValidationError).Inner)
+	}
+}
+
+func TestRotateSigningKeyAdoptsLegacyKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	privateKey := setupPKCETestApp(t, coreConfig, false)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("StoreKeysForApp", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	var stored []roll.SigningKey
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("ListSigningKeys", signingKeyTestClientID).Return(nil, nil)
+	signingKeyRepoMock.On("StoreSigningKey", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		stored = append(stored, *args.Get(0).(*roll.SigningKey))
+	})
+	signingKeyRepoMock.On("RetireSigningKey", signingKeyTestClientID, 1, mock.AnythingOfType("int64")).Return(nil)
+
+	newKey, err := rotateSigningKey(core, &roll.Application{ClientID: signingKeyTestClientID}, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, newKey.Version)
+	assert.Equal(t, roll.SigningKeyActive, newKey.State())
+
+	legacyKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(stored)) {
+		assert.Equal(t, keyID(&legacyKey.PublicKey), stored[0].KeyID)
+		assert.Equal(t, 1, stored[0].Version)
+		assert.Equal(t, newKey.KeyID, stored[1].KeyID)
+	}
+
+	secretsMock.AssertCalled(t, "StoreKeysForApp", signingKeyTestClientID+"/v1", privateKey, mock.Anything)
+	secretsMock.AssertCalled(t, "StoreKeysForApp", signingKeyTestClientID+"/v2", mock.Anything, mock.Anything)
+	secretsMock.AssertCalled(t, "StoreKeysForApp", signingKeyTestClientID, mock.Anything, mock.Anything)
+	signingKeyRepoMock.AssertExpectations(t)
+}
+
+func TestRotateDueSigningKeys(t *testing.T) {
+	_, coreConfig := NewTestCore()
+	coreConfig.SigningKeyRotationInterval = 24 * time.Hour
+	core := roll.NewCore(coreConfig)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("ListApplications", "", true).Return([]roll.Application{
+		{ClientID: "fresh-app"}, {ClientID: "due-app"},
+	}, nil)
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("ListSigningKeys", "fresh-app").Return([]roll.SigningKey{
+		{ClientID: "fresh-app", KeyID: "fresh", Version: 1, CreatedAt: time.Now().Add(-time.Hour).Unix()},
+	}, nil)
+	signingKeyRepoMock.On("ListSigningKeys", "due-app").Return([]roll.SigningKey{
+		{ClientID: "due-app", KeyID: "due", Version: 1, CreatedAt: time.Now().Add(-48 * time.Hour).Unix()},
+	}, nil)
+	signingKeyRepoMock.On("StoreSigningKey", mock.Anything).Return(nil)
+	signingKeyRepoMock.On("RetireSigningKey", "due-app", 1, mock.AnythingOfType("int64")).Return(nil)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("StoreKeysForApp", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	rotateDueSigningKeys(core)
+
+	signingKeyRepoMock.AssertCalled(t, "RetireSigningKey", "due-app", 1, mock.AnythingOfType("int64"))
+	signingKeyRepoMock.AssertNotCalled(t, "RetireSigningKey", "fresh-app", mock.Anything, mock.Anything)
+	secretsMock.AssertNotCalled(t, "StoreKeysForApp", "fresh-app", mock.Anything, mock.Anything)
+}
+
+func TestListSigningKeys(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	retiresAt := time.Now().Add(time.Hour).Unix()
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("RetrieveApplication", signingKeyTestClientID, "rolltest", false).Return(&roll.Application{ClientID: signingKeyTestClientID}, nil)
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("ListSigningKeys", signingKeyTestClientID).Return([]roll.SigningKey{
+		{ClientID: signingKeyTestClientID, KeyID: "kid-1", Version: 1, RetiresAt: retiresAt},
+		{ClientID: signingKeyTestClientID, KeyID: "kid-2", Version: 2},
+	}, nil)
+
+	resp := TestHTTPGetWithRollSubject(t, addr+SigningKeysURI+signingKeyTestClientID, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var keys []signingKeyDescription
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &keys)
+	assert.Nil(t, err)
+	assert.Equal(t, []signingKeyDescription{
+		{KeyID: "kid-1", Version: 1, State: roll.SigningKeyRetiring, RetiresAt: retiresAt},
+		{KeyID: "kid-2", Version: 2, State: roll.SigningKeyActive},
+	}, keys)
+}
+
+func TestRotateSigningKeyNegativeGracePeriod(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("RetrieveApplication", signingKeyTestClientID, "rolltest", false).Return(&roll.Application{ClientID: signingKeyTestClientID}, nil)
+
+	resp := TestHTTPPostWithRollSubject(t, addr+SigningKeysURI+signingKeyTestClientID, map[string]int64{"gracePeriod": -1})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAppJWKSIncludesRetiringKey(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	_, retiredPublicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+	_, retiringPublicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+	_, activePublicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", signingKeyTestClientID).Return(&roll.Application{ClientID: signingKeyTestClientID}, nil)
+
+	signingKeyRepoMock := coreConfig.SigningKeyRepo.(*mocks.SigningKeyRepo)
+	signingKeyRepoMock.On("ListSigningKeys", signingKeyTestClientID).Return([]roll.SigningKey{
+		{ClientID: signingKeyTestClientID, Version: 1, RetiresAt: time.Now().Add(-time.Hour).Unix()},
+		{ClientID: signingKeyTestClientID, Version: 2, RetiresAt: time.Now().Add(time.Hour).Unix()},
+		{ClientID: signingKeyTestClientID, Version: 3},
+	}, nil)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePublicKeyForApp", signingKeyTestClientID+"/v1").Return(retiredPublicKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", signingKeyTestClientID+"/v2").Return(retiringPublicKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", signingKeyTestClientID+"/v3").Return(activePublicKey, nil)
+
+	resp := TestHTTPGet(t, addr+AppJWKSURI+signingKeyTestClientID, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	keySet := readKeySet(t, resp)
+	retiringKey, _ := jwkFromPEM(retiringPublicKey)
+	activeKey, _ := jwkFromPEM(activePublicKey)
+	assert.Equal(t, []jsonWebKey{*retiringKey, *activeKey}, keySet.Keys)
+}
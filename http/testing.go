@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"sync"
 	"testing"
 )
 
@@ -41,12 +42,45 @@ func TestServerWithListener(t *testing.T, ln net.Listener, core *roll.Core) {
 	go server.Serve(ln)
 }
 
+//testIssuers holds the issuer addresses handed out by NewTestCore
+var testIssuers = struct {
+	sync.Mutex
+	addrs map[string]string
+}{addrs: make(map[string]string)}
+
+//testIssuerAddr returns a free address on the localhost for the issuer of a test core. The port is
+//released right away, so cores that are never served don't leave a listener open.
+func testIssuerAddr() string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
 //TestServer return a test listener and its address after firing up a
-//TestServerWithListener
+//TestServerWithListener. The server listens on the address of the core's issuer if the core was
+//created by NewTestCore, so the URLs roll hands out point at the test server.
 func TestServer(t *testing.T, core *roll.Core) (net.Listener, string) {
-	ln, addr := TestListener(t)
+	testIssuers.Lock()
+	issuerAddr, ok := testIssuers.addrs[core.IssuerBaseURL()]
+	testIssuers.Unlock()
+
+	if !ok {
+		ln, addr := TestListener(t)
+		TestServerWithListener(t, ln, core)
+		return ln, addr
+	}
+
+	ln, err := net.Listen("tcp", issuerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	TestServerWithListener(t, ln, core)
-	return ln, addr
+	return ln, core.IssuerBaseURL()
 }
 
 type TestIDGen struct{}
@@ -55,15 +89,35 @@ func (tig TestIDGen) GenerateID() (string, error) {
 	return "steve", nil
 }
 
-//NewTestCore returns a roll.Core instance with mocked implementations of its internal dependencies
+//NewTestCore returns a roll.Core instance with mocked implementations of its internal dependencies. The
+//core's issuer is a free address on the localhost TestServer will serve the core on.
 func NewTestCore() (*roll.Core, *roll.CoreConfig) {
+	addr := testIssuerAddr()
+	issuer := "http://" + addr
+	testIssuers.Lock()
+	testIssuers.addrs[issuer] = addr
+	testIssuers.Unlock()
+
 	var coreConfig = roll.CoreConfig{}
 	coreConfig.DeveloperRepo = new(mocks.DeveloperRepo)
 	coreConfig.ApplicationRepo = new(mocks.ApplicationRepo)
 	coreConfig.AdminRepo = new(mocks.AdminRepo)
+	coreConfig.RefreshTokenRepo = new(mocks.RefreshTokenRepo)
+	coreConfig.RevocationRepo = new(mocks.RevocationRepo)
+	coreConfig.AuthCodeRepo = new(mocks.AuthCodeRepo)
+	coreConfig.DeviceAuthorizationRepo = new(mocks.DeviceAuthorizationRepo)
+	coreConfig.TrustedIssuerRepo = new(mocks.TrustedIssuerRepo)
+	coreConfig.AssertionReplayRepo = new(mocks.AssertionReplayRepo)
+	coreConfig.ScopeRepo = new(mocks.ScopeRepo)
+	coreConfig.ConsentRepo = new(mocks.ConsentRepo)
+	coreConfig.RegistrationTokenRepo = new(mocks.RegistrationTokenRepo)
+	coreConfig.PushedAuthorizationRepo = new(mocks.PushedAuthorizationRepo)
+	coreConfig.ProtectedResourceRepo = new(mocks.ProtectedResourceRepo)
+	coreConfig.SigningKeyRepo = new(mocks.SigningKeyRepo)
 	coreConfig.SecretsRepo = new(mocks.SecretsRepo)
 	coreConfig.IdGenerator = TestIDGen{}
 	coreConfig.Secure = false
+	coreConfig.IssuerBaseURL = issuer
 	return roll.NewCore(&coreConfig), &coreConfig
 }
 
@@ -98,6 +152,10 @@ func TestHTTPPostWithRollSubject(t assert.TestingT, addr string, body interface{
 	return testHTTPData(t, "POST", addr, true, body)
 }
 
+func TestHTTPDeleteWithRollSubject(t assert.TestingT, addr string, body interface{}) *http.Response {
+	return testHTTPData(t, "DELETE", addr, true, body)
+}
+
 func TestHTTPOptionsWithRollSubject(t assert.TestingT, addr string, body interface{}) *http.Response {
 	return testHTTPData(t, "OPTIONS", addr, true, body)
 }
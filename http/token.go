@@ -3,14 +3,13 @@ package http
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	log "github.com/Sirupsen/logrus"
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/roll/authzwrapper"
 	"github.com/xtraclabs/roll/roll"
-	"github.com/xtraclabs/rollsecrets/secrets"
-	rolltoken "github.com/xtraclabs/rollsecrets/token"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const (
@@ -18,12 +17,41 @@ const (
 	OAuth2TokenBaseURI = "/oauth2/token"
 )
 
+//grantTypeHandler issues tokens for a grant type supported by the token endpoint
+type grantTypeHandler func(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext)
+
+//grantTypeHandlers are the handlers for each grant type supported by the token endpoint
+var grantTypeHandlers = map[string]grantTypeHandler{
+	"authorization_code": handleAuthCodeGrantType,
+	"password":           handlePasswordGrantType,
+	"urn:ietf:params:oauth:grant-type:jwt-bearer": handleJWTGrantType,
+	"refresh_token":        handleRefreshTokenGrantType,
+	"client_credentials":   handleClientCredentialsGrantType,
+	deviceCodeGrantType:    handleDeviceCodeGrantType,
+	tokenExchangeGrantType: handleTokenExchangeGrantType,
+}
+
 var (
 	//ErrInvalidClientDetails is returned when supplied client details don't match those on record
 	ErrInvalidClientDetails = errors.New("Invalid application details")
 
 	//ErrRetrievingAppData is generated if the app data associated with a client_id (aka api key) cannot be retrieved
 	ErrRetrievingAppData = errors.New("Missing or invalid form data")
+
+	//ErrUnsupportedGrantType is returned for grant types roll does not support
+	ErrUnsupportedGrantType = errors.New("Invalid grant_type")
+
+	//ErrClientCredentialsMissing is returned when a confidential client presents no credentials
+	ErrClientCredentialsMissing = errors.New("client_secret missing from request")
+
+	//ErrGrantTypeNotAllowed is returned when a client uses a grant type it did not register
+	ErrGrantTypeNotAllowed = errors.New("grant_type not allowed for the client")
+
+	//ErrRedirectURIMismatch is returned when a code is exchanged with a redirect uri the app has not registered
+	ErrRedirectURIMismatch = errors.New("redirect_uri does not match a registered redirect URI")
+
+	//ErrInvalidUserCredentials is returned when the resource owner credentials of the password grant are not valid
+	ErrInvalidUserCredentials = errors.New("Invalid username or password")
 )
 
 func handleToken(core *roll.Core) http.Handler {
@@ -32,7 +60,7 @@ func handleToken(core *roll.Core) http.Handler {
 		case "POST":
 			handleTokenPost(core, w, r)
 		default:
-			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+			respondOAuth2Error(w, http.StatusMethodNotAllowed, oauth2InvalidRequest, errors.New("Method not allowed"))
 		}
 	})
 }
@@ -40,13 +68,27 @@ func handleToken(core *roll.Core) http.Handler {
 type authCodeContext struct {
 	grantType    string
 	clientID     string
-	clientSecret string
+	client       *clientCredentials
 	redirectURI  string
 	authCode     string
 	username     string
 	password     string
 	assertion    string
 	scope        string
+	refreshToken string
+	codeVerifier string
+	deviceCode   string
+
+	//Resource indicators naming where the access token will be used - see RFC 8707
+	resources []string
+
+	//Token exchange params - see RFC 8693
+	subjectToken       string
+	subjectTokenType   string
+	actorToken         string
+	actorTokenType     string
+	audience           string
+	requestedTokenType string
 }
 
 func (acc *authCodeContext) validate() error {
@@ -57,8 +99,18 @@ func (acc *authCodeContext) validate() error {
 		return acc.validatePasswordGrantType()
 	case "urn:ietf:params:oauth:grant-type:jwt-bearer":
 		return acc.validateJWTGrantType()
+	case "refresh_token":
+		return acc.validateRefreshTokenGrantType()
+	case "client_credentials":
+		return acc.validateClientCredentialsGrantType()
+	case deviceCodeGrantType:
+		return acc.validateDeviceCodeGrantType()
+	case tokenExchangeGrantType:
+		return acc.validateTokenExchangeGrantType()
+	case "":
+		return errors.New("grant_type missing from request")
 	default:
-		return errors.New("Invalid grant_type")
+		return ErrUnsupportedGrantType
 	}
 }
 
@@ -68,8 +120,9 @@ func (acc *authCodeContext) validateAuthCodeGrantType() error {
 		return errors.New("client_id missing from request")
 	}
 
-	if acc.clientSecret == "" {
-		return errors.New("client_secret missing from request")
+	//Public clients authenticate the code exchange with a PKCE code verifier instead of a secret
+	if !acc.client.present() && acc.codeVerifier == "" {
+		return ErrClientCredentialsMissing
 	}
 
 	if acc.redirectURI == "" {
@@ -88,8 +141,8 @@ func (acc *authCodeContext) validatePasswordGrantType() error {
 		return errors.New("client_id missing from request")
 	}
 
-	if acc.clientSecret == "" {
-		return errors.New("client_secret missing from request")
+	if !acc.client.present() {
+		return ErrClientCredentialsMissing
 	}
 
 	if acc.username == "" {
@@ -111,30 +164,93 @@ func (acc *authCodeContext) validateJWTGrantType() error {
 	return nil
 }
 
+//validateRefreshTokenGrantType checks the refresh token grant params. Public clients redeem refresh
+//tokens without a client secret, so whether one is needed depends on the app.
+func (acc *authCodeContext) validateRefreshTokenGrantType() error {
+	if acc.clientID == "" {
+		return errors.New("client_id missing from request")
+	}
+
+	if acc.refreshToken == "" {
+		return errors.New("refresh_token missing from request")
+	}
+
+	return nil
+}
+
+func (acc *authCodeContext) validateClientCredentialsGrantType() error {
+	if acc.clientID == "" {
+		return errors.New("client_id missing from request")
+	}
+
+	if !acc.client.present() {
+		return ErrClientCredentialsMissing
+	}
+
+	return nil
+}
+
+//validateDeviceCodeGrantType checks the device code grant params. Public clients poll without a
+//client secret, so whether one is needed depends on the app.
+func (acc *authCodeContext) validateDeviceCodeGrantType() error {
+	if acc.clientID == "" {
+		return errors.New("client_id missing from request")
+	}
+
+	if acc.deviceCode == "" {
+		return errors.New("device_code missing from request")
+	}
+
+	return nil
+}
+
 type accessTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	//IssuedTokenType is returned in response to a token exchange - see RFC 8693 section 2.2.1
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
 
-func validateAndExtractFormParams(r *http.Request) (*authCodeContext, error) {
+func validateAndExtractFormParams(core *roll.Core, r *http.Request) (*authCodeContext, error) {
+	client, err := clientCredentialsFromRequest(core, r)
+	if err != nil {
+		return nil, err
+	}
 
 	acc := &authCodeContext{
 		grantType:    r.FormValue("grant_type"),
-		clientID:     r.FormValue("client_id"),
-		clientSecret: r.FormValue("client_secret"),
+		clientID:     client.clientID,
+		client:       client,
 		redirectURI:  r.FormValue("redirect_uri"),
 		authCode:     r.FormValue("code"),
 		username:     r.FormValue("username"),
 		password:     r.FormValue("password"),
 		assertion:    r.FormValue("assertion"),
 		scope:        r.FormValue("scope"),
+		refreshToken: r.FormValue("refresh_token"),
+		codeVerifier: r.FormValue("code_verifier"),
+		deviceCode:   r.FormValue("device_code"),
+		resources:    r.Form["resource"],
+
+		subjectToken:       r.FormValue("subject_token"),
+		subjectTokenType:   r.FormValue("subject_token_type"),
+		actorToken:         r.FormValue("actor_token"),
+		actorTokenType:     r.FormValue("actor_token_type"),
+		audience:           r.FormValue("audience"),
+		requestedTokenType: r.FormValue("requested_token_type"),
 	}
 
 	return acc, acc.validate()
 
 }
 
-func subjectFromBearerToken(core *roll.Core, r *http.Request) (string, error) {
+//bearerTokenFromRequest returns the bearer token from the Authorization header of the request
+func bearerTokenFromRequest(r *http.Request) (string, error) {
 	//Check for header presence
 	authzHeader := r.Header.Get("Authorization")
 	if authzHeader == "" {
@@ -147,9 +263,36 @@ func subjectFromBearerToken(core *roll.Core, r *http.Request) (string, error) {
 		return "", errors.New("Unexpected authorization header format - expecting bearer token")
 	}
 
+	return strings.TrimSpace(parts[1]), nil
+}
+
+//verifyAccessToken verifies a bearer token, returning it only if it is an access token. Other tokens roll
+//signs with the application's key are rejected, using the same check as the roll api authorization wrapper.
+func verifyAccessToken(core *roll.Core, tokenString string) (*jwt.Token, error) {
+	token, err := jwt.Parse(tokenString, keyExtractionFunction(core))
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("Invalid access token")
+	}
+
+	if err := authzwrapper.CheckAccessToken(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func subjectFromBearerToken(core *roll.Core, r *http.Request) (string, error) {
+	bearerToken, err := bearerTokenFromRequest(r)
+	if err != nil {
+		return "", err
+	}
+
 	//Parse the token
-	bearerToken := strings.TrimSpace(parts[1])
-	token, err := jwt.Parse(bearerToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	token, err := verifyAccessToken(core, bearerToken)
 	if err != nil {
 		return "", err
 	}
@@ -183,46 +326,41 @@ func lookupApplication(core *roll.Core, clientID string) (*roll.Application, err
 	return app, nil
 }
 
-func lookupApplicatioByAudience(core *roll.Core, audience string) (*roll.Application, error) {
-	app, err := core.SystemRetrieveApplicationByJWTFlowAudience(audience)
-	if err != nil {
-		log.Info("Error retrieving app data: ", err.Error())
-		return nil, ErrRetrievingAppData
-	}
-
-	if app == nil {
-		log.Info("invalid client id")
-		return nil, errors.New("Invalid client id")
-	}
-
-	return app, nil
-}
-
 func validateClientDetails(core *roll.Core, ctx *authCodeContext) (*roll.Application, error) {
-	app, err := lookupApplication(core, ctx.clientID)
+	app, err := authenticateClient(core, ctx.client, publicClientGrant(ctx))
 	if err != nil {
-		log.Info("error looking up application")
 		return nil, err
 	}
 
-	if app.ClientSecret != ctx.clientSecret {
-		log.Info("error validating client secret")
-		log.Info("secret from db: ", app.ClientSecret)
-		log.Info("secret from context: ", ctx.clientSecret)
-
-		return nil, ErrInvalidClientDetails
+	if !app.AllowsGrantType(ctx.grantType) {
+		log.Info("Grant type ", ctx.grantType, " not allowed for ", app.ClientID)
+		return nil, ErrGrantTypeNotAllowed
 	}
 
-	if ctx.grantType == "authorization_code" && app.RedirectURI != ctx.redirectURI {
+	if ctx.grantType == "authorization_code" && !app.AllowsRedirectURI(ctx.redirectURI) {
 		log.Info("error validating registered redirect URI")
-		return nil, ErrInvalidClientDetails
+		return nil, ErrRedirectURIMismatch
 	}
 
 	return app, nil
 }
 
-func validateAndReturnCodeToken(secretsRepo secrets.SecretsRepo, ctx *authCodeContext, clientID string) (*jwt.Token, error) {
-	token, err := jwt.Parse(ctx.authCode, rolltoken.GenerateKeyExtractionFunction(secretsRepo))
+//publicClientGrant is true when a public client may use the grant without client credentials. Codes
+//are exchanged with a PKCE code verifier, which is checked against the code. Refresh tokens are bound
+//to the client they were issued to and rotated on each use, so a replayed token revokes its family.
+func publicClientGrant(ctx *authCodeContext) bool {
+	switch ctx.grantType {
+	case "authorization_code":
+		return ctx.codeVerifier != ""
+	case "refresh_token":
+		return true
+	default:
+		return false
+	}
+}
+
+func validateAndReturnCodeToken(core *roll.Core, ctx *authCodeContext, clientID string) (*jwt.Token, error) {
+	token, err := jwt.Parse(ctx.authCode, keyExtractionFunction(core))
 	if err != nil {
 		return nil, err
 	}
@@ -245,249 +383,228 @@ func handleTokenPost(core *roll.Core, w http.ResponseWriter, r *http.Request) {
 	//Verify the form params are as expected: grant_type is authorization_code,
 	//a code is present, client_id and client_secret are provided, redirect_uri is
 	//provided. The content type should be application/x-www-form-urlencoded
-	codeContext, err := validateAndExtractFormParams(r)
+	codeContext, err := validateAndExtractFormParams(core, r)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err)
+		switch err {
+		case ErrUnsupportedGrantType:
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2UnsupportedGrantType, err)
+		case ErrClientCredentialsMissing, ErrClientIDMismatch, ErrUnsupportedClientAssertionType:
+			respondOAuth2Error(w, http.StatusUnauthorized, oauth2InvalidClient, err)
+		default:
+			respondInvalidRequest(w, err)
+		}
 		return
 	}
 
-	//The grant type was validated above, so at this point we have two grant types to
-	//handle: authorization_code and password
-	switch codeContext.grantType {
-	case "authorization_code":
-		handleAuthCodeGrantType(core, w, r, codeContext)
-	case "password":
-		handlePasswordGrantType(core, w, r, codeContext)
-	case "urn:ietf:params:oauth:grant-type:jwt-bearer":
-		handleJWTGrantType(core, w, r, codeContext)
-	default:
+	//The grant type was validated above, so at this point we only have the grant types
+	//we know about to handle
+	handleGrantType, ok := grantTypeHandlers[codeContext.grantType]
+	if !ok {
 		//Never say never...
-		respondError(w, http.StatusBadRequest, err)
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2UnsupportedGrantType, ErrUnsupportedGrantType)
+		return
 	}
+
+	//Any resources the token is requested for must be registered protected resources
+	if _, err := describeResources(core, codeContext.resources); err != nil {
+		respondTargetError(w, err)
+		return
+	}
+
+	handleGrantType(core, w, r, codeContext)
 }
 
-func generateAndRespondWithAccessToken(core *roll.Core, subject, scope string, app *roll.Application, w http.ResponseWriter) {
-	token, err := generateJWT(subject, scope, core, app)
+//generateAccessTokenResponse generates an access token response. The access token's audience is the resources
+//it is for, or the app if no resources are given.
+func generateAccessTokenResponse(core *roll.Core, subject, scope string, resources []string, app *roll.Application) (*accessTokenResponse, error) {
+	token, err := generateJWT(subject, scope, core, app, withAudience(nil, resources))
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err)
-		return
+		return nil, err
 	}
 
-	//Respond with a JSON document included the access_token and a token type of
-	//bearer
-	at := accessTokenResponse{
+	return &accessTokenResponse{
 		AccessToken: token,
 		TokenType:   "Bearer",
-	}
+		ExpiresIn:   expiresIn(core, app),
+		Scope:       scope,
+	}, nil
+}
+
+//expiresIn returns the lifetime in seconds of access tokens issued for the app
+func expiresIn(core *roll.Core, app *roll.Application) int64 {
+	return int64(core.AccessTokenLifetime(app) / time.Second)
+}
 
-	atBytes, err := json.Marshal(&at)
+func respondWithAccessToken(w http.ResponseWriter, at *accessTokenResponse) {
+	atBytes, err := json.Marshal(at)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err)
+		respondServerError(w, err)
 		return
 	}
 
+	//Token responses must not be cached - see RFC 6749 section 5.1
 	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Pragma", "no-cache")
 	w.Write(atBytes)
 }
 
+func generateAndRespondWithAccessToken(core *roll.Core, subject, scope string, resources []string, app *roll.Application, w http.ResponseWriter) {
+	//Respond with a JSON document included the access_token and a token type of
+	//bearer
+	at, err := generateAccessTokenResponse(core, subject, scope, resources, app)
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	respondWithAccessToken(w, at)
+}
+
+//generateAndRespondWithRefreshableAccessToken responds with an access token and a refresh token
+//that starts a new refresh token family.
+func generateAndRespondWithRefreshableAccessToken(core *roll.Core, subject, scope string, resources []string, app *roll.Application, w http.ResponseWriter) {
+	at, err := generateAccessTokenResponse(core, subject, scope, resources, app)
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	at.RefreshToken, err = issueRefreshToken(core, subject, scope, resources, "", app)
+	if err != nil {
+		log.Info("Error issuing refresh token: ", err.Error())
+		respondServerError(w, err)
+		return
+	}
+
+	respondWithAccessToken(w, at)
+}
+
 func handleAuthCodeGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
 	//Verify the client id and secret, plus the redirect_uri by doing a lookup
 	//of the app by client id as api key value
 	app, err := validateClientDetails(core, codeContext)
 	if err != nil {
 		switch err {
-		case ErrInvalidClientDetails:
-			respondError(w, http.StatusBadRequest, ErrInvalidClientDetails)
+		case ErrRedirectURIMismatch:
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, err)
 		default:
-			respondError(w, http.StatusInternalServerError, err)
+			respondClientAuthError(w, err)
 		}
 
 		return
 	}
 
 	//Validate the code - it should be a token signed with the users' private key
-	token, err := validateAndReturnCodeToken(core.SecretsRepo, codeContext, r.FormValue("client_id"))
+	token, err := validateAndReturnCodeToken(core, codeContext, app.ClientID)
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, err)
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, err)
 		return
 	}
 
 	scope, ok := token.Claims["scope"].(string)
 	if !ok {
-		respondError(w, http.StatusBadRequest, errors.New("problem with token scope"))
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, errors.New("problem with token scope"))
 		return
 	}
 
 	subject, ok := token.Claims["sub"].(string)
 	if !ok {
-		respondError(w, http.StatusBadRequest, errors.New("problem with token subject"))
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, errors.New("problem with token subject"))
 		return
 	}
 
-	//If everything is cool, generate a JWT access token
-	generateAndRespondWithAccessToken(core, subject, scope, app, w)
-}
-
-func handlePasswordGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
-	//Validate client details
-	log.Info("Handle password grant type")
-	log.Info("Validate client details")
-	app, err := validateClientDetails(core, codeContext)
-	if err != nil {
-		log.Info(err.Error())
-		switch err {
-		case ErrInvalidClientDetails:
-			respondError(w, http.StatusBadRequest, ErrInvalidClientDetails)
-		default:
-			respondError(w, http.StatusInternalServerError, err)
-		}
-
+	//If a code challenge was presented when the code was issued, the code verifier must match it.
+	//Codes issued to public clients always carry a challenge.
+	cc := codeChallengeFromClaims(token.Claims)
+	switch {
+	case cc != nil && !cc.verify(codeContext.codeVerifier):
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidCodeVerifier)
+		return
+	case cc == nil && app.PublicClient:
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrCodeChallengeRequired)
 		return
 	}
 
-	//If the client details checkout, authenticate the user credentials
-	log.Info("authenticate user credentials")
-	authenticated, err := authenticateUser(codeContext.username, codeContext.password, app)
+	//Codes are single use, and may only be exchanged using the redirect uri they were issued for
+	code, err := retrieveAuthCodeForExchange(core, token.Claims, codeContext)
 	if err != nil {
-		log.Info("Error authenticating user: ", err.Error())
-		respondError(w, http.StatusInternalServerError, err)
+		log.Info("Error retrieving authorization code: ", err.Error())
+		respondServerError(w, err)
 		return
 	}
 
-	//If the user credentials don't check out, we're done.
-	if !authenticated {
-		respondError(w, http.StatusUnauthorized, nil)
+	if code == nil {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidAuthCode)
 		return
 	}
 
-	//If a scope is present, validate it.
-	log.Info("validate scope")
-	valid, err := validateScopes(core, r)
-	if err != nil {
-		log.Info("error validating scope: ", err.Error())
-		respondError(w, http.StatusInternalServerError, nil)
+	if code.Used {
+		revokeAuthCodeGrant(core, code.CodeID, w)
 		return
 	}
 
-	if !valid {
-		log.Info("scope is invalid")
-		respondError(w, http.StatusUnauthorized, nil)
+	if code.Expired() {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidAuthCode)
 		return
 	}
 
-	//Create the access token
-	generateAndRespondWithAccessToken(core, codeContext.username, codeContext.scope, app, w)
-
-}
-
-func filterUnsupportedClaims(scope string) string {
-	if scope == "" {
-		return scope
-	}
-
-	var supportedScope string
-
-	scopeParts := strings.Fields(scope)
-	for _, sp := range scopeParts {
-		//currently only admin is supported
-		if sp == "admin" {
-			supportedScope = sp
-		}
+	//The access token may be for fewer of the resources than the code was issued for
+	grantedResources := resourcesFromClaims(token.Claims, resourceClaim)
+	resources, err := targetResources(codeContext.resources, grantedResources)
+	if err != nil {
+		respondTargetError(w, err)
+		return
 	}
 
-	return supportedScope
+	//If everything is cool, spend the code and generate a JWT access token
+	grantedScope := grantedScopeFromCode(scope)
+	si := signInFromCodeClaims(core, r, grantedScope, token.Claims)
+	exchangeAuthCode(core, code, subject, grantedScope, resources, grantedResources, app, si, w)
 }
 
-func handleJWTGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
-	log.Info("handleJWTGrantType")
-
-	//First step is to verify the token signature
-	log.Info("verify token signature")
-	token, err := jwt.Parse(codeContext.assertion, generateKeyExtractionFunctionForJTWFlow(core.ApplicationRepo))
+func handlePasswordGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
+	//Validate client details
+	log.Info("Handle password grant type")
+	log.Info("Validate client details")
+	app, err := validateClientDetails(core, codeContext)
 	if err != nil {
 		log.Info(err.Error())
-		respondError(w, http.StatusUnauthorized, err)
+		respondClientAuthError(w, err)
 		return
 	}
 
-	//Grab the app definition based on iss carries the api key/client_id
-	log.Info("look up application definition")
-	app, err := lookupApplicatioByAudience(core, token.Claims["aud"].(string))
+	//If the client details checkout, authenticate the user credentials
+	log.Info("authenticate user credentials")
+	authenticated, _, err := authenticateUser(codeContext.username, codeContext.password, app)
 	if err != nil {
-		switch err {
-		case ErrInvalidClientDetails:
-			respondError(w, http.StatusBadRequest, ErrInvalidClientDetails)
-		default:
-			respondError(w, http.StatusInternalServerError, err)
-		}
-
+		log.Info("Error authenticating user: ", err.Error())
+		respondServerError(w, err)
 		return
 	}
 
-	//Pass the identity
-	subject, ok := token.Claims["sub"].(string)
-	if !ok {
-		respondError(w, http.StatusBadRequest, errors.New("sub claim is not a string"))
+	//If the user credentials don't check out, we're done.
+	if !authenticated {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidGrant, ErrInvalidUserCredentials)
 		return
 	}
 
-	//Make sure the claim conveys a sub
-	if subject == "" {
-		respondError(w, http.StatusBadRequest, errors.New("JWT missing sub claim"))
+	//If a scope is present, validate it.
+	log.Info("validate scope")
+	valid, err := validateScopes(core, app, codeContext.username, codeContext.scope)
+	if err != nil {
+		log.Info("error validating scope: ", err.Error())
+		respondServerError(w, err)
 		return
 	}
 
-	//Include scope
-	scope, ok := token.Claims["scope"].(string)
-	if !ok {
-		scope = ""
+	if !valid {
+		log.Info("scope is invalid")
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, ErrScopeNotAllowed)
+		return
 	}
 
-	//Now we can generate a token since we had the app needed to form the token
-	log.Info("generate token")
-
-	//TODO - extract and validate scope
-	generateAndRespondWithAccessToken(core, subject, filterUnsupportedClaims(scope), app, w)
-
-}
-
-func generateKeyExtractionFunctionForJTWFlow(applicationRepo roll.ApplicationRepo) jwt.Keyfunc {
-	return func(token *jwt.Token) (interface{}, error) {
-		//Check the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-
-		//The aud claim conveys the intended application the token is used to gain access to.
-		clientID := token.Claims["aud"]
-		if clientID == nil {
-			return nil, errors.New("Foreign token does not include aud claim")
-		}
-
-		//Look up the application
-		app, err := applicationRepo.SystemRetrieveApplicationByJWTFlowAudience(clientID.(string))
-		if err != nil {
-			log.Info("Error looking up app for ", clientID, " ", err.Error())
-			return nil, err
-		}
-
-		if app == nil {
-			log.Info("No app definition associated with audience found: ", clientID.(string))
-			return nil, errors.New("No app definition associated with aud found")
-		}
-
-		//We also check that the token was issued by the entity registered with the application
-		issuer := token.Claims["iss"]
-		if issuer == nil || issuer != app.JWTFlowIssuer {
-			return nil, errors.New("Foreign token issuer not known")
-		}
-
-		//Grab the public key from the app definition
-		keystring := app.JWTFlowPublicKey
-
-		log.Info("validating with '", keystring, "'")
+	//Create the access token
+	generateAndRespondWithRefreshableAccessToken(core, codeContext.username, codeContext.scope, codeContext.resources, app, w)
 
-		//Parse the keystring
-		return jwt.ParseRSAPublicKeyFromPEM([]byte(keystring))
-	}
 }
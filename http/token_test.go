@@ -5,6 +5,7 @@ import (
 	"errors"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/roll/roll/mocks"
 	"github.com/xtraclabs/rollsecrets/secrets"
@@ -13,6 +14,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestTokenMissingGrantType(t *testing.T) {
@@ -25,7 +27,8 @@ func TestTokenMissingGrantType(t *testing.T) {
 
 	assert.Nil(t, err)
 	body := responseAsString(t, resp)
-	assert.True(t, strings.Contains(body, "Invalid grant_type"))
+	assert.True(t, strings.Contains(body, "grant_type missing from request"))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
 
 func TestTokenInvalidGrantType(t *testing.T) {
@@ -138,7 +141,7 @@ func TestTokenAppLookupNil(t *testing.T) {
 	assert.Nil(t, err)
 	body := responseAsString(t, resp)
 	assert.True(t, strings.Contains(body, "Invalid client id"))
-	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
 
 func TestTokenUnparsableAuthCode(t *testing.T) {
@@ -151,7 +154,7 @@ func TestTokenUnparsableAuthCode(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -168,7 +171,8 @@ func TestTokenUnparsableAuthCode(t *testing.T) {
 	assert.Nil(t, err)
 	body := responseAsString(t, resp)
 	assert.True(t, strings.Contains(body, "token contains an invalid number of segments"))
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.True(t, strings.Contains(body, `"error":"invalid_grant"`))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
 
 func TestTokenInvalidClientSecret(t *testing.T) {
@@ -181,7 +185,7 @@ func TestTokenInvalidClientSecret(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "hax0r",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -198,7 +202,8 @@ func TestTokenInvalidClientSecret(t *testing.T) {
 	assert.Nil(t, err)
 	body := responseAsString(t, resp)
 	assert.True(t, strings.Contains(body, "Invalid application details"))
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(body, `"error":"invalid_client"`))
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
 
 func TestTokenInvalidRedirect(t *testing.T) {
@@ -211,7 +216,7 @@ func TestTokenInvalidRedirect(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -227,8 +232,9 @@ func TestTokenInvalidRedirect(t *testing.T) {
 
 	assert.Nil(t, err)
 	body := responseAsString(t, resp)
-	assert.True(t, strings.Contains(body, "Invalid application details"))
+	assert.True(t, strings.Contains(body, ErrRedirectURIMismatch.Error()))
 	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.True(t, strings.Contains(body, `"error":"invalid_grant"`))
 }
 
 func TestTokenSignedWithWrongKey(t *testing.T) {
@@ -241,7 +247,7 @@ func TestTokenSignedWithWrongKey(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -271,7 +277,7 @@ func TestTokenSignedWithWrongKey(t *testing.T) {
 	assert.Nil(t, err)
 	body := responseAsString(t, resp)
 	assert.True(t, strings.Contains(body, "verification error"))
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
 
 func TestTokenValidCode(t *testing.T) {
@@ -284,7 +290,7 @@ func TestTokenValidCode(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -301,6 +307,11 @@ func TestTokenValidCode(t *testing.T) {
 	code, err := rolltoken.GenerateCode("b-subject", "", returnVal.ClientID, privateKey)
 	assert.Nil(t, err)
 
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
 	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
 		url.Values{"grant_type": {"authorization_code"},
 			"client_id":     {"1111-2222-3333333-4444444"},
@@ -317,6 +328,7 @@ func TestTokenValidCode(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, jsonResponse.AccessToken != "")
 	assert.True(t, jsonResponse.TokenType == "Bearer")
+	assert.Equal(t, "steve", jsonResponse.RefreshToken)
 
 }
 
@@ -330,7 +342,7 @@ func TestTokenValidCodeWithAdminScope(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -347,6 +359,11 @@ func TestTokenValidCodeWithAdminScope(t *testing.T) {
 	code, err := rolltoken.GenerateCode("b-subject", "admin", returnVal.ClientID, privateKey)
 	assert.Nil(t, err)
 
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
 	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
 		url.Values{"grant_type": {"authorization_code"},
 			"client_id":     {"1111-2222-3333333-4444444"},
@@ -363,11 +380,78 @@ func TestTokenValidCodeWithAdminScope(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, jsonResponse.AccessToken != "")
 	assert.True(t, jsonResponse.TokenType == "Bearer")
+	assert.Equal(t, "steve", jsonResponse.RefreshToken)
 
 	token, err := jwt.Parse(jsonResponse.AccessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
 	assert.Nil(t, err)
 	scope, ok := token.Claims["scope"].(string)
 	assert.True(t, ok)
 	assert.Equal(t, "admin", scope)
+	assert.Equal(t, "admin", jsonResponse.Scope)
+	assert.Equal(t, int64(86400), jsonResponse.ExpiresIn)
+
+}
+
+func codeExchangeWithTokenLifetime(t *testing.T, lifetime int64) (*accessTokenResponse, *jwt.Token) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
 
+	returnVal := roll.Application{
+		DeveloperEmail:      "doug@dev.com",
+		ClientID:            "1111-2222-3333333-4444444",
+		ApplicationName:     "fight club",
+		ClientSecret:        "not for browser clients",
+		RedirectURIs:        "http://localhost:3000/ab",
+		LoginProvider:       "xtrac://localhost:9000",
+		AccessTokenLifetime: lifetime,
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", "1111-2222-3333333-4444444").Return(&returnVal, nil)
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	code, err := rolltoken.GenerateCode("b-subject", "", returnVal.ClientID, privateKey)
+	assert.Nil(t, err)
+
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
+	expectAuthCodeExchange(coreConfig, "http://localhost:3000/ab")
+
+	resp := exchangeCode(t, addr, code, "http://localhost:3000/ab")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	assert.Nil(t, err)
+
+	return &jsonResponse, token
+}
+
+func TestTokenAppAccessTokenLifetime(t *testing.T) {
+	at, token := codeExchangeWithTokenLifetime(t, 300)
+	assert.Equal(t, int64(300), at.ExpiresIn)
+
+	exp, ok := token.Claims["exp"].(float64)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Now().Add(300*time.Second).Unix(), int64(exp), 5)
+}
+
+func TestTokenAppAccessTokenLifetimeCappedAtMax(t *testing.T) {
+	at, token := codeExchangeWithTokenLifetime(t, int64(30*24*time.Hour/time.Second))
+	assert.Equal(t, int64(roll.MaxAccessTokenLifetime/time.Second), at.ExpiresIn)
+
+	exp, ok := token.Claims["exp"].(float64)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Now().Add(roll.MaxAccessTokenLifetime).Unix(), int64(exp), 5)
 }
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+	"time"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	//Token type identifiers - see RFC 8693 section 3. Access tokens issued by roll are JWTs, so
+	//either identifier may be used to describe them.
+	accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	jwtTokenType    = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+var (
+	//ErrUnsupportedTokenType is returned when a token type other than a roll access token is presented or requested
+	ErrUnsupportedTokenType = errors.New("Unsupported token type")
+
+	//ErrInvalidSubjectToken is returned when the subject token is not a valid access token issued to the client
+	ErrInvalidSubjectToken = errors.New("Invalid subject_token")
+
+	//ErrInvalidActorToken is returned when the actor token is not a valid access token
+	ErrInvalidActorToken = errors.New("Invalid actor_token")
+
+	//ErrAudienceNotAllowed is returned when the client may not exchange tokens for the requested audience
+	ErrAudienceNotAllowed = errors.New("Token exchange not allowed for audience")
+)
+
+//validateTokenExchangeGrantType checks the token exchange grant params - see RFC 8693 section 2.1.
+//Roll issues tokens for a single application, so the audience must be given.
+func (acc *authCodeContext) validateTokenExchangeGrantType() error {
+	if acc.clientID == "" {
+		return errors.New("client_id missing from request")
+	}
+
+	if !acc.client.present() {
+		return errors.New("client_secret missing from request")
+	}
+
+	if acc.subjectToken == "" {
+		return errors.New("subject_token missing from request")
+	}
+
+	if acc.subjectTokenType == "" {
+		return errors.New("subject_token_type missing from request")
+	}
+
+	if acc.actorToken != "" && acc.actorTokenType == "" {
+		return errors.New("actor_token_type missing from request")
+	}
+
+	if acc.actorToken == "" && acc.actorTokenType != "" {
+		return errors.New("actor_token missing from request")
+	}
+
+	if acc.audience == "" {
+		return errors.New("audience missing from request")
+	}
+
+	return nil
+}
+
+func supportedTokenType(tokenType string) bool {
+	return tokenType == accessTokenType || tokenType == jwtTokenType
+}
+
+//parseExchangeableToken returns the claims of a token presented in a token exchange. The token must be a
+//current, unrevoked access token issued by roll.
+func parseExchangeableToken(core *roll.Core, tokenString string) (map[string]interface{}, bool, error) {
+	token, err := verifyAccessToken(core, tokenString)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	if sub, _ := token.Claims["sub"].(string); sub == "" {
+		return nil, false, nil
+	}
+
+	revoked, err := tokenRevoked(core, token.Claims)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return token.Claims, !revoked, nil
+}
+
+//actClaim builds the act claim of an exchanged token. The actor is the subject of the actor token, or the
+//client making the exchange if there is no actor token. Any actors recorded in the subject token are
+//nested below the current actor - see RFC 8693 section 4.1.
+func actClaim(subjectClaims, actorClaims map[string]interface{}, clientID string) map[string]interface{} {
+	act := map[string]interface{}{
+		"sub": clientID,
+	}
+
+	if actorClaims != nil {
+		act["sub"] = actorClaims["sub"]
+	}
+
+	if priorAct, ok := subjectClaims["act"].(map[string]interface{}); ok {
+		act["act"] = priorAct
+	}
+
+	return act
+}
+
+//handleTokenExchangeGrantType exchanges an access token issued to the client for a token the client may use
+//to call another application on behalf of the token subject. The target application's token exchange policy
+//lists the clients that may exchange tokens for it. The exchanged token may narrow but not widen the scope of the
+//subject token, does not outlive it, and has no refresh token.
+func handleTokenExchangeGrantType(core *roll.Core, w http.ResponseWriter, r *http.Request, codeContext *authCodeContext) {
+	if !supportedTokenType(codeContext.subjectTokenType) ||
+		(codeContext.actorToken != "" && !supportedTokenType(codeContext.actorTokenType)) ||
+		(codeContext.requestedTokenType != "" && !supportedTokenType(codeContext.requestedTokenType)) {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, ErrUnsupportedTokenType)
+		return
+	}
+
+	app, err := validateClientDetails(core, codeContext)
+	if err != nil {
+		respondClientAuthError(w, err)
+
+		return
+	}
+
+	targetApp, err := core.SystemRetrieveApplication(codeContext.audience)
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	if targetApp == nil || !targetApp.AllowsTokenExchangeBy(app.ClientID) {
+		log.Info("Token exchange for ", codeContext.audience, " not allowed for ", app.ClientID)
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidTarget, ErrAudienceNotAllowed)
+		return
+	}
+
+	subjectClaims, valid, err := parseExchangeableToken(core, codeContext.subjectToken)
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	//The subject token must have been issued to the client making the exchange
+	if clientID, _ := tokenClientID(subjectClaims); !valid || clientID != app.ClientID {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, ErrInvalidSubjectToken)
+		return
+	}
+
+	var actorClaims map[string]interface{}
+	if codeContext.actorToken != "" {
+		actorClaims, valid, err = parseExchangeableToken(core, codeContext.actorToken)
+		if err != nil {
+			respondServerError(w, err)
+			return
+		}
+
+		if !valid {
+			respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidRequest, ErrInvalidActorToken)
+			return
+		}
+	}
+
+	subjectScope, _ := subjectClaims["scope"].(string)
+	scope := codeContext.scope
+	if scope == "" {
+		scope = subjectScope
+	}
+
+	if !scopeWithinGrant(scope, subjectScope) {
+		respondOAuth2Error(w, http.StatusBadRequest, oauth2InvalidScope, ErrScopeNotAllowed)
+		return
+	}
+
+	//The exchanged token is issued for the target application, so the scope must be one it allows
+	if err := validateRequestedScope(core, targetApp, scope); err != nil {
+		respondScopeError(w, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(core.AccessTokenLifetime(targetApp)).Unix()
+	if subjectExpiry := int64Claim(subjectClaims, "exp"); subjectExpiry < expiresAt {
+		expiresAt = subjectExpiry
+	}
+
+	subject, _ := subjectClaims["sub"].(string)
+	token, err := generateJWT(subject, scope, core, targetApp, withAudience(map[string]interface{}{
+		"act": actClaim(subjectClaims, actorClaims, app.ClientID),
+		"exp": expiresAt,
+	}, codeContext.resources))
+	if err != nil {
+		respondServerError(w, err)
+		return
+	}
+
+	respondWithAccessToken(w, &accessTokenResponse{
+		AccessToken:     token,
+		IssuedTokenType: accessTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       expiresAt - time.Now().Unix(),
+		Scope:           scope,
+	})
+}
@@ -0,0 +1,355 @@
+package http
+
+import (
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	exchangeClientID = "1111-2222-3333333-4444444"
+	exchangeTargetID = "5555-6666-7777777-8888888"
+)
+
+//setupTokenExchangeTestApps registers a client along with a target app that allows the client to exchange
+//tokens for it. The returned apps can be used to generate subject and actor tokens.
+func setupTokenExchangeTestApps(t *testing.T, coreConfig *roll.CoreConfig) (*roll.Application, *roll.Application) {
+	client := &roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        exchangeClientID,
+		ApplicationName: "front end",
+		ClientSecret:    "front end secret",
+		RedirectURIs:    "http://localhost:3000/ab",
+		LoginProvider:   "xtrac://localhost:9000",
+		AllowedScopes:   "a b",
+	}
+
+	target := &roll.Application{
+		DeveloperEmail:  "doug@dev.com",
+		ClientID:        exchangeTargetID,
+		ApplicationName: "back end",
+		ClientSecret:    "back end secret",
+		RedirectURIs:    "http://localhost:3000/cd",
+		LoginProvider:   "xtrac://localhost:9000",
+		AllowedScopes:   "a b",
+
+		TokenExchangeClients: exchangeClientID,
+	}
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("SystemRetrieveApplication", exchangeClientID).Return(client, nil)
+	appRepoMock.On("SystemRetrieveApplication", exchangeTargetID).Return(target, nil)
+	appRepoMock.On("SystemRetrieveApplication", mock.Anything).Return(nil, nil)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	for _, clientID := range []string{exchangeClientID, exchangeTargetID} {
+		privateKey, publicKey, err := secrets.GenerateKeyPair()
+		assert.Nil(t, err)
+		secretsMock.On("RetrievePrivateKeyForApp", clientID).Return(privateKey, nil)
+		secretsMock.On("RetrievePublicKeyForApp", clientID).Return(publicKey, nil)
+	}
+
+	scopeRepoMock := coreConfig.ScopeRepo.(*mocks.ScopeRepo)
+	scopeRepoMock.On("RetrieveScope", "a").Return(&roll.Scope{Name: "a", Description: "Scope a"}, nil)
+	scopeRepoMock.On("RetrieveScope", "b").Return(&roll.Scope{Name: "b", Description: "Scope b"}, nil)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
+	return client, target
+}
+
+func tokenExchangeForm(subjectToken string) url.Values {
+	return url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"client_id":          {exchangeClientID},
+		"client_secret":      {"front end secret"},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {accessTokenType},
+		"audience":           {exchangeTargetID},
+	}
+}
+
+func readOAuth2Error(t *testing.T, resp *http.Response) OAuth2ErrorResponse {
+	var errResp OAuth2ErrorResponse
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &errResp)
+	assert.Nil(t, err)
+	return errResp
+}
+
+func TestTokenExchangeMissingAudience(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	form := tokenExchangeForm("x")
+	form.Del("audience")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTokenExchangeActorTokenWithoutType(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	form := tokenExchangeForm("x")
+	form.Set("actor_token", "y")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTokenExchangeUnsupportedTokenType(t *testing.T) {
+	core, _ := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	form := tokenExchangeForm("x")
+	form.Set("subject_token_type", "urn:ietf:params:oauth:token-type:saml2")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_request", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeInvalidClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupTokenExchangeTestApps(t, coreConfig)
+
+	form := tokenExchangeForm("x")
+	form.Set("client_secret", "guessing")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "invalid_client", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeAudienceNotAllowed(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, _ := setupTokenExchangeTestApps(t, coreConfig)
+	subjectToken, err := generateJWT("user", "a b", core, client, nil)
+	assert.Nil(t, err)
+
+	form := tokenExchangeForm(subjectToken)
+	form.Set("audience", "some-other-app")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_target", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeTargetDoesNotAllowClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	//The policy is the target's, so a client can't allow itself to exchange tokens for the target
+	client, target := setupTokenExchangeTestApps(t, coreConfig)
+	target.TokenExchangeClients = ""
+	client.TokenExchangeClients = exchangeTargetID
+
+	subjectToken, err := generateJWT("user", "a b", core, client, nil)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, tokenExchangeForm(subjectToken))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_target", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeSubjectTokenForOtherClient(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	_, target := setupTokenExchangeTestApps(t, coreConfig)
+	subjectToken, err := generateJWT("user", "a b", core, target, nil)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, tokenExchangeForm(subjectToken))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_request", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeScopeWidened(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, _ := setupTokenExchangeTestApps(t, coreConfig)
+	subjectToken, err := generateJWT("user", "a b", core, client, nil)
+	assert.Nil(t, err)
+
+	form := tokenExchangeForm(subjectToken)
+	form.Set("scope", "a c")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_scope", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeScopeNotAllowedForTarget(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, target := setupTokenExchangeTestApps(t, coreConfig)
+	target.AllowedScopes = "a"
+	subjectToken, err := generateJWT("user", "a b", core, client, nil)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, tokenExchangeForm(subjectToken))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_scope", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeOk(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, _ := setupTokenExchangeTestApps(t, coreConfig)
+	subjectExpiry := time.Now().Add(10 * time.Minute).Unix()
+	subjectToken, err := generateJWT("user", "a b", core, client, map[string]interface{}{"exp": subjectExpiry})
+	assert.Nil(t, err)
+
+	form := tokenExchangeForm(subjectToken)
+	form.Set("scope", "a")
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, accessTokenType, jsonResponse.IssuedTokenType)
+	assert.Equal(t, "Bearer", jsonResponse.TokenType)
+	assert.Equal(t, "a", jsonResponse.Scope)
+	assert.Equal(t, "", jsonResponse.RefreshToken)
+	assert.True(t, jsonResponse.ExpiresIn <= 600)
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, keyExtractionFunction(core))
+	if assert.Nil(t, err) {
+		assert.Equal(t, exchangeTargetID, token.Claims["aud"])
+		assert.Equal(t, "user", token.Claims["sub"])
+		assert.Equal(t, "a", token.Claims["scope"])
+		assert.Equal(t, subjectExpiry, int64Claim(token.Claims, "exp"))
+		assert.Equal(t, map[string]interface{}{"sub": exchangeClientID}, token.Claims["act"])
+	}
+}
+
+func TestTokenExchangeWithActorToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, target := setupTokenExchangeTestApps(t, coreConfig)
+	subjectToken, err := generateJWT("user", "a b", core, client, map[string]interface{}{
+		"act": map[string]interface{}{"sub": "first-hop"},
+	})
+	assert.Nil(t, err)
+	actorToken, err := generateJWT("service-account", "", core, target, nil)
+	assert.Nil(t, err)
+
+	form := tokenExchangeForm(subjectToken)
+	form.Set("actor_token", actorToken)
+	form.Set("actor_token_type", jwtTokenType)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, form)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var jsonResponse accessTokenResponse
+	err = json.Unmarshal([]byte(responseAsString(t, resp)), &jsonResponse)
+	assert.Nil(t, err)
+	assert.Equal(t, "a b", jsonResponse.Scope)
+
+	token, err := jwt.Parse(jsonResponse.AccessToken, keyExtractionFunction(core))
+	if assert.Nil(t, err) {
+		assert.Equal(t, map[string]interface{}{
+			"sub": "service-account",
+			"act": map[string]interface{}{"sub": "first-hop"},
+		}, token.Claims["act"])
+	}
+}
+
+func TestTokenExchangeAuthCodeNotExchangeable(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, _ := setupTokenExchangeTestApps(t, coreConfig)
+	subjectToken, err := generateJWT("user", "", core, client, map[string]interface{}{
+		"scope": authCodeScopeMarker + " a",
+	})
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, tokenExchangeForm(subjectToken))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_request", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeLoginSessionNotExchangeable(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, _ := setupTokenExchangeTestApps(t, coreConfig)
+	subjectToken, err := newLoginSession(core, "user", client, nil)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, tokenExchangeForm(subjectToken))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_request", readOAuth2Error(t, resp).Error)
+}
+
+func TestTokenExchangeTokenWithoutJTINotExchangeable(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	client, _ := setupTokenExchangeTestApps(t, coreConfig)
+	privateKey, err := core.RetrievePrivateKeyForApp(client.ClientID)
+	assert.Nil(t, err)
+
+	//A token with no jti is not an access token, even if it names the client
+	subjectToken, err := signToken(map[string]interface{}{
+		"sub":       "user",
+		"aud":       client.ClientID,
+		"client_id": client.ClientID,
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}, privateKey)
+	assert.Nil(t, err)
+
+	resp, err := http.PostForm(addr+OAuth2TokenBaseURI, tokenExchangeForm(subjectToken))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_request", readOAuth2Error(t, resp).Error)
+}
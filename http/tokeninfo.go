@@ -4,14 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	log "github.com/Sirupsen/logrus"
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/xtraclabs/roll/roll"
-	rolltoken "github.com/xtraclabs/rollsecrets/token"
 	"net/http"
 )
 
 const (
-	//TokenInfoURI is the base uri for the token validation service.
+	//TokenInfoURI is the base uri for the token validation service. This predates the RFC 7662
+	//introspection endpoint and is retained for compatibility - new resource servers should use
+	//IntrospectURI.
 	TokenInfoURI = "/oauth2/tokeninfo"
 )
 
@@ -39,23 +39,24 @@ func handleTokenInfoGet(core *roll.Core, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	//Parse and validate the token
-	token, err := jwt.Parse(tokenString, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
+	//Introspect the access token - anything other than an active access token is
+	//reported as a bad request
+	ir, err := introspectAccessToken(core, tokenString)
 	if err != nil {
-		log.Info(err.Error())
-		w.WriteHeader(http.StatusBadRequest)
+		log.Info("Error introspecting token: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	//Panic is there's no aud claim
-	audience := token.Claims["aud"]
-	if audience == "" {
-		panic(errors.New("No aud claim in token"))
+	if !ir.Active {
+		log.Info("inactive token presented to tokeninfo")
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	//Return the token info
 	tokenInfo := &tokenInfo{
-		Audience: audience.(string),
+		Audience: ir.ClientID,
 	}
 
 	bytes, err := json.Marshal(&tokenInfo)
@@ -2,7 +2,10 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/roll/roll/mocks"
 	"github.com/xtraclabs/rollsecrets/secrets"
@@ -51,7 +54,7 @@ func TestValidAccessToken(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -65,6 +68,9 @@ func TestValidAccessToken(t *testing.T) {
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
 	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(false, nil)
+
 	token, err := rolltoken.GenerateToken("a-subject", "", returnVal.ClientID, returnVal.ApplicationName, privateKey)
 	assert.Nil(t, err)
 
@@ -80,3 +86,50 @@ func TestValidAccessToken(t *testing.T) {
 	assert.Equal(t, "1111-2222-3333333-4444444", ti.Audience)
 
 }
+
+func TestRevokedAccessToken(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
+	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
+
+	revocationRepoMock := coreConfig.RevocationRepo.(*mocks.RevocationRepo)
+	revocationRepoMock.On("IsTokenRevoked", mock.Anything).Return(true, nil)
+
+	token, err := rolltoken.GenerateToken("a-subject", "", "1111-2222-3333333-4444444", "fight club", privateKey)
+	assert.Nil(t, err)
+
+	resp, err := http.Get(addr + TokenInfoURI + "?access_token=" + token)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAccessTokenWithoutAudience(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	privateKey, _, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	signingKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+	assert.Nil(t, err)
+
+	token := jwt.New(jwt.SigningMethodRS256)
+	token.Claims["sub"] = "a-subject"
+	tokenString, err := token.SignedString(signingKey)
+	assert.Nil(t, err)
+
+	secretsMock := coreConfig.SecretsRepo.(*mocks.SecretsRepo)
+	secretsMock.On("RetrievePublicKeyForApp", mock.Anything).Return("", errors.New("no key"))
+
+	resp, err := http.Get(addr + TokenInfoURI + "?access_token=" + tokenString)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/roll/roll/mocks"
 	"github.com/xtraclabs/rollsecrets/secrets"
@@ -104,7 +105,7 @@ func TestPWGrantLoginFailure(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
@@ -120,7 +121,8 @@ func TestPWGrantLoginFailure(t *testing.T) {
 
 	assert.True(t, loginCalled)
 	assert.Nil(t, err)
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_grant", readOAuth2Error(t, resp).Error)
 }
 
 func TestPWGrantLoginCallError(t *testing.T) {
@@ -133,7 +135,7 @@ func TestPWGrantLoginCallError(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:77",
 	}
 
@@ -170,7 +172,7 @@ func TestPWGrantLoginOk(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
@@ -184,6 +186,9 @@ func TestPWGrantLoginOk(t *testing.T) {
 	secretsMock.On("RetrievePrivateKeyForApp", "1111-2222-3333333-4444444").Return(privateKey, nil)
 	secretsMock.On("RetrievePublicKeyForApp", "1111-2222-3333333-4444444").Return(publicKey, nil)
 
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
 	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
 		url.Values{"grant_type": {"password"},
 			"client_id":     {"1111-2222-3333333-4444444"},
@@ -201,6 +206,7 @@ func TestPWGrantLoginOk(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, jsonResponse.AccessToken != "")
 	assert.True(t, jsonResponse.TokenType == "Bearer")
+	assert.Equal(t, "steve", jsonResponse.RefreshToken)
 
 	token, err := jwt.Parse(jsonResponse.AccessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
 	assert.Nil(t, err)
@@ -229,8 +235,9 @@ func TestPWGrantLoginOkAdminScope(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://" + lsURL.Host,
+		AllowedScopes:   "admin",
 	}
 
 	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
@@ -246,6 +253,9 @@ func TestPWGrantLoginOkAdminScope(t *testing.T) {
 	adminRepoMock := coreConfig.AdminRepo.(*mocks.AdminRepo)
 	adminRepoMock.On("IsAdmin", "abc").Return(true, nil)
 
+	refreshTokenRepoMock := coreConfig.RefreshTokenRepo.(*mocks.RefreshTokenRepo)
+	refreshTokenRepoMock.On("StoreRefreshToken", mock.Anything).Return(nil)
+
 	resp, err := http.PostForm(addr+OAuth2TokenBaseURI,
 		url.Values{"grant_type": {"password"},
 			"client_id":     {"1111-2222-3333333-4444444"},
@@ -264,6 +274,7 @@ func TestPWGrantLoginOkAdminScope(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, jsonResponse.AccessToken != "")
 	assert.True(t, jsonResponse.TokenType == "Bearer")
+	assert.Equal(t, "steve", jsonResponse.RefreshToken)
 
 	token, err := jwt.Parse(jsonResponse.AccessToken, rolltoken.GenerateKeyExtractionFunction(core.SecretsRepo))
 	assert.Nil(t, err)
@@ -292,7 +303,7 @@ func TestPWGrantLoginOkInvalidScope(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "not for browser clients",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://" + lsURL.Host,
 	}
 
@@ -319,7 +330,8 @@ func TestPWGrantLoginOkInvalidScope(t *testing.T) {
 
 	assert.True(t, loginCalled)
 	assert.Nil(t, err)
-	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid_scope", readOAuth2Error(t, resp).Error)
 
 }
 
@@ -354,7 +366,7 @@ func TestPWGrantInvalidClientSecret(t *testing.T) {
 		ClientID:        "1111-2222-3333333-4444444",
 		ApplicationName: "fight club",
 		ClientSecret:    "hax0r",
-		RedirectURI:     "http://localhost:3000/ab",
+		RedirectURIs:    "http://localhost:3000/ab",
 		LoginProvider:   "xtrac://localhost:9000",
 	}
 
@@ -371,5 +383,5 @@ func TestPWGrantInvalidClientSecret(t *testing.T) {
 	assert.Nil(t, err)
 	body := responseAsString(t, resp)
 	assert.True(t, strings.Contains(body, "Invalid application details"))
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/roll"
+	"net/http"
+)
+
+//TrustedIssuersURI is the base uri for managing the issuers whose JWT bearer assertions an application
+//accepts - the client id of the application follows the base uri
+const TrustedIssuersURI = "/v1/trustedissuers/"
+
+func handleTrustedIssuers(core *roll.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleTrustedIssuersGet(core, w, r)
+		case "PUT":
+			handleTrustedIssuersPut(core, w, r)
+		case "DELETE":
+			handleTrustedIssuersDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		}
+	})
+}
+
+func handleTrustedIssuersGet(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app := ownedApplication(core, w, r, TrustedIssuersURI)
+	if app == nil {
+		return
+	}
+
+	issuers, err := core.ListTrustedIssuers(app.ClientID)
+	if err != nil {
+		log.Info("Error listing trusted issuers: ", err.Error())
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if issuers == nil {
+		issuers = []roll.TrustedIssuer{}
+	}
+
+	respondOk(w, issuers)
+}
+
+func handleTrustedIssuersPut(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app := ownedApplication(core, w, r, TrustedIssuersURI)
+	if app == nil {
+		return
+	}
+
+	var ti roll.TrustedIssuer
+	if err := parseRequest(r, &ti); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	//The application is identified by the uri, not the request body
+	ti.ClientID = app.ClientID
+
+	if err := ti.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := core.StoreTrustedIssuer(&ti); err != nil {
+		switch err.(type) {
+		case roll.TrustedIssuerOwnerError:
+			respondError(w, http.StatusConflict, err)
+		default:
+			log.Info("Error storing trusted issuer: ", err.Error())
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	respondOk(w, nil)
+}
+
+func handleTrustedIssuersDelete(core *roll.Core, w http.ResponseWriter, r *http.Request) {
+	app := ownedApplication(core, w, r, TrustedIssuersURI)
+	if app == nil {
+		return
+	}
+
+	issuer := r.URL.Query().Get("issuer")
+	audience := r.URL.Query().Get("audience")
+	if issuer == "" || audience == "" {
+		respondError(w, http.StatusBadRequest, errors.New("issuer and audience query parameters must be specified"))
+		return
+	}
+
+	if err := core.DeleteTrustedIssuer(app.ClientID, issuer, audience); err != nil {
+		switch err.(type) {
+		case roll.NoSuchTrustedIssuerError:
+			respondNotFound(w)
+		default:
+			log.Info("Error deleting trusted issuer: ", err.Error())
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	respondOk(w, nil)
+}
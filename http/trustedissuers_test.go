@@ -0,0 +1,137 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"github.com/xtraclabs/roll/roll/mocks"
+	"github.com/xtraclabs/rollsecrets/secrets"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+const trustedIssuerTestClientID = "1111-2222-3333333-4444444"
+
+func setupTrustedIssuersTestApp(coreConfig *roll.CoreConfig) *mocks.TrustedIssuerRepo {
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("RetrieveApplication", trustedIssuerTestClientID, "rolltest", false).Return(&roll.Application{ClientID: trustedIssuerTestClientID}, nil)
+
+	return coreConfig.TrustedIssuerRepo.(*mocks.TrustedIssuerRepo)
+}
+
+func TestTrustedIssuersList(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	trustedIssuerRepoMock := setupTrustedIssuersTestApp(coreConfig)
+	trustedIssuerRepoMock.On("ListTrustedIssuers", trustedIssuerTestClientID).Return([]roll.TrustedIssuer{
+		{ClientID: trustedIssuerTestClientID, Issuer: trustedIssuer, Audience: trustedAudience},
+	}, nil)
+
+	resp := TestHTTPGetWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var issuers []roll.TrustedIssuer
+	err := json.Unmarshal([]byte(responseAsString(t, resp)), &issuers)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(issuers)) {
+		assert.Equal(t, trustedIssuer, issuers[0].Issuer)
+	}
+}
+
+func TestTrustedIssuersAppNotFound(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	appRepoMock := coreConfig.ApplicationRepo.(*mocks.ApplicationRepo)
+	appRepoMock.On("RetrieveApplication", trustedIssuerTestClientID, "rolltest", false).Return(nil, nil)
+
+	resp := TestHTTPGetWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestTrustedIssuersPut(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	_, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	//The client id comes from the uri, whatever the body says
+	expected := &roll.TrustedIssuer{
+		ClientID:      trustedIssuerTestClientID,
+		Issuer:        trustedIssuer,
+		Audience:      trustedAudience,
+		PublicKeys:    publicKey,
+		AllowedScopes: "read",
+	}
+
+	trustedIssuerRepoMock := setupTrustedIssuersTestApp(coreConfig)
+	trustedIssuerRepoMock.On("StoreTrustedIssuer", expected).Return(nil)
+
+	body := *expected
+	body.ClientID = "another-app"
+
+	resp := TestHTTPPutWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID, body)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	trustedIssuerRepoMock.AssertExpectations(t)
+}
+
+func TestTrustedIssuersPutInvalid(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	setupTrustedIssuersTestApp(coreConfig)
+
+	resp := TestHTTPPutWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID,
+		roll.TrustedIssuer{Issuer: trustedIssuer, Audience: trustedAudience, PublicKeys: "not a key"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTrustedIssuersPutOwnedByAnotherApp(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	_, publicKey, err := secrets.GenerateKeyPair()
+	assert.Nil(t, err)
+
+	ti := roll.TrustedIssuer{
+		ClientID:   trustedIssuerTestClientID,
+		Issuer:     trustedIssuer,
+		Audience:   trustedAudience,
+		PublicKeys: publicKey,
+	}
+
+	trustedIssuerRepoMock := setupTrustedIssuersTestApp(coreConfig)
+	trustedIssuerRepoMock.On("StoreTrustedIssuer", &ti).Return(roll.TrustedIssuerOwnerError{})
+
+	resp := TestHTTPPutWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID, ti)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestTrustedIssuersDelete(t *testing.T) {
+	core, coreConfig := NewTestCore()
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	trustedIssuerRepoMock := setupTrustedIssuersTestApp(coreConfig)
+	trustedIssuerRepoMock.On("DeleteTrustedIssuer", trustedIssuerTestClientID, trustedIssuer, trustedAudience).Return(nil)
+	trustedIssuerRepoMock.On("DeleteTrustedIssuer", trustedIssuerTestClientID, "unknown", trustedAudience).Return(roll.NoSuchTrustedIssuerError{})
+
+	query := url.Values{"issuer": {trustedIssuer}, "audience": {trustedAudience}}
+	resp := TestHTTPDeleteWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID+"?"+query.Encode(), nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	query.Set("issuer", "unknown")
+	resp = TestHTTPDeleteWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID+"?"+query.Encode(), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = TestHTTPDeleteWithRollSubject(t, addr+TrustedIssuersURI+trustedIssuerTestClientID, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
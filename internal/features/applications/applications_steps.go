@@ -36,7 +36,7 @@ func init() {
 		app = roll.Application{
 			ApplicationName: "int test app name",
 			DeveloperEmail:  dev.Email,
-			RedirectURI:     "http://localhost:3000/ab",
+			RedirectURIs:    "http://localhost:3000/ab",
 			LoginProvider:   "xtrac://localhost:9000",
 		}
 	})
@@ -61,7 +61,7 @@ func init() {
 	Then(`^the details associated with the application can be retrieved$`, func() {
 		assert.Equal(T, app.ApplicationName, retrievedApp.ApplicationName)
 		assert.Equal(T, app.DeveloperEmail, retrievedApp.DeveloperEmail)
-		assert.Equal(T, app.RedirectURI, retrievedApp.RedirectURI)
+		assert.Equal(T, app.RedirectURIs, retrievedApp.RedirectURIs)
 		assert.Equal(T, app.LoginProvider, retrievedApp.LoginProvider)
 		assert.Equal(T, clientId, retrievedApp.ClientID)
 		assert.True(T, len(retrievedApp.ClientSecret) > 0)
@@ -95,7 +95,7 @@ func init() {
 	})
 
 	And(`^there are updates to make to the application defnition$`, func() {
-		app.RedirectURI = "http://localhost:3000/son_of_callback"
+		app.RedirectURIs = "http://localhost:3000/son_of_callback"
 	})
 
 	Then(`^the application can be updated$`, func() {
@@ -105,7 +105,7 @@ func init() {
 
 	And(`^the updates are reflected when retrieving the application definition anew$`, func() {
 		retrieveAppDefinition(clientId, &retrievedApp)
-		assert.Equal(T, "http://localhost:3000/son_of_callback", retrievedApp.RedirectURI)
+		assert.Equal(T, "http://localhost:3000/son_of_callback", retrievedApp.RedirectURIs)
 	})
 
 }
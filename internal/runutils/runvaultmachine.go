@@ -143,6 +143,7 @@ func RunVaultAndRoll() chan bool {
 		os.Setenv("VAULT_ADDR", "http://localhost:8200")
 
 		coreConfig := rollsvcs.DefaultUnsecureConfig()
+		coreConfig.IssuerBaseURL = "http://localhost:3000"
 		rollsvcs.RunRoll(3000, coreConfig)
 	}()
 
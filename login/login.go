@@ -2,10 +2,12 @@ package login
 
 import "fmt"
 
-//LoginKit defines the functions needed to form and execute a login request
+//LoginKit defines the functions needed to form and execute a login request, and to describe the
+//user authenticated by a successful login using OpenID Connect standard claims
 type LoginKit interface {
 	RequestBuilder(string, string) string
 	EndpointBuilder(string) string
+	UserClaims(string, []byte) map[string]interface{}
 }
 
 var loginKits map[string]LoginKit
@@ -38,6 +40,15 @@ func (xt *XtracLoginKit) EndpointBuilder(hostportSpec string) string {
 	return fmt.Sprintf("http://%s/XtracWeb/services/Login", hostportSpec)
 }
 
+//UserClaims returns the claims for the operator logged into XTRAC. The loginXt response does not
+//describe the operator beyond confirming the login, so the claims are based on the operator name.
+func (xt *XtracLoginKit) UserClaims(username string, loginResponse []byte) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":                username,
+		"preferred_username": username,
+	}
+}
+
 //GetLoginKit returns the kit for the given provider, if one is present in the loginKits map.
 func GetLoginKit(provider string) LoginKit {
 	return loginKits[provider]
@@ -9,19 +9,32 @@ import (
 	"github.com/xtraclabs/roll/dbutil"
 	"github.com/xtraclabs/roll/roll"
 	"github.com/xtraclabs/rollsecrets/secrets"
+	"strconv"
 )
 
 const (
-	ClientID         = "ClientID"
-	ApplicationName  = "ApplicationName"
-	ClientSecret     = "ClientSecret"
-	DeveloperEmail   = "DeveloperEmail"
-	DeveloperID      = "DeveloperID"
-	RedirectUri      = "RedirectUri"
-	LoginProvider    = "LoginProvider"
-	JWTFlowPublicKey = "JWTFlowPublicKey"
-	JWTFlowIssuer    = "JWTFlowIssuer"
-	JWTFlowAudience  = "JWTFlowAudience"
+	ClientID            = "ClientID"
+	ApplicationName     = "ApplicationName"
+	ClientSecret        = "ClientSecret"
+	DeveloperEmail      = "DeveloperEmail"
+	DeveloperID         = "DeveloperID"
+	RedirectUri         = "RedirectUri" //Holds the space delimited redirect URIs
+	LoginProvider       = "LoginProvider"
+	JWTFlowPublicKey    = "JWTFlowPublicKey"
+	JWTFlowIssuer       = "JWTFlowIssuer"
+	JWTFlowAudience     = "JWTFlowAudience"
+	AllowedScopes       = "AllowedScopes"
+	PublicClient        = "PublicClient"
+	AccessTokenLifetime = "AccessTokenLifetime"
+
+	TokenExchangeClients     = "TokenExchangeClients"
+	TokenEndpointAuthMethods = "TokenEndpointAuthMethods"
+	ClientAssertionPublicKey = "ClientAssertionPublicKey"
+	TokenSigningAlg          = "TokenSigningAlg"
+
+	RequirePushedAuthorizationRequests = "RequirePushedAuthorizationRequests"
+	GrantTypes                         = "GrantTypes"
+	ResponseTypes                      = "ResponseTypes"
 )
 
 //DynamoAppRepo presents a repository interface for storing and retrieving application definitions,
@@ -70,6 +83,51 @@ func CheckJWTCertParts(app *roll.Application) error {
 	return nil
 }
 
+//applicationFromItem builds an application definition from the attributes of a DynamoDB item
+func applicationFromItem(item map[string]*dynamodb.AttributeValue) *roll.Application {
+	return &roll.Application{
+		ClientID:            extractString(item[ClientID]),
+		ApplicationName:     extractString(item[ApplicationName]),
+		ClientSecret:        extractString(item[ClientSecret]),
+		DeveloperEmail:      extractString(item[DeveloperEmail]),
+		DeveloperID:         extractString(item[DeveloperID]),
+		RedirectURIs:        extractString(item[RedirectUri]),
+		LoginProvider:       extractString(item[LoginProvider]),
+		JWTFlowPublicKey:    extractString(item[JWTFlowPublicKey]),
+		JWTFlowIssuer:       extractString(item[JWTFlowIssuer]),
+		JWTFlowAudience:     extractString(item[JWTFlowAudience]),
+		AllowedScopes:       extractString(item[AllowedScopes]),
+		PublicClient:        extractBool(item[PublicClient]),
+		AccessTokenLifetime: extractInt64(item[AccessTokenLifetime]),
+
+		TokenExchangeClients:     extractString(item[TokenExchangeClients]),
+		TokenEndpointAuthMethods: extractString(item[TokenEndpointAuthMethods]),
+		ClientAssertionPublicKey: extractString(item[ClientAssertionPublicKey]),
+		TokenSigningAlg:          extractString(item[TokenSigningAlg]),
+
+		RequirePushedAuthorizationRequests: extractBool(item[RequirePushedAuthorizationRequests]),
+		GrantTypes:                         extractString(item[GrantTypes]),
+		ResponseTypes:                      extractString(item[ResponseTypes]),
+	}
+}
+
+//putOrDeleteString returns an update that sets a string attribute. Dynamo does not store empty strings, so
+//an empty value removes the attribute.
+func putOrDeleteString(value string) *dynamodb.AttributeValueUpdate {
+	if value == "" {
+		return &dynamodb.AttributeValueUpdate{
+			Action: aws.String(dynamodb.AttributeActionDelete),
+		}
+	}
+
+	return &dynamodb.AttributeValueUpdate{
+		Action: aws.String(dynamodb.AttributeActionPut),
+		Value: &dynamodb.AttributeValue{
+			S: aws.String(value),
+		},
+	}
+}
+
 //CreateApplication stores an application definition in DynamoDB
 func (dar *DynamoAppRepo) CreateApplication(app *roll.Application) error {
 	log.Info("create application")
@@ -96,13 +154,17 @@ func (dar *DynamoAppRepo) CreateApplication(app *roll.Application) error {
 	}
 
 	appAttrs := map[string]*dynamodb.AttributeValue{
-		ClientID:        {S: aws.String(app.ClientID)},
-		ApplicationName: {S: aws.String(app.ApplicationName)},
-		ClientSecret:    {S: aws.String(app.ClientSecret)},
-		DeveloperEmail:  {S: aws.String(app.DeveloperEmail)},
-		DeveloperID:     {S: aws.String(app.DeveloperID)},
-		RedirectUri:     {S: aws.String(app.RedirectURI)},
-		LoginProvider:   {S: aws.String(app.LoginProvider)},
+		ClientID:            {S: aws.String(app.ClientID)},
+		ApplicationName:     {S: aws.String(app.ApplicationName)},
+		ClientSecret:        {S: aws.String(app.ClientSecret)},
+		DeveloperEmail:      {S: aws.String(app.DeveloperEmail)},
+		DeveloperID:         {S: aws.String(app.DeveloperID)},
+		RedirectUri:         {S: aws.String(app.RedirectURIs)},
+		LoginProvider:       {S: aws.String(app.LoginProvider)},
+		PublicClient:        {BOOL: aws.Bool(app.PublicClient)},
+		AccessTokenLifetime: {N: aws.String(strconv.FormatInt(app.AccessTokenLifetime, 10))},
+
+		RequirePushedAuthorizationRequests: {BOOL: aws.Bool(app.RequirePushedAuthorizationRequests)},
 	}
 
 	if err := CheckJWTCertParts(app); err != nil {
@@ -124,6 +186,48 @@ func (dar *DynamoAppRepo) CreateApplication(app *roll.Application) error {
 		}
 	}
 
+	if app.AllowedScopes != "" {
+		appAttrs[AllowedScopes] = &dynamodb.AttributeValue{
+			S: aws.String(app.AllowedScopes),
+		}
+	}
+
+	if app.TokenExchangeClients != "" {
+		appAttrs[TokenExchangeClients] = &dynamodb.AttributeValue{
+			S: aws.String(app.TokenExchangeClients),
+		}
+	}
+
+	if app.TokenEndpointAuthMethods != "" {
+		appAttrs[TokenEndpointAuthMethods] = &dynamodb.AttributeValue{
+			S: aws.String(app.TokenEndpointAuthMethods),
+		}
+	}
+
+	if app.ClientAssertionPublicKey != "" {
+		appAttrs[ClientAssertionPublicKey] = &dynamodb.AttributeValue{
+			S: aws.String(app.ClientAssertionPublicKey),
+		}
+	}
+
+	if app.TokenSigningAlg != "" {
+		appAttrs[TokenSigningAlg] = &dynamodb.AttributeValue{
+			S: aws.String(app.TokenSigningAlg),
+		}
+	}
+
+	if app.GrantTypes != "" {
+		appAttrs[GrantTypes] = &dynamodb.AttributeValue{
+			S: aws.String(app.GrantTypes),
+		}
+	}
+
+	if app.ResponseTypes != "" {
+		appAttrs[ResponseTypes] = &dynamodb.AttributeValue{
+			S: aws.String(app.ResponseTypes),
+		}
+	}
+
 	params := &dynamodb.PutItemInput{
 		TableName:           aws.String("Application"),
 		ConditionExpression: aws.String("attribute_not_exists(ClientID)"),
@@ -169,12 +273,12 @@ func (dar *DynamoAppRepo) UpdateApplication(app *roll.Application, subjectID str
 		}
 	}
 
-	if app.RedirectURI != "" {
-		log.Info("Updating redirect uri: ", app.RedirectURI)
+	if app.RedirectURIs != "" {
+		log.Info("Updating redirect uris: ", app.RedirectURIs)
 		updateAttributes[RedirectUri] = &dynamodb.AttributeValueUpdate{
 			Action: aws.String(dynamodb.AttributeActionPut),
 			Value: &dynamodb.AttributeValue{
-				S: aws.String(app.RedirectURI),
+				S: aws.String(app.RedirectURIs),
 			},
 		}
 	}
@@ -216,6 +320,58 @@ func (dar *DynamoAppRepo) UpdateApplication(app *roll.Application, subjectID str
 		}
 	}
 
+	//Updates replace the allowed scopes, so an application can be left with none
+	log.Info("Updating allowed scopes: ", app.AllowedScopes)
+	updateAttributes[AllowedScopes] = putOrDeleteString(app.AllowedScopes)
+
+	log.Info("Updating public client: ", app.PublicClient)
+	updateAttributes[PublicClient] = &dynamodb.AttributeValueUpdate{
+		Action: aws.String(dynamodb.AttributeActionPut),
+		Value: &dynamodb.AttributeValue{
+			BOOL: aws.Bool(app.PublicClient),
+		},
+	}
+
+	log.Info("Updating access token lifetime: ", app.AccessTokenLifetime)
+	updateAttributes[AccessTokenLifetime] = &dynamodb.AttributeValueUpdate{
+		Action: aws.String(dynamodb.AttributeActionPut),
+		Value: &dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(app.AccessTokenLifetime, 10)),
+		},
+	}
+
+	log.Info("Updating token exchange clients: ", app.TokenExchangeClients)
+	updateAttributes[TokenExchangeClients] = putOrDeleteString(app.TokenExchangeClients)
+
+	log.Info("Updating token endpoint auth methods: ", app.TokenEndpointAuthMethods)
+	updateAttributes[TokenEndpointAuthMethods] = putOrDeleteString(app.TokenEndpointAuthMethods)
+	updateAttributes[ClientAssertionPublicKey] = putOrDeleteString(app.ClientAssertionPublicKey)
+
+	log.Info("Updating token signing alg: ", app.TokenSigningAlg)
+	updateAttributes[TokenSigningAlg] = putOrDeleteString(app.TokenSigningAlg)
+
+	log.Info("Updating require pushed authorization requests: ", app.RequirePushedAuthorizationRequests)
+	updateAttributes[RequirePushedAuthorizationRequests] = &dynamodb.AttributeValueUpdate{
+		Action: aws.String(dynamodb.AttributeActionPut),
+		Value: &dynamodb.AttributeValue{
+			BOOL: aws.Bool(app.RequirePushedAuthorizationRequests),
+		},
+	}
+
+	log.Info("Updating grant types: ", app.GrantTypes, " and response types: ", app.ResponseTypes)
+	updateAttributes[GrantTypes] = putOrDeleteString(app.GrantTypes)
+	updateAttributes[ResponseTypes] = putOrDeleteString(app.ResponseTypes)
+
+	if app.DeveloperEmail != "" {
+		log.Info("Updating developer email: ", app.DeveloperEmail)
+		updateAttributes[DeveloperEmail] = &dynamodb.AttributeValueUpdate{
+			Action: aws.String(dynamodb.AttributeActionPut),
+			Value: &dynamodb.AttributeValue{
+				S: aws.String(app.DeveloperEmail),
+			},
+		}
+	}
+
 	if app.ApplicationName != "" {
 		log.Info("Updating application name: ", app.ApplicationName)
 		updateAttributes[ApplicationName] = &dynamodb.AttributeValueUpdate{
@@ -239,6 +395,25 @@ func (dar *DynamoAppRepo) UpdateApplication(app *roll.Application, subjectID str
 	return err
 }
 
+//DeleteApplication removes an application definition. A NoSuchApplicationError is returned if there is
+//no application with the client id.
+func (dar *DynamoAppRepo) DeleteApplication(clientID string) error {
+	params := &dynamodb.DeleteItemInput{
+		TableName: aws.String("Application"),
+		Key: map[string]*dynamodb.AttributeValue{
+			ClientID: {S: aws.String(clientID)},
+		},
+		ConditionExpression: aws.String("attribute_exists(ClientID)"),
+	}
+
+	_, err := dar.client.DeleteItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		return roll.NoSuchApplicationError{}
+	}
+
+	return err
+}
+
 //RetrieveAppByNameAndDevEmail retrieves an application definition based on the combination of
 //application name and developer email
 func (dar *DynamoAppRepo) RetrieveAppByNameAndDevEmail(appName, email string) (*roll.Application, error) {
@@ -262,18 +437,7 @@ func (dar *DynamoAppRepo) RetrieveAppByNameAndDevEmail(appName, email string) (*
 		return nil, nil
 	}
 
-	return &roll.Application{
-		ClientID:         extractString(resp.Items[0][ClientID]),
-		ApplicationName:  extractString(resp.Items[0][ApplicationName]),
-		ClientSecret:     extractString(resp.Items[0][ClientSecret]),
-		DeveloperEmail:   extractString(resp.Items[0][DeveloperEmail]),
-		DeveloperID:      extractString(resp.Items[0][DeveloperID]),
-		RedirectURI:      extractString(resp.Items[0][RedirectUri]),
-		LoginProvider:    extractString(resp.Items[0][LoginProvider]),
-		JWTFlowPublicKey: extractString(resp.Items[0][JWTFlowPublicKey]),
-		JWTFlowIssuer:    extractString(resp.Items[0][JWTFlowIssuer]),
-		JWTFlowAudience:  extractString(resp.Items[0][JWTFlowAudience]),
-	}, nil
+	return applicationFromItem(resp.Items[0]), nil
 }
 
 //RetrieveApplication retrieves an application definition from DynamoDB. Note a nil
@@ -298,18 +462,7 @@ func (dar *DynamoAppRepo) RetrieveApplication(clientID string, subjectID string,
 	}
 
 	log.Info("Load struct with data returned from dynamo")
-	app := &roll.Application{
-		ClientID:         extractString(out.Item[ClientID]),
-		ApplicationName:  extractString(out.Item[ApplicationName]),
-		ClientSecret:     extractString(out.Item[ClientSecret]),
-		DeveloperEmail:   extractString(out.Item[DeveloperEmail]),
-		DeveloperID:      extractString(out.Item[DeveloperID]),
-		RedirectURI:      extractString(out.Item[RedirectUri]),
-		LoginProvider:    extractString(out.Item[LoginProvider]),
-		JWTFlowPublicKey: extractString(out.Item[JWTFlowPublicKey]),
-		JWTFlowIssuer:    extractString(out.Item[JWTFlowIssuer]),
-		JWTFlowAudience:  extractString(out.Item[JWTFlowAudience]),
-	}
+	app := applicationFromItem(out.Item)
 
 	if !adminScope && app.DeveloperID != subjectID {
 		return nil, roll.NotAuthorizedToReadApp{}
@@ -339,18 +492,7 @@ func (dar *DynamoAppRepo) SystemRetrieveApplication(clientID string) (*roll.Appl
 	}
 
 	log.Info("Load struct with data returned from dynamo")
-	return &roll.Application{
-		ClientID:         extractString(out.Item[ClientID]),
-		ApplicationName:  extractString(out.Item[ApplicationName]),
-		ClientSecret:     extractString(out.Item[ClientSecret]),
-		DeveloperEmail:   extractString(out.Item[DeveloperEmail]),
-		DeveloperID:      extractString(out.Item[DeveloperID]),
-		RedirectURI:      extractString(out.Item[RedirectUri]),
-		LoginProvider:    extractString(out.Item[LoginProvider]),
-		JWTFlowPublicKey: extractString(out.Item[JWTFlowPublicKey]),
-		JWTFlowIssuer:    extractString(out.Item[JWTFlowIssuer]),
-		JWTFlowAudience:  extractString(out.Item[JWTFlowAudience]),
-	}, nil
+	return applicationFromItem(out.Item), nil
 }
 
 func (dar *DynamoAppRepo) SystemRetrieveApplicationByJWTFlowAudience(audience string) (*roll.Application, error) {
@@ -398,20 +540,7 @@ func (dar *DynamoAppRepo) ListApplications(subjectID string, adminScope bool) ([
 	var apps []roll.Application
 
 	for _, item := range resp.Items {
-		application := roll.Application{
-			ClientID:         extractString(item[ClientID]),
-			ApplicationName:  extractString(item[ApplicationName]),
-			ClientSecret:     extractString(item[ClientSecret]),
-			DeveloperEmail:   extractString(item[DeveloperEmail]),
-			DeveloperID:      extractString(item[DeveloperID]),
-			RedirectURI:      extractString(item[RedirectUri]),
-			LoginProvider:    extractString(item[LoginProvider]),
-			JWTFlowPublicKey: extractString(item[JWTFlowPublicKey]),
-			JWTFlowIssuer:    extractString(item[JWTFlowIssuer]),
-			JWTFlowAudience:  extractString(item[JWTFlowAudience]),
-		}
-
-		apps = append(apps, application)
+		apps = append(apps, *applicationFromItem(item))
 	}
 	return apps, nil
 }
@@ -41,7 +41,7 @@ func TestListApps(t *testing.T) {
 		DeveloperEmail:  testDev.Email,
 		DeveloperID:     testDev.ID,
 		ApplicationName: "test app",
-		RedirectURI:     "http://foo.com/dev/null",
+		RedirectURIs:    "http://foo.com/dev/null",
 		LoginProvider:   "xtrac://loginhost:9000",
 	}
 
@@ -85,7 +85,7 @@ func TestUpdateApplication(t *testing.T) {
 		DeveloperEmail:  testDev.Email,
 		DeveloperID:     testDev.ID,
 		ApplicationName: appName,
-		RedirectURI:     "http://foo.com/dev/null",
+		RedirectURIs:    "http://foo.com/dev/null",
 		LoginProvider:   "xtrac://loginhost:9000",
 	}
 
@@ -104,7 +104,7 @@ func TestUpdateApplication(t *testing.T) {
 	assert.Equal(t, app.DeveloperEmail, retrieved.DeveloperEmail)
 	assert.Equal(t, app.DeveloperID, retrieved.DeveloperID)
 	assert.Equal(t, app.ApplicationName, retrieved.ApplicationName)
-	assert.Equal(t, app.RedirectURI, retrieved.RedirectURI)
+	assert.Equal(t, app.RedirectURIs, retrieved.RedirectURIs)
 	assert.Equal(t, app.LoginProvider, retrieved.LoginProvider)
 
 	t.Log("Update when not the owner generates an error")
@@ -135,7 +135,7 @@ func TestUpdateApplication(t *testing.T) {
 	assert.Equal(t, retrieved.DeveloperEmail, updated.DeveloperEmail)
 	assert.Equal(t, retrieved.DeveloperID, updated.DeveloperID)
 	assert.Equal(t, retrieved.ApplicationName, updated.ApplicationName)
-	assert.Equal(t, retrieved.RedirectURI, updated.RedirectURI)
+	assert.Equal(t, retrieved.RedirectURIs, updated.RedirectURIs)
 	assert.Equal(t, retrieved.LoginProvider, updated.LoginProvider)
 
 }
@@ -159,7 +159,7 @@ func TestRetrieveApplication(t *testing.T) {
 		DeveloperEmail:  testDev.Email,
 		DeveloperID:     testDev.ID,
 		ApplicationName: appName,
-		RedirectURI:     "http://foo.com/dev/null",
+		RedirectURIs:    "http://foo.com/dev/null",
 		LoginProvider:   "xtrac://loginhost:9000",
 	}
 
@@ -184,7 +184,7 @@ func TestRetrieveApplication(t *testing.T) {
 	assert.Equal(t, app.DeveloperEmail, retrieved.DeveloperEmail)
 	assert.Equal(t, app.DeveloperID, retrieved.DeveloperID)
 	assert.Equal(t, app.ApplicationName, retrieved.ApplicationName)
-	assert.Equal(t, app.RedirectURI, retrieved.RedirectURI)
+	assert.Equal(t, app.RedirectURIs, retrieved.RedirectURIs)
 	assert.Equal(t, app.LoginProvider, retrieved.LoginProvider)
 
 	_, err = appRepo.RetrieveApplication(clientID, "xxx", true)
@@ -0,0 +1,50 @@
+package repos
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+	"time"
+)
+
+//DynamoAssertionReplayRepo presents a repository interface for recording used JWT bearer assertions,
+//backed by DynamoDB
+type DynamoAssertionReplayRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoAssertionReplayRepo returns a new instance of type DynamoAssertionReplayRepo
+func NewDynamoAssertionReplayRepo() *DynamoAssertionReplayRepo {
+	return &DynamoAssertionReplayRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+//RecordAssertionUse records the use of an assertion. An AssertionReplayError is returned if the assertion
+//has been used before. Records of expired assertions may be overwritten, as time to live purges are lazy.
+func (dar *DynamoAssertionReplayRepo) RecordAssertionUse(issuer, tokenID string, expiresAt int64) error {
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(ddl.UsedAssertionTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			Issuer:    {S: aws.String(issuer)},
+			TokenID:   {S: aws.String(tokenID)},
+			ExpiresAt: {N: aws.String(strconv.FormatInt(expiresAt, 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(TokenID) OR ExpiresAt < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	}
+
+	_, err := dar.client.PutItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		log.Info("Assertion ", tokenID, " from ", issuer, " already used")
+		return roll.AssertionReplayError{}
+	}
+
+	return err
+}
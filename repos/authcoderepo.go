@@ -0,0 +1,125 @@
+package repos
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+)
+
+const (
+	CodeID               = "CodeID"
+	AccessTokenID        = "AccessTokenID"
+	AccessTokenExpiresAt = "AccessTokenExpiresAt"
+	RefreshTokenFamilyID = "RefreshTokenFamilyID"
+)
+
+//DynamoAuthCodeRepo presents a repository interface for recording issued authorization codes,
+//backed by DynamoDB
+type DynamoAuthCodeRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoAuthCodeRepo returns a new instance of type DynamoAuthCodeRepo
+func NewDynamoAuthCodeRepo() *DynamoAuthCodeRepo {
+	return &DynamoAuthCodeRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+//StoreAuthCode records an issued authorization code in DynamoDB
+func (acr *DynamoAuthCodeRepo) StoreAuthCode(code *roll.AuthCode) error {
+	params := &dynamodb.PutItemInput{
+		TableName:           aws.String(ddl.AuthCodeTableName),
+		ConditionExpression: aws.String("attribute_not_exists(CodeID)"),
+		Item: map[string]*dynamodb.AttributeValue{
+			CodeID:      {S: aws.String(code.CodeID)},
+			ClientID:    {S: aws.String(code.ClientID)},
+			RedirectUri: {S: aws.String(code.RedirectURI)},
+			ExpiresAt:   {N: aws.String(strconv.FormatInt(code.ExpiresAt, 10))},
+			Used:        {BOOL: aws.Bool(code.Used)},
+		},
+	}
+
+	_, err := acr.client.PutItem(params)
+	return err
+}
+
+//RetrieveAuthCode retrieves an authorization code record from DynamoDB. Note a nil pointer is returned
+//if there is no record for the given code id
+func (acr *DynamoAuthCodeRepo) RetrieveAuthCode(codeID string) (*roll.AuthCode, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.AuthCodeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			CodeID: {S: aws.String(codeID)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	out, err := acr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return &roll.AuthCode{
+		CodeID:               extractString(out.Item[CodeID]),
+		ClientID:             extractString(out.Item[ClientID]),
+		RedirectURI:          extractString(out.Item[RedirectUri]),
+		ExpiresAt:            extractInt64(out.Item[ExpiresAt]),
+		Used:                 extractBool(out.Item[Used]),
+		AccessTokenID:        extractString(out.Item[AccessTokenID]),
+		AccessTokenExpiresAt: extractInt64(out.Item[AccessTokenExpiresAt]),
+		RefreshTokenFamilyID: extractString(out.Item[RefreshTokenFamilyID]),
+	}, nil
+}
+
+//MarkAuthCodeUsed flags the code as used. The update is conditional on the code not having
+//been used already so concurrent exchanges of the same code can be detected.
+func (acr *DynamoAuthCodeRepo) MarkAuthCodeUsed(codeID string) error {
+	params := &dynamodb.UpdateItemInput{
+		TableName: aws.String(ddl.AuthCodeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			CodeID: {S: aws.String(codeID)},
+		},
+		UpdateExpression:    aws.String("SET Used = :used"),
+		ConditionExpression: aws.String("attribute_exists(CodeID) AND Used = :unused"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":used":   {BOOL: aws.Bool(true)},
+			":unused": {BOOL: aws.Bool(false)},
+		},
+	}
+
+	_, err := acr.client.UpdateItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		log.Info("Authorization code already used: ", codeID)
+		return roll.AuthCodeReuseError{}
+	}
+
+	return err
+}
+
+//RecordAuthCodeTokens notes the tokens issued in exchange for the code
+func (acr *DynamoAuthCodeRepo) RecordAuthCodeTokens(codeID, accessTokenID string, accessTokenExpiresAt int64, refreshTokenFamilyID string) error {
+	params := &dynamodb.UpdateItemInput{
+		TableName: aws.String(ddl.AuthCodeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			CodeID: {S: aws.String(codeID)},
+		},
+		UpdateExpression: aws.String("SET AccessTokenID = :atid, AccessTokenExpiresAt = :atexp, RefreshTokenFamilyID = :family"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":atid":   {S: aws.String(accessTokenID)},
+			":atexp":  {N: aws.String(strconv.FormatInt(accessTokenExpiresAt, 10))},
+			":family": {S: aws.String(refreshTokenFamilyID)},
+		},
+	}
+
+	_, err := acr.client.UpdateItem(params)
+	return err
+}
@@ -0,0 +1,124 @@
+package repos
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+)
+
+const (
+	GrantedAt = "GrantedAt"
+)
+
+//DynamoConsentRepo presents a repository interface for recording user consent, backed by DynamoDB
+type DynamoConsentRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoConsentRepo returns a new instance of type DynamoConsentRepo
+func NewDynamoConsentRepo() *DynamoConsentRepo {
+	return &DynamoConsentRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func consentFromItem(item map[string]*dynamodb.AttributeValue) *roll.Consent {
+	return &roll.Consent{
+		Subject:   extractString(item[Subject]),
+		ClientID:  extractString(item[ClientID]),
+		Scope:     extractString(item[Scope]),
+		GrantedAt: extractInt64(item[GrantedAt]),
+	}
+}
+
+//StoreConsent stores or replaces the consent a user has given an application
+func (dcr *DynamoConsentRepo) StoreConsent(consent *roll.Consent) error {
+	attrs := map[string]*dynamodb.AttributeValue{
+		Subject:   {S: aws.String(consent.Subject)},
+		ClientID:  {S: aws.String(consent.ClientID)},
+		GrantedAt: {N: aws.String(strconv.FormatInt(consent.GrantedAt, 10))},
+	}
+
+	//Dynamo does not allow empty string attributes
+	if consent.Scope != "" {
+		attrs[Scope] = &dynamodb.AttributeValue{S: aws.String(consent.Scope)}
+	}
+
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(ddl.ConsentTableName),
+		Item:      attrs,
+	}
+
+	_, err := dcr.client.PutItem(params)
+	return err
+}
+
+//RetrieveConsent retrieves the consent a user has given an application. Note a nil pointer is returned
+//if the user has not given the application consent
+func (dcr *DynamoConsentRepo) RetrieveConsent(subject, clientID string) (*roll.Consent, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.ConsentTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			Subject:  {S: aws.String(subject)},
+			ClientID: {S: aws.String(clientID)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	out, err := dcr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return consentFromItem(out.Item), nil
+}
+
+//ListConsents lists the consents a user has given
+func (dcr *DynamoConsentRepo) ListConsents(subject string) ([]roll.Consent, error) {
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(ddl.ConsentTableName),
+		KeyConditionExpression: aws.String("Subject=:subject"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":subject": {S: aws.String(subject)},
+		},
+	}
+
+	resp, err := dcr.client.Query(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var consents []roll.Consent
+	for _, item := range resp.Items {
+		consents = append(consents, *consentFromItem(item))
+	}
+
+	return consents, nil
+}
+
+//DeleteConsent removes the consent a user has given an application. A NoSuchConsentError is returned if
+//the user has not given the application consent.
+func (dcr *DynamoConsentRepo) DeleteConsent(subject, clientID string) error {
+	params := &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddl.ConsentTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			Subject:  {S: aws.String(subject)},
+			ClientID: {S: aws.String(clientID)},
+		},
+		ConditionExpression: aws.String("attribute_exists(Subject)"),
+	}
+
+	_, err := dcr.client.DeleteItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		return roll.NoSuchConsentError{}
+	}
+
+	return err
+}
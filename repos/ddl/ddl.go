@@ -18,6 +18,51 @@ const (
 	//DynamoDB table name for storing registered developers
 	DeveloperTableName = "Developer"
 
+	//DynamoDB table name for storing issued refresh tokens
+	RefreshTokenTableName = "RefreshToken"
+
+	//Index for looking up refresh tokens by family
+	FamilyIDIndex = "FamilyID-Index"
+
+	//DynamoDB table name for recording revoked tokens
+	RevokedTokenTableName = "RevokedToken"
+
+	//DynamoDB table name for recording issued authorization codes
+	AuthCodeTableName = "AuthCode"
+
+	//DynamoDB table name for recording application signing key versions
+	SigningKeyTableName = "SigningKey"
+
+	//DynamoDB table name for recording device authorization requests
+	DeviceAuthorizationTableName = "DeviceAuthorization"
+
+	//Index for looking up device authorizations by user code
+	UserCodeIndex = "UserCode-Index"
+
+	//DynamoDB table name for the trusted assertion issuer registry
+	TrustedIssuerTableName = "TrustedIssuer"
+
+	//Index for looking up trusted issuers by application
+	ClientIDIndex = "ClientID-Index"
+
+	//DynamoDB table name for recording used JWT bearer assertions
+	UsedAssertionTableName = "UsedAssertion"
+
+	//DynamoDB table name for the scope registry
+	ScopeTableName = "Scope"
+
+	//DynamoDB table name for recording user consent
+	ConsentTableName = "Consent"
+
+	//DynamoDB table name for the tokens used with the dynamic client registration endpoints
+	RegistrationTokenTableName = "RegistrationToken"
+
+	//DynamoDB table name for the protected resource registry
+	ProtectedResourceTableName = "ProtectedResource"
+
+	//DynamoDB table name for recording pushed authorization requests
+	PushedAuthorizationTableName = "PushedAuthorization"
+
 	email = "EMail"
 	devid = "ID"
 )
@@ -183,3 +228,492 @@ func CreateAdminTable() {
 
 	log.Info(resp)
 }
+
+func CreateRefreshTokenTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("TokenID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("FamilyID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("TokenID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(RefreshTokenTableName),
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(FamilyIDIndex),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{
+						AttributeName: aws.String("FamilyID"),
+						KeyType:       aws.String("HASH"),
+					},
+				},
+				Projection: &dynamodb.Projection{
+					ProjectionType: aws.String("KEYS_ONLY"),
+				},
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(1),
+					WriteCapacityUnits: aws.Int64(1),
+				},
+			},
+		},
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateRevokedTokenTable creates the table used to record revoked tokens. Items carry an ExpiresAt attribute
+//holding the epoch second the token expires - enable time to live on that attribute for the table to have
+//dynamo purge entries that are no longer needed.
+func CreateRevokedTokenTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("TokenID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("TokenID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(RevokedTokenTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateAuthCodeTable creates the table used to record issued authorization codes. As with the revoked
+//token table, time to live can be enabled on the ExpiresAt attribute to have dynamo purge old codes.
+func CreateAuthCodeTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("CodeID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("CodeID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(AuthCodeTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateSigningKeyTable creates the table used to record the versions of application signing keys
+func CreateSigningKeyTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ClientID"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("Version"),
+				AttributeType: aws.String("N"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ClientID"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("Version"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(SigningKeyTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateDeviceAuthorizationTable creates the table used to record device authorization requests. Time to
+//live can be enabled on the ExpiresAt attribute to have dynamo purge expired requests.
+func CreateDeviceAuthorizationTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("DeviceCode"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("UserCode"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("DeviceCode"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(DeviceAuthorizationTableName),
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(UserCodeIndex),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{
+						AttributeName: aws.String("UserCode"),
+						KeyType:       aws.String("HASH"),
+					},
+				},
+				Projection: &dynamodb.Projection{
+					ProjectionType: aws.String("KEYS_ONLY"),
+				},
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(1),
+					WriteCapacityUnits: aws.Int64(1),
+				},
+			},
+		},
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateTrustedIssuerTable creates the table used to register the assertion issuers trusted by applications
+func CreateTrustedIssuerTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("Issuer"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("Audience"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("ClientID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("Issuer"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("Audience"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(TrustedIssuerTableName),
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(ClientIDIndex),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{
+						AttributeName: aws.String("ClientID"),
+						KeyType:       aws.String("HASH"),
+					},
+				},
+				Projection: &dynamodb.Projection{
+					ProjectionType: aws.String("ALL"),
+				},
+				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(1),
+					WriteCapacityUnits: aws.Int64(1),
+				},
+			},
+		},
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateUsedAssertionTable creates the table used to record used JWT bearer assertions. Time to live can be
+//enabled on the ExpiresAt attribute to have dynamo purge expired assertions.
+func CreateUsedAssertionTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("Issuer"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("TokenID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("Issuer"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("TokenID"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(UsedAssertionTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateScopeTable creates the table used for the scope registry
+func CreateScopeTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ScopeName"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ScopeName"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(ScopeTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateConsentTable creates the table used to record the consent users give applications. Consents are
+//keyed by subject so a user's consents can be listed with a query.
+func CreateConsentTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("Subject"),
+				AttributeType: aws.String("S"),
+			},
+			{
+				AttributeName: aws.String("ClientID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("Subject"),
+				KeyType:       aws.String("HASH"),
+			},
+			{
+				AttributeName: aws.String("ClientID"),
+				KeyType:       aws.String("RANGE"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(ConsentTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateRegistrationTokenTable creates the table used to record initial access tokens and registration
+//access tokens
+func CreateRegistrationTokenTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("TokenID"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("TokenID"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(RegistrationTokenTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreateProtectedResourceTable creates the table used for the protected resource registry
+func CreateProtectedResourceTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("ResourceIdentifier"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("ResourceIdentifier"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(ProtectedResourceTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
+
+//CreatePushedAuthorizationTable creates the table used to record pushed authorization requests. Time to
+//live can be enabled on the ExpiresAt attribute to have dynamo purge expired requests.
+func CreatePushedAuthorizationTable() {
+	var svc *dynamodb.DynamoDB = dbutil.CreateDynamoDBClient()
+
+	params := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("RequestURI"),
+				AttributeType: aws.String("S"),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("RequestURI"),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+		TableName: aws.String(PushedAuthorizationTableName),
+	}
+
+	resp, err := svc.CreateTable(params)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Info(resp)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "github.com/xtraclabs/roll/repos/ddl"
+
+func main() {
+	ddl.DeleteTable(ddl.SigningKeyTableName)
+	ddl.CreateSigningKeyTable()
+}
@@ -24,10 +24,20 @@ create or replace table rolldb.application (
     developerEmail varchar(256) not null,
     developerId varchar(256) not null,
     loginProvider varchar(256) not null,
-    redirectUri varchar(512) not null,
+    redirectUri varchar(2048) not null,
     jwtFlowAudience varchar(256),
     jwtFlowIssuer varchar(256),
     jwtFlowPublicKey varchar(2048),
+    allowedScopes varchar(512) not null default '',
+    publicClient boolean not null default false,
+    accessTokenLifetime bigint not null default 0,
+    tokenExchangeClients varchar(1024) not null default '',
+    tokenEndpointAuthMethods varchar(256) not null default '',
+    clientAssertionPublicKey varchar(2048) not null default '',
+    tokenSigningAlg varchar(16) not null default '',
+    requirePushedAuthorizationRequests boolean not null default false,
+    grantTypes varchar(512) not null default '',
+    responseTypes varchar(64) not null default '',
     primary key(applicationName, developerEmail),
     unique(clientId)
 );
@@ -36,4 +46,164 @@ grant select, update, insert, delete
 on rolldb.application
 to rolluser;
 
+create or replace table rolldb.refresh_token (
+    tokenId varchar(100) primary key,
+    familyId varchar(100) not null,
+    clientId varchar(100) not null,
+    subject varchar(256) not null,
+    scope varchar(512),
+    resources varchar(2048),
+    expiresAt bigint not null,
+    used boolean not null default false,
+    revoked boolean not null default false,
+    index(familyId),
+    index(subject, clientId)
+);
+
+grant select, update, insert, delete
+on rolldb.refresh_token
+to rolluser;
+
+create or replace table rolldb.revoked_token (
+    tokenId varchar(100) primary key,
+    expiresAt bigint not null,
+    index(expiresAt)
+);
+
+grant select, update, insert, delete
+on rolldb.revoked_token
+to rolluser;
+
+create or replace table rolldb.auth_code (
+    codeId varchar(100) primary key,
+    clientId varchar(100) not null,
+    redirectUri varchar(512) not null,
+    expiresAt bigint not null,
+    used boolean not null default false,
+    accessTokenId varchar(100),
+    accessTokenExpiresAt bigint,
+    refreshTokenFamilyId varchar(100),
+    index(expiresAt)
+);
+
+grant select, update, insert, delete
+on rolldb.auth_code
+to rolluser;
+
+create or replace table rolldb.signing_key (
+    clientId varchar(100) not null,
+    version int not null,
+    keyId varchar(100) not null,
+    createdAt bigint not null,
+    retiresAt bigint not null default 0,
+    primary key(clientId, version),
+    unique(clientId, keyId)
+);
+
+grant select, update, insert, delete
+on rolldb.signing_key
+to rolluser;
+
+create or replace table rolldb.device_authorization (
+    deviceCode varchar(100) primary key,
+    userCode varchar(20) not null unique,
+    clientId varchar(100) not null,
+    scope varchar(1024),
+    status varchar(20) not null,
+    subject varchar(100),
+    expiresAt bigint not null,
+    pollInterval bigint not null,
+    lastPolledAt bigint not null default 0,
+    index(expiresAt)
+);
+
+grant select, update, insert, delete
+on rolldb.device_authorization
+to rolluser;
+
+create or replace table rolldb.trusted_issuer (
+    issuer varchar(255) not null,
+    audience varchar(255) not null,
+    clientId varchar(100) not null,
+    publicKeys text not null,
+    allowedSubjects varchar(1024) not null default '',
+    allowedScopes varchar(1024) not null default '',
+    primary key(issuer, audience),
+    index(clientId)
+);
+
+grant select, update, insert, delete
+on rolldb.trusted_issuer
+to rolluser;
+
+create or replace table rolldb.used_assertion (
+    issuer varchar(255) not null,
+    tokenId varchar(255) not null,
+    expiresAt bigint not null,
+    primary key(issuer, tokenId),
+    index(expiresAt)
+);
+
+grant select, update, insert, delete
+on rolldb.used_assertion
+to rolluser;
+
+create or replace table rolldb.scope (
+    name varchar(255) not null primary key,
+    description varchar(1024) not null
+);
+
+grant select, update, insert, delete
+on rolldb.scope
+to rolluser;
+
+create or replace table rolldb.consent (
+    subject varchar(256) not null,
+    clientId varchar(100) not null,
+    scope varchar(1024) not null default '',
+    grantedAt bigint not null,
+    primary key(subject, clientId)
+);
+
+grant select, update, insert, delete
+on rolldb.consent
+to rolluser;
+
+create or replace table rolldb.registration_token (
+    tokenId varchar(100) not null primary key,
+    secretHash varchar(100) not null,
+    tokenType varchar(20) not null,
+    clientId varchar(100) not null default '',
+    issuedBy varchar(256) not null,
+    description varchar(1024) not null default '',
+    issuedAt bigint not null,
+    expiresAt bigint not null default 0,
+    index(tokenType)
+);
+
+grant select, update, insert, delete
+on rolldb.registration_token
+to rolluser;
+
+create or replace table rolldb.protected_resource (
+    identifier varchar(512) not null primary key,
+    description varchar(1024) not null
+);
+
+grant select, update, insert, delete
+on rolldb.protected_resource
+to rolluser;
+
+create or replace table rolldb.pushed_authorization (
+    requestUri varchar(256) not null primary key,
+    clientId varchar(100) not null,
+    params text not null,
+    expiresAt bigint not null,
+    index(expiresAt)
+);
+
+grant select, update, insert, delete
+on rolldb.pushed_authorization
+to rolluser;
+
 /* TODO - add proper constraints once initial mariadb support is in place. */
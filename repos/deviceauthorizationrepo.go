@@ -0,0 +1,175 @@
+package repos
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+)
+
+const (
+	DeviceCode          = "DeviceCode"
+	UserCode            = "UserCode"
+	AuthorizationStatus = "AuthorizationStatus"
+	PollInterval        = "PollInterval"
+	LastPolledAt        = "LastPolledAt"
+)
+
+//DynamoDeviceAuthorizationRepo presents a repository interface for recording device authorization
+//requests, backed by DynamoDB
+type DynamoDeviceAuthorizationRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoDeviceAuthorizationRepo returns a new instance of type DynamoDeviceAuthorizationRepo
+func NewDynamoDeviceAuthorizationRepo() *DynamoDeviceAuthorizationRepo {
+	return &DynamoDeviceAuthorizationRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func deviceAuthorizationFromItem(item map[string]*dynamodb.AttributeValue) *roll.DeviceAuthorization {
+	return &roll.DeviceAuthorization{
+		DeviceCode:   extractString(item[DeviceCode]),
+		UserCode:     extractString(item[UserCode]),
+		ClientID:     extractString(item[ClientID]),
+		Scope:        extractString(item[Scope]),
+		Status:       extractString(item[AuthorizationStatus]),
+		ExpiresAt:    extractInt64(item[ExpiresAt]),
+		Subject:      extractString(item[Subject]),
+		Interval:     extractInt64(item[PollInterval]),
+		LastPolledAt: extractInt64(item[LastPolledAt]),
+	}
+}
+
+//StoreDeviceAuthorization records a device authorization request in DynamoDB
+func (dar *DynamoDeviceAuthorizationRepo) StoreDeviceAuthorization(da *roll.DeviceAuthorization) error {
+	attrs := map[string]*dynamodb.AttributeValue{
+		DeviceCode:          {S: aws.String(da.DeviceCode)},
+		UserCode:            {S: aws.String(da.UserCode)},
+		ClientID:            {S: aws.String(da.ClientID)},
+		AuthorizationStatus: {S: aws.String(da.Status)},
+		ExpiresAt:           {N: aws.String(strconv.FormatInt(da.ExpiresAt, 10))},
+		PollInterval:        {N: aws.String(strconv.FormatInt(da.Interval, 10))},
+		LastPolledAt:        {N: aws.String(strconv.FormatInt(da.LastPolledAt, 10))},
+	}
+
+	//Dynamo does not allow empty string attributes
+	if da.Scope != "" {
+		attrs[Scope] = &dynamodb.AttributeValue{S: aws.String(da.Scope)}
+	}
+
+	if da.Subject != "" {
+		attrs[Subject] = &dynamodb.AttributeValue{S: aws.String(da.Subject)}
+	}
+
+	params := &dynamodb.PutItemInput{
+		TableName:           aws.String(ddl.DeviceAuthorizationTableName),
+		ConditionExpression: aws.String("attribute_not_exists(DeviceCode)"),
+		Item:                attrs,
+	}
+
+	_, err := dar.client.PutItem(params)
+	return err
+}
+
+//RetrieveDeviceAuthorization retrieves a device authorization from DynamoDB. Note a nil pointer is returned
+//if there is no record for the given device code
+func (dar *DynamoDeviceAuthorizationRepo) RetrieveDeviceAuthorization(deviceCode string) (*roll.DeviceAuthorization, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.DeviceAuthorizationTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			DeviceCode: {S: aws.String(deviceCode)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	out, err := dar.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return deviceAuthorizationFromItem(out.Item), nil
+}
+
+//RetrieveDeviceAuthorizationByUserCode retrieves a device authorization from DynamoDB using the user code
+//index. Note a nil pointer is returned if there is no record for the given user code
+func (dar *DynamoDeviceAuthorizationRepo) RetrieveDeviceAuthorizationByUserCode(userCode string) (*roll.DeviceAuthorization, error) {
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(ddl.DeviceAuthorizationTableName),
+		IndexName:              aws.String(ddl.UserCodeIndex),
+		KeyConditionExpression: aws.String("UserCode=:userCode"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userCode": {S: aws.String(userCode)},
+		},
+	}
+
+	resp, err := dar.client.Query(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp == nil || *resp.Count == 0 {
+		return nil, nil
+	}
+
+	//The index is eventually consistent, so reread the item to get its current status
+	return dar.RetrieveDeviceAuthorization(extractString(resp.Items[0][DeviceCode]))
+}
+
+//RecordDeviceAuthorizationPoll notes when the device last polled, and the interval it must now observe
+func (dar *DynamoDeviceAuthorizationRepo) RecordDeviceAuthorizationPoll(deviceCode string, polledAt, interval int64) error {
+	params := &dynamodb.UpdateItemInput{
+		TableName: aws.String(ddl.DeviceAuthorizationTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			DeviceCode: {S: aws.String(deviceCode)},
+		},
+		UpdateExpression:    aws.String("SET LastPolledAt = :polledAt, PollInterval = :interval"),
+		ConditionExpression: aws.String("attribute_exists(DeviceCode)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":polledAt": {N: aws.String(strconv.FormatInt(polledAt, 10))},
+			":interval": {N: aws.String(strconv.FormatInt(interval, 10))},
+		},
+	}
+
+	_, err := dar.client.UpdateItem(params)
+	return err
+}
+
+//UpdateDeviceAuthorizationStatus moves the device authorization to a new status. The update is conditional
+//on the current status so concurrent approvals or token requests can be detected.
+func (dar *DynamoDeviceAuthorizationRepo) UpdateDeviceAuthorizationStatus(deviceCode, fromStatus, toStatus, subject string) error {
+	params := &dynamodb.UpdateItemInput{
+		TableName: aws.String(ddl.DeviceAuthorizationTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			DeviceCode: {S: aws.String(deviceCode)},
+		},
+		UpdateExpression:    aws.String("SET AuthorizationStatus = :to"),
+		ConditionExpression: aws.String("attribute_exists(DeviceCode) AND AuthorizationStatus = :from"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":to":   {S: aws.String(toStatus)},
+			":from": {S: aws.String(fromStatus)},
+		},
+	}
+
+	//Dynamo does not allow empty string attributes
+	if subject != "" {
+		params.UpdateExpression = aws.String("SET AuthorizationStatus = :to, Subject = :subject")
+		params.ExpressionAttributeValues[":subject"] = &dynamodb.AttributeValue{S: aws.String(subject)}
+	}
+
+	_, err := dar.client.UpdateItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		log.Info("Device authorization ", deviceCode, " not in status ", fromStatus)
+		return roll.DeviceAuthorizationStatusError{}
+	}
+
+	return err
+}
@@ -10,6 +10,12 @@ import (
 	"github.com/xtraclabs/rollsecrets/secrets"
 )
 
+//Columns selected when reading an application definition - see scanApplication
+const appColumns = `applicationName, clientId, clientSecret, developerEmail, developerId, loginProvider,
+	redirectUri, jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey, allowedScopes, publicClient,
+	accessTokenLifetime, tokenExchangeClients, tokenEndpointAuthMethods, clientAssertionPublicKey, tokenSigningAlg,
+	requirePushedAuthorizationRequests, grantTypes, responseTypes`
+
 type MariaDBAppRepo struct {
 	db *sql.DB
 }
@@ -42,7 +48,10 @@ func (ar *MariaDBAppRepo) CreateApplication(app *roll.Application) error {
 
 	//Insert the app
 	const appSql = `insert into rolldb.application(applicationName, clientId, clientSecret, developerEmail, developerId, loginProvider,
-	redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey) values(?,?,?,?,?,?,?,?,?,?)
+	redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey, allowedScopes, publicClient, accessTokenLifetime,
+	tokenExchangeClients, tokenEndpointAuthMethods, clientAssertionPublicKey, tokenSigningAlg,
+	requirePushedAuthorizationRequests, grantTypes, responseTypes)
+	values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
 	`
 	stmt, err := ar.db.Prepare(appSql)
 	if err != nil {
@@ -57,10 +66,20 @@ func (ar *MariaDBAppRepo) CreateApplication(app *roll.Application) error {
 		app.DeveloperEmail,
 		app.DeveloperID,
 		app.LoginProvider,
-		app.RedirectURI,
+		app.RedirectURIs,
 		app.JWTFlowAudience,
 		app.JWTFlowIssuer,
 		app.JWTFlowPublicKey,
+		app.AllowedScopes,
+		app.PublicClient,
+		app.AccessTokenLifetime,
+		app.TokenExchangeClients,
+		app.TokenEndpointAuthMethods,
+		app.ClientAssertionPublicKey,
+		app.TokenSigningAlg,
+		app.RequirePushedAuthorizationRequests,
+		app.GrantTypes,
+		app.ResponseTypes,
 	)
 
 	if err != nil {
@@ -86,7 +105,9 @@ func applyUpdatesWithJWTColumns(db *sql.DB, app *roll.Application) error {
 
 	const updateSql = `
 	update application set loginProvider=?, redirectUri=?,jwtFlowPublicKey=?,jwtFlowIssuer=?,
-	jwtFlowAudience=?,applicationName=? where clientId=?
+	jwtFlowAudience=?,applicationName=?,developerEmail=?,allowedScopes=?,publicClient=?,accessTokenLifetime=?,
+	tokenExchangeClients=?,tokenEndpointAuthMethods=?,clientAssertionPublicKey=?,tokenSigningAlg=?,
+	requirePushedAuthorizationRequests=?,grantTypes=?,responseTypes=? where clientId=?
 	`
 	stmt, err := db.Prepare(updateSql)
 	if err != nil {
@@ -95,15 +116,19 @@ func applyUpdatesWithJWTColumns(db *sql.DB, app *roll.Application) error {
 
 	defer stmt.Close()
 
-	_, err = stmt.Exec(app.LoginProvider, app.RedirectURI, app.JWTFlowPublicKey, app.JWTFlowIssuer,
-		app.JWTFlowAudience, app.ApplicationName, app.ClientID)
+	_, err = stmt.Exec(app.LoginProvider, app.RedirectURIs, app.JWTFlowPublicKey, app.JWTFlowIssuer,
+		app.JWTFlowAudience, app.ApplicationName, app.DeveloperEmail, app.AllowedScopes, app.PublicClient,
+		app.AccessTokenLifetime, app.TokenExchangeClients, app.TokenEndpointAuthMethods, app.ClientAssertionPublicKey,
+		app.TokenSigningAlg, app.RequirePushedAuthorizationRequests, app.GrantTypes, app.ResponseTypes, app.ClientID)
 	return err
 
 }
 
 func applyUpdate(db *sql.DB, app *roll.Application) error {
 	const updateSql = `
-	update application set loginProvider=?, redirectUri=?,applicationName=? where clientId=?
+	update application set loginProvider=?, redirectUri=?,applicationName=?,developerEmail=?,allowedScopes=?,
+	publicClient=?,accessTokenLifetime=?,tokenExchangeClients=?,tokenEndpointAuthMethods=?,clientAssertionPublicKey=?,
+	tokenSigningAlg=?,requirePushedAuthorizationRequests=?,grantTypes=?,responseTypes=? where clientId=?
 	`
 	stmt, err := db.Prepare(updateSql)
 	if err != nil {
@@ -112,10 +137,27 @@ func applyUpdate(db *sql.DB, app *roll.Application) error {
 
 	defer stmt.Close()
 
-	_, err = stmt.Exec(app.LoginProvider, app.RedirectURI, app.ApplicationName, app.ClientID)
+	_, err = stmt.Exec(app.LoginProvider, app.RedirectURIs, app.ApplicationName, app.DeveloperEmail, app.AllowedScopes,
+		app.PublicClient, app.AccessTokenLifetime, app.TokenExchangeClients, app.TokenEndpointAuthMethods,
+		app.ClientAssertionPublicKey, app.TokenSigningAlg, app.RequirePushedAuthorizationRequests, app.GrantTypes,
+		app.ResponseTypes, app.ClientID)
 	return err
 }
 
+//scanApplication reads an application definition from a row selecting appColumns
+func scanApplication(row *sql.Row) (*roll.Application, error) {
+	var app roll.Application
+	err := row.Scan(
+		&app.ApplicationName, &app.ClientID, &app.ClientSecret, &app.DeveloperEmail, &app.DeveloperID, &app.LoginProvider,
+		&app.RedirectURIs, &app.JWTFlowAudience, &app.JWTFlowIssuer, &app.JWTFlowPublicKey, &app.AllowedScopes,
+		&app.PublicClient, &app.AccessTokenLifetime, &app.TokenExchangeClients,
+		&app.TokenEndpointAuthMethods, &app.ClientAssertionPublicKey, &app.TokenSigningAlg,
+		&app.RequirePushedAuthorizationRequests, &app.GrantTypes, &app.ResponseTypes,
+	)
+
+	return &app, err
+}
+
 //to the existing things, specifically for the jwt parts?
 func (ar *MariaDBAppRepo) UpdateApplication(app *roll.Application, subjectID string) error {
 	storedApp, err := ar.SystemRetrieveApplication(app.ClientID)
@@ -163,25 +205,42 @@ func (ar *MariaDBAppRepo) delete(app *roll.Application) error {
 	return nil
 }
 
+func (ar *MariaDBAppRepo) DeleteApplication(clientID string) error {
+	stmt, err := ar.db.Prepare("delete from application where clientId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(clientID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return roll.NoSuchApplicationError{}
+	}
+
+	return nil
+}
+
 func (ar *MariaDBAppRepo) RetrieveAppByNameAndDevEmail(appName, email string) (*roll.Application, error) {
 	const appSql = `
-	select applicationName, clientId, clientSecret, developerEmail, developerId, loginProvider,
-	redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey from application where applicationName = ?
+	select ` + appColumns + ` from application where applicationName = ?
 	and developerEmail = ?
 	`
 
-	var app roll.Application
-	err := ar.db.QueryRow(appSql,
-		appName, email).Scan(
-		&app.ApplicationName, &app.ClientID, &app.ClientSecret, &app.DeveloperEmail, &app.DeveloperID, &app.LoginProvider,
-		&app.RedirectURI, &app.JWTFlowAudience, &app.JWTFlowIssuer, &app.JWTFlowPublicKey,
-	)
-
+	app, err := scanApplication(ar.db.QueryRow(appSql, appName, email))
 	if err != nil {
 		return nil, err
 	}
 
-	return &app, nil
+	return app, nil
 }
 
 func (ar *MariaDBAppRepo) RetrieveApplication(clientID string, subjectID string, adminScope bool) (*roll.Application, error) {
@@ -201,35 +260,19 @@ func (ar *MariaDBAppRepo) RetrieveApplication(clientID string, subjectID string,
 //security model does not need to be applied.
 func (ar *MariaDBAppRepo) SystemRetrieveApplication(clientID string) (*roll.Application, error) {
 	const appSql = `
-	select applicationName, clientId, clientSecret, developerEmail, developerId, loginProvider,
-	redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey from application where clientId = ?
+	select ` + appColumns + ` from application where clientId = ?
 	`
 
 	log.Info("Looking up app for ", clientID)
-	var app roll.Application
-	err := ar.db.QueryRow(appSql,
-		clientID).Scan(
-		&app.ApplicationName, &app.ClientID, &app.ClientSecret, &app.DeveloperEmail, &app.DeveloperID, &app.LoginProvider,
-		&app.RedirectURI, &app.JWTFlowAudience, &app.JWTFlowIssuer, &app.JWTFlowPublicKey,
-	)
-
-	return &app, err
+	return scanApplication(ar.db.QueryRow(appSql, clientID))
 }
 
 func (ar *MariaDBAppRepo) SystemRetrieveApplicationByJWTFlowAudience(audience string) (*roll.Application, error) {
 	const appSql = `
-	select applicationName, clientId, clientSecret, developerEmail, developerId, loginProvider,
-	redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey from application where jwtFlowAudience = ?
+	select ` + appColumns + ` from application where jwtFlowAudience = ?
 	`
 
-	var app roll.Application
-	err := ar.db.QueryRow(appSql,
-		audience).Scan(
-		&app.ApplicationName, &app.ClientID, &app.ClientSecret, &app.DeveloperEmail, &app.DeveloperID, &app.LoginProvider,
-		&app.RedirectURI, &app.JWTFlowAudience, &app.JWTFlowIssuer, &app.JWTFlowPublicKey,
-	)
-
-	return &app, err
+	return scanApplication(ar.db.QueryRow(appSql, audience))
 }
 
 func (ar *MariaDBAppRepo) ListApplications(subjectID string, adminScope bool) ([]roll.Application, error) {
@@ -239,14 +282,18 @@ func (ar *MariaDBAppRepo) ListApplications(subjectID string, adminScope bool) ([
 	if adminScope == true {
 		const adminScopeSelect = `
 		select applicationName, clientId, developerEmail, developerId, loginProvider,
-		redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey from application
+		redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey, allowedScopes, publicClient, accessTokenLifetime,
+		tokenExchangeClients, tokenEndpointAuthMethods, clientAssertionPublicKey, tokenSigningAlg, requirePushedAuthorizationRequests,
+		grantTypes, responseTypes from application
 		`
 
 		rows, err = ar.db.Query(adminScopeSelect)
 	} else {
 		const nonAdminSelect = `
 		select applicationName, clientId, developerEmail, developerId, loginProvider,
-		redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey from application where developerId = ?
+		redirectUri,jwtFlowAudience, jwtFlowIssuer, jwtFlowPublicKey, allowedScopes, publicClient, accessTokenLifetime,
+		tokenExchangeClients, tokenEndpointAuthMethods, clientAssertionPublicKey, tokenSigningAlg, requirePushedAuthorizationRequests,
+		grantTypes, responseTypes from application where developerId = ?
 		`
 
 		rows, err = ar.db.Query(nonAdminSelect, subjectID)
@@ -266,10 +313,20 @@ func (ar *MariaDBAppRepo) ListApplications(subjectID string, adminScope bool) ([
 			&app.DeveloperEmail,
 			&app.DeveloperID,
 			&app.LoginProvider,
-			&app.RedirectURI,
+			&app.RedirectURIs,
 			&app.JWTFlowAudience,
 			&app.JWTFlowIssuer,
 			&app.JWTFlowPublicKey,
+			&app.AllowedScopes,
+			&app.PublicClient,
+			&app.AccessTokenLifetime,
+			&app.TokenExchangeClients,
+			&app.TokenEndpointAuthMethods,
+			&app.ClientAssertionPublicKey,
+			&app.TokenSigningAlg,
+			&app.RequirePushedAuthorizationRequests,
+			&app.GrantTypes,
+			&app.ResponseTypes,
 		)
 
 		if err != nil {
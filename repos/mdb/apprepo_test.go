@@ -24,7 +24,7 @@ func TestAddAndRetrieveApp(t *testing.T) {
 	app.DeveloperEmail = "foo@foo.bar"
 	app.DeveloperID = "foo"
 	app.LoginProvider = "auth0"
-	app.RedirectURI = "neither here nor there"
+	app.RedirectURIs = "neither here nor there"
 
 	appRepo := NewMBDAppRepo()
 	err := appRepo.CreateApplication(app)
@@ -41,7 +41,7 @@ func TestAddAndRetrieveApp(t *testing.T) {
 		assert.Equal(t, app.DeveloperEmail, retapp.DeveloperEmail)
 		assert.Equal(t, app.DeveloperID, retapp.DeveloperID)
 		assert.Equal(t, app.LoginProvider, retapp.LoginProvider)
-		assert.Equal(t, app.RedirectURI, retapp.RedirectURI)
+		assert.Equal(t, app.RedirectURIs, retapp.RedirectURIs)
 	}
 
 	retapp, err = appRepo.RetrieveApplication(app.ClientID, app.DeveloperID, false)
@@ -53,7 +53,7 @@ func TestAddAndRetrieveApp(t *testing.T) {
 		assert.Equal(t, app.DeveloperEmail, retapp.DeveloperEmail)
 		assert.Equal(t, app.DeveloperID, retapp.DeveloperID)
 		assert.Equal(t, app.LoginProvider, retapp.LoginProvider)
-		assert.Equal(t, app.RedirectURI, retapp.RedirectURI)
+		assert.Equal(t, app.RedirectURIs, retapp.RedirectURIs)
 	}
 
 	retapp, err = appRepo.RetrieveApplication(app.ClientID, "huh", true)
@@ -65,7 +65,7 @@ func TestAddAndRetrieveApp(t *testing.T) {
 		assert.Equal(t, app.DeveloperEmail, retapp.DeveloperEmail)
 		assert.Equal(t, app.DeveloperID, retapp.DeveloperID)
 		assert.Equal(t, app.LoginProvider, retapp.LoginProvider)
-		assert.Equal(t, app.RedirectURI, retapp.RedirectURI)
+		assert.Equal(t, app.RedirectURIs, retapp.RedirectURIs)
 	}
 
 	retapp, err = appRepo.SystemRetrieveApplication(app.ClientID)
@@ -84,7 +84,7 @@ func TestSecretGeneratedWhenNeede(t *testing.T) {
 	app.DeveloperEmail = "foo@foo.bar"
 	app.DeveloperID = "foo"
 	app.LoginProvider = "auth0"
-	app.RedirectURI = "neither here nor there"
+	app.RedirectURIs = "neither here nor there"
 
 	appRepo := NewMBDAppRepo()
 	err := appRepo.CreateApplication(app)
@@ -104,7 +104,7 @@ func TestDuplicateAppCreateGeneratesError(t *testing.T) {
 	app.DeveloperEmail = "foo@foo.bar"
 	app.DeveloperID = "foo"
 	app.LoginProvider = "auth0"
-	app.RedirectURI = "neither here nor there"
+	app.RedirectURIs = "neither here nor there"
 
 	appRepo := NewMBDAppRepo()
 	err := appRepo.CreateApplication(app)
@@ -137,7 +137,7 @@ func TestUpdateApp(t *testing.T) {
 	app.DeveloperEmail = "foo@foo.bar"
 	app.DeveloperID = "foo"
 	app.LoginProvider = "auth0"
-	app.RedirectURI = "neither here nor there"
+	app.RedirectURIs = "neither here nor there"
 
 	err = appRepo.CreateApplication(app)
 	if assert.Nil(t, err) {
@@ -164,7 +164,7 @@ func TestUpdateApp(t *testing.T) {
 		assert.Equal(t, app.DeveloperEmail, retapp.DeveloperEmail)
 		assert.Equal(t, app.DeveloperID, retapp.DeveloperID)
 		assert.Equal(t, app.LoginProvider, retapp.LoginProvider)
-		assert.Equal(t, app.RedirectURI, retapp.RedirectURI)
+		assert.Equal(t, app.RedirectURIs, retapp.RedirectURIs)
 		assert.Equal(t, app.JWTFlowAudience, retapp.JWTFlowAudience)
 		assert.Equal(t, app.JWTFlowIssuer, retapp.JWTFlowIssuer)
 		assert.Equal(t, app.JWTFlowPublicKey, retapp.JWTFlowPublicKey)
@@ -192,8 +192,31 @@ func TestUpdateNoSuchApp(t *testing.T) {
 	app.DeveloperEmail = "foo@foo.bar"
 	app.DeveloperID = "foo"
 	app.LoginProvider = "auth0"
-	app.RedirectURI = "neither here nor there"
+	app.RedirectURIs = "neither here nor there"
 
 	err := appRepo.UpdateApplication(app, app.DeveloperID)
 	assert.NotNil(t, err)
 }
+
+func TestDeleteApp(t *testing.T) {
+	app := new(roll.Application)
+	app.ApplicationName = "an app"
+	app.ClientID = "123"
+	app.DeveloperEmail = "foo@foo.bar"
+	app.DeveloperID = "foo"
+	app.LoginProvider = "auth0"
+	app.RedirectURIs = "neither here nor there"
+
+	appRepo := NewMBDAppRepo()
+	err := appRepo.CreateApplication(app)
+	if assert.Nil(t, err) {
+		defer appRepo.delete(app)
+	}
+
+	err = appRepo.DeleteApplication(app.ClientID)
+	assert.Nil(t, err)
+
+	err = appRepo.DeleteApplication(app.ClientID)
+	_, ok := err.(roll.NoSuchApplicationError)
+	assert.True(t, ok)
+}
@@ -0,0 +1,68 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/go-sql-driver/mysql"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+	"time"
+)
+
+type MBDAssertionReplayRepo struct {
+	db *sql.DB
+}
+
+func NewMBDAssertionReplayRepo() *MBDAssertionReplayRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDAssertionReplayRepo{
+		db: db,
+	}
+}
+
+func (arr *MBDAssertionReplayRepo) RecordAssertionUse(issuer, tokenID string, expiresAt int64) error {
+	//Expired assertions are rejected before their use is recorded, so their records are no longer needed
+	if err := arr.purgeExpired(); err != nil {
+		log.Info("Error purging expired assertions: ", err.Error())
+	}
+
+	stmt, err := arr.db.Prepare("insert into used_assertion(issuer, tokenId, expiresAt) values(?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(issuer, tokenID, expiresAt)
+	if sqlErr, ok := err.(*mysql.MySQLError); ok && sqlErr.Number == 1062 {
+		log.Info("Assertion ", tokenID, " from ", issuer, " already used")
+		return roll.AssertionReplayError{}
+	}
+
+	return err
+}
+
+func (arr *MBDAssertionReplayRepo) purgeExpired() error {
+	stmt, err := arr.db.Prepare("delete from used_assertion where expiresAt < ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now().Unix())
+	return err
+}
+
+func (arr *MBDAssertionReplayRepo) delete(issuer, tokenID string) error {
+	stmt, err := arr.db.Prepare("delete from used_assertion where issuer = ? and tokenId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(issuer, tokenID)
+	return err
+}
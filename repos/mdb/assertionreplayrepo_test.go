@@ -0,0 +1,27 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+	"time"
+)
+
+func TestRecordAssertionUse(t *testing.T) {
+	arRepo := NewMBDAssertionReplayRepo()
+	err := arRepo.RecordAssertionUse("an-issuer", "jti-1", time.Now().Add(time.Minute).Unix())
+	if assert.Nil(t, err) {
+		defer arRepo.delete("an-issuer", "jti-1")
+	}
+
+	err = arRepo.RecordAssertionUse("an-issuer", "jti-1", time.Now().Add(time.Minute).Unix())
+	_, ok := err.(roll.AssertionReplayError)
+	assert.True(t, ok)
+
+	err = arRepo.RecordAssertionUse("another-issuer", "jti-1", time.Now().Add(time.Minute).Unix())
+	if assert.Nil(t, err) {
+		defer arRepo.delete("another-issuer", "jti-1")
+	}
+}
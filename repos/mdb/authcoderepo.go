@@ -0,0 +1,133 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+	"time"
+)
+
+type MBDAuthCodeRepo struct {
+	db *sql.DB
+}
+
+func NewMBDAuthCodeRepo() *MBDAuthCodeRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDAuthCodeRepo{
+		db: db,
+	}
+}
+
+func (acr *MBDAuthCodeRepo) StoreAuthCode(code *roll.AuthCode) error {
+	//Expired codes are rejected when exchanged, so their records are no longer needed
+	if err := acr.purgeExpired(); err != nil {
+		log.Info("Error purging expired authorization codes: ", err.Error())
+	}
+
+	stmt, err := acr.db.Prepare("insert into auth_code(codeId, clientId, redirectUri, expiresAt, used) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(
+		code.CodeID,
+		code.ClientID,
+		code.RedirectURI,
+		code.ExpiresAt,
+		code.Used,
+	)
+
+	return err
+}
+
+func (acr *MBDAuthCodeRepo) RetrieveAuthCode(codeID string) (*roll.AuthCode, error) {
+	const codeSql = `
+	select codeId, clientId, redirectUri, expiresAt, used, accessTokenId, accessTokenExpiresAt, refreshTokenFamilyId
+	from auth_code where codeId = ?
+	`
+
+	var code roll.AuthCode
+	var accessTokenID, familyID sql.NullString
+	var accessTokenExpiresAt sql.NullInt64
+	err := acr.db.QueryRow(codeSql, codeID).Scan(
+		&code.CodeID, &code.ClientID, &code.RedirectURI, &code.ExpiresAt, &code.Used,
+		&accessTokenID, &accessTokenExpiresAt, &familyID,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	code.AccessTokenID = accessTokenID.String
+	code.AccessTokenExpiresAt = accessTokenExpiresAt.Int64
+	code.RefreshTokenFamilyID = familyID.String
+	return &code, nil
+}
+
+func (acr *MBDAuthCodeRepo) MarkAuthCodeUsed(codeID string) error {
+	stmt, err := acr.db.Prepare("update auth_code set used = true where codeId = ? and used = false")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(codeID)
+	if err != nil {
+		return err
+	}
+
+	//If no row was updated the code was exchanged by someone else first
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		log.Info("Authorization code already used: ", codeID)
+		return roll.AuthCodeReuseError{}
+	}
+
+	return nil
+}
+
+func (acr *MBDAuthCodeRepo) RecordAuthCodeTokens(codeID, accessTokenID string, accessTokenExpiresAt int64, refreshTokenFamilyID string) error {
+	stmt, err := acr.db.Prepare("update auth_code set accessTokenId = ?, accessTokenExpiresAt = ?, refreshTokenFamilyId = ? where codeId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(accessTokenID, accessTokenExpiresAt, refreshTokenFamilyID, codeID)
+	return err
+}
+
+func (acr *MBDAuthCodeRepo) purgeExpired() error {
+	stmt, err := acr.db.Prepare("delete from auth_code where expiresAt <= ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now().Unix())
+	return err
+}
+
+func (acr *MBDAuthCodeRepo) delete(codeID string) error {
+	stmt, err := acr.db.Prepare("delete from auth_code where codeId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(codeID)
+	return err
+}
@@ -0,0 +1,59 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+	"time"
+)
+
+func TestAuthCodeSingleUse(t *testing.T) {
+	code := &roll.AuthCode{
+		CodeID:      "code-1",
+		ClientID:    "123",
+		RedirectURI: "http://localhost:3000/ab",
+		ExpiresAt:   time.Now().Add(time.Minute).Unix(),
+	}
+
+	acRepo := NewMBDAuthCodeRepo()
+	err := acRepo.StoreAuthCode(code)
+	if assert.Nil(t, err) {
+		defer acRepo.delete(code.CodeID)
+	}
+
+	retrieved, err := acRepo.RetrieveAuthCode(code.CodeID)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, code.ClientID, retrieved.ClientID)
+		assert.Equal(t, code.RedirectURI, retrieved.RedirectURI)
+		assert.Equal(t, code.ExpiresAt, retrieved.ExpiresAt)
+		assert.False(t, retrieved.Used)
+		assert.Equal(t, "", retrieved.AccessTokenID)
+	}
+
+	err = acRepo.MarkAuthCodeUsed(code.CodeID)
+	assert.Nil(t, err)
+
+	err = acRepo.MarkAuthCodeUsed(code.CodeID)
+	_, ok := err.(roll.AuthCodeReuseError)
+	assert.True(t, ok)
+
+	err = acRepo.RecordAuthCodeTokens(code.CodeID, "at-1", 1000, "rt-1")
+	assert.Nil(t, err)
+
+	retrieved, err = acRepo.RetrieveAuthCode(code.CodeID)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.True(t, retrieved.Used)
+		assert.Equal(t, "at-1", retrieved.AccessTokenID)
+		assert.Equal(t, int64(1000), retrieved.AccessTokenExpiresAt)
+		assert.Equal(t, "rt-1", retrieved.RefreshTokenFamilyID)
+	}
+}
+
+func TestRetrieveNonexistentAuthCode(t *testing.T) {
+	acRepo := NewMBDAuthCodeRepo()
+	code, err := acRepo.RetrieveAuthCode("no such code")
+	assert.Nil(t, err)
+	assert.Nil(t, code)
+}
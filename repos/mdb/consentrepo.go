@@ -0,0 +1,104 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+)
+
+type MBDConsentRepo struct {
+	db *sql.DB
+}
+
+func NewMBDConsentRepo() *MBDConsentRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDConsentRepo{
+		db: db,
+	}
+}
+
+func (cr *MBDConsentRepo) StoreConsent(consent *roll.Consent) error {
+	stmt, err := cr.db.Prepare(`insert into consent(subject, clientId, scope, grantedAt) values(?,?,?,?)
+	on duplicate key update scope = values(scope), grantedAt = values(grantedAt)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(consent.Subject, consent.ClientID, consent.Scope, consent.GrantedAt)
+	return err
+}
+
+const consentSelect = `
+	select subject, clientId, scope, grantedAt
+	from consent
+	`
+
+func scanConsent(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*roll.Consent, error) {
+	var consent roll.Consent
+	err := scanner.Scan(&consent.Subject, &consent.ClientID, &consent.Scope, &consent.GrantedAt)
+	return &consent, err
+}
+
+func (cr *MBDConsentRepo) RetrieveConsent(subject, clientID string) (*roll.Consent, error) {
+	consent, err := scanConsent(cr.db.QueryRow(consentSelect+"where subject = ? and clientId = ?", subject, clientID))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return consent, nil
+}
+
+func (cr *MBDConsentRepo) ListConsents(subject string) ([]roll.Consent, error) {
+	rows, err := cr.db.Query(consentSelect+"where subject = ?", subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consents []roll.Consent
+	for rows.Next() {
+		consent, err := scanConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		consents = append(consents, *consent)
+	}
+
+	return consents, rows.Err()
+}
+
+func (cr *MBDConsentRepo) DeleteConsent(subject, clientID string) error {
+	stmt, err := cr.db.Prepare("delete from consent where subject = ? and clientId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(subject, clientID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return roll.NoSuchConsentError{}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+	"time"
+)
+
+func TestConsentStoreListDelete(t *testing.T) {
+	consent := &roll.Consent{
+		Subject:   "consent-subject",
+		ClientID:  "123",
+		Scope:     "openid",
+		GrantedAt: time.Now().Unix(),
+	}
+
+	consentRepo := NewMBDConsentRepo()
+	err := consentRepo.StoreConsent(consent)
+	assert.Nil(t, err)
+
+	consent.AddScope("admin")
+	err = consentRepo.StoreConsent(consent)
+	assert.Nil(t, err)
+
+	retrieved, err := consentRepo.RetrieveConsent(consent.Subject, consent.ClientID)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, "openid admin", retrieved.Scope)
+		assert.Equal(t, consent.GrantedAt, retrieved.GrantedAt)
+	}
+
+	consents, err := consentRepo.ListConsents(consent.Subject)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, len(consents))
+	}
+
+	err = consentRepo.DeleteConsent(consent.Subject, consent.ClientID)
+	assert.Nil(t, err)
+
+	err = consentRepo.DeleteConsent(consent.Subject, consent.ClientID)
+	_, ok := err.(roll.NoSuchConsentError)
+	assert.True(t, ok)
+
+	retrieved, err = consentRepo.RetrieveConsent(consent.Subject, consent.ClientID)
+	assert.Nil(t, err)
+	assert.Nil(t, retrieved)
+}
@@ -0,0 +1,144 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+	"time"
+)
+
+type MBDDeviceAuthorizationRepo struct {
+	db *sql.DB
+}
+
+func NewMBDDeviceAuthorizationRepo() *MBDDeviceAuthorizationRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDDeviceAuthorizationRepo{
+		db: db,
+	}
+}
+
+func (dar *MBDDeviceAuthorizationRepo) StoreDeviceAuthorization(da *roll.DeviceAuthorization) error {
+	//Expired requests can no longer be approved or exchanged, so their records are no longer needed
+	if err := dar.purgeExpired(); err != nil {
+		log.Info("Error purging expired device authorizations: ", err.Error())
+	}
+
+	stmt, err := dar.db.Prepare(`insert into device_authorization(deviceCode, userCode, clientId, scope, status, subject, expiresAt, pollInterval, lastPolledAt)
+	values(?,?,?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(
+		da.DeviceCode,
+		da.UserCode,
+		da.ClientID,
+		da.Scope,
+		da.Status,
+		da.Subject,
+		da.ExpiresAt,
+		da.Interval,
+		da.LastPolledAt,
+	)
+
+	return err
+}
+
+const deviceAuthorizationSelect = `
+	select deviceCode, userCode, clientId, scope, status, subject, expiresAt, pollInterval, lastPolledAt
+	from device_authorization
+	`
+
+func (dar *MBDDeviceAuthorizationRepo) retrieve(query string, arg string) (*roll.DeviceAuthorization, error) {
+	var da roll.DeviceAuthorization
+	var scope, subject sql.NullString
+	err := dar.db.QueryRow(deviceAuthorizationSelect+query, arg).Scan(
+		&da.DeviceCode, &da.UserCode, &da.ClientID, &scope, &da.Status, &subject,
+		&da.ExpiresAt, &da.Interval, &da.LastPolledAt,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	da.Scope = scope.String
+	da.Subject = subject.String
+	return &da, nil
+}
+
+func (dar *MBDDeviceAuthorizationRepo) RetrieveDeviceAuthorization(deviceCode string) (*roll.DeviceAuthorization, error) {
+	return dar.retrieve("where deviceCode = ?", deviceCode)
+}
+
+func (dar *MBDDeviceAuthorizationRepo) RetrieveDeviceAuthorizationByUserCode(userCode string) (*roll.DeviceAuthorization, error) {
+	return dar.retrieve("where userCode = ?", userCode)
+}
+
+func (dar *MBDDeviceAuthorizationRepo) RecordDeviceAuthorizationPoll(deviceCode string, polledAt, interval int64) error {
+	stmt, err := dar.db.Prepare("update device_authorization set lastPolledAt = ?, pollInterval = ? where deviceCode = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(polledAt, interval, deviceCode)
+	return err
+}
+
+func (dar *MBDDeviceAuthorizationRepo) UpdateDeviceAuthorizationStatus(deviceCode, fromStatus, toStatus, subject string) error {
+	stmt, err := dar.db.Prepare("update device_authorization set status = ?, subject = coalesce(nullif(?, ''), subject) where deviceCode = ? and status = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(toStatus, subject, deviceCode, fromStatus)
+	if err != nil {
+		return err
+	}
+
+	//If no row was updated the status was changed by someone else first
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		log.Info("Device authorization ", deviceCode, " not in status ", fromStatus)
+		return roll.DeviceAuthorizationStatusError{}
+	}
+
+	return nil
+}
+
+func (dar *MBDDeviceAuthorizationRepo) purgeExpired() error {
+	stmt, err := dar.db.Prepare("delete from device_authorization where expiresAt <= ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now().Unix())
+	return err
+}
+
+func (dar *MBDDeviceAuthorizationRepo) delete(deviceCode string) error {
+	stmt, err := dar.db.Prepare("delete from device_authorization where deviceCode = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(deviceCode)
+	return err
+}
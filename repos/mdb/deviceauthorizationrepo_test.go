@@ -0,0 +1,61 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+	"time"
+)
+
+func TestDeviceAuthorizationApproval(t *testing.T) {
+	da := &roll.DeviceAuthorization{
+		DeviceCode: "device-code-1",
+		UserCode:   "BCDFGHJK",
+		ClientID:   "123",
+		Status:     roll.DeviceAuthorizationPending,
+		ExpiresAt:  time.Now().Add(time.Minute).Unix(),
+		Interval:   5,
+	}
+
+	daRepo := NewMBDDeviceAuthorizationRepo()
+	err := daRepo.StoreDeviceAuthorization(da)
+	if assert.Nil(t, err) {
+		defer daRepo.delete(da.DeviceCode)
+	}
+
+	retrieved, err := daRepo.RetrieveDeviceAuthorizationByUserCode(da.UserCode)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, da.DeviceCode, retrieved.DeviceCode)
+		assert.Equal(t, da.ClientID, retrieved.ClientID)
+		assert.Equal(t, "", retrieved.Scope)
+		assert.Equal(t, roll.DeviceAuthorizationPending, retrieved.Status)
+		assert.Equal(t, int64(5), retrieved.Interval)
+	}
+
+	err = daRepo.RecordDeviceAuthorizationPoll(da.DeviceCode, 1000, 10)
+	assert.Nil(t, err)
+
+	err = daRepo.UpdateDeviceAuthorizationStatus(da.DeviceCode, roll.DeviceAuthorizationPending, roll.DeviceAuthorizationApproved, "a-user")
+	assert.Nil(t, err)
+
+	err = daRepo.UpdateDeviceAuthorizationStatus(da.DeviceCode, roll.DeviceAuthorizationPending, roll.DeviceAuthorizationDenied, "")
+	_, ok := err.(roll.DeviceAuthorizationStatusError)
+	assert.True(t, ok)
+
+	retrieved, err = daRepo.RetrieveDeviceAuthorization(da.DeviceCode)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, roll.DeviceAuthorizationApproved, retrieved.Status)
+		assert.Equal(t, "a-user", retrieved.Subject)
+		assert.Equal(t, int64(1000), retrieved.LastPolledAt)
+		assert.Equal(t, int64(10), retrieved.Interval)
+	}
+}
+
+func TestRetrieveNonexistentDeviceAuthorization(t *testing.T) {
+	daRepo := NewMBDDeviceAuthorizationRepo()
+	da, err := daRepo.RetrieveDeviceAuthorization("no such code")
+	assert.Nil(t, err)
+	assert.Nil(t, da)
+}
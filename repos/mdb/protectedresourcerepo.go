@@ -0,0 +1,94 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+)
+
+type MBDProtectedResourceRepo struct {
+	db *sql.DB
+}
+
+func NewMBDProtectedResourceRepo() *MBDProtectedResourceRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDProtectedResourceRepo{
+		db: db,
+	}
+}
+
+func (pr *MBDProtectedResourceRepo) StoreProtectedResource(resource *roll.ProtectedResource) error {
+	stmt, err := pr.db.Prepare(`insert into protected_resource(identifier, description) values(?,?)
+	on duplicate key update description = values(description)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(resource.Identifier, resource.Description)
+	return err
+}
+
+func (pr *MBDProtectedResourceRepo) RetrieveProtectedResource(identifier string) (*roll.ProtectedResource, error) {
+	var resource roll.ProtectedResource
+	err := pr.db.QueryRow("select identifier, description from protected_resource where identifier = ?", identifier).Scan(
+		&resource.Identifier, &resource.Description,
+	)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &resource, nil
+}
+
+func (pr *MBDProtectedResourceRepo) ListProtectedResources() ([]roll.ProtectedResource, error) {
+	rows, err := pr.db.Query("select identifier, description from protected_resource order by identifier")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resources []roll.ProtectedResource
+	for rows.Next() {
+		var resource roll.ProtectedResource
+		if err := rows.Scan(&resource.Identifier, &resource.Description); err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, rows.Err()
+}
+
+func (pr *MBDProtectedResourceRepo) DeleteProtectedResource(identifier string) error {
+	stmt, err := pr.db.Prepare("delete from protected_resource where identifier = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(identifier)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return roll.NoSuchProtectedResourceError{}
+	}
+
+	return nil
+}
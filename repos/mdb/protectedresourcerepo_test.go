@@ -0,0 +1,39 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+)
+
+func TestProtectedResourceLifecycle(t *testing.T) {
+	resourceRepo := NewMBDProtectedResourceRepo()
+
+	identifier := "https://api.example.com/orders"
+	err := resourceRepo.StoreProtectedResource(&roll.ProtectedResource{Identifier: identifier, Description: "Orders"})
+	if assert.Nil(t, err) {
+		defer resourceRepo.DeleteProtectedResource(identifier)
+	}
+
+	err = resourceRepo.StoreProtectedResource(&roll.ProtectedResource{Identifier: identifier, Description: "Orders API"})
+	assert.Nil(t, err)
+
+	resource, err := resourceRepo.RetrieveProtectedResource(identifier)
+	if assert.Nil(t, err) && assert.NotNil(t, resource) {
+		assert.Equal(t, "Orders API", resource.Description)
+	}
+
+	resources, err := resourceRepo.ListProtectedResources()
+	assert.Nil(t, err)
+	assert.True(t, len(resources) > 0)
+
+	resource, err = resourceRepo.RetrieveProtectedResource("https://api.example.com/no-such-resource")
+	assert.Nil(t, err)
+	assert.Nil(t, resource)
+
+	err = resourceRepo.DeleteProtectedResource("https://api.example.com/no-such-resource")
+	_, ok := err.(roll.NoSuchProtectedResourceError)
+	assert.True(t, ok)
+}
@@ -0,0 +1,96 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+	"time"
+)
+
+type MBDPushedAuthorizationRepo struct {
+	db *sql.DB
+}
+
+func NewMBDPushedAuthorizationRepo() *MBDPushedAuthorizationRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDPushedAuthorizationRepo{
+		db: db,
+	}
+}
+
+func (par *MBDPushedAuthorizationRepo) StorePushedAuthorization(pa *roll.PushedAuthorization) error {
+	//Request uris that were never redeemed are no longer usable once expired
+	if err := par.purgeExpired(); err != nil {
+		log.Info("Error purging expired pushed authorizations: ", err.Error())
+	}
+
+	stmt, err := par.db.Prepare(`insert into pushed_authorization(requestUri, clientId, params, expiresAt)
+	values(?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(
+		pa.RequestURI,
+		pa.ClientID,
+		pa.Params,
+		pa.ExpiresAt,
+	)
+
+	return err
+}
+
+func (par *MBDPushedAuthorizationRepo) RetrievePushedAuthorization(requestURI string) (*roll.PushedAuthorization, error) {
+	var pa roll.PushedAuthorization
+	err := par.db.QueryRow(`select requestUri, clientId, params, expiresAt from pushed_authorization
+	where requestUri = ?`, requestURI).Scan(&pa.RequestURI, &pa.ClientID, &pa.Params, &pa.ExpiresAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &pa, nil
+}
+
+func (par *MBDPushedAuthorizationRepo) DeletePushedAuthorization(requestURI string) error {
+	stmt, err := par.db.Prepare("delete from pushed_authorization where requestUri = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(requestURI)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return roll.NoSuchPushedAuthorizationError{}
+	}
+
+	return nil
+}
+
+func (par *MBDPushedAuthorizationRepo) purgeExpired() error {
+	stmt, err := par.db.Prepare("delete from pushed_authorization where expiresAt <= ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now().Unix())
+	return err
+}
@@ -0,0 +1,41 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+	"time"
+)
+
+func TestPushedAuthorizationSingleUse(t *testing.T) {
+	pa := &roll.PushedAuthorization{
+		RequestURI: "urn:ietf:params:oauth:request_uri:abc",
+		ClientID:   "123",
+		Params:     "client_id=123&response_type=code",
+		ExpiresAt:  time.Now().Add(time.Minute).Unix(),
+	}
+
+	paRepo := NewMBDPushedAuthorizationRepo()
+	err := paRepo.StorePushedAuthorization(pa)
+	assert.Nil(t, err)
+
+	retrieved, err := paRepo.RetrievePushedAuthorization(pa.RequestURI)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, pa.ClientID, retrieved.ClientID)
+		assert.Equal(t, pa.Params, retrieved.Params)
+		assert.Equal(t, pa.ExpiresAt, retrieved.ExpiresAt)
+	}
+
+	err = paRepo.DeletePushedAuthorization(pa.RequestURI)
+	assert.Nil(t, err)
+
+	err = paRepo.DeletePushedAuthorization(pa.RequestURI)
+	_, ok := err.(roll.NoSuchPushedAuthorizationError)
+	assert.True(t, ok)
+
+	retrieved, err = paRepo.RetrievePushedAuthorization(pa.RequestURI)
+	assert.Nil(t, err)
+	assert.Nil(t, retrieved)
+}
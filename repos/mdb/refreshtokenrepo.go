@@ -0,0 +1,132 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+)
+
+type MBDRefreshTokenRepo struct {
+	db *sql.DB
+}
+
+func NewMBDRefreshTokenRepo() *MBDRefreshTokenRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDRefreshTokenRepo{
+		db: db,
+	}
+}
+
+func (rtr *MBDRefreshTokenRepo) StoreRefreshToken(rt *roll.RefreshToken) error {
+	const tokenSql = `insert into rolldb.refresh_token(tokenId, familyId, clientId, subject, scope, expiresAt,
+	used, revoked, resources) values(?,?,?,?,?,?,?,?,?)
+	`
+	stmt, err := rtr.db.Prepare(tokenSql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(
+		rt.TokenID,
+		rt.FamilyID,
+		rt.ClientID,
+		rt.Subject,
+		rt.Scope,
+		rt.ExpiresAt,
+		rt.Used,
+		rt.Revoked,
+		rt.Resources,
+	)
+
+	return err
+}
+
+func (rtr *MBDRefreshTokenRepo) RetrieveRefreshToken(tokenID string) (*roll.RefreshToken, error) {
+	const tokenSql = `
+	select tokenId, familyId, clientId, subject, scope, expiresAt, used, revoked, resources
+	from refresh_token where tokenId = ?
+	`
+
+	var rt roll.RefreshToken
+	var scope, resources sql.NullString
+	err := rtr.db.QueryRow(tokenSql, tokenID).Scan(
+		&rt.TokenID, &rt.FamilyID, &rt.ClientID, &rt.Subject, &scope, &rt.ExpiresAt, &rt.Used, &rt.Revoked,
+		&resources,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	rt.Scope = scope.String
+	rt.Resources = resources.String
+	return &rt, nil
+}
+
+func (rtr *MBDRefreshTokenRepo) MarkRefreshTokenUsed(tokenID string) error {
+	stmt, err := rtr.db.Prepare("update refresh_token set used = true where tokenId = ? and used = false")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(tokenID)
+	if err != nil {
+		return err
+	}
+
+	//If no row was updated the token was used by someone else first
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		log.Info("Refresh token already used: ", tokenID)
+		return roll.RefreshTokenReuseError{}
+	}
+
+	return nil
+}
+
+func (rtr *MBDRefreshTokenRepo) RevokeRefreshTokenFamily(familyID string) error {
+	stmt, err := rtr.db.Prepare("update refresh_token set revoked = true where familyId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(familyID)
+	return err
+}
+
+func (rtr *MBDRefreshTokenRepo) RevokeSubjectRefreshTokens(subject, clientID string) error {
+	stmt, err := rtr.db.Prepare("update refresh_token set revoked = true where subject = ? and clientId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(subject, clientID)
+	return err
+}
+
+func (rtr *MBDRefreshTokenRepo) delete(tokenID string) error {
+	stmt, err := rtr.db.Prepare("delete from refresh_token where tokenId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(tokenID)
+	return err
+}
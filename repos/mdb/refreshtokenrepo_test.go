@@ -0,0 +1,87 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	rt := &roll.RefreshToken{
+		TokenID:   "rt-1",
+		FamilyID:  "rt-1",
+		ClientID:  "123",
+		Subject:   "foo",
+		Scope:     "admin",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Resources: "https://api.example.com/orders",
+	}
+
+	rtRepo := NewMBDRefreshTokenRepo()
+	err := rtRepo.StoreRefreshToken(rt)
+	if assert.Nil(t, err) {
+		defer rtRepo.delete(rt.TokenID)
+	}
+
+	retrieved, err := rtRepo.RetrieveRefreshToken(rt.TokenID)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, rt.FamilyID, retrieved.FamilyID)
+		assert.Equal(t, rt.ClientID, retrieved.ClientID)
+		assert.Equal(t, rt.Subject, retrieved.Subject)
+		assert.Equal(t, rt.Scope, retrieved.Scope)
+		assert.Equal(t, rt.ExpiresAt, retrieved.ExpiresAt)
+		assert.Equal(t, rt.Resources, retrieved.Resources)
+		assert.False(t, retrieved.Used)
+		assert.False(t, retrieved.Revoked)
+	}
+
+	err = rtRepo.MarkRefreshTokenUsed(rt.TokenID)
+	assert.Nil(t, err)
+
+	err = rtRepo.MarkRefreshTokenUsed(rt.TokenID)
+	_, ok := err.(roll.RefreshTokenReuseError)
+	assert.True(t, ok)
+
+	err = rtRepo.RevokeRefreshTokenFamily(rt.FamilyID)
+	assert.Nil(t, err)
+
+	retrieved, err = rtRepo.RetrieveRefreshToken(rt.TokenID)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.True(t, retrieved.Used)
+		assert.True(t, retrieved.Revoked)
+	}
+}
+
+func TestRevokeSubjectRefreshTokens(t *testing.T) {
+	rt := &roll.RefreshToken{
+		TokenID:   "rt-2",
+		FamilyID:  "rt-2",
+		ClientID:  "123",
+		Subject:   "foo",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	rtRepo := NewMBDRefreshTokenRepo()
+	err := rtRepo.StoreRefreshToken(rt)
+	if assert.Nil(t, err) {
+		defer rtRepo.delete(rt.TokenID)
+	}
+
+	err = rtRepo.RevokeSubjectRefreshTokens(rt.Subject, rt.ClientID)
+	assert.Nil(t, err)
+
+	retrieved, err := rtRepo.RetrieveRefreshToken(rt.TokenID)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.True(t, retrieved.Revoked)
+	}
+}
+
+func TestRetrieveNonexistentRefreshToken(t *testing.T) {
+	rtRepo := NewMBDRefreshTokenRepo()
+	rt, err := rtRepo.RetrieveRefreshToken("no such token")
+	assert.Nil(t, err)
+	assert.Nil(t, rt)
+}
@@ -0,0 +1,115 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+)
+
+type MBDRegistrationTokenRepo struct {
+	db *sql.DB
+}
+
+func NewMBDRegistrationTokenRepo() *MBDRegistrationTokenRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDRegistrationTokenRepo{
+		db: db,
+	}
+}
+
+func (rtr *MBDRegistrationTokenRepo) StoreRegistrationToken(token *roll.RegistrationToken) error {
+	stmt, err := rtr.db.Prepare(`insert into registration_token(tokenId, secretHash, tokenType, clientId, issuedBy,
+	description, issuedAt, expiresAt) values(?,?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(
+		token.TokenID,
+		token.SecretHash,
+		token.TokenType,
+		token.ClientID,
+		token.IssuedBy,
+		token.Description,
+		token.IssuedAt,
+		token.ExpiresAt,
+	)
+
+	return err
+}
+
+const registrationTokenSelect = `
+	select tokenId, secretHash, tokenType, clientId, issuedBy, description, issuedAt, expiresAt
+	from registration_token
+	`
+
+func scanRegistrationToken(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*roll.RegistrationToken, error) {
+	var rt roll.RegistrationToken
+	err := scanner.Scan(&rt.TokenID, &rt.SecretHash, &rt.TokenType, &rt.ClientID, &rt.IssuedBy, &rt.Description,
+		&rt.IssuedAt, &rt.ExpiresAt)
+	return &rt, err
+}
+
+func (rtr *MBDRegistrationTokenRepo) RetrieveRegistrationToken(tokenID string) (*roll.RegistrationToken, error) {
+	rt, err := scanRegistrationToken(rtr.db.QueryRow(registrationTokenSelect+"where tokenId = ?", tokenID))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+func (rtr *MBDRegistrationTokenRepo) ListInitialAccessTokens() ([]roll.RegistrationToken, error) {
+	rows, err := rtr.db.Query(registrationTokenSelect+"where tokenType = ? order by issuedAt", roll.InitialAccessTokenType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []roll.RegistrationToken
+	for rows.Next() {
+		rt, err := scanRegistrationToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, *rt)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (rtr *MBDRegistrationTokenRepo) DeleteRegistrationToken(tokenID string) error {
+	stmt, err := rtr.db.Prepare("delete from registration_token where tokenId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(tokenID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return roll.NoSuchRegistrationTokenError{}
+	}
+
+	return nil
+}
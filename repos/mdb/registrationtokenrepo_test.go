@@ -0,0 +1,62 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+)
+
+func TestRegistrationTokenLifecycle(t *testing.T) {
+	initial := &roll.RegistrationToken{
+		TokenID:     "initial-123",
+		SecretHash:  "hashed",
+		TokenType:   roll.InitialAccessTokenType,
+		IssuedBy:    "an-admin",
+		Description: "partner onboarding",
+		IssuedAt:    1000,
+		ExpiresAt:   2000,
+	}
+
+	rtRepo := NewMBDRegistrationTokenRepo()
+	err := rtRepo.StoreRegistrationToken(initial)
+	if assert.Nil(t, err) {
+		defer rtRepo.DeleteRegistrationToken(initial.TokenID)
+	}
+
+	registration := &roll.RegistrationToken{
+		TokenID:    "registration-123",
+		SecretHash: "hashed",
+		TokenType:  roll.RegistrationAccessTokenType,
+		ClientID:   "123",
+		IssuedBy:   "an-admin",
+		IssuedAt:   1000,
+	}
+
+	err = rtRepo.StoreRegistrationToken(registration)
+	if assert.Nil(t, err) {
+		defer rtRepo.DeleteRegistrationToken(registration.TokenID)
+	}
+
+	retrieved, err := rtRepo.RetrieveRegistrationToken("registration-123")
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, "123", retrieved.ClientID)
+		assert.Equal(t, roll.RegistrationAccessTokenType, retrieved.TokenType)
+		assert.Equal(t, int64(0), retrieved.ExpiresAt)
+	}
+
+	tokens, err := rtRepo.ListInitialAccessTokens()
+	assert.Nil(t, err)
+	for _, token := range tokens {
+		assert.Equal(t, roll.InitialAccessTokenType, token.TokenType)
+	}
+
+	retrieved, err = rtRepo.RetrieveRegistrationToken("no-such-token")
+	assert.Nil(t, err)
+	assert.Nil(t, retrieved)
+
+	err = rtRepo.DeleteRegistrationToken("no-such-token")
+	_, ok := err.(roll.NoSuchRegistrationTokenError)
+	assert.True(t, ok)
+}
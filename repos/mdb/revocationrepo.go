@@ -0,0 +1,62 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"time"
+)
+
+type MBDRevocationRepo struct {
+	db *sql.DB
+}
+
+func NewMBDRevocationRepo() *MBDRevocationRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDRevocationRepo{
+		db: db,
+	}
+}
+
+func (rr *MBDRevocationRepo) RevokeToken(tokenID string, expiresAt int64) error {
+	//Entries for tokens that have since expired are no longer needed, so clear them out as we go
+	if err := rr.purgeExpired(); err != nil {
+		log.Info("Error purging expired revocations: ", err.Error())
+	}
+
+	stmt, err := rr.db.Prepare("insert into revoked_token(tokenId, expiresAt) values(?,?) on duplicate key update expiresAt = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(tokenID, expiresAt, expiresAt)
+	return err
+}
+
+func (rr *MBDRevocationRepo) IsTokenRevoked(tokenID string) (bool, error) {
+	var count int
+
+	err := rr.db.QueryRow("select count(*) from revoked_token where tokenId = ? and expiresAt > ?",
+		tokenID, time.Now().Unix()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (rr *MBDRevocationRepo) purgeExpired() error {
+	stmt, err := rr.db.Prepare("delete from revoked_token where expiresAt <= ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(time.Now().Unix())
+	return err
+}
@@ -0,0 +1,35 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRevokeToken(t *testing.T) {
+	revocationRepo := NewMBDRevocationRepo()
+
+	revoked, err := revocationRepo.IsTokenRevoked("revoked-jti")
+	if assert.Nil(t, err) {
+		assert.False(t, revoked)
+	}
+
+	err = revocationRepo.RevokeToken("revoked-jti", time.Now().Add(time.Hour).Unix())
+	assert.Nil(t, err)
+
+	revoked, err = revocationRepo.IsTokenRevoked("revoked-jti")
+	if assert.Nil(t, err) {
+		assert.True(t, revoked)
+	}
+
+	//Revocations past the token expiry no longer count
+	err = revocationRepo.RevokeToken("expired-jti", time.Now().Add(-1*time.Hour).Unix())
+	assert.Nil(t, err)
+
+	revoked, err = revocationRepo.IsTokenRevoked("expired-jti")
+	if assert.Nil(t, err) {
+		assert.False(t, revoked)
+	}
+}
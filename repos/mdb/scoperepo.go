@@ -0,0 +1,92 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+)
+
+type MBDScopeRepo struct {
+	db *sql.DB
+}
+
+func NewMBDScopeRepo() *MBDScopeRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDScopeRepo{
+		db: db,
+	}
+}
+
+func (sr *MBDScopeRepo) StoreScope(scope *roll.Scope) error {
+	stmt, err := sr.db.Prepare(`insert into scope(name, description) values(?,?)
+	on duplicate key update description = values(description)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(scope.Name, scope.Description)
+	return err
+}
+
+func (sr *MBDScopeRepo) RetrieveScope(name string) (*roll.Scope, error) {
+	var scope roll.Scope
+	err := sr.db.QueryRow("select name, description from scope where name = ?", name).Scan(&scope.Name, &scope.Description)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &scope, nil
+}
+
+func (sr *MBDScopeRepo) ListScopes() ([]roll.Scope, error) {
+	rows, err := sr.db.Query("select name, description from scope order by name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scopes []roll.Scope
+	for rows.Next() {
+		var scope roll.Scope
+		if err := rows.Scan(&scope.Name, &scope.Description); err != nil {
+			return nil, err
+		}
+
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, rows.Err()
+}
+
+func (sr *MBDScopeRepo) DeleteScope(name string) error {
+	stmt, err := sr.db.Prepare("delete from scope where name = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(name)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return roll.NoSuchScopeError{}
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+)
+
+func TestScopeLifecycle(t *testing.T) {
+	scopeRepo := NewMBDScopeRepo()
+
+	err := scopeRepo.StoreScope(&roll.Scope{Name: "orders.read", Description: "Read orders"})
+	if assert.Nil(t, err) {
+		defer scopeRepo.DeleteScope("orders.read")
+	}
+
+	err = scopeRepo.StoreScope(&roll.Scope{Name: "orders.read", Description: "Read your orders"})
+	assert.Nil(t, err)
+
+	scope, err := scopeRepo.RetrieveScope("orders.read")
+	if assert.Nil(t, err) && assert.NotNil(t, scope) {
+		assert.Equal(t, "Read your orders", scope.Description)
+	}
+
+	scopes, err := scopeRepo.ListScopes()
+	assert.Nil(t, err)
+	assert.True(t, len(scopes) > 0)
+
+	scope, err = scopeRepo.RetrieveScope("no.such.scope")
+	assert.Nil(t, err)
+	assert.Nil(t, scope)
+
+	err = scopeRepo.DeleteScope("no.such.scope")
+	_, ok := err.(roll.NoSuchScopeError)
+	assert.True(t, ok)
+}
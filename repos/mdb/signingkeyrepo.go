@@ -0,0 +1,109 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+)
+
+type MBDSigningKeyRepo struct {
+	db *sql.DB
+}
+
+func NewMBDSigningKeyRepo() *MBDSigningKeyRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDSigningKeyRepo{
+		db: db,
+	}
+}
+
+func (skr *MBDSigningKeyRepo) StoreSigningKey(key *roll.SigningKey) error {
+	stmt, err := skr.db.Prepare("insert into signing_key(clientId, version, keyId, createdAt, retiresAt) values(?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(
+		key.ClientID,
+		key.Version,
+		key.KeyID,
+		key.CreatedAt,
+		key.RetiresAt,
+	)
+
+	return err
+}
+
+func (skr *MBDSigningKeyRepo) ListSigningKeys(clientID string) ([]roll.SigningKey, error) {
+	const listSql = `
+	select clientId, keyId, version, createdAt, retiresAt from signing_key where clientId = ? order by version
+	`
+
+	rows, err := skr.db.Query(listSql, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []roll.SigningKey
+	for rows.Next() {
+		var key roll.SigningKey
+		err = rows.Scan(&key.ClientID, &key.KeyID, &key.Version, &key.CreatedAt, &key.RetiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (skr *MBDSigningKeyRepo) RetrieveSigningKey(clientID, keyID string) (*roll.SigningKey, error) {
+	const keySql = `
+	select clientId, keyId, version, createdAt, retiresAt from signing_key where clientId = ? and keyId = ?
+	`
+
+	var key roll.SigningKey
+	err := skr.db.QueryRow(keySql, clientID, keyID).Scan(
+		&key.ClientID, &key.KeyID, &key.Version, &key.CreatedAt, &key.RetiresAt,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (skr *MBDSigningKeyRepo) RetireSigningKey(clientID string, version int, retiresAt int64) error {
+	stmt, err := skr.db.Prepare("update signing_key set retiresAt = ? where clientId = ? and version = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(retiresAt, clientID, version)
+	return err
+}
+
+func (skr *MBDSigningKeyRepo) delete(clientID string) error {
+	stmt, err := skr.db.Prepare("delete from signing_key where clientId = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(clientID)
+	return err
+}
@@ -0,0 +1,42 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+	"time"
+)
+
+func TestSigningKeyVersions(t *testing.T) {
+	skRepo := NewMBDSigningKeyRepo()
+	defer skRepo.delete("sk-client")
+
+	now := time.Now().Unix()
+	err := skRepo.StoreSigningKey(&roll.SigningKey{ClientID: "sk-client", KeyID: "kid-1", Version: 1, CreatedAt: now})
+	assert.Nil(t, err)
+	err = skRepo.StoreSigningKey(&roll.SigningKey{ClientID: "sk-client", KeyID: "kid-2", Version: 2, CreatedAt: now})
+	assert.Nil(t, err)
+
+	err = skRepo.RetireSigningKey("sk-client", 1, now+60)
+	assert.Nil(t, err)
+
+	keys, err := skRepo.ListSigningKeys("sk-client")
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(keys)) {
+		assert.Equal(t, "kid-1", keys[0].KeyID)
+		assert.Equal(t, roll.SigningKeyRetiring, keys[0].State())
+		assert.Equal(t, "kid-2", keys[1].KeyID)
+		assert.Equal(t, roll.SigningKeyActive, keys[1].State())
+	}
+
+	key, err := skRepo.RetrieveSigningKey("sk-client", "kid-1")
+	if assert.Nil(t, err) && assert.NotNil(t, key) {
+		assert.Equal(t, 1, key.Version)
+		assert.Equal(t, now+60, key.RetiresAt)
+	}
+
+	key, err = skRepo.RetrieveSigningKey("sk-client", "no-such-kid")
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+}
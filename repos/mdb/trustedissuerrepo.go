@@ -0,0 +1,124 @@
+package mdb
+
+import (
+	"database/sql"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/roll"
+)
+
+type MBDTrustedIssuerRepo struct {
+	db *sql.DB
+}
+
+func NewMBDTrustedIssuerRepo() *MBDTrustedIssuerRepo {
+	//If we error out, there nothing we can do to recover, so we're done.
+	db, err := dbutil.CreateMariaDBSqlDB()
+	if err != nil {
+		log.Fatal("Error prepping for MariaDB connection", err.Error())
+	}
+	return &MBDTrustedIssuerRepo{
+		db: db,
+	}
+}
+
+func (tir *MBDTrustedIssuerRepo) StoreTrustedIssuer(ti *roll.TrustedIssuer) error {
+	//The issuer and audience pair identifies a single application, so only its owner may replace it
+	existing, err := tir.RetrieveTrustedIssuer(ti.Issuer, ti.Audience)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && existing.ClientID != ti.ClientID {
+		log.Info("Issuer ", ti.Issuer, " for audience ", ti.Audience, " registered to another application")
+		return roll.TrustedIssuerOwnerError{}
+	}
+
+	stmt, err := tir.db.Prepare(`insert into trusted_issuer(issuer, audience, clientId, publicKeys, allowedSubjects, allowedScopes)
+	values(?,?,?,?,?,?)
+	on duplicate key update publicKeys = values(publicKeys), allowedSubjects = values(allowedSubjects), allowedScopes = values(allowedScopes)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(
+		ti.Issuer,
+		ti.Audience,
+		ti.ClientID,
+		ti.PublicKeys,
+		ti.AllowedSubjects,
+		ti.AllowedScopes,
+	)
+
+	return err
+}
+
+const trustedIssuerSelect = `
+	select issuer, audience, clientId, publicKeys, allowedSubjects, allowedScopes
+	from trusted_issuer
+	`
+
+func scanTrustedIssuer(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*roll.TrustedIssuer, error) {
+	var ti roll.TrustedIssuer
+	err := scanner.Scan(&ti.Issuer, &ti.Audience, &ti.ClientID, &ti.PublicKeys, &ti.AllowedSubjects, &ti.AllowedScopes)
+	return &ti, err
+}
+
+func (tir *MBDTrustedIssuerRepo) RetrieveTrustedIssuer(issuer, audience string) (*roll.TrustedIssuer, error) {
+	ti, err := scanTrustedIssuer(tir.db.QueryRow(trustedIssuerSelect+"where issuer = ? and audience = ?", issuer, audience))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return ti, nil
+}
+
+func (tir *MBDTrustedIssuerRepo) ListTrustedIssuers(clientID string) ([]roll.TrustedIssuer, error) {
+	rows, err := tir.db.Query(trustedIssuerSelect+"where clientId = ?", clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var issuers []roll.TrustedIssuer
+	for rows.Next() {
+		ti, err := scanTrustedIssuer(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		issuers = append(issuers, *ti)
+	}
+
+	return issuers, rows.Err()
+}
+
+func (tir *MBDTrustedIssuerRepo) DeleteTrustedIssuer(clientID, issuer, audience string) error {
+	stmt, err := tir.db.Prepare("delete from trusted_issuer where clientId = ? and issuer = ? and audience = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(clientID, issuer, audience)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return roll.NoSuchTrustedIssuerError{}
+	}
+
+	return nil
+}
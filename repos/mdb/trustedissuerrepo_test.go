@@ -0,0 +1,48 @@
+// +build integration
+
+package mdb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/xtraclabs/roll/roll"
+	"testing"
+)
+
+func TestTrustedIssuerLifecycle(t *testing.T) {
+	ti := &roll.TrustedIssuer{
+		ClientID:      "123",
+		Issuer:        "https://idp.example.com",
+		Audience:      "https://roll.example.com",
+		PublicKeys:    "-----BEGIN PUBLIC KEY-----\nkey\n-----END PUBLIC KEY-----\n",
+		AllowedScopes: "read",
+	}
+
+	tiRepo := NewMBDTrustedIssuerRepo()
+	err := tiRepo.StoreTrustedIssuer(ti)
+	if assert.Nil(t, err) {
+		defer tiRepo.DeleteTrustedIssuer(ti.ClientID, ti.Issuer, ti.Audience)
+	}
+
+	ti.AllowedScopes = "read write"
+	err = tiRepo.StoreTrustedIssuer(ti)
+	assert.Nil(t, err)
+
+	retrieved, err := tiRepo.RetrieveTrustedIssuer(ti.Issuer, ti.Audience)
+	if assert.Nil(t, err) && assert.NotNil(t, retrieved) {
+		assert.Equal(t, "123", retrieved.ClientID)
+		assert.Equal(t, "read write", retrieved.AllowedScopes)
+		assert.Equal(t, "", retrieved.AllowedSubjects)
+	}
+
+	issuers, err := tiRepo.ListTrustedIssuers("123")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(issuers))
+
+	err = tiRepo.StoreTrustedIssuer(&roll.TrustedIssuer{ClientID: "456", Issuer: ti.Issuer, Audience: ti.Audience, PublicKeys: ti.PublicKeys})
+	_, ok := err.(roll.TrustedIssuerOwnerError)
+	assert.True(t, ok)
+
+	err = tiRepo.DeleteTrustedIssuer("456", ti.Issuer, ti.Audience)
+	_, ok = err.(roll.NoSuchTrustedIssuerError)
+	assert.True(t, ok)
+}
@@ -0,0 +1,107 @@
+package repos
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+)
+
+const (
+	ResourceIdentifier = "ResourceIdentifier"
+)
+
+//DynamoProtectedResourceRepo presents a repository interface for the protected resource registry,
+//backed by DynamoDB
+type DynamoProtectedResourceRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoProtectedResourceRepo returns a new instance of type DynamoProtectedResourceRepo
+func NewDynamoProtectedResourceRepo() *DynamoProtectedResourceRepo {
+	return &DynamoProtectedResourceRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func protectedResourceFromItem(item map[string]*dynamodb.AttributeValue) *roll.ProtectedResource {
+	return &roll.ProtectedResource{
+		Identifier:  extractString(item[ResourceIdentifier]),
+		Description: extractString(item[Description]),
+	}
+}
+
+//StoreProtectedResource stores or replaces a protected resource
+func (dpr *DynamoProtectedResourceRepo) StoreProtectedResource(resource *roll.ProtectedResource) error {
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(ddl.ProtectedResourceTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			ResourceIdentifier: {S: aws.String(resource.Identifier)},
+			Description:        {S: aws.String(resource.Description)},
+		},
+	}
+
+	_, err := dpr.client.PutItem(params)
+	return err
+}
+
+//RetrieveProtectedResource retrieves a protected resource. Note a nil pointer is returned if the resource
+//is not registered
+func (dpr *DynamoProtectedResourceRepo) RetrieveProtectedResource(identifier string) (*roll.ProtectedResource, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.ProtectedResourceTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			ResourceIdentifier: {S: aws.String(identifier)},
+		},
+	}
+
+	out, err := dpr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return protectedResourceFromItem(out.Item), nil
+}
+
+//ListProtectedResources lists the registered protected resources
+func (dpr *DynamoProtectedResourceRepo) ListProtectedResources() ([]roll.ProtectedResource, error) {
+	params := &dynamodb.ScanInput{
+		TableName: aws.String(ddl.ProtectedResourceTableName),
+	}
+
+	resp, err := dpr.client.Scan(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []roll.ProtectedResource
+	for _, item := range resp.Items {
+		resources = append(resources, *protectedResourceFromItem(item))
+	}
+
+	return resources, nil
+}
+
+//DeleteProtectedResource removes a resource from the registry. A NoSuchProtectedResourceError is
+//returned if the resource is not registered.
+func (dpr *DynamoProtectedResourceRepo) DeleteProtectedResource(identifier string) error {
+	params := &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddl.ProtectedResourceTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			ResourceIdentifier: {S: aws.String(identifier)},
+		},
+		ConditionExpression: aws.String("attribute_exists(ResourceIdentifier)"),
+	}
+
+	_, err := dpr.client.DeleteItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		return roll.NoSuchProtectedResourceError{}
+	}
+
+	return err
+}
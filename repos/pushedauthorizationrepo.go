@@ -0,0 +1,92 @@
+package repos
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+)
+
+const (
+	RequestURI          = "RequestURI"
+	AuthorizationParams = "AuthorizationParams"
+)
+
+//DynamoPushedAuthorizationRepo presents a repository interface for pushed authorization requests backed
+//by DynamoDB
+type DynamoPushedAuthorizationRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoPushedAuthorizationRepo returns a new instance of type DynamoPushedAuthorizationRepo
+func NewDynamoPushedAuthorizationRepo() *DynamoPushedAuthorizationRepo {
+	return &DynamoPushedAuthorizationRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+//StorePushedAuthorization stores a pushed authorization request
+func (dpr *DynamoPushedAuthorizationRepo) StorePushedAuthorization(pa *roll.PushedAuthorization) error {
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(ddl.PushedAuthorizationTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			RequestURI:          {S: aws.String(pa.RequestURI)},
+			ClientID:            {S: aws.String(pa.ClientID)},
+			AuthorizationParams: {S: aws.String(pa.Params)},
+			ExpiresAt:           {N: aws.String(strconv.FormatInt(pa.ExpiresAt, 10))},
+		},
+	}
+
+	_, err := dpr.client.PutItem(params)
+	return err
+}
+
+//RetrievePushedAuthorization retrieves a pushed authorization request. Note a nil pointer is returned
+//if there is no record for the given request uri
+func (dpr *DynamoPushedAuthorizationRepo) RetrievePushedAuthorization(requestURI string) (*roll.PushedAuthorization, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.PushedAuthorizationTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			RequestURI: {S: aws.String(requestURI)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	out, err := dpr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return &roll.PushedAuthorization{
+		RequestURI: extractString(out.Item[RequestURI]),
+		ClientID:   extractString(out.Item[ClientID]),
+		Params:     extractString(out.Item[AuthorizationParams]),
+		ExpiresAt:  extractInt64(out.Item[ExpiresAt]),
+	}, nil
+}
+
+//DeletePushedAuthorization removes a pushed authorization request. The delete is conditional on the
+//record existing so a request uri can be redeemed only once - a NoSuchPushedAuthorizationError is
+//returned if it has already been removed.
+func (dpr *DynamoPushedAuthorizationRepo) DeletePushedAuthorization(requestURI string) error {
+	params := &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddl.PushedAuthorizationTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			RequestURI: {S: aws.String(requestURI)},
+		},
+		ConditionExpression: aws.String("attribute_exists(RequestURI)"),
+	}
+
+	_, err := dpr.client.DeleteItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		return roll.NoSuchPushedAuthorizationError{}
+	}
+
+	return err
+}
@@ -0,0 +1,238 @@
+package repos
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+)
+
+const (
+	TokenID   = "TokenID"
+	FamilyID  = "FamilyID"
+	Subject   = "Subject"
+	Scope     = "Scope"
+	ExpiresAt = "ExpiresAt"
+	Used      = "Used"
+	Revoked   = "Revoked"
+	Resources = "Resources"
+
+	conditionalCheckFailed = "ConditionalCheckFailedException"
+)
+
+//DynamoRefreshTokenRepo presents a repository interface for storing and retrieving refresh tokens,
+//backed by DynamoDB
+type DynamoRefreshTokenRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoRefreshTokenRepo returns a new instance of type DynamoRefreshTokenRepo
+func NewDynamoRefreshTokenRepo() *DynamoRefreshTokenRepo {
+	return &DynamoRefreshTokenRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func extractInt64(attrval *dynamodb.AttributeValue) int64 {
+	if attrval == nil || attrval.N == nil {
+		return 0
+	}
+
+	val, err := strconv.ParseInt(*attrval.N, 10, 64)
+	if err != nil {
+		log.Info("Unable to parse numeric attribute: ", *attrval.N)
+		return 0
+	}
+
+	return val
+}
+
+func extractBool(attrval *dynamodb.AttributeValue) bool {
+	if attrval == nil || attrval.BOOL == nil {
+		return false
+	}
+
+	return *attrval.BOOL
+}
+
+func isConditionalCheckFailure(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == conditionalCheckFailed
+}
+
+//StoreRefreshToken stores a refresh token in DynamoDB
+func (rtr *DynamoRefreshTokenRepo) StoreRefreshToken(rt *roll.RefreshToken) error {
+	tokenAttrs := map[string]*dynamodb.AttributeValue{
+		TokenID:   {S: aws.String(rt.TokenID)},
+		FamilyID:  {S: aws.String(rt.FamilyID)},
+		ClientID:  {S: aws.String(rt.ClientID)},
+		Subject:   {S: aws.String(rt.Subject)},
+		ExpiresAt: {N: aws.String(strconv.FormatInt(rt.ExpiresAt, 10))},
+		Used:      {BOOL: aws.Bool(rt.Used)},
+		Revoked:   {BOOL: aws.Bool(rt.Revoked)},
+	}
+
+	//Dynamo does not allow empty string attributes
+	if rt.Scope != "" {
+		tokenAttrs[Scope] = &dynamodb.AttributeValue{S: aws.String(rt.Scope)}
+	}
+
+	if rt.Resources != "" {
+		tokenAttrs[Resources] = &dynamodb.AttributeValue{S: aws.String(rt.Resources)}
+	}
+
+	params := &dynamodb.PutItemInput{
+		TableName:           aws.String(ddl.RefreshTokenTableName),
+		ConditionExpression: aws.String("attribute_not_exists(TokenID)"),
+		Item:                tokenAttrs,
+	}
+
+	_, err := rtr.client.PutItem(params)
+	return err
+}
+
+//RetrieveRefreshToken retrieves a refresh token from DynamoDB. Note a nil pointer is returned
+//if there is no token stored for the given token id
+func (rtr *DynamoRefreshTokenRepo) RetrieveRefreshToken(tokenID string) (*roll.RefreshToken, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.RefreshTokenTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			TokenID: {S: aws.String(tokenID)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	out, err := rtr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return &roll.RefreshToken{
+		TokenID:   extractString(out.Item[TokenID]),
+		FamilyID:  extractString(out.Item[FamilyID]),
+		ClientID:  extractString(out.Item[ClientID]),
+		Subject:   extractString(out.Item[Subject]),
+		Scope:     extractString(out.Item[Scope]),
+		ExpiresAt: extractInt64(out.Item[ExpiresAt]),
+		Used:      extractBool(out.Item[Used]),
+		Revoked:   extractBool(out.Item[Revoked]),
+		Resources: extractString(out.Item[Resources]),
+	}, nil
+}
+
+//MarkRefreshTokenUsed flags the token as used. The update is conditional on the token not having
+//been used already so concurrent redemptions of the same token can be detected.
+func (rtr *DynamoRefreshTokenRepo) MarkRefreshTokenUsed(tokenID string) error {
+	params := &dynamodb.UpdateItemInput{
+		TableName: aws.String(ddl.RefreshTokenTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			TokenID: {S: aws.String(tokenID)},
+		},
+		UpdateExpression:    aws.String("SET Used = :used"),
+		ConditionExpression: aws.String("attribute_exists(TokenID) AND Used = :unused"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":used":   {BOOL: aws.Bool(true)},
+			":unused": {BOOL: aws.Bool(false)},
+		},
+	}
+
+	_, err := rtr.client.UpdateItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		log.Info("Refresh token already used: ", tokenID)
+		return roll.RefreshTokenReuseError{}
+	}
+
+	return err
+}
+
+//RevokeRefreshTokenFamily flags every token in the family as revoked
+func (rtr *DynamoRefreshTokenRepo) RevokeRefreshTokenFamily(familyID string) error {
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(ddl.RefreshTokenTableName),
+		IndexName:              aws.String(ddl.FamilyIDIndex),
+		KeyConditionExpression: aws.String("FamilyID=:familyID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":familyID": {S: aws.String(familyID)},
+		},
+	}
+
+	//A family may span more than one page of query results
+	var items []map[string]*dynamodb.AttributeValue
+	err := rtr.client.QueryPages(params, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		items = append(items, page.Items...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Revoking ", len(items), " refresh tokens in family ", familyID)
+	for _, item := range items {
+		updateParams := &dynamodb.UpdateItemInput{
+			TableName: aws.String(ddl.RefreshTokenTableName),
+			Key: map[string]*dynamodb.AttributeValue{
+				TokenID: item[TokenID],
+			},
+			UpdateExpression: aws.String("SET Revoked = :revoked"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":revoked": {BOOL: aws.Bool(true)},
+			},
+		}
+
+		if _, err := rtr.client.UpdateItem(updateParams); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//RevokeSubjectRefreshTokens flags every token issued to the application on behalf of the subject as revoked
+func (rtr *DynamoRefreshTokenRepo) RevokeSubjectRefreshTokens(subject, clientID string) error {
+	params := &dynamodb.ScanInput{
+		TableName:        aws.String(ddl.RefreshTokenTableName),
+		FilterExpression: aws.String("Subject = :subject AND ClientID = :clientID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":subject":  {S: aws.String(subject)},
+			":clientID": {S: aws.String(clientID)},
+		},
+	}
+
+	//The filter is applied a page at a time, so every page must be scanned
+	var items []map[string]*dynamodb.AttributeValue
+	err := rtr.client.ScanPages(params, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		items = append(items, page.Items...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Revoking ", len(items), " refresh tokens for ", subject, " issued to ", clientID)
+	for _, item := range items {
+		updateParams := &dynamodb.UpdateItemInput{
+			TableName: aws.String(ddl.RefreshTokenTableName),
+			Key: map[string]*dynamodb.AttributeValue{
+				TokenID: item[TokenID],
+			},
+			UpdateExpression: aws.String("SET Revoked = :revoked"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":revoked": {BOOL: aws.Bool(true)},
+			},
+		}
+
+		if _, err := rtr.client.UpdateItem(updateParams); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
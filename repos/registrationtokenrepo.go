@@ -0,0 +1,136 @@
+package repos
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+)
+
+const (
+	SecretHash = "SecretHash"
+	TokenType  = "TokenType"
+	IssuedBy   = "IssuedBy"
+	IssuedAt   = "IssuedAt"
+)
+
+//DynamoRegistrationTokenRepo presents a repository interface for the tokens used with the dynamic client
+//registration endpoints, backed by DynamoDB
+type DynamoRegistrationTokenRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoRegistrationTokenRepo returns a new instance of type DynamoRegistrationTokenRepo
+func NewDynamoRegistrationTokenRepo() *DynamoRegistrationTokenRepo {
+	return &DynamoRegistrationTokenRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func registrationTokenFromItem(item map[string]*dynamodb.AttributeValue) *roll.RegistrationToken {
+	return &roll.RegistrationToken{
+		TokenID:     extractString(item[TokenID]),
+		SecretHash:  extractString(item[SecretHash]),
+		TokenType:   extractString(item[TokenType]),
+		ClientID:    extractString(item[ClientID]),
+		IssuedBy:    extractString(item[IssuedBy]),
+		Description: extractString(item[Description]),
+		IssuedAt:    extractInt64(item[IssuedAt]),
+		ExpiresAt:   extractInt64(item[ExpiresAt]),
+	}
+}
+
+//StoreRegistrationToken stores a registration token
+func (drr *DynamoRegistrationTokenRepo) StoreRegistrationToken(token *roll.RegistrationToken) error {
+	attrs := map[string]*dynamodb.AttributeValue{
+		TokenID:    {S: aws.String(token.TokenID)},
+		SecretHash: {S: aws.String(token.SecretHash)},
+		TokenType:  {S: aws.String(token.TokenType)},
+		IssuedBy:   {S: aws.String(token.IssuedBy)},
+		IssuedAt:   {N: aws.String(strconv.FormatInt(token.IssuedAt, 10))},
+		ExpiresAt:  {N: aws.String(strconv.FormatInt(token.ExpiresAt, 10))},
+	}
+
+	//Dynamo does not allow empty string attributes
+	if token.ClientID != "" {
+		attrs[ClientID] = &dynamodb.AttributeValue{S: aws.String(token.ClientID)}
+	}
+
+	if token.Description != "" {
+		attrs[Description] = &dynamodb.AttributeValue{S: aws.String(token.Description)}
+	}
+
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(ddl.RegistrationTokenTableName),
+		Item:      attrs,
+	}
+
+	_, err := drr.client.PutItem(params)
+	return err
+}
+
+//RetrieveRegistrationToken retrieves a registration token. Note a nil pointer is returned if there is
+//no such token
+func (drr *DynamoRegistrationTokenRepo) RetrieveRegistrationToken(tokenID string) (*roll.RegistrationToken, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.RegistrationTokenTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			TokenID: {S: aws.String(tokenID)},
+		},
+	}
+
+	out, err := drr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return registrationTokenFromItem(out.Item), nil
+}
+
+//ListInitialAccessTokens lists the initial access tokens issued by admins
+func (drr *DynamoRegistrationTokenRepo) ListInitialAccessTokens() ([]roll.RegistrationToken, error) {
+	params := &dynamodb.ScanInput{
+		TableName:        aws.String(ddl.RegistrationTokenTableName),
+		FilterExpression: aws.String("TokenType=:tokenType"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":tokenType": {S: aws.String(roll.InitialAccessTokenType)},
+		},
+	}
+
+	resp, err := drr.client.Scan(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []roll.RegistrationToken
+	for _, item := range resp.Items {
+		tokens = append(tokens, *registrationTokenFromItem(item))
+	}
+
+	return tokens, nil
+}
+
+//DeleteRegistrationToken removes a registration token. A NoSuchRegistrationTokenError is returned if
+//there is no such token.
+func (drr *DynamoRegistrationTokenRepo) DeleteRegistrationToken(tokenID string) error {
+	params := &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddl.RegistrationTokenTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			TokenID: {S: aws.String(tokenID)},
+		},
+		ConditionExpression: aws.String("attribute_exists(TokenID)"),
+	}
+
+	_, err := drr.client.DeleteItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		return roll.NoSuchRegistrationTokenError{}
+	}
+
+	return err
+}
@@ -0,0 +1,59 @@
+package repos
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"strconv"
+	"time"
+)
+
+//DynamoRevocationRepo presents a repository interface for recording revoked tokens, backed by DynamoDB
+type DynamoRevocationRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoRevocationRepo returns a new instance of type DynamoRevocationRepo
+func NewDynamoRevocationRepo() *DynamoRevocationRepo {
+	return &DynamoRevocationRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+//RevokeToken records the token id as revoked. The expiry time is stored with the item so the
+//table's time to live setting can remove it once the token has expired.
+func (rr *DynamoRevocationRepo) RevokeToken(tokenID string, expiresAt int64) error {
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(ddl.RevokedTokenTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			TokenID:   {S: aws.String(tokenID)},
+			ExpiresAt: {N: aws.String(strconv.FormatInt(expiresAt, 10))},
+		},
+	}
+
+	_, err := rr.client.PutItem(params)
+	return err
+}
+
+//IsTokenRevoked returns true if the token id has been revoked. As dynamo only purges expired
+//items periodically, entries past their expiry are ignored.
+func (rr *DynamoRevocationRepo) IsTokenRevoked(tokenID string) (bool, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.RevokedTokenTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			TokenID: {S: aws.String(tokenID)},
+		},
+	}
+
+	out, err := rr.client.GetItem(params)
+	if err != nil {
+		return false, err
+	}
+
+	if len(out.Item) == 0 {
+		return false, nil
+	}
+
+	return extractInt64(out.Item[ExpiresAt]) > time.Now().Unix(), nil
+}
@@ -0,0 +1,106 @@
+package repos
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+)
+
+const (
+	ScopeName   = "ScopeName"
+	Description = "Description"
+)
+
+//DynamoScopeRepo presents a repository interface for the scope registry, backed by DynamoDB
+type DynamoScopeRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoScopeRepo returns a new instance of type DynamoScopeRepo
+func NewDynamoScopeRepo() *DynamoScopeRepo {
+	return &DynamoScopeRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func scopeFromItem(item map[string]*dynamodb.AttributeValue) *roll.Scope {
+	return &roll.Scope{
+		Name:        extractString(item[ScopeName]),
+		Description: extractString(item[Description]),
+	}
+}
+
+//StoreScope stores or replaces a scope
+func (dsr *DynamoScopeRepo) StoreScope(scope *roll.Scope) error {
+	params := &dynamodb.PutItemInput{
+		TableName: aws.String(ddl.ScopeTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			ScopeName:   {S: aws.String(scope.Name)},
+			Description: {S: aws.String(scope.Description)},
+		},
+	}
+
+	_, err := dsr.client.PutItem(params)
+	return err
+}
+
+//RetrieveScope retrieves a scope. Note a nil pointer is returned if the scope is not registered
+func (dsr *DynamoScopeRepo) RetrieveScope(name string) (*roll.Scope, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.ScopeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			ScopeName: {S: aws.String(name)},
+		},
+	}
+
+	out, err := dsr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return scopeFromItem(out.Item), nil
+}
+
+//ListScopes lists the registered scopes
+func (dsr *DynamoScopeRepo) ListScopes() ([]roll.Scope, error) {
+	params := &dynamodb.ScanInput{
+		TableName: aws.String(ddl.ScopeTableName),
+	}
+
+	resp, err := dsr.client.Scan(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []roll.Scope
+	for _, item := range resp.Items {
+		scopes = append(scopes, *scopeFromItem(item))
+	}
+
+	return scopes, nil
+}
+
+//DeleteScope removes a scope from the registry. A NoSuchScopeError is returned if the scope is
+//not registered.
+func (dsr *DynamoScopeRepo) DeleteScope(name string) error {
+	params := &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddl.ScopeTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			ScopeName: {S: aws.String(name)},
+		},
+		ConditionExpression: aws.String("attribute_exists(ScopeName)"),
+	}
+
+	_, err := dsr.client.DeleteItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		return roll.NoSuchScopeError{}
+	}
+
+	return err
+}
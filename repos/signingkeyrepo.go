@@ -0,0 +1,127 @@
+package repos
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+	"strconv"
+)
+
+const (
+	KeyID     = "KeyID"
+	Version   = "Version"
+	CreatedAt = "CreatedAt"
+	RetiresAt = "RetiresAt"
+)
+
+//DynamoSigningKeyRepo presents a repository interface for recording application signing key versions,
+//backed by DynamoDB
+type DynamoSigningKeyRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoSigningKeyRepo returns a new instance of type DynamoSigningKeyRepo
+func NewDynamoSigningKeyRepo() *DynamoSigningKeyRepo {
+	return &DynamoSigningKeyRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func signingKeyFromItem(item map[string]*dynamodb.AttributeValue) *roll.SigningKey {
+	return &roll.SigningKey{
+		ClientID:  extractString(item[ClientID]),
+		KeyID:     extractString(item[KeyID]),
+		Version:   int(extractInt64(item[Version])),
+		CreatedAt: extractInt64(item[CreatedAt]),
+		RetiresAt: extractInt64(item[RetiresAt]),
+	}
+}
+
+//StoreSigningKey records a signing key version in DynamoDB
+func (skr *DynamoSigningKeyRepo) StoreSigningKey(key *roll.SigningKey) error {
+	params := &dynamodb.PutItemInput{
+		TableName:           aws.String(ddl.SigningKeyTableName),
+		ConditionExpression: aws.String("attribute_not_exists(Version)"),
+		Item: map[string]*dynamodb.AttributeValue{
+			ClientID:  {S: aws.String(key.ClientID)},
+			KeyID:     {S: aws.String(key.KeyID)},
+			Version:   {N: aws.String(strconv.Itoa(key.Version))},
+			CreatedAt: {N: aws.String(strconv.FormatInt(key.CreatedAt, 10))},
+			RetiresAt: {N: aws.String(strconv.FormatInt(key.RetiresAt, 10))},
+		},
+	}
+
+	_, err := skr.client.PutItem(params)
+	return err
+}
+
+//ListSigningKeys returns the signing key versions recorded for the application, oldest first
+func (skr *DynamoSigningKeyRepo) ListSigningKeys(clientID string) ([]roll.SigningKey, error) {
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(ddl.SigningKeyTableName),
+		KeyConditionExpression: aws.String("ClientID=:clientID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":clientID": {S: aws.String(clientID)},
+		},
+		ScanIndexForward: aws.Bool(true),
+		ConsistentRead:   aws.Bool(true),
+	}
+
+	resp, err := skr.client.Query(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []roll.SigningKey
+	for _, item := range resp.Items {
+		keys = append(keys, *signingKeyFromItem(item))
+	}
+
+	return keys, nil
+}
+
+//RetrieveSigningKey retrieves a signing key version by key id. Note a nil pointer is returned if the
+//application has no such key
+func (skr *DynamoSigningKeyRepo) RetrieveSigningKey(clientID, keyID string) (*roll.SigningKey, error) {
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(ddl.SigningKeyTableName),
+		KeyConditionExpression: aws.String("ClientID=:clientID"),
+		FilterExpression:       aws.String("KeyID=:keyID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":clientID": {S: aws.String(clientID)},
+			":keyID":    {S: aws.String(keyID)},
+		},
+	}
+
+	resp, err := skr.client.Query(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp == nil || *resp.Count == 0 {
+		return nil, nil
+	}
+
+	return signingKeyFromItem(resp.Items[0]), nil
+}
+
+//RetireSigningKey sets the retirement time of a signing key version
+func (skr *DynamoSigningKeyRepo) RetireSigningKey(clientID string, version int, retiresAt int64) error {
+	params := &dynamodb.UpdateItemInput{
+		TableName: aws.String(ddl.SigningKeyTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			ClientID: {S: aws.String(clientID)},
+			Version:  {N: aws.String(strconv.Itoa(version))},
+		},
+		UpdateExpression:    aws.String("SET RetiresAt = :retiresAt"),
+		ConditionExpression: aws.String("attribute_exists(Version)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":retiresAt": {N: aws.String(strconv.FormatInt(retiresAt, 10))},
+		},
+	}
+
+	_, err := skr.client.UpdateItem(params)
+	return err
+}
@@ -0,0 +1,147 @@
+package repos
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/xtraclabs/roll/dbutil"
+	"github.com/xtraclabs/roll/repos/ddl"
+	"github.com/xtraclabs/roll/roll"
+)
+
+const (
+	Issuer          = "Issuer"
+	Audience        = "Audience"
+	PublicKeys      = "PublicKeys"
+	AllowedSubjects = "AllowedSubjects"
+)
+
+//DynamoTrustedIssuerRepo presents a repository interface for the trusted issuer registry, backed by DynamoDB
+type DynamoTrustedIssuerRepo struct {
+	client *dynamodb.DynamoDB
+}
+
+//NewDynamoTrustedIssuerRepo returns a new instance of type DynamoTrustedIssuerRepo
+func NewDynamoTrustedIssuerRepo() *DynamoTrustedIssuerRepo {
+	return &DynamoTrustedIssuerRepo{
+		client: dbutil.CreateDynamoDBClient(),
+	}
+}
+
+func trustedIssuerFromItem(item map[string]*dynamodb.AttributeValue) *roll.TrustedIssuer {
+	return &roll.TrustedIssuer{
+		ClientID:        extractString(item[ClientID]),
+		Issuer:          extractString(item[Issuer]),
+		Audience:        extractString(item[Audience]),
+		PublicKeys:      extractString(item[PublicKeys]),
+		AllowedSubjects: extractString(item[AllowedSubjects]),
+		AllowedScopes:   extractString(item[AllowedScopes]),
+	}
+}
+
+//StoreTrustedIssuer stores or replaces a trusted issuer. The store fails with a TrustedIssuerOwnerError if the
+//issuer and audience are already registered by another application.
+func (dtr *DynamoTrustedIssuerRepo) StoreTrustedIssuer(ti *roll.TrustedIssuer) error {
+	attrs := map[string]*dynamodb.AttributeValue{
+		ClientID:   {S: aws.String(ti.ClientID)},
+		Issuer:     {S: aws.String(ti.Issuer)},
+		Audience:   {S: aws.String(ti.Audience)},
+		PublicKeys: {S: aws.String(ti.PublicKeys)},
+	}
+
+	//Dynamo does not allow empty string attributes
+	if ti.AllowedSubjects != "" {
+		attrs[AllowedSubjects] = &dynamodb.AttributeValue{S: aws.String(ti.AllowedSubjects)}
+	}
+
+	if ti.AllowedScopes != "" {
+		attrs[AllowedScopes] = &dynamodb.AttributeValue{S: aws.String(ti.AllowedScopes)}
+	}
+
+	params := &dynamodb.PutItemInput{
+		TableName:           aws.String(ddl.TrustedIssuerTableName),
+		ConditionExpression: aws.String("attribute_not_exists(Issuer) OR ClientID = :clientID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":clientID": {S: aws.String(ti.ClientID)},
+		},
+		Item: attrs,
+	}
+
+	_, err := dtr.client.PutItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		log.Info("Issuer ", ti.Issuer, " for audience ", ti.Audience, " registered to another application")
+		return roll.TrustedIssuerOwnerError{}
+	}
+
+	return err
+}
+
+//RetrieveTrustedIssuer retrieves the trusted issuer registered for the issuer and audience. Note a nil
+//pointer is returned if the issuer is not registered
+func (dtr *DynamoTrustedIssuerRepo) RetrieveTrustedIssuer(issuer, audience string) (*roll.TrustedIssuer, error) {
+	params := &dynamodb.GetItemInput{
+		TableName: aws.String(ddl.TrustedIssuerTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			Issuer:   {S: aws.String(issuer)},
+			Audience: {S: aws.String(audience)},
+		},
+	}
+
+	out, err := dtr.client.GetItem(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	return trustedIssuerFromItem(out.Item), nil
+}
+
+//ListTrustedIssuers lists the issuers trusted by an application
+func (dtr *DynamoTrustedIssuerRepo) ListTrustedIssuers(clientID string) ([]roll.TrustedIssuer, error) {
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(ddl.TrustedIssuerTableName),
+		IndexName:              aws.String(ddl.ClientIDIndex),
+		KeyConditionExpression: aws.String("ClientID=:clientID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":clientID": {S: aws.String(clientID)},
+		},
+	}
+
+	resp, err := dtr.client.Query(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var issuers []roll.TrustedIssuer
+	for _, item := range resp.Items {
+		issuers = append(issuers, *trustedIssuerFromItem(item))
+	}
+
+	return issuers, nil
+}
+
+//DeleteTrustedIssuer removes an issuer trusted by an application. A NoSuchTrustedIssuerError is returned if the
+//application does not trust the issuer.
+func (dtr *DynamoTrustedIssuerRepo) DeleteTrustedIssuer(clientID, issuer, audience string) error {
+	params := &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddl.TrustedIssuerTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			Issuer:   {S: aws.String(issuer)},
+			Audience: {S: aws.String(audience)},
+		},
+		ConditionExpression: aws.String("ClientID = :clientID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":clientID": {S: aws.String(clientID)},
+		},
+	}
+
+	_, err := dtr.client.DeleteItem(params)
+	if err != nil && isConditionalCheckFailure(err) {
+		return roll.NoSuchTrustedIssuerError{}
+	}
+
+	return err
+}
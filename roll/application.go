@@ -2,25 +2,124 @@ package roll
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"github.com/xtraclabs/roll/login"
+	"github.com/xtraclabs/roll/signing"
+	"net"
 	"net/url"
 	"regexp"
 	"strings"
 )
 
+//Client authentication methods an application may use at the token endpoint - see RFC 7591 section 2.
+//Applications that do not specify their methods may use either client secret method.
+const (
+	ClientSecretBasic = "client_secret_basic"
+	ClientSecretPost  = "client_secret_post"
+	PrivateKeyJWT     = "private_key_jwt"
+)
+
+var defaultTokenEndpointAuthMethods = ClientSecretBasic + " " + ClientSecretPost
+
 //Application represents the data associated with an application that is exposed via the REST API
 type Application struct {
-	DeveloperEmail   string `json:"developerEmail"`
-	DeveloperID      string `json:developerID`
-	ClientID         string `json:"clientID"`
-	ApplicationName  string `json:"applicationName"`
-	ClientSecret     string `json:"clientSecret"`
-	RedirectURI      string `json:"redirectURI"`
-	LoginProvider    string `json:"loginProvider"`
-	JWTFlowPublicKey string `json:"jwtFlowPublicKey"`
-	JWTFlowIssuer    string `json:"jwtFlowIssuer`
-	JWTFlowAudience  string `json:"jwtFlowAudience"`
+	DeveloperEmail      string `json:"developerEmail"`
+	DeveloperID         string `json:developerID`
+	ClientID            string `json:"clientID"`
+	ApplicationName     string `json:"applicationName"`
+	ClientSecret        string `json:"clientSecret"`
+	LoginProvider       string `json:"loginProvider"`
+	JWTFlowPublicKey    string `json:"jwtFlowPublicKey"`
+	JWTFlowIssuer       string `json:"jwtFlowIssuer`
+	JWTFlowAudience     string `json:"jwtFlowAudience"`
+	AllowedScopes       string `json:"allowedScopes"`
+	PublicClient        bool   `json:"publicClient"`
+	AccessTokenLifetime int64  `json:"accessTokenLifetime"`
+
+	//RedirectURIs lists, space delimited, the URIs the application may use as the redirect_uri of an
+	//authorization request. Requested URIs must match exactly, except that native apps registering a
+	//loopback URI may use any port - see RFC 8252 section 7.3.
+	RedirectURIs string `json:"redirectURIs"`
+
+	//TokenExchangeClients lists, space delimited, the client IDs of the applications that may exchange
+	//tokens for tokens issued for this application - see RFC 8693. The policy belongs to the application
+	//the exchanged tokens are for, so only its owner can allow other applications to act for it.
+	TokenExchangeClients string `json:"tokenExchangeClients"`
+
+	//TokenEndpointAuthMethods lists, space delimited, the client authentication methods the application
+	//may use. ClientAssertionPublicKey is the PEM encoded key used to verify private_key_jwt assertions.
+	TokenEndpointAuthMethods string `json:"tokenEndpointAuthMethods"`
+	ClientAssertionPublicKey string `json:"clientAssertionPublicKey"`
+
+	//TokenSigningAlg is the algorithm roll signs the application's tokens with - RS256, ES256, ES384 or
+	//EdDSA. Applications that do not specify an algorithm have their tokens signed with RS256.
+	TokenSigningAlg string `json:"tokenSigningAlg"`
+
+	//RequirePushedAuthorizationRequests means authorization requests for the application must be pushed
+	//to the pushed authorization request endpoint first, so the parameters are authenticated - see RFC 9126
+	RequirePushedAuthorizationRequests bool `json:"requirePushedAuthorizationRequests"`
+
+	//GrantTypes and ResponseTypes list, space delimited, the grant types the application may use at the
+	//token endpoint and the response types it may use at the authorize endpoint - see RFC 7591 section 2.
+	//Applications that do not list them may use any that roll supports.
+	GrantTypes    string `json:"grantTypes"`
+	ResponseTypes string `json:"responseTypes"`
+}
+
+//applicationJSON has the fields of Application without its JSON methods, so they can encode and decode the
+//fields without calling themselves
+type applicationJSON Application
+
+//legacyApplicationJSON adds the redirectURI key applications were defined with before they could register
+//more than one redirect URI, so existing clients keep working. The tokenExchangeAudiences key is decoded
+//only so it can be rejected.
+type legacyApplicationJSON struct {
+	*applicationJSON
+	RedirectURI            string  `json:"redirectURI"`
+	TokenExchangeAudiences *string `json:"tokenExchangeAudiences,omitempty"`
+}
+
+//ErrTokenExchangeAudiences is returned when an application definition lists the applications it may exchange
+//tokens for. The target application lists the clients that may exchange tokens for it instead.
+var ErrTokenExchangeAudiences = errors.New("tokenExchangeAudiences is not supported - the target application lists the clients allowed in tokenExchangeClients")
+
+//UnmarshalJSON decodes an application definition, taking the redirect URI from the redirectURI key of
+//definitions that do not give redirectURIs. Like other fields, the redirect URIs are left as they are when
+//the definition gives neither key, so a definition can be decoded onto an existing application.
+func (a *Application) UnmarshalJSON(data []byte) error {
+	redirectURIs := a.RedirectURIs
+	a.RedirectURIs = ""
+
+	legacy := legacyApplicationJSON{applicationJSON: (*applicationJSON)(a)}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+
+	if legacy.TokenExchangeAudiences != nil {
+		return ErrTokenExchangeAudiences
+	}
+
+	if strings.TrimSpace(a.RedirectURIs) == "" {
+		a.RedirectURIs = legacy.RedirectURI
+	}
+
+	if strings.TrimSpace(a.RedirectURIs) == "" {
+		a.RedirectURIs = redirectURIs
+	}
+
+	return nil
+}
+
+//MarshalJSON encodes an application definition, including the first of its redirect URIs under the
+//redirectURI key read by existing clients
+func (a Application) MarshalJSON() ([]byte, error) {
+	legacy := legacyApplicationJSON{applicationJSON: (*applicationJSON)(&a)}
+	if uris := strings.Fields(a.RedirectURIs); len(uris) > 0 {
+		legacy.RedirectURI = uris[0]
+	}
+
+	return json.Marshal(&legacy)
 }
 
 var appName = regexp.MustCompile(`^([a-zA-Z'-.0-9]\s*)+$`)
@@ -33,8 +132,9 @@ func (a *Application) validateApplicationName() bool {
 	return appName.MatchString(a.ApplicationName)
 }
 
-func (a *Application) validateRedirectURI() bool {
-	parsed, err := url.Parse(a.RedirectURI)
+//ValidRedirectURI is true if the uri can be registered as a redirect URI
+func ValidRedirectURI(uri string) bool {
+	parsed, err := url.Parse(uri)
 	if err != nil {
 		return false
 	}
@@ -47,6 +147,22 @@ func (a *Application) validateRedirectURI() bool {
 		return false
 	}
 
+	//Redirect URIs cannot include a fragment - see RFC 6749 section 3.1.2
+	return parsed.Fragment == ""
+}
+
+func (a *Application) validateRedirectURIs() bool {
+	uris := strings.Fields(a.RedirectURIs)
+	if len(uris) == 0 {
+		return false
+	}
+
+	for _, uri := range uris {
+		if !ValidRedirectURI(uri) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -63,6 +179,55 @@ func (a *Application) validateLoginProvider() bool {
 	return login.SupportedProvider(parsed.Scheme)
 }
 
+func (a *Application) validateAccessTokenLifetime() bool {
+	return a.AccessTokenLifetime >= 0
+}
+
+func (a *Application) validateTokenEndpointAuthMethods() bool {
+	for _, method := range strings.Fields(a.TokenEndpointAuthMethods) {
+		switch method {
+		case ClientSecretBasic, ClientSecretPost:
+		case PrivateKeyJWT:
+			if a.ClientAssertionPublicKey == "" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *Application) validateTokenSigningAlg() bool {
+	return a.TokenSigningAlg == "" || signing.SupportedAlg(a.TokenSigningAlg)
+}
+
+//SigningAlg returns the algorithm the application's tokens are signed with
+func (a *Application) SigningAlg() string {
+	if a.TokenSigningAlg == "" {
+		return signing.RS256
+	}
+
+	return a.TokenSigningAlg
+}
+
+//AllowsClientAuthMethod is true if the application may authenticate using the given method
+func (a *Application) AllowsClientAuthMethod(method string) bool {
+	methods := a.TokenEndpointAuthMethods
+	if strings.TrimSpace(methods) == "" {
+		methods = defaultTokenEndpointAuthMethods
+	}
+
+	for _, m := range strings.Fields(methods) {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (a *Application) Validate() error {
 	var valid = true
 	var err error
@@ -79,9 +244,9 @@ func (a *Application) Validate() error {
 		bs.WriteString("DeveloperEmail ")
 	}
 
-	if !a.validateRedirectURI() {
+	if !a.validateRedirectURIs() {
 		valid = false
-		bs.WriteString("RedirectURI ")
+		bs.WriteString("RedirectURIs ")
 	}
 
 	if !a.validateLoginProvider() {
@@ -89,6 +254,21 @@ func (a *Application) Validate() error {
 		bs.WriteString("LoginProvider ")
 	}
 
+	if !a.validateAccessTokenLifetime() {
+		valid = false
+		bs.WriteString("AccessTokenLifetime ")
+	}
+
+	if !a.validateTokenEndpointAuthMethods() {
+		valid = false
+		bs.WriteString("TokenEndpointAuthMethods ")
+	}
+
+	if !a.validateTokenSigningAlg() {
+		valid = false
+		bs.WriteString("TokenSigningAlg ")
+	}
+
 	if !valid {
 		err = errors.New(bs.String())
 	}
@@ -97,6 +277,87 @@ func (a *Application) Validate() error {
 
 }
 
+//AllowsRedirectURI is true if the uri is one of the application's redirect URIs
+func (a *Application) AllowsRedirectURI(uri string) bool {
+	for _, registered := range strings.Fields(a.RedirectURIs) {
+		if registered == uri || loopbackRedirectMatch(registered, uri) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//SingleRedirectURI returns the application's redirect URI if it has only one, or an empty string otherwise
+func (a *Application) SingleRedirectURI() string {
+	uris := strings.Fields(a.RedirectURIs)
+	if len(uris) != 1 {
+		return ""
+	}
+
+	return uris[0]
+}
+
+//loopbackRedirectMatch is true if the registered uri is an http loopback IP address uri and the requested uri
+//differs from it only in port. Native apps listen on a port chosen at run time - see RFC 8252 section 7.3.
+func loopbackRedirectMatch(registered, requested string) bool {
+	reg, err := url.Parse(registered)
+	if err != nil || reg.Scheme != "http" {
+		return false
+	}
+
+	ip := net.ParseIP(reg.Hostname())
+	if ip == nil || !ip.IsLoopback() {
+		return false
+	}
+
+	req, err := url.Parse(requested)
+	if err != nil {
+		return false
+	}
+
+	return req.Scheme == reg.Scheme && req.Hostname() == reg.Hostname() && req.User == nil &&
+		req.Path == reg.Path && req.RawQuery == reg.RawQuery && req.Fragment == ""
+}
+
+//AllowsGrantType is true if the application may use the grant type
+func (a *Application) AllowsGrantType(grantType string) bool {
+	return listAllows(a.GrantTypes, grantType)
+}
+
+//AllowsResponseType is true if the application may use the response type
+func (a *Application) AllowsResponseType(responseType string) bool {
+	return listAllows(a.ResponseTypes, responseType)
+}
+
+//listAllows is true if the space delimited list is empty or includes the value
+func listAllows(list, value string) bool {
+	values := strings.Fields(list)
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+//AllowsTokenExchangeBy is true if the application's token exchange policy allows the client to
+//exchange tokens for tokens issued for the application
+func (a *Application) AllowsTokenExchangeBy(clientID string) bool {
+	for _, client := range strings.Fields(a.TokenExchangeClients) {
+		if client == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
 //ApplicationRepo represents a repository abstraction for dealing with persistent Application instances.
 type ApplicationRepo interface {
 	CreateApplication(app *Application) error
@@ -105,6 +366,7 @@ type ApplicationRepo interface {
 	SystemRetrieveApplication(clientID string) (*Application, error)
 	SystemRetrieveApplicationByJWTFlowAudience(audience string) (*Application, error)
 	ListApplications(subjectID string, adminScope bool) ([]Application, error)
+	DeleteApplication(clientID string) error
 }
 
 //NonOwnerUpdateError is used to discriminate general repo errors from security model violations
@@ -115,12 +377,12 @@ func (e NonOwnerUpdateError) Error() string {
 	return "Non-owner attempted update"
 }
 
-//NoSuchApplicationError is used to discriminate updates of non-existent application from repo errors
+//NoSuchApplicationError is used to discriminate updates or deletes of non-existent applications from repo errors
 type NoSuchApplicationError struct{}
 
 //Error implements the Error interface for NoSuchApplicationError
 func (e NoSuchApplicationError) Error() string {
-	return "No such application to update"
+	return "No such application"
 }
 
 //NotAuthorizedToReadApp is used to discriminate repo access errors from security model errors
@@ -1,7 +1,9 @@
 package roll
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -9,7 +11,7 @@ func TestValidateAppName(t *testing.T) {
 	var app = Application{
 		ApplicationName: "Most excellent app",
 		DeveloperEmail:  "jane@someplace.com",
-		RedirectURI:     "http://google.com/login_callback",
+		RedirectURIs:    "http://google.com/login_callback",
 		LoginProvider:   "xtrac://bigiron:9000",
 	}
 
@@ -27,7 +29,7 @@ func TestValidateDeveloperEmail(t *testing.T) {
 	var app = Application{
 		ApplicationName: "Most excellent app",
 		DeveloperEmail:  "jane@someplace.com",
-		RedirectURI:     "http://google.com/login_callback",
+		RedirectURIs:    "http://google.com/login_callback",
 		LoginProvider:   "xtrac://bigiron:9000",
 	}
 
@@ -47,7 +49,7 @@ func TestValidateLoginProvider(t *testing.T) {
 	var app = Application{
 		ApplicationName: "Most excellent app",
 		DeveloperEmail:  "jane@someplace.com",
-		RedirectURI:     "http://google.com/login_callback",
+		RedirectURIs:    "http://google.com/login_callback",
 		LoginProvider:   "xtrac://bigiron:9000",
 	}
 
@@ -57,21 +59,33 @@ func TestValidateLoginProvider(t *testing.T) {
 	assert.False(t, app.validateLoginProvider())
 }
 
-func TestValidateRedirectURI(t *testing.T) {
+func TestValidateRedirectURIs(t *testing.T) {
 	var app = Application{
 		ApplicationName: "Most excellent app",
 		DeveloperEmail:  "jane@someplace.com",
-		RedirectURI:     "http://google.com/login_callback",
+		RedirectURIs:    "http://google.com/login_callback",
 		LoginProvider:   "xtrac://bigiron:9000",
 	}
 
-	assert.True(t, app.validateRedirectURI())
+	assert.True(t, app.validateRedirectURIs())
 
-	app.RedirectURI = "huh?"
-	assert.False(t, app.validateRedirectURI())
+	app.RedirectURIs = "huh?"
+	assert.False(t, app.validateRedirectURIs())
 
-	app.RedirectURI = "https://google.com/"
-	assert.True(t, app.validateRedirectURI())
+	app.RedirectURIs = "https://google.com/"
+	assert.True(t, app.validateRedirectURIs())
+
+	app.RedirectURIs = "https://dev.google.com/cb https://test.google.com/cb https://google.com/cb"
+	assert.True(t, app.validateRedirectURIs())
+
+	app.RedirectURIs = "https://dev.google.com/cb huh?"
+	assert.False(t, app.validateRedirectURIs())
+
+	app.RedirectURIs = "https://google.com/cb#frag"
+	assert.False(t, app.validateRedirectURIs())
+
+	app.RedirectURIs = ""
+	assert.False(t, app.validateRedirectURIs())
 
 }
 
@@ -79,7 +93,7 @@ func TestApplicationFullValidationOK(t *testing.T) {
 	var app = Application{
 		ApplicationName: "Most excellent app",
 		DeveloperEmail:  "jane@someplace.com",
-		RedirectURI:     "http://google.com/login_callback",
+		RedirectURIs:    "http://google.com/login_callback",
 		LoginProvider:   "xtrac://bigiron:9000",
 	}
 
@@ -91,7 +105,7 @@ func TestApplicationFullValidationAllBad(t *testing.T) {
 	var app = Application{
 		ApplicationName: "Most excelle<script/>nt app",
 		DeveloperEmail:  "jane@some<script/>place.com",
-		RedirectURI:     "xxx",
+		RedirectURIs:    "xxx",
 		LoginProvider:   "xxx",
 	}
 
@@ -102,5 +116,189 @@ func TestApplicationFullValidationAllBad(t *testing.T) {
 	assert.Contains(t, msg, "ApplicationName")
 	assert.Contains(t, msg, "DeveloperEmail")
 	assert.Contains(t, msg, "LoginProvider")
-	assert.Contains(t, msg, "RedirectURI")
+	assert.Contains(t, msg, "RedirectURIs")
+}
+
+func TestValidateAccessTokenLifetime(t *testing.T) {
+	var app = Application{
+		ApplicationName: "Most excellent app",
+		DeveloperEmail:  "jane@someplace.com",
+		RedirectURIs:    "http://google.com/login_callback",
+		LoginProvider:   "xtrac://bigiron:9000",
+	}
+
+	assert.True(t, app.validateAccessTokenLifetime())
+
+	app.AccessTokenLifetime = 3600
+	assert.True(t, app.validateAccessTokenLifetime())
+
+	app.AccessTokenLifetime = -1
+	assert.False(t, app.validateAccessTokenLifetime())
+	assert.NotNil(t, app.Validate())
+}
+
+func TestAllowsTokenExchangeBy(t *testing.T) {
+	var app = Application{}
+	assert.False(t, app.AllowsTokenExchangeBy("app-1"))
+
+	app.TokenExchangeClients = "app-1  app-2"
+	assert.True(t, app.AllowsTokenExchangeBy("app-1"))
+	assert.True(t, app.AllowsTokenExchangeBy("app-2"))
+	assert.False(t, app.AllowsTokenExchangeBy("app-3"))
+	assert.False(t, app.AllowsTokenExchangeBy(""))
+}
+
+func TestApplicationJSONRejectsTokenExchangeAudiences(t *testing.T) {
+	var app Application
+	err := json.Unmarshal([]byte(`{"clientID":"app-1","tokenExchangeAudiences":"roll-portal"}`), &app)
+	assert.NotNil(t, err)
+
+	err = json.Unmarshal([]byte(`{"clientID":"app-2","tokenExchangeClients":"app-1"}`), &app)
+	assert.Nil(t, err)
+	assert.Equal(t, "app-1", app.TokenExchangeClients)
+
+	encoded, err := json.Marshal(app)
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(encoded), "tokenExchangeAudiences"))
+}
+
+func TestValidateTokenEndpointAuthMethods(t *testing.T) {
+	var app = Application{}
+	assert.True(t, app.validateTokenEndpointAuthMethods())
+
+	app.TokenEndpointAuthMethods = "client_secret_basic client_secret_post"
+	assert.True(t, app.validateTokenEndpointAuthMethods())
+
+	app.TokenEndpointAuthMethods = "client_secret_jwt"
+	assert.False(t, app.validateTokenEndpointAuthMethods())
+
+	app.TokenEndpointAuthMethods = "private_key_jwt"
+	assert.False(t, app.validateTokenEndpointAuthMethods())
+
+	app.ClientAssertionPublicKey = "-----BEGIN PUBLIC KEY-----"
+	assert.True(t, app.validateTokenEndpointAuthMethods())
+}
+
+func TestValidateTokenSigningAlg(t *testing.T) {
+	var app = Application{}
+	assert.True(t, app.validateTokenSigningAlg())
+	assert.Equal(t, "RS256", app.SigningAlg())
+
+	for _, alg := range []string{"RS256", "ES256", "ES384", "EdDSA"} {
+		app.TokenSigningAlg = alg
+		assert.True(t, app.validateTokenSigningAlg())
+		assert.Equal(t, alg, app.SigningAlg())
+	}
+
+	app.TokenSigningAlg = "HS256"
+	assert.False(t, app.validateTokenSigningAlg())
+
+	app.TokenSigningAlg = "ES512"
+	assert.False(t, app.validateTokenSigningAlg())
+}
+
+func TestAllowsClientAuthMethod(t *testing.T) {
+	var app = Application{}
+	assert.True(t, app.AllowsClientAuthMethod(ClientSecretBasic))
+	assert.True(t, app.AllowsClientAuthMethod(ClientSecretPost))
+	assert.False(t, app.AllowsClientAuthMethod(PrivateKeyJWT))
+
+	app.TokenEndpointAuthMethods = PrivateKeyJWT
+	assert.False(t, app.AllowsClientAuthMethod(ClientSecretPost))
+	assert.True(t, app.AllowsClientAuthMethod(PrivateKeyJWT))
+}
+
+func TestAllowsRedirectURI(t *testing.T) {
+	var app = Application{
+		RedirectURIs: "https://dev.google.com/cb https://google.com/cb",
+	}
+
+	assert.True(t, app.AllowsRedirectURI("https://dev.google.com/cb"))
+	assert.True(t, app.AllowsRedirectURI("https://google.com/cb"))
+	assert.False(t, app.AllowsRedirectURI("https://google.com/cb/"))
+	assert.False(t, app.AllowsRedirectURI("https://google.com/cb?x=1"))
+	assert.False(t, app.AllowsRedirectURI("https://google.com:8443/cb"))
+	assert.False(t, app.AllowsRedirectURI(""))
+}
+
+func TestAllowsLoopbackRedirectURI(t *testing.T) {
+	var app = Application{
+		RedirectURIs: "http://127.0.0.1/callback http://[::1]:8080/callback http://localhost:3000/ab",
+	}
+
+	assert.True(t, app.AllowsRedirectURI("http://127.0.0.1/callback"))
+	assert.True(t, app.AllowsRedirectURI("http://127.0.0.1:51004/callback"))
+	assert.True(t, app.AllowsRedirectURI("http://[::1]:60123/callback"))
+	assert.False(t, app.AllowsRedirectURI("http://127.0.0.1:51004/other"))
+	assert.False(t, app.AllowsRedirectURI("http://127.0.0.2:51004/callback"))
+	assert.False(t, app.AllowsRedirectURI("https://127.0.0.1:51004/callback"))
+	assert.False(t, app.AllowsRedirectURI("http://user@127.0.0.1:51004/callback"))
+
+	//localhost is not a loopback IP literal so its port must match
+	assert.True(t, app.AllowsRedirectURI("http://localhost:3000/ab"))
+	assert.False(t, app.AllowsRedirectURI("http://localhost:3001/ab"))
+}
+
+func TestSingleRedirectURI(t *testing.T) {
+	var app = Application{
+		RedirectURIs: "https://google.com/cb",
+	}
+
+	assert.Equal(t, "https://google.com/cb", app.SingleRedirectURI())
+
+	app.RedirectURIs = "https://dev.google.com/cb https://google.com/cb"
+	assert.Equal(t, "", app.SingleRedirectURI())
+}
+
+func TestApplicationJSONLegacyRedirectURI(t *testing.T) {
+	var app Application
+	err := json.Unmarshal([]byte(`{"applicationName":"legacy app","redirectURI":"http://localhost:3000/ab"}`), &app)
+	assert.Nil(t, err)
+	assert.Equal(t, "legacy app", app.ApplicationName)
+	assert.Equal(t, "http://localhost:3000/ab", app.RedirectURIs)
+
+	//redirectURIs is used if both keys are given
+	app = Application{}
+	err = json.Unmarshal([]byte(`{"redirectURI":"http://localhost:3000/ab","redirectURIs":"http://localhost:3000/cd http://localhost:3000/ef"}`), &app)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:3000/cd http://localhost:3000/ef", app.RedirectURIs)
+
+	//Definitions are encoded with both keys, the legacy key carrying the first redirect URI
+	encoded, err := json.Marshal([]Application{app})
+	assert.Nil(t, err)
+
+	var decoded []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, "http://localhost:3000/cd http://localhost:3000/ef", decoded[0]["redirectURIs"])
+	assert.Equal(t, "http://localhost:3000/cd", decoded[0]["redirectURI"])
+
+	var roundTripped []Application
+	assert.Nil(t, json.Unmarshal(encoded, &roundTripped))
+	assert.Equal(t, app, roundTripped[0])
+}
+
+func TestApplicationJSONOntoExistingApplication(t *testing.T) {
+	app := Application{ApplicationName: "fight club", RedirectURIs: "https://a.example.com/cb", TokenSigningAlg: "ES256"}
+
+	//Keys left out of the definition keep the application's values
+	assert.Nil(t, json.Unmarshal([]byte(`{"applicationName":"project mayhem"}`), &app))
+	assert.Equal(t, "project mayhem", app.ApplicationName)
+	assert.Equal(t, "https://a.example.com/cb", app.RedirectURIs)
+	assert.Equal(t, "ES256", app.TokenSigningAlg)
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"redirectURI":"https://b.example.com/cb"}`), &app))
+	assert.Equal(t, "https://b.example.com/cb", app.RedirectURIs)
+}
+
+func TestAllowsGrantAndResponseTypes(t *testing.T) {
+	var app Application
+	assert.True(t, app.AllowsGrantType("client_credentials"))
+	assert.True(t, app.AllowsResponseType("token"))
+
+	app.GrantTypes = "authorization_code refresh_token"
+	app.ResponseTypes = "code"
+	assert.True(t, app.AllowsGrantType("refresh_token"))
+	assert.False(t, app.AllowsGrantType("client_credentials"))
+	assert.True(t, app.AllowsResponseType("code"))
+	assert.False(t, app.AllowsResponseType("token"))
 }
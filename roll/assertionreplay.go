@@ -0,0 +1,17 @@
+package roll
+
+//AssertionReplayRepo represents a repository abstraction for recording the JWT bearer assertions that have
+//been exchanged for tokens, so each assertion can be used only once. Assertions are identified by their
+//issuer and jti claim. Entries need only be kept until the assertion expires, after which it is rejected
+//anyway.
+type AssertionReplayRepo interface {
+	RecordAssertionUse(issuer, tokenID string, expiresAt int64) error
+}
+
+//AssertionReplayError is returned when the use of an assertion that has already been used is recorded
+type AssertionReplayError struct{}
+
+//Error implements the Error interface for AssertionReplayError
+func (e AssertionReplayError) Error() string {
+	return "Assertion has already been used"
+}
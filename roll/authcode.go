@@ -0,0 +1,41 @@
+package roll
+
+import (
+	"time"
+)
+
+//AuthCode records an issued authorization code. Codes are signed tokens, so the record exists to
+//make each code single use: it is marked used on first exchange, and the tokens issued in exchange
+//for it are noted so they can be revoked should the code be presented again.
+type AuthCode struct {
+	CodeID               string
+	ClientID             string
+	RedirectURI          string
+	ExpiresAt            int64
+	Used                 bool
+	AccessTokenID        string
+	AccessTokenExpiresAt int64
+	RefreshTokenFamilyID string
+}
+
+//Expired returns true if the authorization code is past its expiry time
+func (ac *AuthCode) Expired() bool {
+	return time.Now().Unix() > ac.ExpiresAt
+}
+
+//AuthCodeRepo represents a repository abstraction for dealing with persistent AuthCode instances.
+type AuthCodeRepo interface {
+	StoreAuthCode(code *AuthCode) error
+	RetrieveAuthCode(codeID string) (*AuthCode, error)
+	MarkAuthCodeUsed(codeID string) error
+	RecordAuthCodeTokens(codeID, accessTokenID string, accessTokenExpiresAt int64, refreshTokenFamilyID string) error
+}
+
+//AuthCodeReuseError is returned when an attempt is made to mark an already used
+//authorization code as used
+type AuthCodeReuseError struct{}
+
+//Error implements the Error interface for AuthCodeReuseError
+func (e AuthCodeReuseError) Error() string {
+	return "Authorization code has already been used"
+}
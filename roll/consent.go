@@ -0,0 +1,60 @@
+package roll
+
+import (
+	"strings"
+)
+
+//Consent records the scopes a user has allowed an application to request on their behalf. There is a single
+//consent per subject and application, with scopes granted by later requests added to the scope set.
+type Consent struct {
+	Subject   string `json:"subject"`
+	ClientID  string `json:"clientId"`
+	Scope     string `json:"scope"`
+	GrantedAt int64  `json:"grantedAt"`
+}
+
+//Covers is true if every part of the given scope has been consented to
+func (c *Consent) Covers(scope string) bool {
+	for _, s := range strings.Fields(scope) {
+		if !c.hasScope(s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//AddScope adds the parts of the given scope not already consented to the consent's scope set
+func (c *Consent) AddScope(scope string) {
+	for _, s := range strings.Fields(scope) {
+		if !c.hasScope(s) {
+			c.Scope = strings.TrimSpace(c.Scope + " " + s)
+		}
+	}
+}
+
+func (c *Consent) hasScope(s string) bool {
+	for _, granted := range strings.Fields(c.Scope) {
+		if granted == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+//ConsentRepo represents a repository abstraction for recording user consent
+type ConsentRepo interface {
+	StoreConsent(consent *Consent) error
+	RetrieveConsent(subject, clientID string) (*Consent, error)
+	ListConsents(subject string) ([]Consent, error)
+	DeleteConsent(subject, clientID string) error
+}
+
+//NoSuchConsentError is returned when deleting a consent the user has not given
+type NoSuchConsentError struct{}
+
+//Error implements the Error interface for NoSuchConsentError
+func (e NoSuchConsentError) Error() string {
+	return "No such consent"
+}
@@ -0,0 +1,24 @@
+package roll
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConsentCovers(t *testing.T) {
+	c := Consent{Subject: "a-subject", ClientID: "1111-2222-3333333-4444444", Scope: "openid orders.read"}
+	assert.True(t, c.Covers(""))
+	assert.True(t, c.Covers("orders.read"))
+	assert.True(t, c.Covers("orders.read openid"))
+	assert.False(t, c.Covers("orders.read orders.write"))
+}
+
+func TestConsentAddScope(t *testing.T) {
+	c := Consent{Subject: "a-subject", ClientID: "1111-2222-3333333-4444444"}
+	c.AddScope("orders.read")
+	assert.Equal(t, "orders.read", c.Scope)
+
+	c.AddScope("openid orders.read")
+	assert.Equal(t, "orders.read openid", c.Scope)
+	assert.True(t, c.Covers("openid"))
+}
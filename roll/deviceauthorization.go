@@ -0,0 +1,58 @@
+package roll
+
+import (
+	"time"
+)
+
+//Device authorization states. An authorization is pending until the user approves or denies it on the
+//verification page. Once tokens have been issued for an approved authorization it is complete, so the
+//device code cannot be exchanged again.
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+	DeviceAuthorizationComplete = "complete"
+)
+
+//DeviceAuthorization records a device authorization request (RFC 8628). The device polls for tokens
+//using the device code while the user enters the user code on the verification page.
+type DeviceAuthorization struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scope      string
+	Status     string
+	ExpiresAt  int64
+
+	//Subject is the user who approved the authorization
+	Subject string
+
+	//Interval is the minimum number of seconds the device must wait between polls, and LastPolledAt
+	//the epoch second of the last poll
+	Interval     int64
+	LastPolledAt int64
+}
+
+//Expired returns true if the device authorization is past its expiry time
+func (da *DeviceAuthorization) Expired() bool {
+	return time.Now().Unix() > da.ExpiresAt
+}
+
+//DeviceAuthorizationRepo represents a repository abstraction for dealing with persistent DeviceAuthorization
+//instances.
+type DeviceAuthorizationRepo interface {
+	StoreDeviceAuthorization(da *DeviceAuthorization) error
+	RetrieveDeviceAuthorization(deviceCode string) (*DeviceAuthorization, error)
+	RetrieveDeviceAuthorizationByUserCode(userCode string) (*DeviceAuthorization, error)
+	RecordDeviceAuthorizationPoll(deviceCode string, polledAt, interval int64) error
+	UpdateDeviceAuthorizationStatus(deviceCode, fromStatus, toStatus, subject string) error
+}
+
+//DeviceAuthorizationStatusError is returned when the status of a device authorization is updated but
+//the authorization is not in the expected status
+type DeviceAuthorizationStatusError struct{}
+
+//Error implements the Error interface for DeviceAuthorizationStatusError
+func (e DeviceAuthorizationStatusError) Error() string {
+	return "Device authorization is not in the expected state"
+}
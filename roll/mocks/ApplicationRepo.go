@@ -115,3 +115,15 @@ func (_m *ApplicationRepo) ListApplications(subjectID string, adminScope bool) (
 
 	return r0, r1
 }
+func (_m *ApplicationRepo) DeleteApplication(clientID string) error {
+	ret := _m.Called(clientID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(clientID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
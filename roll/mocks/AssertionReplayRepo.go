@@ -0,0 +1,20 @@
+package mocks
+
+import "github.com/stretchr/testify/mock"
+
+type AssertionReplayRepo struct {
+	mock.Mock
+}
+
+func (_m *AssertionReplayRepo) RecordAssertionUse(issuer string, tokenID string, expiresAt int64) error {
+	ret := _m.Called(issuer, tokenID, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, int64) error); ok {
+		r0 = rf(issuer, tokenID, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
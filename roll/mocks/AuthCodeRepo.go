@@ -0,0 +1,66 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type AuthCodeRepo struct {
+	mock.Mock
+}
+
+func (_m *AuthCodeRepo) StoreAuthCode(code *roll.AuthCode) error {
+	ret := _m.Called(code)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.AuthCode) error); ok {
+		r0 = rf(code)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *AuthCodeRepo) RetrieveAuthCode(codeID string) (*roll.AuthCode, error) {
+	ret := _m.Called(codeID)
+
+	var r0 *roll.AuthCode
+	if rf, ok := ret.Get(0).(func(string) *roll.AuthCode); ok {
+		r0 = rf(codeID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.AuthCode)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(codeID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *AuthCodeRepo) MarkAuthCodeUsed(codeID string) error {
+	ret := _m.Called(codeID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(codeID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *AuthCodeRepo) RecordAuthCodeTokens(codeID, accessTokenID string, accessTokenExpiresAt int64, refreshTokenFamilyID string) error {
+	ret := _m.Called(codeID, accessTokenID, accessTokenExpiresAt, refreshTokenFamilyID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, int64, string) error); ok {
+		r0 = rf(codeID, accessTokenID, accessTokenExpiresAt, refreshTokenFamilyID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
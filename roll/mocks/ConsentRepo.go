@@ -0,0 +1,75 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type ConsentRepo struct {
+	mock.Mock
+}
+
+func (_m *ConsentRepo) StoreConsent(consent *roll.Consent) error {
+	ret := _m.Called(consent)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.Consent) error); ok {
+		r0 = rf(consent)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *ConsentRepo) RetrieveConsent(subject string, clientID string) (*roll.Consent, error) {
+	ret := _m.Called(subject, clientID)
+
+	var r0 *roll.Consent
+	if rf, ok := ret.Get(0).(func(string, string) *roll.Consent); ok {
+		r0 = rf(subject, clientID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.Consent)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(subject, clientID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *ConsentRepo) ListConsents(subject string) ([]roll.Consent, error) {
+	ret := _m.Called(subject)
+
+	var r0 []roll.Consent
+	if rf, ok := ret.Get(0).(func(string) []roll.Consent); ok {
+		r0 = rf(subject)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roll.Consent)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(subject)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *ConsentRepo) DeleteConsent(subject string, clientID string) error {
+	ret := _m.Called(subject, clientID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(subject, clientID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,87 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type DeviceAuthorizationRepo struct {
+	mock.Mock
+}
+
+func (_m *DeviceAuthorizationRepo) StoreDeviceAuthorization(da *roll.DeviceAuthorization) error {
+	ret := _m.Called(da)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.DeviceAuthorization) error); ok {
+		r0 = rf(da)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *DeviceAuthorizationRepo) RetrieveDeviceAuthorization(deviceCode string) (*roll.DeviceAuthorization, error) {
+	ret := _m.Called(deviceCode)
+
+	var r0 *roll.DeviceAuthorization
+	if rf, ok := ret.Get(0).(func(string) *roll.DeviceAuthorization); ok {
+		r0 = rf(deviceCode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.DeviceAuthorization)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(deviceCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *DeviceAuthorizationRepo) RetrieveDeviceAuthorizationByUserCode(userCode string) (*roll.DeviceAuthorization, error) {
+	ret := _m.Called(userCode)
+
+	var r0 *roll.DeviceAuthorization
+	if rf, ok := ret.Get(0).(func(string) *roll.DeviceAuthorization); ok {
+		r0 = rf(userCode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.DeviceAuthorization)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(userCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *DeviceAuthorizationRepo) RecordDeviceAuthorizationPoll(deviceCode string, polledAt, interval int64) error {
+	ret := _m.Called(deviceCode, polledAt, interval)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int64, int64) error); ok {
+		r0 = rf(deviceCode, polledAt, interval)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *DeviceAuthorizationRepo) UpdateDeviceAuthorizationStatus(deviceCode, fromStatus, toStatus, subject string) error {
+	ret := _m.Called(deviceCode, fromStatus, toStatus, subject)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string, string) error); ok {
+		r0 = rf(deviceCode, fromStatus, toStatus, subject)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,75 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type ProtectedResourceRepo struct {
+	mock.Mock
+}
+
+func (_m *ProtectedResourceRepo) StoreProtectedResource(resource *roll.ProtectedResource) error {
+	ret := _m.Called(resource)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.ProtectedResource) error); ok {
+		r0 = rf(resource)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *ProtectedResourceRepo) RetrieveProtectedResource(identifier string) (*roll.ProtectedResource, error) {
+	ret := _m.Called(identifier)
+
+	var r0 *roll.ProtectedResource
+	if rf, ok := ret.Get(0).(func(string) *roll.ProtectedResource); ok {
+		r0 = rf(identifier)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.ProtectedResource)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(identifier)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *ProtectedResourceRepo) ListProtectedResources() ([]roll.ProtectedResource, error) {
+	ret := _m.Called()
+
+	var r0 []roll.ProtectedResource
+	if rf, ok := ret.Get(0).(func() []roll.ProtectedResource); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roll.ProtectedResource)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *ProtectedResourceRepo) DeleteProtectedResource(identifier string) error {
+	ret := _m.Called(identifier)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(identifier)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
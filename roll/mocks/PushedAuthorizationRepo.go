@@ -0,0 +1,54 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type PushedAuthorizationRepo struct {
+	mock.Mock
+}
+
+func (_m *PushedAuthorizationRepo) StorePushedAuthorization(pa *roll.PushedAuthorization) error {
+	ret := _m.Called(pa)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.PushedAuthorization) error); ok {
+		r0 = rf(pa)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *PushedAuthorizationRepo) RetrievePushedAuthorization(requestURI string) (*roll.PushedAuthorization, error) {
+	ret := _m.Called(requestURI)
+
+	var r0 *roll.PushedAuthorization
+	if rf, ok := ret.Get(0).(func(string) *roll.PushedAuthorization); ok {
+		r0 = rf(requestURI)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.PushedAuthorization)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(requestURI)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *PushedAuthorizationRepo) DeletePushedAuthorization(requestURI string) error {
+	ret := _m.Called(requestURI)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(requestURI)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,78 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type RefreshTokenRepo struct {
+	mock.Mock
+}
+
+func (_m *RefreshTokenRepo) StoreRefreshToken(rt *roll.RefreshToken) error {
+	ret := _m.Called(rt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.RefreshToken) error); ok {
+		r0 = rf(rt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *RefreshTokenRepo) RetrieveRefreshToken(tokenID string) (*roll.RefreshToken, error) {
+	ret := _m.Called(tokenID)
+
+	var r0 *roll.RefreshToken
+	if rf, ok := ret.Get(0).(func(string) *roll.RefreshToken); ok {
+		r0 = rf(tokenID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.RefreshToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(tokenID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *RefreshTokenRepo) MarkRefreshTokenUsed(tokenID string) error {
+	ret := _m.Called(tokenID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(tokenID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *RefreshTokenRepo) RevokeRefreshTokenFamily(familyID string) error {
+	ret := _m.Called(familyID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(familyID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *RefreshTokenRepo) RevokeSubjectRefreshTokens(subject string, clientID string) error {
+	ret := _m.Called(subject, clientID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(subject, clientID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,75 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type RegistrationTokenRepo struct {
+	mock.Mock
+}
+
+func (_m *RegistrationTokenRepo) StoreRegistrationToken(token *roll.RegistrationToken) error {
+	ret := _m.Called(token)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.RegistrationToken) error); ok {
+		r0 = rf(token)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *RegistrationTokenRepo) RetrieveRegistrationToken(tokenID string) (*roll.RegistrationToken, error) {
+	ret := _m.Called(tokenID)
+
+	var r0 *roll.RegistrationToken
+	if rf, ok := ret.Get(0).(func(string) *roll.RegistrationToken); ok {
+		r0 = rf(tokenID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.RegistrationToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(tokenID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *RegistrationTokenRepo) ListInitialAccessTokens() ([]roll.RegistrationToken, error) {
+	ret := _m.Called()
+
+	var r0 []roll.RegistrationToken
+	if rf, ok := ret.Get(0).(func() []roll.RegistrationToken); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roll.RegistrationToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *RegistrationTokenRepo) DeleteRegistrationToken(tokenID string) error {
+	ret := _m.Called(tokenID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(tokenID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
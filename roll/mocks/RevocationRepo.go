@@ -0,0 +1,39 @@
+package mocks
+
+import "github.com/stretchr/testify/mock"
+
+type RevocationRepo struct {
+	mock.Mock
+}
+
+func (_m *RevocationRepo) RevokeToken(tokenID string, expiresAt int64) error {
+	ret := _m.Called(tokenID, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int64) error); ok {
+		r0 = rf(tokenID, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *RevocationRepo) IsTokenRevoked(tokenID string) (bool, error) {
+	ret := _m.Called(tokenID)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(tokenID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(tokenID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
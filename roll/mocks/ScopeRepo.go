@@ -0,0 +1,75 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type ScopeRepo struct {
+	mock.Mock
+}
+
+func (_m *ScopeRepo) StoreScope(scope *roll.Scope) error {
+	ret := _m.Called(scope)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.Scope) error); ok {
+		r0 = rf(scope)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *ScopeRepo) RetrieveScope(name string) (*roll.Scope, error) {
+	ret := _m.Called(name)
+
+	var r0 *roll.Scope
+	if rf, ok := ret.Get(0).(func(string) *roll.Scope); ok {
+		r0 = rf(name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.Scope)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *ScopeRepo) ListScopes() ([]roll.Scope, error) {
+	ret := _m.Called()
+
+	var r0 []roll.Scope
+	if rf, ok := ret.Get(0).(func() []roll.Scope); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roll.Scope)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *ScopeRepo) DeleteScope(name string) error {
+	ret := _m.Called(name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
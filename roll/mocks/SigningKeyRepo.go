@@ -0,0 +1,75 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type SigningKeyRepo struct {
+	mock.Mock
+}
+
+func (_m *SigningKeyRepo) StoreSigningKey(key *roll.SigningKey) error {
+	ret := _m.Called(key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.SigningKey) error); ok {
+		r0 = rf(key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *SigningKeyRepo) ListSigningKeys(clientID string) ([]roll.SigningKey, error) {
+	ret := _m.Called(clientID)
+
+	var r0 []roll.SigningKey
+	if rf, ok := ret.Get(0).(func(string) []roll.SigningKey); ok {
+		r0 = rf(clientID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roll.SigningKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(clientID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *SigningKeyRepo) RetrieveSigningKey(clientID string, keyID string) (*roll.SigningKey, error) {
+	ret := _m.Called(clientID, keyID)
+
+	var r0 *roll.SigningKey
+	if rf, ok := ret.Get(0).(func(string, string) *roll.SigningKey); ok {
+		r0 = rf(clientID, keyID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.SigningKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(clientID, keyID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *SigningKeyRepo) RetireSigningKey(clientID string, version int, retiresAt int64) error {
+	ret := _m.Called(clientID, version, retiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int, int64) error); ok {
+		r0 = rf(clientID, version, retiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
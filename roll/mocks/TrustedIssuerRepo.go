@@ -0,0 +1,75 @@
+package mocks
+
+import "github.com/xtraclabs/roll/roll"
+import "github.com/stretchr/testify/mock"
+
+type TrustedIssuerRepo struct {
+	mock.Mock
+}
+
+func (_m *TrustedIssuerRepo) StoreTrustedIssuer(ti *roll.TrustedIssuer) error {
+	ret := _m.Called(ti)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*roll.TrustedIssuer) error); ok {
+		r0 = rf(ti)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+func (_m *TrustedIssuerRepo) RetrieveTrustedIssuer(issuer string, audience string) (*roll.TrustedIssuer, error) {
+	ret := _m.Called(issuer, audience)
+
+	var r0 *roll.TrustedIssuer
+	if rf, ok := ret.Get(0).(func(string, string) *roll.TrustedIssuer); ok {
+		r0 = rf(issuer, audience)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*roll.TrustedIssuer)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(issuer, audience)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *TrustedIssuerRepo) ListTrustedIssuers(clientID string) ([]roll.TrustedIssuer, error) {
+	ret := _m.Called(clientID)
+
+	var r0 []roll.TrustedIssuer
+	if rf, ok := ret.Get(0).(func(string) []roll.TrustedIssuer); ok {
+		r0 = rf(clientID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]roll.TrustedIssuer)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(clientID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+func (_m *TrustedIssuerRepo) DeleteTrustedIssuer(clientID string, issuer string, audience string) error {
+	ret := _m.Called(clientID, issuer, audience)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(clientID, issuer, audience)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,71 @@
+package roll
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+//ProtectedResource is an entry in the registry of resource servers clients may request tokens for.
+//Clients name the resource in the resource parameter of authorize and token requests, and the access
+//tokens issued have the resource identifier as their audience - see RFC 8707.
+type ProtectedResource struct {
+	Identifier  string `json:"identifier"`
+	Description string `json:"description"`
+}
+
+//ValidResourceIdentifier is true if the identifier is an absolute URI without a fragment, as required
+//for resource indicators by RFC 8707 section 2
+func ValidResourceIdentifier(identifier string) bool {
+	if strings.Contains(identifier, "#") {
+		return false
+	}
+
+	u, err := url.Parse(identifier)
+	if err != nil {
+		return false
+	}
+
+	return u.IsAbs()
+}
+
+//Validate checks the protected resource definition is complete
+func (pr *ProtectedResource) Validate() error {
+	var valid = true
+	var err error
+
+	bs := bytes.NewBufferString("Fields with invalid content: ")
+
+	if !ValidResourceIdentifier(pr.Identifier) {
+		valid = false
+		bs.WriteString("Identifier ")
+	}
+
+	if pr.Description == "" {
+		valid = false
+		bs.WriteString("Description ")
+	}
+
+	if !valid {
+		err = errors.New(bs.String())
+	}
+
+	return err
+}
+
+//ProtectedResourceRepo represents a repository abstraction for the protected resource registry
+type ProtectedResourceRepo interface {
+	StoreProtectedResource(resource *ProtectedResource) error
+	RetrieveProtectedResource(identifier string) (*ProtectedResource, error)
+	ListProtectedResources() ([]ProtectedResource, error)
+	DeleteProtectedResource(identifier string) error
+}
+
+//NoSuchProtectedResourceError is returned when deleting a resource that is not in the registry
+type NoSuchProtectedResourceError struct{}
+
+//Error implements the Error interface for NoSuchProtectedResourceError
+func (e NoSuchProtectedResourceError) Error() string {
+	return "No such protected resource"
+}
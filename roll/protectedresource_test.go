@@ -0,0 +1,29 @@
+package roll
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestValidResourceIdentifier(t *testing.T) {
+	assert.True(t, ValidResourceIdentifier("https://api.example.com"))
+	assert.True(t, ValidResourceIdentifier("https://api.example.com/orders"))
+	assert.True(t, ValidResourceIdentifier("urn:example:orders"))
+	assert.False(t, ValidResourceIdentifier(""))
+	assert.False(t, ValidResourceIdentifier("/orders"))
+	assert.False(t, ValidResourceIdentifier("https://api.example.com/orders#v1"))
+	assert.False(t, ValidResourceIdentifier("https://api.example.com/orders#"))
+}
+
+func TestValidateProtectedResource(t *testing.T) {
+	pr := ProtectedResource{Identifier: "https://api.example.com/orders", Description: "Orders API"}
+	assert.Nil(t, pr.Validate())
+
+	pr = ProtectedResource{Identifier: "orders"}
+	err := pr.Validate()
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "Identifier"))
+		assert.True(t, strings.Contains(err.Error(), "Description"))
+	}
+}
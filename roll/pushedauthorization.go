@@ -0,0 +1,38 @@
+package roll
+
+import (
+	"time"
+)
+
+//PushedAuthorization records the parameters of an authorization request pushed to the pushed authorization
+//request endpoint (RFC 9126). The client starts the authorization by sending the user to the authorize
+//endpoint with the request uri, which may be used only once.
+type PushedAuthorization struct {
+	RequestURI string
+	ClientID   string
+
+	//Params holds the form encoded authorization request parameters
+	Params    string
+	ExpiresAt int64
+}
+
+//Expired returns true if the pushed authorization is past its expiry time
+func (pa *PushedAuthorization) Expired() bool {
+	return time.Now().Unix() > pa.ExpiresAt
+}
+
+//PushedAuthorizationRepo represents a repository abstraction for dealing with persistent PushedAuthorization
+//instances.
+type PushedAuthorizationRepo interface {
+	StorePushedAuthorization(pa *PushedAuthorization) error
+	RetrievePushedAuthorization(requestURI string) (*PushedAuthorization, error)
+	DeletePushedAuthorization(requestURI string) error
+}
+
+//NoSuchPushedAuthorizationError is returned when deleting a pushed authorization that does not exist
+type NoSuchPushedAuthorizationError struct{}
+
+//Error implements the Error interface for NoSuchPushedAuthorizationError
+func (e NoSuchPushedAuthorizationError) Error() string {
+	return "No such pushed authorization"
+}
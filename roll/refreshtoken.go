@@ -0,0 +1,45 @@
+package roll
+
+import (
+	"time"
+)
+
+//RefreshToken represents a refresh token issued alongside an access token. Every time a refresh
+//token is used it is rotated, with the replacement token sharing the family ID of the original
+//grant. This allows the whole family to be revoked when reuse of a spent token is detected.
+type RefreshToken struct {
+	TokenID   string
+	FamilyID  string
+	ClientID  string
+	Subject   string
+	Scope     string
+	ExpiresAt int64
+	Used      bool
+	Revoked   bool
+
+	//Resources holds the space delimited resource indicators (RFC 8707) the grant was issued for
+	Resources string
+}
+
+//Expired returns true if the refresh token is past its expiry time
+func (rt *RefreshToken) Expired() bool {
+	return time.Now().Unix() > rt.ExpiresAt
+}
+
+//RefreshTokenRepo represents a repository abstraction for dealing with persistent RefreshToken instances.
+type RefreshTokenRepo interface {
+	StoreRefreshToken(rt *RefreshToken) error
+	RetrieveRefreshToken(tokenID string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(tokenID string) error
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeSubjectRefreshTokens(subject, clientID string) error
+}
+
+//RefreshTokenReuseError is returned when an attempt is made to mark an already used
+//refresh token as used
+type RefreshTokenReuseError struct{}
+
+//Error implements the Error interface for RefreshTokenReuseError
+func (e RefreshTokenReuseError) Error() string {
+	return "Refresh token has already been used"
+}
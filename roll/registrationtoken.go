@@ -0,0 +1,54 @@
+package roll
+
+//Types of token accepted by the dynamic client registration endpoints
+const (
+	//InitialAccessTokenType tokens are issued by admins to allow clients to register - see RFC 7591 section 3
+	InitialAccessTokenType = "initial"
+
+	//RegistrationAccessTokenType tokens are issued to a registered client to read, update and delete
+	//its registration - see RFC 7592 section 3
+	RegistrationAccessTokenType = "registration"
+)
+
+//RegistrationToken is a bearer token for the dynamic client registration endpoints. The token presented
+//by the client is the token id and a secret joined by a period. Only a hash of the secret is stored, so
+//the token cannot be recovered from the repository.
+type RegistrationToken struct {
+	TokenID    string `json:"tokenID"`
+	SecretHash string `json:"-"`
+	TokenType  string `json:"tokenType"`
+
+	//ClientID is the application a registration access token was issued for
+	ClientID string `json:"clientID,omitempty"`
+
+	//IssuedBy is the subject of the admin who issued the initial access token the registration derives
+	//from. Applications registered with the token are owned by this subject.
+	IssuedBy    string `json:"issuedBy"`
+	Description string `json:"description,omitempty"`
+	IssuedAt    int64  `json:"issuedAt"`
+
+	//ExpiresAt is zero for tokens that do not expire
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+//Expired is true if the token has an expiry time that has passed
+func (rt *RegistrationToken) Expired(now int64) bool {
+	return rt.ExpiresAt != 0 && rt.ExpiresAt <= now
+}
+
+//RegistrationTokenRepo represents a repository abstraction for the tokens used with the dynamic client
+//registration endpoints
+type RegistrationTokenRepo interface {
+	StoreRegistrationToken(token *RegistrationToken) error
+	RetrieveRegistrationToken(tokenID string) (*RegistrationToken, error)
+	ListInitialAccessTokens() ([]RegistrationToken, error)
+	DeleteRegistrationToken(tokenID string) error
+}
+
+//NoSuchRegistrationTokenError is returned when deleting a registration token that does not exist
+type NoSuchRegistrationTokenError struct{}
+
+//Error implements the Error interface for NoSuchRegistrationTokenError
+func (e NoSuchRegistrationTokenError) Error() string {
+	return "No such registration token"
+}
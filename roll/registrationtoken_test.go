@@ -0,0 +1,15 @@
+package roll
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRegistrationTokenExpired(t *testing.T) {
+	rt := RegistrationToken{TokenID: "a-token", TokenType: InitialAccessTokenType, ExpiresAt: 1000}
+	assert.False(t, rt.Expired(999))
+	assert.True(t, rt.Expired(1000))
+
+	rt.ExpiresAt = 0
+	assert.False(t, rt.Expired(1000))
+}
@@ -0,0 +1,9 @@
+package roll
+
+//RevocationRepo represents a repository abstraction for recording revoked tokens. Tokens are identified
+//by their jti claim. Entries need only be kept until the token would have expired, after which the
+//token is rejected anyway.
+type RevocationRepo interface {
+	RevokeToken(tokenID string, expiresAt int64) error
+	IsTokenRevoked(tokenID string) (bool, error)
+}
@@ -4,29 +4,102 @@ import (
 	"errors"
 	"github.com/xtraclabs/rollsecrets/secrets"
 	"github.com/xtraclabs/rollsecrets/token"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	//DefaultAccessTokenLifetime is the lifetime of access tokens issued for applications that
+	//do not specify their own lifetime, unless overridden in the core config
+	DefaultAccessTokenLifetime = 24 * time.Hour
+
+	//MaxAccessTokenLifetime is the longest lifetime an application may specify, unless
+	//overridden in the core config
+	MaxAccessTokenLifetime = 24 * time.Hour
+
+	//DefaultJWTAssertionClockSkew is the leeway allowed when checking the time claims of JWT bearer
+	//assertions, unless overridden in the core config
+	DefaultJWTAssertionClockSkew = time.Minute
+
+	//DefaultJWTAssertionMaxLifetime is the longest a JWT bearer assertion may be valid for, unless
+	//overridden in the core config
+	DefaultJWTAssertionMaxLifetime = time.Hour
 )
 
 //Core encapsulates the infrastructure dependencies associated with the application
 type Core struct {
-	developerRepo   DeveloperRepo
-	ApplicationRepo ApplicationRepo
-	AdminRepo       AdminRepo
-	SecretsRepo     secrets.SecretsRepo
-	IdGenerator     token.IdGenerator
-	secure          bool
-	rollClientId    string
+	developerRepo           DeveloperRepo
+	ApplicationRepo         ApplicationRepo
+	AdminRepo               AdminRepo
+	RefreshTokenRepo        RefreshTokenRepo
+	RevocationRepo          RevocationRepo
+	AuthCodeRepo            AuthCodeRepo
+	SigningKeyRepo          SigningKeyRepo
+	DeviceAuthorizationRepo DeviceAuthorizationRepo
+	TrustedIssuerRepo       TrustedIssuerRepo
+	AssertionReplayRepo     AssertionReplayRepo
+	ScopeRepo               ScopeRepo
+	ConsentRepo             ConsentRepo
+	RegistrationTokenRepo   RegistrationTokenRepo
+	ProtectedResourceRepo   ProtectedResourceRepo
+	PushedAuthorizationRepo PushedAuthorizationRepo
+	SecretsRepo             secrets.SecretsRepo
+	IdGenerator             token.IdGenerator
+	secure                  bool
+	rollClientId            string
+
+	defaultAccessTokenLifetime time.Duration
+	maxAccessTokenLifetime     time.Duration
+	signingKeyGracePeriod      time.Duration
+	signingKeyRotationInterval time.Duration
+	jwtAssertionClockSkew      time.Duration
+	jwtAssertionMaxLifetime    time.Duration
+	issuerBaseURL              string
 }
 
 //CoreConfig is a structure used to inject infrastructure dependency implementations into
 //the core struct
 type CoreConfig struct {
-	DeveloperRepo   DeveloperRepo
-	ApplicationRepo ApplicationRepo
-	AdminRepo       AdminRepo
-	SecretsRepo     secrets.SecretsRepo
-	IdGenerator     token.IdGenerator
-	Secure          bool
-	RollClientID    string
+	DeveloperRepo           DeveloperRepo
+	ApplicationRepo         ApplicationRepo
+	AdminRepo               AdminRepo
+	RefreshTokenRepo        RefreshTokenRepo
+	RevocationRepo          RevocationRepo
+	AuthCodeRepo            AuthCodeRepo
+	SigningKeyRepo          SigningKeyRepo
+	DeviceAuthorizationRepo DeviceAuthorizationRepo
+	TrustedIssuerRepo       TrustedIssuerRepo
+	AssertionReplayRepo     AssertionReplayRepo
+	ScopeRepo               ScopeRepo
+	ConsentRepo             ConsentRepo
+	RegistrationTokenRepo   RegistrationTokenRepo
+	ProtectedResourceRepo   ProtectedResourceRepo
+	PushedAuthorizationRepo PushedAuthorizationRepo
+	SecretsRepo             secrets.SecretsRepo
+	IdGenerator             token.IdGenerator
+	Secure                  bool
+	RollClientID            string
+
+	//Access token lifetime settings - the package defaults are used if these are not set
+	DefaultAccessTokenLifetime time.Duration
+	MaxAccessTokenLifetime     time.Duration
+
+	//How long a replaced signing key continues to verify tokens. This defaults to the maximum access
+	//token lifetime so tokens signed before a rotation remain valid until they expire.
+	SigningKeyGracePeriod time.Duration
+
+	//How often signing keys are rotated on a schedule - zero means keys are only rotated on request
+	SigningKeyRotationInterval time.Duration
+
+	//JWT bearer assertion policy - the leeway allowed checking exp, nbf and iat, and the longest an
+	//assertion may be valid for. The package defaults are used if these are not set.
+	JWTAssertionClockSkew   time.Duration
+	JWTAssertionMaxLifetime time.Duration
+
+	//The base URL clients use to reach roll, which is the issuer of the tokens roll signs and the base of
+	//the endpoint URLs in the authorization server metadata. It must be set.
+	IssuerBaseURL string
 }
 
 //NewCore creates a new Core instance injecting dependencies from the CoreConfig argument
@@ -40,6 +113,54 @@ func NewCore(config *CoreConfig) *Core {
 		panic(errors.New("core config must specify a repo for application persistance"))
 	}
 
+	if config.RefreshTokenRepo == nil {
+		panic(errors.New("core config must specify a repo for refresh token persistance"))
+	}
+
+	if config.RevocationRepo == nil {
+		panic(errors.New("core config must specify a repo for token revocation persistance"))
+	}
+
+	if config.AuthCodeRepo == nil {
+		panic(errors.New("core config must specify a repo for authorization code persistance"))
+	}
+
+	if config.SigningKeyRepo == nil {
+		panic(errors.New("core config must specify a repo for signing key persistance"))
+	}
+
+	if config.DeviceAuthorizationRepo == nil {
+		panic(errors.New("core config must specify a repo for device authorization persistance"))
+	}
+
+	if config.TrustedIssuerRepo == nil {
+		panic(errors.New("core config must specify a repo for trusted issuer persistance"))
+	}
+
+	if config.AssertionReplayRepo == nil {
+		panic(errors.New("core config must specify a repo for assertion replay persistance"))
+	}
+
+	if config.ScopeRepo == nil {
+		panic(errors.New("core config must specify a repo for scope persistance"))
+	}
+
+	if config.ConsentRepo == nil {
+		panic(errors.New("core config must specify a repo for consent persistance"))
+	}
+
+	if config.RegistrationTokenRepo == nil {
+		panic(errors.New("core config must specify a repo for registration token persistance"))
+	}
+
+	if config.ProtectedResourceRepo == nil {
+		panic(errors.New("core config must specify a repo for protected resource persistance"))
+	}
+
+	if config.PushedAuthorizationRepo == nil {
+		panic(errors.New("core config must specify a repo for pushed authorization persistance"))
+	}
+
 	if config.SecretsRepo == nil {
 		panic(errors.New("core config must specify a repo for secrets persistance"))
 	}
@@ -48,15 +169,93 @@ func NewCore(config *CoreConfig) *Core {
 		panic(errors.New("core config must specify an id generator"))
 	}
 
+	defaultLifetime := config.DefaultAccessTokenLifetime
+	if defaultLifetime <= 0 {
+		defaultLifetime = DefaultAccessTokenLifetime
+	}
+
+	maxLifetime := config.MaxAccessTokenLifetime
+	if maxLifetime <= 0 {
+		maxLifetime = MaxAccessTokenLifetime
+	}
+
+	if defaultLifetime > maxLifetime {
+		panic(errors.New("core config default access token lifetime exceeds the maximum lifetime"))
+	}
+
+	gracePeriod := config.SigningKeyGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = maxLifetime
+	}
+
+	if config.SigningKeyRotationInterval < 0 {
+		panic(errors.New("core config signing key rotation interval cannot be negative"))
+	}
+
+	clockSkew := config.JWTAssertionClockSkew
+	if clockSkew <= 0 {
+		clockSkew = DefaultJWTAssertionClockSkew
+	}
+
+	assertionLifetime := config.JWTAssertionMaxLifetime
+	if assertionLifetime <= 0 {
+		assertionLifetime = DefaultJWTAssertionMaxLifetime
+	}
+
+	//The issuer must be configured - deriving it from the Host header of each request would let callers
+	//choose the issuer and endpoint URLs roll hands out and checks assertions against
+	issuerBaseURL := strings.TrimSuffix(config.IssuerBaseURL, "/")
+	if issuerBaseURL == "" {
+		panic(errors.New("core config must specify an issuer base URL"))
+	}
+
+	if !validIssuerBaseURL(issuerBaseURL) {
+		panic(errors.New("core config issuer base URL must be an absolute http or https URL with no query or fragment"))
+	}
+
 	return &Core{
-		developerRepo:   config.DeveloperRepo,
-		ApplicationRepo: config.ApplicationRepo,
-		AdminRepo:       config.AdminRepo,
-		SecretsRepo:     config.SecretsRepo,
-		IdGenerator:     config.IdGenerator,
-		secure:          config.Secure,
-		rollClientId:    config.RollClientID,
+		developerRepo:           config.DeveloperRepo,
+		ApplicationRepo:         config.ApplicationRepo,
+		AdminRepo:               config.AdminRepo,
+		RefreshTokenRepo:        config.RefreshTokenRepo,
+		RevocationRepo:          config.RevocationRepo,
+		AuthCodeRepo:            config.AuthCodeRepo,
+		SigningKeyRepo:          config.SigningKeyRepo,
+		DeviceAuthorizationRepo: config.DeviceAuthorizationRepo,
+		TrustedIssuerRepo:       config.TrustedIssuerRepo,
+		AssertionReplayRepo:     config.AssertionReplayRepo,
+		ScopeRepo:               config.ScopeRepo,
+		ConsentRepo:             config.ConsentRepo,
+		RegistrationTokenRepo:   config.RegistrationTokenRepo,
+		ProtectedResourceRepo:   config.ProtectedResourceRepo,
+		PushedAuthorizationRepo: config.PushedAuthorizationRepo,
+		SecretsRepo:             config.SecretsRepo,
+		IdGenerator:             config.IdGenerator,
+		secure:                  config.Secure,
+		rollClientId:            config.RollClientID,
+
+		defaultAccessTokenLifetime: defaultLifetime,
+		maxAccessTokenLifetime:     maxLifetime,
+		signingKeyGracePeriod:      gracePeriod,
+		signingKeyRotationInterval: config.SigningKeyRotationInterval,
+		jwtAssertionClockSkew:      clockSkew,
+		jwtAssertionMaxLifetime:    assertionLifetime,
+		issuerBaseURL:              issuerBaseURL,
+	}
+}
+
+//validIssuerBaseURL checks the issuer can be used as described in RFC 8414 section 2
+func validIssuerBaseURL(issuer string) bool {
+	parsed, err := url.Parse(issuer)
+	if err != nil {
+		return false
+	}
+
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return false
 	}
+
+	return parsed.Host != "" && !strings.ContainsAny(issuer, "?#")
 }
 
 //Secure returns true if roll is running in secure mode, false otherwise
@@ -64,6 +263,53 @@ func (core *Core) Secure() bool {
 	return core.secure
 }
 
+//AccessTokenLifetime returns the lifetime of access tokens issued for the application. This is the
+//application's own lifetime if it specifies one, otherwise the server default, and is never more than
+//the server maximum.
+func (core *Core) AccessTokenLifetime(app *Application) time.Duration {
+	if app.AccessTokenLifetime <= 0 {
+		return core.defaultAccessTokenLifetime
+	}
+
+	lifetime := time.Duration(app.AccessTokenLifetime) * time.Second
+	if lifetime > core.maxAccessTokenLifetime {
+		return core.maxAccessTokenLifetime
+	}
+
+	return lifetime
+}
+
+//MaxAccessTokenLifetime returns the longest an access token issued by the core may live
+func (core *Core) MaxAccessTokenLifetime() time.Duration {
+	return core.maxAccessTokenLifetime
+}
+
+//SigningKeyGracePeriod returns how long a replaced signing key continues to verify tokens
+func (core *Core) SigningKeyGracePeriod() time.Duration {
+	return core.signingKeyGracePeriod
+}
+
+//SigningKeyRotationInterval returns how often signing keys are rotated on a schedule, or zero
+//if scheduled rotation is disabled
+func (core *Core) SigningKeyRotationInterval() time.Duration {
+	return core.signingKeyRotationInterval
+}
+
+//JWTAssertionClockSkew returns the leeway allowed when checking the time claims of JWT bearer assertions
+func (core *Core) JWTAssertionClockSkew() time.Duration {
+	return core.jwtAssertionClockSkew
+}
+
+//JWTAssertionMaxLifetime returns the longest a JWT bearer assertion may be valid for
+func (core *Core) JWTAssertionMaxLifetime() time.Duration {
+	return core.jwtAssertionMaxLifetime
+}
+
+//IssuerBaseURL returns the configured base URL clients use to reach roll
+func (core *Core) IssuerBaseURL() string {
+	return core.issuerBaseURL
+}
+
 //StoreDeveloper stores a developer using the embedded Developer repository
 func (core *Core) StoreDeveloper(dev *Developer) error {
 	return core.developerRepo.StoreDeveloper(dev)
@@ -100,6 +346,12 @@ func (core *Core) SystemRetrieveApplication(clientID string) (*Application, erro
 	return core.ApplicationRepo.SystemRetrieveApplication(clientID)
 }
 
+//DeleteApplication removes an application. A NoSuchApplicationError is returned if there is no
+//application with the client id.
+func (core *Core) DeleteApplication(clientID string) error {
+	return core.ApplicationRepo.DeleteApplication(clientID)
+}
+
 //StoreKeysForApp stores the private and public keys associated with an application
 //using the embedded secrets store
 func (core *Core) StoreKeysForApp(clientID, privateKey, publicKey string) error {
@@ -133,7 +385,249 @@ func (core *Core) IsAdmin(subject string) (bool, error) {
 	return core.AdminRepo.IsAdmin(subject)
 }
 
+//StoreRefreshToken stores a refresh token using the embedded RefreshToken repository
+func (core *Core) StoreRefreshToken(rt *RefreshToken) error {
+	return core.RefreshTokenRepo.StoreRefreshToken(rt)
+}
+
+//RetrieveRefreshToken retrieves a refresh token using the embedded RefreshToken repository
+func (core *Core) RetrieveRefreshToken(tokenID string) (*RefreshToken, error) {
+	return core.RefreshTokenRepo.RetrieveRefreshToken(tokenID)
+}
+
+//MarkRefreshTokenUsed flags a refresh token as spent. A RefreshTokenReuseError is returned
+//if the token had already been used.
+func (core *Core) MarkRefreshTokenUsed(tokenID string) error {
+	return core.RefreshTokenRepo.MarkRefreshTokenUsed(tokenID)
+}
+
+//RevokeRefreshTokenFamily revokes all the refresh tokens descended from the same original grant
+func (core *Core) RevokeRefreshTokenFamily(familyID string) error {
+	return core.RefreshTokenRepo.RevokeRefreshTokenFamily(familyID)
+}
+
+//RevokeSubjectRefreshTokens revokes all the refresh tokens issued to an application on behalf of a subject
+func (core *Core) RevokeSubjectRefreshTokens(subject, clientID string) error {
+	return core.RefreshTokenRepo.RevokeSubjectRefreshTokens(subject, clientID)
+}
+
+//RevokeToken records the revocation of the token with the given id until its expiry time
+func (core *Core) RevokeToken(tokenID string, expiresAt int64) error {
+	return core.RevocationRepo.RevokeToken(tokenID, expiresAt)
+}
+
+//IsTokenRevoked is a predicate used to determine if the token with the given id has been revoked
+func (core *Core) IsTokenRevoked(tokenID string) (bool, error) {
+	return core.RevocationRepo.IsTokenRevoked(tokenID)
+}
+
+//StoreAuthCode records an issued authorization code using the embedded AuthCode repository
+func (core *Core) StoreAuthCode(code *AuthCode) error {
+	return core.AuthCodeRepo.StoreAuthCode(code)
+}
+
+//RetrieveAuthCode retrieves an authorization code record using the embedded AuthCode repository
+func (core *Core) RetrieveAuthCode(codeID string) (*AuthCode, error) {
+	return core.AuthCodeRepo.RetrieveAuthCode(codeID)
+}
+
+//MarkAuthCodeUsed flags an authorization code as exchanged. An AuthCodeReuseError is returned
+//if the code had already been used.
+func (core *Core) MarkAuthCodeUsed(codeID string) error {
+	return core.AuthCodeRepo.MarkAuthCodeUsed(codeID)
+}
+
+//RecordAuthCodeTokens notes the tokens issued in exchange for an authorization code
+func (core *Core) RecordAuthCodeTokens(codeID, accessTokenID string, accessTokenExpiresAt int64, refreshTokenFamilyID string) error {
+	return core.AuthCodeRepo.RecordAuthCodeTokens(codeID, accessTokenID, accessTokenExpiresAt, refreshTokenFamilyID)
+}
+
+//StoreSigningKey records a version of an application signing key
+func (core *Core) StoreSigningKey(key *SigningKey) error {
+	return core.SigningKeyRepo.StoreSigningKey(key)
+}
+
+//ListSigningKeys returns the recorded versions of an application's signing key, oldest first
+func (core *Core) ListSigningKeys(clientID string) ([]SigningKey, error) {
+	return core.SigningKeyRepo.ListSigningKeys(clientID)
+}
+
+//RetrieveSigningKey retrieves a version of an application signing key by its key id. Note a nil
+//pointer is returned if there is no such key
+func (core *Core) RetrieveSigningKey(clientID, keyID string) (*SigningKey, error) {
+	return core.SigningKeyRepo.RetrieveSigningKey(clientID, keyID)
+}
+
+//RetireSigningKey sets the time after which a version of an application signing key no longer verifies tokens
+func (core *Core) RetireSigningKey(clientID string, version int, retiresAt int64) error {
+	return core.SigningKeyRepo.RetireSigningKey(clientID, version, retiresAt)
+}
+
 //GenerateID generates and id
 func (core *Core) GenerateID() (string, error) {
 	return core.IdGenerator.GenerateID()
 }
+
+//StoreDeviceAuthorization records a device authorization request
+func (core *Core) StoreDeviceAuthorization(da *DeviceAuthorization) error {
+	return core.DeviceAuthorizationRepo.StoreDeviceAuthorization(da)
+}
+
+//RetrieveDeviceAuthorization retrieves a device authorization by its device code. Note a nil pointer is
+//returned if there is no record for the device code.
+func (core *Core) RetrieveDeviceAuthorization(deviceCode string) (*DeviceAuthorization, error) {
+	return core.DeviceAuthorizationRepo.RetrieveDeviceAuthorization(deviceCode)
+}
+
+//RetrieveDeviceAuthorizationByUserCode retrieves a device authorization by its user code. Note a nil pointer
+//is returned if there is no record for the user code.
+func (core *Core) RetrieveDeviceAuthorizationByUserCode(userCode string) (*DeviceAuthorization, error) {
+	return core.DeviceAuthorizationRepo.RetrieveDeviceAuthorizationByUserCode(userCode)
+}
+
+//RecordDeviceAuthorizationPoll notes when the device last polled for tokens, along with the polling interval
+//it must now observe
+func (core *Core) RecordDeviceAuthorizationPoll(deviceCode string, polledAt, interval int64) error {
+	return core.DeviceAuthorizationRepo.RecordDeviceAuthorizationPoll(deviceCode, polledAt, interval)
+}
+
+//UpdateDeviceAuthorizationStatus moves a device authorization from one status to another, recording the
+//subject that approved it. A DeviceAuthorizationStatusError is returned if the authorization is not in the
+//from status.
+func (core *Core) UpdateDeviceAuthorizationStatus(deviceCode, fromStatus, toStatus, subject string) error {
+	return core.DeviceAuthorizationRepo.UpdateDeviceAuthorizationStatus(deviceCode, fromStatus, toStatus, subject)
+}
+
+//StoreTrustedIssuer adds an issuer to the trusted issuer registry, or replaces the definition of an issuer
+//the application already trusts. A TrustedIssuerOwnerError is returned if the issuer and audience are
+//registered to another application.
+func (core *Core) StoreTrustedIssuer(ti *TrustedIssuer) error {
+	return core.TrustedIssuerRepo.StoreTrustedIssuer(ti)
+}
+
+//RetrieveTrustedIssuer retrieves the trusted issuer for an assertion issuer and audience. Note a nil pointer
+//is returned if no application trusts the issuer with that audience
+func (core *Core) RetrieveTrustedIssuer(issuer, audience string) (*TrustedIssuer, error) {
+	return core.TrustedIssuerRepo.RetrieveTrustedIssuer(issuer, audience)
+}
+
+//ListTrustedIssuers returns the issuers an application trusts
+func (core *Core) ListTrustedIssuers(clientID string) ([]TrustedIssuer, error) {
+	return core.TrustedIssuerRepo.ListTrustedIssuers(clientID)
+}
+
+//DeleteTrustedIssuer removes an issuer from the issuers an application trusts
+func (core *Core) DeleteTrustedIssuer(clientID, issuer, audience string) error {
+	return core.TrustedIssuerRepo.DeleteTrustedIssuer(clientID, issuer, audience)
+}
+
+//RecordAssertionUse records the use of a JWT bearer assertion. An AssertionReplayError is returned if the
+//assertion has already been used.
+func (core *Core) RecordAssertionUse(issuer, tokenID string, expiresAt int64) error {
+	return core.AssertionReplayRepo.RecordAssertionUse(issuer, tokenID, expiresAt)
+}
+
+//StoreScope adds a scope to the scope registry, or replaces its description
+func (core *Core) StoreScope(scope *Scope) error {
+	return core.ScopeRepo.StoreScope(scope)
+}
+
+//RetrieveScope retrieves a scope from the scope registry. Note a nil pointer is returned if the scope
+//is not registered
+func (core *Core) RetrieveScope(name string) (*Scope, error) {
+	return core.ScopeRepo.RetrieveScope(name)
+}
+
+//ListScopes returns the scopes in the scope registry
+func (core *Core) ListScopes() ([]Scope, error) {
+	return core.ScopeRepo.ListScopes()
+}
+
+//DeleteScope removes a scope from the scope registry. A NoSuchScopeError is returned if the scope is
+//not registered.
+func (core *Core) DeleteScope(name string) error {
+	return core.ScopeRepo.DeleteScope(name)
+}
+
+//StoreConsent records the scopes a user has consented to an application requesting
+func (core *Core) StoreConsent(consent *Consent) error {
+	return core.ConsentRepo.StoreConsent(consent)
+}
+
+//RetrieveConsent retrieves the consent a user has given an application. Note a nil pointer is returned if
+//the user has not given the application consent
+func (core *Core) RetrieveConsent(subject, clientID string) (*Consent, error) {
+	return core.ConsentRepo.RetrieveConsent(subject, clientID)
+}
+
+//ListConsents returns the consents a user has given
+func (core *Core) ListConsents(subject string) ([]Consent, error) {
+	return core.ConsentRepo.ListConsents(subject)
+}
+
+//DeleteConsent removes the consent a user has given an application. A NoSuchConsentError is returned if
+//the user has not given the application consent.
+func (core *Core) DeleteConsent(subject, clientID string) error {
+	return core.ConsentRepo.DeleteConsent(subject, clientID)
+}
+
+//StoreRegistrationToken records an initial access token or registration access token
+func (core *Core) StoreRegistrationToken(token *RegistrationToken) error {
+	return core.RegistrationTokenRepo.StoreRegistrationToken(token)
+}
+
+//RetrieveRegistrationToken retrieves a registration token by its id. Note a nil pointer is returned if
+//there is no such token
+func (core *Core) RetrieveRegistrationToken(tokenID string) (*RegistrationToken, error) {
+	return core.RegistrationTokenRepo.RetrieveRegistrationToken(tokenID)
+}
+
+//ListInitialAccessTokens returns the initial access tokens admins have issued
+func (core *Core) ListInitialAccessTokens() ([]RegistrationToken, error) {
+	return core.RegistrationTokenRepo.ListInitialAccessTokens()
+}
+
+//DeleteRegistrationToken removes a registration token. A NoSuchRegistrationTokenError is returned if there
+//is no such token.
+func (core *Core) DeleteRegistrationToken(tokenID string) error {
+	return core.RegistrationTokenRepo.DeleteRegistrationToken(tokenID)
+}
+
+//StoreProtectedResource adds a resource to the protected resource registry, or replaces its description
+func (core *Core) StoreProtectedResource(resource *ProtectedResource) error {
+	return core.ProtectedResourceRepo.StoreProtectedResource(resource)
+}
+
+//RetrieveProtectedResource retrieves a resource from the protected resource registry. Note a nil pointer
+//is returned if the resource is not registered
+func (core *Core) RetrieveProtectedResource(identifier string) (*ProtectedResource, error) {
+	return core.ProtectedResourceRepo.RetrieveProtectedResource(identifier)
+}
+
+//ListProtectedResources returns the resources in the protected resource registry
+func (core *Core) ListProtectedResources() ([]ProtectedResource, error) {
+	return core.ProtectedResourceRepo.ListProtectedResources()
+}
+
+//DeleteProtectedResource removes a resource from the protected resource registry. A
+//NoSuchProtectedResourceError is returned if the resource is not registered.
+func (core *Core) DeleteProtectedResource(identifier string) error {
+	return core.ProtectedResourceRepo.DeleteProtectedResource(identifier)
+}
+
+//StorePushedAuthorization records the parameters of a pushed authorization request
+func (core *Core) StorePushedAuthorization(pa *PushedAuthorization) error {
+	return core.PushedAuthorizationRepo.StorePushedAuthorization(pa)
+}
+
+//RetrievePushedAuthorization retrieves a pushed authorization by its request uri. Note a nil pointer is
+//returned if there is no such pushed authorization
+func (core *Core) RetrievePushedAuthorization(requestURI string) (*PushedAuthorization, error) {
+	return core.PushedAuthorizationRepo.RetrievePushedAuthorization(requestURI)
+}
+
+//DeletePushedAuthorization removes a pushed authorization once it has been used. A
+//NoSuchPushedAuthorizationError is returned if there is no such pushed authorization.
+func (core *Core) DeletePushedAuthorization(requestURI string) error {
+	return core.PushedAuthorizationRepo.DeletePushedAuthorization(requestURI)
+}
@@ -0,0 +1,63 @@
+package roll
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+)
+
+//Scope is an entry in the scope registry. Applications may only request registered scopes, and only
+//those they list in their allowed scopes. The description is shown to users when they authorize an
+//application.
+type Scope struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+//scopeToken matches the scope-token syntax of RFC 6749 section 3.3
+var scopeToken = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+//ValidScopeName is true if the name can be used as a scope
+func ValidScopeName(name string) bool {
+	return scopeToken.MatchString(name)
+}
+
+//Validate checks the scope definition is complete
+func (s *Scope) Validate() error {
+	var valid = true
+	var err error
+
+	bs := bytes.NewBufferString("Fields with invalid content: ")
+
+	if !ValidScopeName(s.Name) {
+		valid = false
+		bs.WriteString("Name ")
+	}
+
+	if s.Description == "" {
+		valid = false
+		bs.WriteString("Description ")
+	}
+
+	if !valid {
+		err = errors.New(bs.String())
+	}
+
+	return err
+}
+
+//ScopeRepo represents a repository abstraction for the scope registry
+type ScopeRepo interface {
+	StoreScope(scope *Scope) error
+	RetrieveScope(name string) (*Scope, error)
+	ListScopes() ([]Scope, error)
+	DeleteScope(name string) error
+}
+
+//NoSuchScopeError is returned when deleting a scope that is not in the registry
+type NoSuchScopeError struct{}
+
+//Error implements the Error interface for NoSuchScopeError
+func (e NoSuchScopeError) Error() string {
+	return "No such scope"
+}
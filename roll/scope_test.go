@@ -0,0 +1,28 @@
+package roll
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestValidScopeName(t *testing.T) {
+	assert.True(t, ValidScopeName("read"))
+	assert.True(t, ValidScopeName("https://api.example.com/orders.read"))
+	assert.False(t, ValidScopeName(""))
+	assert.False(t, ValidScopeName("read write"))
+	assert.False(t, ValidScopeName(`say"what`))
+	assert.False(t, ValidScopeName(`back\slash`))
+}
+
+func TestValidateScope(t *testing.T) {
+	s := Scope{Name: "orders.read", Description: "Read your orders"}
+	assert.Nil(t, s.Validate())
+
+	s = Scope{Name: "orders read"}
+	err := s.Validate()
+	if assert.NotNil(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "Name"))
+		assert.True(t, strings.Contains(err.Error(), "Description"))
+	}
+}
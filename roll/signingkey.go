@@ -0,0 +1,52 @@
+package roll
+
+import (
+	"fmt"
+	"time"
+)
+
+//Signing key states. Only the active key signs tokens. A retiring key still verifies tokens until its
+//retirement time, after which it is retired and tokens signed with it are rejected.
+const (
+	SigningKeyActive   = "active"
+	SigningKeyRetiring = "retiring"
+	SigningKeyRetired  = "retired"
+)
+
+//SigningKey records a version of an application's token signing key. The key pair itself is held in the
+//secrets repo under SecretName. The application's current key is also held under the application's
+//client id, which is where token signing and verifiers that predate key rotation look for it.
+type SigningKey struct {
+	ClientID  string
+	KeyID     string
+	Version   int
+	CreatedAt int64
+
+	//RetiresAt is zero for the active key, and is set when the key is replaced
+	RetiresAt int64
+}
+
+//State returns the state of the key - active, retiring or retired
+func (sk *SigningKey) State() string {
+	switch {
+	case sk.RetiresAt == 0:
+		return SigningKeyActive
+	case time.Now().Unix() < sk.RetiresAt:
+		return SigningKeyRetiring
+	default:
+		return SigningKeyRetired
+	}
+}
+
+//SecretName returns the name the key pair for this version of the key is stored under in the secrets repo
+func (sk *SigningKey) SecretName() string {
+	return fmt.Sprintf("%s/v%d", sk.ClientID, sk.Version)
+}
+
+//SigningKeyRepo represents a repository abstraction for recording the versions of application signing keys.
+type SigningKeyRepo interface {
+	StoreSigningKey(key *SigningKey) error
+	ListSigningKeys(clientID string) ([]SigningKey, error)
+	RetrieveSigningKey(clientID, keyID string) (*SigningKey, error)
+	RetireSigningKey(clientID string, version int, retiresAt int64) error
+}
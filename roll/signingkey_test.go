@@ -0,0 +1,23 @@
+package roll
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSigningKeyState(t *testing.T) {
+	key := SigningKey{ClientID: "1111-2222", KeyID: "kid", Version: 1}
+	assert.Equal(t, SigningKeyActive, key.State())
+
+	key.RetiresAt = time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, SigningKeyRetiring, key.State())
+
+	key.RetiresAt = time.Now().Add(-time.Hour).Unix()
+	assert.Equal(t, SigningKeyRetired, key.State())
+}
+
+func TestSigningKeySecretName(t *testing.T) {
+	key := SigningKey{ClientID: "1111-2222", KeyID: "kid", Version: 3}
+	assert.Equal(t, "1111-2222/v3", key.SecretName())
+}
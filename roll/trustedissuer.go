@@ -0,0 +1,111 @@
+package roll
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+//TrustedIssuer records an external token issuer whose JWT bearer assertions (RFC 7523) an application
+//accepts. Assertions name the issuer in their iss claim and the application in their aud claim, so each
+//issuer and audience pair identifies a single application. An application may trust several issuers.
+type TrustedIssuer struct {
+	ClientID string `json:"clientID"`
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+
+	//PublicKeys holds one or more PEM encoded keys the issuer signs assertions with
+	PublicKeys string `json:"publicKeys"`
+
+	//AllowedSubjects and AllowedScopes are space delimited. No allowed subjects means any subject
+	//is allowed, whereas a scope must be listed to be asserted.
+	AllowedSubjects string `json:"allowedSubjects"`
+	AllowedScopes   string `json:"allowedScopes"`
+}
+
+//PublicKeyPEMs returns each of the issuer's PEM encoded public keys
+func (ti *TrustedIssuer) PublicKeyPEMs() []string {
+	var keys []string
+
+	rest := []byte(ti.PublicKeys)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return keys
+		}
+
+		keys = append(keys, string(pem.EncodeToMemory(block)))
+	}
+}
+
+//SubjectAllowed is true if assertions from the issuer may name the given subject
+func (ti *TrustedIssuer) SubjectAllowed(subject string) bool {
+	allowed := strings.Fields(ti.AllowedSubjects)
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, s := range allowed {
+		if s == subject {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Validate checks the trusted issuer definition is complete
+func (ti *TrustedIssuer) Validate() error {
+	var valid = true
+	var err error
+
+	bs := bytes.NewBufferString("Fields with invalid content: ")
+
+	if ti.Issuer == "" {
+		valid = false
+		bs.WriteString("Issuer ")
+	}
+
+	if ti.Audience == "" {
+		valid = false
+		bs.WriteString("Audience ")
+	}
+
+	if len(ti.PublicKeyPEMs()) == 0 {
+		valid = false
+		bs.WriteString("PublicKeys ")
+	}
+
+	if !valid {
+		err = errors.New(bs.String())
+	}
+
+	return err
+}
+
+//TrustedIssuerRepo represents a repository abstraction for the registry of trusted assertion issuers.
+type TrustedIssuerRepo interface {
+	StoreTrustedIssuer(ti *TrustedIssuer) error
+	RetrieveTrustedIssuer(issuer, audience string) (*TrustedIssuer, error)
+	ListTrustedIssuers(clientID string) ([]TrustedIssuer, error)
+	DeleteTrustedIssuer(clientID, issuer, audience string) error
+}
+
+//TrustedIssuerOwnerError is returned when an issuer and audience pair is already registered by
+//another application
+type TrustedIssuerOwnerError struct{}
+
+//Error implements the Error interface for TrustedIssuerOwnerError
+func (e TrustedIssuerOwnerError) Error() string {
+	return "Issuer and audience are registered to another application"
+}
+
+//NoSuchTrustedIssuerError is returned when deleting an issuer the application does not trust
+type NoSuchTrustedIssuerError struct{}
+
+//Error implements the Error interface for NoSuchTrustedIssuerError
+func (e NoSuchTrustedIssuerError) Error() string {
+	return "No such trusted issuer"
+}
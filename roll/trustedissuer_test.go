@@ -0,0 +1,50 @@
+package roll
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const (
+	testKey1 = "-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n"
+	testKey2 = "-----BEGIN PUBLIC KEY-----\nBBBB\n-----END PUBLIC KEY-----\n"
+)
+
+func TestTrustedIssuerPublicKeyPEMs(t *testing.T) {
+	ti := TrustedIssuer{PublicKeys: testKey1 + "\n" + testKey2}
+	assert.Equal(t, []string{testKey1, testKey2}, ti.PublicKeyPEMs())
+
+	ti.PublicKeys = "not a key"
+	assert.Equal(t, 0, len(ti.PublicKeyPEMs()))
+}
+
+func TestTrustedIssuerSubjectAllowed(t *testing.T) {
+	ti := TrustedIssuer{}
+	assert.True(t, ti.SubjectAllowed("anyone"))
+
+	ti.AllowedSubjects = "svc-a svc-b"
+	assert.True(t, ti.SubjectAllowed("svc-b"))
+	assert.False(t, ti.SubjectAllowed("svc-c"))
+}
+
+func TestValidateTrustedIssuer(t *testing.T) {
+	ti := TrustedIssuer{
+		Issuer:     "https://idp.example.com",
+		Audience:   "https://roll.example.com",
+		PublicKeys: testKey1,
+	}
+
+	assert.Nil(t, ti.Validate())
+
+	ti.PublicKeys = ""
+	err := ti.Validate()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "PublicKeys")
+	}
+
+	ti.Issuer = ""
+	err = ti.Validate()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "Issuer")
+	}
+}
@@ -65,12 +65,24 @@ func main() {
 
 	var port = flag.Int("port", -1, "Port to listen on")
 	var unsecureMode = flag.Bool("unsecure", false, "Boot in unsecure mode")
+	var tokenLifetime = flag.Duration("token-lifetime", roll.DefaultAccessTokenLifetime, "Default access token lifetime")
+	var maxTokenLifetime = flag.Duration("max-token-lifetime", roll.MaxAccessTokenLifetime, "Maximum access token lifetime an application may specify")
+	var keyGracePeriod = flag.Duration("key-grace-period", 0, "How long a replaced signing key verifies tokens (default max-token-lifetime)")
+	var keyRotationInterval = flag.Duration("key-rotation-interval", 0, "Rotate application signing keys on this schedule (default no scheduled rotation)")
+	var assertionClockSkew = flag.Duration("jwt-assertion-clock-skew", roll.DefaultJWTAssertionClockSkew, "Leeway allowed checking the time claims of JWT bearer assertions")
+	var assertionMaxLifetime = flag.Duration("jwt-assertion-max-lifetime", roll.DefaultJWTAssertionMaxLifetime, "Longest a JWT bearer assertion may be valid for")
+	var issuer = flag.String("issuer", "", "Base URL clients use to reach roll, e.g. https://auth.example.com")
 	flag.Parse()
 	if *port == -1 {
 		fmt.Println("Must specify a -port argument")
 		return
 	}
 
+	if *issuer == "" {
+		fmt.Println("Must specify an -issuer argument")
+		return
+	}
+
 	var coreConfig *roll.CoreConfig
 
 	if *unsecureMode == true {
@@ -92,5 +104,13 @@ func main() {
 		}
 	}
 
+	coreConfig.DefaultAccessTokenLifetime = *tokenLifetime
+	coreConfig.MaxAccessTokenLifetime = *maxTokenLifetime
+	coreConfig.SigningKeyGracePeriod = *keyGracePeriod
+	coreConfig.SigningKeyRotationInterval = *keyRotationInterval
+	coreConfig.JWTAssertionClockSkew = *assertionClockSkew
+	coreConfig.JWTAssertionMaxLifetime = *assertionMaxLifetime
+	coreConfig.IssuerBaseURL = *issuer
+
 	rollsvcs.RunRoll(*port, coreConfig)
 }
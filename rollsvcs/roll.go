@@ -14,50 +14,99 @@ import (
 
 func DefaultConfig() *roll.CoreConfig {
 	return &roll.CoreConfig{
-		DeveloperRepo:   repos.NewDynamoDevRepo(),
-		ApplicationRepo: repos.NewDynamoAppRepo(),
-		AdminRepo:       repos.NewDynamoAdminRepo(),
-		SecretsRepo:     secretsrepos.NewVaultSecretsRepo(),
-		IdGenerator:     new(rolltoken.UUIDIdGenerator),
-		Secure:          true,
+		DeveloperRepo:           repos.NewDynamoDevRepo(),
+		ApplicationRepo:         repos.NewDynamoAppRepo(),
+		AdminRepo:               repos.NewDynamoAdminRepo(),
+		RefreshTokenRepo:        repos.NewDynamoRefreshTokenRepo(),
+		RevocationRepo:          repos.NewDynamoRevocationRepo(),
+		AuthCodeRepo:            repos.NewDynamoAuthCodeRepo(),
+		SigningKeyRepo:          repos.NewDynamoSigningKeyRepo(),
+		DeviceAuthorizationRepo: repos.NewDynamoDeviceAuthorizationRepo(),
+		TrustedIssuerRepo:       repos.NewDynamoTrustedIssuerRepo(),
+		AssertionReplayRepo:     repos.NewDynamoAssertionReplayRepo(),
+		ScopeRepo:               repos.NewDynamoScopeRepo(),
+		ConsentRepo:             repos.NewDynamoConsentRepo(),
+		RegistrationTokenRepo:   repos.NewDynamoRegistrationTokenRepo(),
+		ProtectedResourceRepo:   repos.NewDynamoProtectedResourceRepo(),
+		PushedAuthorizationRepo: repos.NewDynamoPushedAuthorizationRepo(),
+		SecretsRepo:             secretsrepos.NewVaultSecretsRepo(),
+		IdGenerator:             new(rolltoken.UUIDIdGenerator),
+		Secure:                  true,
 	}
 }
 
 func DefaultUnsecureConfig() *roll.CoreConfig {
 	return &roll.CoreConfig{
-		DeveloperRepo:   repos.NewDynamoDevRepo(),
-		ApplicationRepo: repos.NewDynamoAppRepo(),
-		AdminRepo:       repos.NewDynamoAdminRepo(),
-		SecretsRepo:     secretsrepos.NewVaultSecretsRepo(),
-		IdGenerator:     new(rolltoken.UUIDIdGenerator),
-		Secure:          false,
+		DeveloperRepo:           repos.NewDynamoDevRepo(),
+		ApplicationRepo:         repos.NewDynamoAppRepo(),
+		AdminRepo:               repos.NewDynamoAdminRepo(),
+		RefreshTokenRepo:        repos.NewDynamoRefreshTokenRepo(),
+		RevocationRepo:          repos.NewDynamoRevocationRepo(),
+		AuthCodeRepo:            repos.NewDynamoAuthCodeRepo(),
+		SigningKeyRepo:          repos.NewDynamoSigningKeyRepo(),
+		DeviceAuthorizationRepo: repos.NewDynamoDeviceAuthorizationRepo(),
+		TrustedIssuerRepo:       repos.NewDynamoTrustedIssuerRepo(),
+		AssertionReplayRepo:     repos.NewDynamoAssertionReplayRepo(),
+		ScopeRepo:               repos.NewDynamoScopeRepo(),
+		ConsentRepo:             repos.NewDynamoConsentRepo(),
+		RegistrationTokenRepo:   repos.NewDynamoRegistrationTokenRepo(),
+		ProtectedResourceRepo:   repos.NewDynamoProtectedResourceRepo(),
+		PushedAuthorizationRepo: repos.NewDynamoPushedAuthorizationRepo(),
+		SecretsRepo:             secretsrepos.NewVaultSecretsRepo(),
+		IdGenerator:             new(rolltoken.UUIDIdGenerator),
+		Secure:                  false,
 	}
 }
 
 func MariaDBUnsecureConfig() *roll.CoreConfig {
 	return &roll.CoreConfig{
-		AdminRepo:       mdb.NewMBDAdminRepo(),
-		DeveloperRepo:   mdb.NewMBDDevRepo(),
-		ApplicationRepo: mdb.NewMBDAppRepo(),
-		SecretsRepo:     secretsrepos.NewVaultSecretsRepo(),
-		IdGenerator:     new(rolltoken.UUIDIdGenerator),
-		Secure:          false,
+		AdminRepo:               mdb.NewMBDAdminRepo(),
+		DeveloperRepo:           mdb.NewMBDDevRepo(),
+		ApplicationRepo:         mdb.NewMBDAppRepo(),
+		RefreshTokenRepo:        mdb.NewMBDRefreshTokenRepo(),
+		RevocationRepo:          mdb.NewMBDRevocationRepo(),
+		AuthCodeRepo:            mdb.NewMBDAuthCodeRepo(),
+		SigningKeyRepo:          mdb.NewMBDSigningKeyRepo(),
+		DeviceAuthorizationRepo: mdb.NewMBDDeviceAuthorizationRepo(),
+		TrustedIssuerRepo:       mdb.NewMBDTrustedIssuerRepo(),
+		AssertionReplayRepo:     mdb.NewMBDAssertionReplayRepo(),
+		ScopeRepo:               mdb.NewMBDScopeRepo(),
+		ConsentRepo:             mdb.NewMBDConsentRepo(),
+		RegistrationTokenRepo:   mdb.NewMBDRegistrationTokenRepo(),
+		ProtectedResourceRepo:   mdb.NewMBDProtectedResourceRepo(),
+		PushedAuthorizationRepo: mdb.NewMBDPushedAuthorizationRepo(),
+		SecretsRepo:             secretsrepos.NewVaultSecretsRepo(),
+		IdGenerator:             new(rolltoken.UUIDIdGenerator),
+		Secure:                  false,
 	}
 }
 
 func MariaDBSecureConfig() *roll.CoreConfig {
 	return &roll.CoreConfig{
-		AdminRepo:       mdb.NewMBDAdminRepo(),
-		DeveloperRepo:   mdb.NewMBDDevRepo(),
-		ApplicationRepo: mdb.NewMBDAppRepo(),
-		SecretsRepo:     secretsrepos.NewVaultSecretsRepo(),
-		IdGenerator:     new(rolltoken.UUIDIdGenerator),
-		Secure:          true,
+		AdminRepo:               mdb.NewMBDAdminRepo(),
+		DeveloperRepo:           mdb.NewMBDDevRepo(),
+		ApplicationRepo:         mdb.NewMBDAppRepo(),
+		RefreshTokenRepo:        mdb.NewMBDRefreshTokenRepo(),
+		RevocationRepo:          mdb.NewMBDRevocationRepo(),
+		AuthCodeRepo:            mdb.NewMBDAuthCodeRepo(),
+		SigningKeyRepo:          mdb.NewMBDSigningKeyRepo(),
+		DeviceAuthorizationRepo: mdb.NewMBDDeviceAuthorizationRepo(),
+		TrustedIssuerRepo:       mdb.NewMBDTrustedIssuerRepo(),
+		AssertionReplayRepo:     mdb.NewMBDAssertionReplayRepo(),
+		ScopeRepo:               mdb.NewMBDScopeRepo(),
+		ConsentRepo:             mdb.NewMBDConsentRepo(),
+		RegistrationTokenRepo:   mdb.NewMBDRegistrationTokenRepo(),
+		ProtectedResourceRepo:   mdb.NewMBDProtectedResourceRepo(),
+		PushedAuthorizationRepo: mdb.NewMBDPushedAuthorizationRepo(),
+		SecretsRepo:             secretsrepos.NewVaultSecretsRepo(),
+		IdGenerator:             new(rolltoken.UUIDIdGenerator),
+		Secure:                  true,
 	}
 }
 
 func RunRoll(port int, config *roll.CoreConfig) {
 	core := roll.NewCore(config)
+	go rollhttp.RotateSigningKeysOnSchedule(core)
 	log.Info("Starting roll - listening on port ", port)
 	http.ListenAndServe(fmt.Sprintf(":%d", port), rollhttp.Handler(core))
 }
@@ -0,0 +1,58 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+//ErrEdDSAVerification is returned when an EdDSA signature does not verify
+var ErrEdDSAVerification = errors.New("ed25519: verification error")
+
+//SigningMethodEdDSA implements the EdDSA signing method of RFC 8037 for Ed25519 keys, which the jwt
+//package does not provide. Sign takes an ed25519.PrivateKey, Verify an ed25519.PublicKey.
+type SigningMethodEdDSA struct{}
+
+//SigningMethodEd25519 is registered with the jwt package for the EdDSA alg header value
+var SigningMethodEd25519 *SigningMethodEdDSA
+
+func init() {
+	SigningMethodEd25519 = &SigningMethodEdDSA{}
+	jwt.RegisterSigningMethod(SigningMethodEd25519.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEd25519
+	})
+}
+
+//Alg returns the alg header value for the method
+func (m *SigningMethodEdDSA) Alg() string {
+	return EdDSA
+}
+
+//Verify checks the signature of the signing string
+func (m *SigningMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok || len(publicKey) != ed25519.PublicKeySize {
+		return jwt.ErrInvalidKey
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return ErrEdDSAVerification
+	}
+
+	return nil
+}
+
+//Sign signs the signing string, returning the encoded signature
+func (m *SigningMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok || len(privateKey) != ed25519.PrivateKeySize {
+		return "", jwt.ErrInvalidKey
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
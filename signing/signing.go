@@ -0,0 +1,216 @@
+//Package signing handles the keys roll signs tokens with, and the keys clients and trusted issuers sign
+//assertions with. RSA, ECDSA (P-256 and P-384) and Ed25519 keys are supported.
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/xtraclabs/rollsecrets/secrets"
+)
+
+//Algorithms roll can sign an application's tokens with - see RFC 7518 section 3.1 and RFC 8037
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	ES384 = "ES384"
+	EdDSA = "EdDSA"
+)
+
+//Algs lists the algorithms roll can sign tokens with
+var Algs = []string{RS256, ES256, ES384, EdDSA}
+
+var (
+	//ErrUnsupportedKey is returned for keys that are not RSA, P-256 or P-384 ECDSA, or Ed25519 keys
+	ErrUnsupportedKey = errors.New("Unsupported key type - keys must be RSA, ECDSA P-256 or P-384, or Ed25519")
+
+	//ErrKeyNotPEMEncoded is returned when a key cannot be decoded from PEM
+	ErrKeyNotPEMEncoded = errors.New("Key must be PEM encoded")
+)
+
+//SupportedAlg is true if roll can sign tokens with the algorithm
+func SupportedAlg(alg string) bool {
+	for _, a := range Algs {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+//GenerateKeyPair generates a key pair for signing tokens with the given algorithm, returning the PEM
+//encoded private and public keys. RSA keys are generated as they always have been by the secrets package.
+func GenerateKeyPair(alg string) (string, string, error) {
+	var privateKey crypto.Signer
+	var err error
+
+	switch alg {
+	case RS256:
+		return secrets.GenerateKeyPair()
+	case ES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ES384:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case EdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", "", fmt.Errorf("Unsupported signing algorithm %s", alg)
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicKey, err := PublicKeyPEM(privateKey.Public())
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), publicKey, nil
+}
+
+//ParsePrivateKeyPEM reads a PKCS #1 RSA, SEC 1 EC or PKCS #8 private key
+func ParsePrivateKeyPEM(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, ErrKeyNotPEMEncoded
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return checkedPrivateKey(key)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	return checkedPrivateKey(signer)
+}
+
+func checkedPrivateKey(key crypto.Signer) (crypto.Signer, error) {
+	if _, err := MethodForKey(key.Public()); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+//ParsePublicKeyPEM reads a PKIX or PKCS #1 public key, or the public key of a certificate. The PEM block
+//type is not checked, as keys stored by earlier versions of roll are labelled RSA PUBLIC KEY whatever their
+//encoding.
+func ParsePublicKeyPEM(keyPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, ErrKeyNotPEMEncoded
+	}
+
+	var publicKey crypto.PublicKey
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		publicKey = key
+	} else if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		publicKey = cert.PublicKey
+	} else if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		publicKey = key
+	} else {
+		return nil, errors.New("Unable to parse public key")
+	}
+
+	if _, err := MethodForKey(publicKey); err != nil {
+		return nil, err
+	}
+
+	return publicKey, nil
+}
+
+//PublicKeyPEM PEM encodes a public key in PKIX form
+func PublicKeyPEM(publicKey crypto.PublicKey) (string, error) {
+	if _, err := MethodForKey(publicKey); err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+//MethodForKey returns the method tokens are signed with using the key pair the public key belongs to
+func MethodForKey(publicKey crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		}
+	case ed25519.PublicKey:
+		return SigningMethodEd25519, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+//CheckMethod checks a token is signed with a method that uses the key it is to be verified with, so a
+//token cannot choose how its signature is checked. RSA keys verify any of the RSA PKCS #1 v1.5 methods.
+func CheckMethod(method jwt.SigningMethod, publicKey crypto.PublicKey) error {
+	expected, err := MethodForKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := expected.(*jwt.SigningMethodRSA); ok {
+		if _, ok := method.(*jwt.SigningMethodRSA); ok {
+			return nil
+		}
+	}
+
+	if method.Alg() != expected.Alg() {
+		return errors.New("Unexpected signing method: " + method.Alg())
+	}
+
+	return nil
+}
+
+//VerificationKey parses the PEM encoded public key a token is to be verified with, checking the token is
+//signed with a method that uses the key. It is intended for use in a jwt.Keyfunc.
+func VerificationKey(token *jwt.Token, publicKeyPEM string) (crypto.PublicKey, error) {
+	publicKey, err := ParsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckMethod(token.Method, publicKey); err != nil {
+		return nil, err
+	}
+
+	return publicKey, nil
+}
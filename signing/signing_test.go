@@ -0,0 +1,152 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func signedTestToken(t *testing.T, privateKey string) string {
+	signingKey, err := ParsePrivateKeyPEM(privateKey)
+	assert.Nil(t, err)
+
+	method, err := MethodForKey(signingKey.Public())
+	assert.Nil(t, err)
+
+	token := jwt.New(method)
+	token.Claims["sub"] = "a-subject"
+	tokenString, err := token.SignedString(signingKey)
+	assert.Nil(t, err)
+	return tokenString
+}
+
+func TestSupportedAlg(t *testing.T) {
+	for _, alg := range Algs {
+		assert.True(t, SupportedAlg(alg))
+	}
+
+	assert.False(t, SupportedAlg("HS256"))
+	assert.False(t, SupportedAlg("ES512"))
+	assert.False(t, SupportedAlg(""))
+}
+
+func TestSignAndVerifyWithGeneratedKeys(t *testing.T) {
+	for _, alg := range Algs {
+		privateKey, publicKey, err := GenerateKeyPair(alg)
+		if !assert.Nil(t, err, alg) {
+			continue
+		}
+
+		tokenString := signedTestToken(t, privateKey)
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			return VerificationKey(token, publicKey)
+		})
+		if assert.Nil(t, err, alg) {
+			assert.Equal(t, alg, token.Header["alg"])
+			assert.Equal(t, "a-subject", token.Claims["sub"])
+		}
+	}
+}
+
+func TestGenerateKeyPairUnsupportedAlg(t *testing.T) {
+	_, _, err := GenerateKeyPair("HS256")
+	assert.NotNil(t, err)
+}
+
+func TestEdDSASignatureChecked(t *testing.T) {
+	privateKey, _, err := GenerateKeyPair(EdDSA)
+	assert.Nil(t, err)
+
+	_, otherPublicKey, err := GenerateKeyPair(EdDSA)
+	assert.Nil(t, err)
+
+	_, err = jwt.Parse(signedTestToken(t, privateKey), func(token *jwt.Token) (interface{}, error) {
+		return VerificationKey(token, otherPublicKey)
+	})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, ErrEdDSAVerification, err.(*jwt.ValidationError).Inner)
+	}
+}
+
+func TestTokenCannotChooseMethod(t *testing.T) {
+	rsaPrivateKey, rsaPublicKey, err := GenerateKeyPair(RS256)
+	assert.Nil(t, err)
+
+	_, ecPublicKey, err := GenerateKeyPair(ES256)
+	assert.Nil(t, err)
+
+	_, ec384PublicKey, err := GenerateKeyPair(ES384)
+	assert.Nil(t, err)
+
+	rsaPublic, err := ParsePublicKeyPEM(rsaPublicKey)
+	assert.Nil(t, err)
+
+	ecPublic, err := ParsePublicKeyPEM(ecPublicKey)
+	assert.Nil(t, err)
+
+	ec384Public, err := ParsePublicKeyPEM(ec384PublicKey)
+	assert.Nil(t, err)
+
+	assert.Nil(t, CheckMethod(jwt.SigningMethodRS256, rsaPublic))
+	assert.Nil(t, CheckMethod(jwt.SigningMethodRS512, rsaPublic))
+	assert.NotNil(t, CheckMethod(jwt.SigningMethodES256, rsaPublic))
+	assert.NotNil(t, CheckMethod(jwt.SigningMethodHS256, rsaPublic))
+	assert.Nil(t, CheckMethod(jwt.SigningMethodES256, ecPublic))
+	assert.NotNil(t, CheckMethod(jwt.SigningMethodES384, ecPublic))
+	assert.NotNil(t, CheckMethod(jwt.SigningMethodRS256, ecPublic))
+	assert.NotNil(t, CheckMethod(SigningMethodEd25519, ecPublic))
+	assert.Nil(t, CheckMethod(jwt.SigningMethodES384, ec384Public))
+
+	_, err = jwt.Parse(signedTestToken(t, rsaPrivateKey), func(token *jwt.Token) (interface{}, error) {
+		return VerificationKey(token, ecPublicKey)
+	})
+	assert.NotNil(t, err)
+}
+
+func TestUnsupportedCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	assert.Nil(t, err)
+
+	_, err = PublicKeyPEM(key.Public())
+	assert.Equal(t, ErrUnsupportedKey, err)
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	assert.Nil(t, err)
+
+	_, err = ParsePublicKeyPEM(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	assert.Equal(t, ErrUnsupportedKey, err)
+
+	der, err = x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	_, err = ParsePrivateKeyPEM(string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})))
+	assert.Equal(t, ErrUnsupportedKey, err)
+}
+
+func TestParseKeysNotPEM(t *testing.T) {
+	_, err := ParsePublicKeyPEM("not a key")
+	assert.Equal(t, ErrKeyNotPEMEncoded, err)
+
+	_, err = ParsePrivateKeyPEM("not a key")
+	assert.Equal(t, ErrKeyNotPEMEncoded, err)
+}
+
+func TestParseSEC1PrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	signingKey, err := ParsePrivateKeyPEM(string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})))
+	if assert.Nil(t, err) {
+		method, err := MethodForKey(signingKey.Public())
+		assert.Nil(t, err)
+		assert.Equal(t, ES256, method.Alg())
+	}
+}